@@ -6,6 +6,9 @@ type Attributes struct {
 	Style   *Style
 	Classes []string
 	Extra   map[string]any
+	// Title is a short description of the object, typically
+	// shown by viewers as a tooltip. May span multiple lines.
+	Title string
 }
 
 // EnsureStyle ensures that a.Style is not
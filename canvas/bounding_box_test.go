@@ -94,3 +94,25 @@ func TestAABBTransform(t *testing.T) {
 	checkVec(t, min, vec.Vec2{X: -5.0 / math.Sqrt2, Y: 0})
 	checkVec(t, max, vec.Vec2{X: 5.0 / math.Sqrt2, Y: 10.0 / math.Sqrt2})
 }
+
+func TestTextAABBBaseline(t *testing.T) {
+	text := NewText(vec.Vec2{X: 0, Y: 10}, "ab")
+	text.Size = 10
+
+	// The box is the same size, moved to match the baseline
+	tests := []struct {
+		baseline TextBaseline
+		top      float32
+	}{
+		{TextBaselineNone, 1.5},
+		{TextBaselineTop, 10},
+		{TextBaselineMiddle, 5},
+		{TextBaselineBottom, 0},
+	}
+	for _, test := range tests {
+		text.Baseline = test.baseline
+		min, max := text.GetAABB().Bounds()
+		checkVec(t, min, vec.Vec2{X: 0, Y: test.top})
+		checkVec(t, max, vec.Vec2{X: 13, Y: test.top + 10})
+	}
+}
@@ -7,6 +7,13 @@ type Canvas struct {
 	Element
 	Margin     vec.Vec2 // Specifies the margin around the image
 	Stylesheet Stylesheet
+	// Information about how the image was made, such as the program
+	// and its inputs. The SVG renderer writes each entry as a data
+	// attribute on the root element, so keys should be lower case
+	// letters, digits and '-'.
+	Metadata map[string]string
+	// Drawings defined once and drawn by [Use] objects, by id
+	Symbols map[string]*Symbol
 }
 
 // NewCanvas returns a new Canvas to draw to
@@ -73,6 +80,18 @@ type Renderer interface {
 	RenderText(*Text) error
 }
 
+// ImageRenderer is implemented by [Renderer]s that can draw [Image]s.
+// Renderers that don't implement it leave the images out.
+type ImageRenderer interface {
+	RenderImage(*Image) error
+}
+
+// UseRenderer is implemented by [Renderer]s that can draw [Use]s of
+// symbols. Renderers that don't implement it leave them out.
+type UseRenderer interface {
+	RenderUse(*Use) error
+}
+
 // Helper function for rendering children
 func RenderChildren(renderer Renderer, children []Object) error {
 	for _, obj := range children {
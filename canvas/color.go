@@ -1,6 +1,7 @@
 package canvas
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -142,10 +143,19 @@ func (e *ColorParseError) Unwrap() error {
 //
 // Currently only hex-strings starting with '#' are supported
 func ParseColor(s string) (Color, error) {
-	if s[0] == '#' {
-		return ParseHexColor(s)
-	} else if s[:4] == "hsl(" {
-		return ParseHSLColor(s)
+	// Avoid returning typed nil pointers as a non-nil Color
+	if strings.HasPrefix(s, "#") {
+		if c, err := ParseHexColor(s); err != nil {
+			return nil, err
+		} else {
+			return c, nil
+		}
+	} else if strings.HasPrefix(s, "hsl(") {
+		if c, err := ParseHSLColor(s); err != nil {
+			return nil, err
+		} else {
+			return c, nil
+		}
 	}
 
 	return nil, &ColorParseError{
@@ -173,9 +183,7 @@ func ParseHexColor(s string) (*RGBColor, error) {
 		return err
 	}
 
-	if s[0] == '#' {
-		s = s[1:]
-	}
+	s = strings.TrimPrefix(s, "#")
 
 	if len(s) != 6 {
 		return nil, makeError(fmt.Errorf("Invalid length: %d (expected 6)", len(s)))
@@ -187,15 +195,16 @@ func ParseHexColor(s string) (*RGBColor, error) {
 	greenPart = s[2:4]
 	bluePart = s[4:6]
 
-	red, err := strconv.ParseInt(redPart, 16, 16)
+	// ParseUint rejects signs, which ParseInt would accept
+	red, err := strconv.ParseUint(redPart, 16, 8)
 	if err != nil {
 		return nil, makeError(err)
 	}
-	green, err := strconv.ParseInt(greenPart, 16, 16)
+	green, err := strconv.ParseUint(greenPart, 16, 8)
 	if err != nil {
 		return nil, makeError(err)
 	}
-	blue, err := strconv.ParseInt(bluePart, 16, 16)
+	blue, err := strconv.ParseUint(bluePart, 16, 8)
 	if err != nil {
 		return nil, makeError(err)
 	}
@@ -360,7 +369,7 @@ func ParseHSLColor(str string) (*HSLColor, error) {
 		return err
 	}
 
-	if str[:4] == "hsl(" {
+	if strings.HasPrefix(str, "hsl(") && strings.HasSuffix(str, ")") {
 		str = str[4 : len(str)-1]
 	} else {
 		return nil, makeError(errors.New("Invalid HSL format"))
@@ -381,7 +390,7 @@ func ParseHSLColor(str string) (*HSLColor, error) {
 	}
 
 	parseMaybePC := func(s string) (float64, error) {
-		if s[len(s)-1] == '%' {
+		if strings.HasSuffix(s, "%") {
 			val, err := strconv.ParseFloat(s[:len(s)-1], 32)
 			if err != nil {
 				return 0, makeError(err)
@@ -574,6 +583,26 @@ func HeatColorScale() *ColorScale {
 	return scale
 }
 
+// DivergingColorScale returns a scale from blue at -1, through light
+// grey at 0, to red at 1, for values that change either way, such as
+// the change in a link's utilization
+func DivergingColorScale() *ColorScale {
+	colors := map[float32]Color{
+		-1.0: RGB(0.129, 0.400, 0.675),
+		0.0:  RGB(0.850, 0.850, 0.850),
+		1.0:  RGB(0.698, 0.094, 0.169),
+	}
+
+	return ColorScaleFromMap(colors)
+}
+
+// Clone returns a copy of the color scale
+func (s *ColorScale) Clone() *ColorScale {
+	clone := *s
+	clone.points = slices.Clone(s.points)
+	return &clone
+}
+
 func (s *ColorScale) AddColor(val float32, color Color) {
 	s.points = append(s.points, colorPoint{val: val, color: color})
 	s.sort()
@@ -637,6 +666,7 @@ func (s *ColorScale) sort() {
 }
 
 func (s *ColorScale) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
 	if string(data) == "null" {
 		return nil
 	}
@@ -669,7 +699,7 @@ func (s *ColorScale) UnmarshalJSON(data []byte) error {
 		return newPoints, nil
 	}
 
-	if data[0] == '[' {
+	if bytes.HasPrefix(data, []byte("[")) {
 		var array [][2]json.RawMessage
 		if err := json.Unmarshal(data, &array); err != nil {
 			return err
@@ -685,7 +715,7 @@ func (s *ColorScale) UnmarshalJSON(data []byte) error {
 		s.sort()
 
 		return nil
-	} else if data[0] == '{' {
+	} else if bytes.HasPrefix(data, []byte("{")) {
 		var object struct {
 			Space  ColorSpace           `json:"space"`
 			Colors [][2]json.RawMessage `json:"colors"`
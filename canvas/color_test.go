@@ -422,3 +422,39 @@ func ExampleHSLColor_Interpolate() {
 	// hsl(90, 90%, 50%)
 	// hsl(180, 100%, 50%)
 }
+
+func FuzzParseColor(f *testing.F) {
+	f.Add("#ff0000")
+	f.Add("00ff00")
+	f.Add("hsl(120, 50%, 50%)")
+	f.Add("hsl(")
+	f.Add("#")
+	f.Add("")
+
+	f.Fuzz(func(t *testing.T, s string) {
+		color, err := ParseColor(s)
+		if err == nil && color == nil {
+			t.Errorf("No color or error returned for %q", s)
+		}
+		if color != nil {
+			// Converting the color must not panic either
+			color.ToRGB().ToHex()
+		}
+	})
+}
+
+func FuzzColorScaleUnmarshal(f *testing.F) {
+	f.Add(`[[0, "#000000"], [100, "#ffffff"]]`)
+	f.Add(`{"space": "hsl", "colors": [[0, "hsl(0, 1, 0.5)"]]}`)
+	f.Add(`[[0]]`)
+	f.Add(`[[0, ""]]`)
+	f.Add(``)
+
+	f.Fuzz(func(t *testing.T, data string) {
+		scale := NewColorScale()
+		if err := scale.UnmarshalJSON([]byte(data)); err != nil {
+			return
+		}
+		scale.GetColor(50)
+	})
+}
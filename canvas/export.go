@@ -0,0 +1,119 @@
+package canvas
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Rasterizer writes a canvas as a PNG image
+type Rasterizer func(c *Canvas, w io.Writer) error
+
+// CommandRasterizer returns a [Rasterizer] that runs an external
+// program, such as rsvg-convert, to convert the canvas to PNG. The
+// canvas is written as SVG to a temporary file in dir, whose path is
+// added to the end of the arguments, so relative hrefs such as icons
+// are found from dir, as they would be from an SVG saved there. If
+// dir is empty, the working directory is used. The program writes
+// the PNG to its standard output.
+func CommandRasterizer(dir, name string, args ...string) Rasterizer {
+	if dir == "" {
+		dir = "."
+	}
+	return func(c *Canvas, w io.Writer) error {
+		f, err := os.CreateTemp(dir, ".raumata-*.svg")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(f.Name())
+		if err := c.Render(NewSVGRenderer(f)); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+
+		cmd := exec.Command(name, append(slices.Clone(args), f.Name())...)
+		cmd.Stdout = w
+		stderr := &bytes.Buffer{}
+		cmd.Stderr = stderr
+		if err := cmd.Run(); err != nil {
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				return fmt.Errorf("Error running %s: %w: %s", name, err, msg)
+			}
+			return fmt.Errorf("Error running %s: %w", name, err)
+		}
+		return nil
+	}
+}
+
+// PNGPath returns the path of the PNG written alongside the SVG at
+// path, which has the same base name, e.g. "map.png" for "map.svg"
+func PNGPath(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".png"
+}
+
+// Exporter writes canvases to files as SVG, along with a PNG of the
+// same canvas for viewers that can't display SVG, such as chat
+// integrations and wikis
+type Exporter struct {
+	// Makes the renderer for the SVG, e.g. to set its indent. If nil,
+	// [NewSVGRenderer] is used.
+	NewSVGRenderer func(w io.Writer) *SVGRenderer
+	// Writes the PNG. If nil, only the SVG is written.
+	RasterizePNG Rasterizer
+}
+
+// Export writes the canvas to path as SVG and, if RasterizePNG is
+// set, to [PNGPath] as PNG
+func (e *Exporter) Export(c *Canvas, path string) error {
+	if err := e.WriteSVG(c, path); err != nil {
+		return err
+	}
+	if e.RasterizePNG == nil {
+		return nil
+	}
+	return e.WritePNG(c, PNGPath(path))
+}
+
+// WriteSVG writes the canvas to path as SVG
+func (e *Exporter) WriteSVG(c *Canvas, path string) error {
+	newRenderer := e.NewSVGRenderer
+	if newRenderer == nil {
+		newRenderer = NewSVGRenderer
+	}
+	return writeFile(path, func(w io.Writer) error {
+		return c.Render(newRenderer(w))
+	})
+}
+
+// WritePNG writes the canvas to path as PNG with RasterizePNG
+func (e *Exporter) WritePNG(c *Canvas, path string) error {
+	if e.RasterizePNG == nil {
+		return fmt.Errorf("No rasterizer to write %s with", path)
+	}
+	return writeFile(path, func(w io.Writer) error {
+		return e.RasterizePNG(c, w)
+	})
+}
+
+// Writes the file at path with write, removing it if write fails, so
+// a broken image isn't left behind
+func writeFile(path string, write func(w io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,109 @@
+package canvas_test
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/REANNZ/raumata/canvas"
+	"github.com/REANNZ/raumata/vec"
+)
+
+func TestPNGPath(t *testing.T) {
+	paths := map[string]string{
+		"map.svg":          "map.png",
+		"out/map.core.svg": "out/map.core.png",
+		"map":              "map.png",
+	}
+	for path, expected := range paths {
+		if png := PNGPath(path); png != expected {
+			t.Errorf("Expected %s for %s, got %s", expected, path, png)
+		}
+	}
+}
+
+func TestExporter(t *testing.T) {
+	c := NewCanvas()
+	c.AppendChild(NewCircle(vec.Vec2{X: 5, Y: 5}, 5))
+
+	dir := t.TempDir()
+	rasterized := 0
+	exporter := &Exporter{
+		RasterizePNG: func(rc *Canvas, w io.Writer) error {
+			if rc != c {
+				t.Errorf("Expected the PNG to be made from the exported canvas")
+			}
+			rasterized++
+			_, err := io.WriteString(w, "png")
+			return err
+		},
+	}
+
+	if err := exporter.Export(c, filepath.Join(dir, "map.svg")); err != nil {
+		t.Fatalf("Error exporting canvas: %s", err)
+	}
+	svg, err := os.ReadFile(filepath.Join(dir, "map.svg"))
+	if err != nil || !strings.Contains(string(svg), "<circle") {
+		t.Errorf("Expected the SVG to be written, got %q, %v", svg, err)
+	}
+	png, err := os.ReadFile(filepath.Join(dir, "map.png"))
+	if err != nil || string(png) != "png" || rasterized != 1 {
+		t.Errorf("Expected the PNG to be written once, got %q, %v", png, err)
+	}
+
+	// A failed PNG isn't left behind
+	exporter.RasterizePNG = func(c *Canvas, w io.Writer) error {
+		io.WriteString(w, "partial")
+		return errors.New("failed")
+	}
+	if err := exporter.Export(c, filepath.Join(dir, "broken.svg")); err == nil {
+		t.Errorf("Expected the rasterizer's error")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "broken.png")); !os.IsNotExist(err) {
+		t.Errorf("Expected the broken PNG to be removed, got %v", err)
+	}
+
+	// Without a rasterizer only the SVG is written
+	exporter.RasterizePNG = nil
+	if err := exporter.Export(c, filepath.Join(dir, "svg-only.svg")); err != nil {
+		t.Fatalf("Error exporting canvas: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "svg-only.png")); !os.IsNotExist(err) {
+		t.Errorf("Expected no PNG without a rasterizer, got %v", err)
+	}
+}
+
+func TestCommandRasterizer(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("No shell to run the command with")
+	}
+
+	c := NewCanvas()
+	c.AppendChild(NewCircle(vec.Vec2{X: 5, Y: 5}, 5))
+
+	// The command is given the SVG, which is echoed back here, in a
+	// file in the directory the hrefs are relative to
+	dir := t.TempDir()
+	out := &strings.Builder{}
+	if err := CommandRasterizer(dir, "sh", "-c", `cat "$0"; dirname "$0"`)(c, out); err != nil {
+		t.Fatalf("Error running the rasterizer: %s", err)
+	}
+	if !strings.Contains(out.String(), "<circle") {
+		t.Errorf("Expected the command to be given the SVG, got %q", out.String())
+	}
+	if !strings.HasSuffix(out.String(), dir+"\n") {
+		t.Errorf("Expected the SVG to be in %s, got %q", dir, out.String())
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Expected the SVG to be removed, got %v", entries)
+	}
+
+	err := CommandRasterizer(dir, "sh", "-c", "echo bad input >&2; exit 1")(c, io.Discard)
+	if err == nil || !strings.Contains(err.Error(), "bad input") {
+		t.Errorf("Expected the command's error message, got %v", err)
+	}
+}
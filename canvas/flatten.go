@@ -0,0 +1,405 @@
+package canvas
+
+import (
+	"math"
+
+	"github.com/REANNZ/raumata/internal/f32"
+	"github.com/REANNZ/raumata/vec"
+)
+
+// The type of a [DrawOp]
+type DrawOpType int
+
+const (
+	// Fill and/or stroke the contours of the op
+	DrawOpShape DrawOpType = iota
+	// Draw the text of the op
+	DrawOpText
+)
+
+// A Contour is a sequence of connected points, part of the outline
+// of a shape
+type Contour struct {
+	Points []vec.Vec2
+	Closed bool
+}
+
+// DrawOp is a single primitive drawing operation in a flattened
+// display list, see [Canvas.Flatten].
+//
+// All positions are in world coordinates, and Style is the final
+// resolved style of the object, including inherited values.
+type DrawOp struct {
+	Type DrawOpType
+	// The outline of a shape, arcs, curves, ellipses and rounded
+	// corners are approximated with straight line segments
+	Contours []Contour
+
+	// The text to draw, with its position, font size, alignment and
+	// shaping
+	Text     string
+	Pos      vec.Vec2
+	Size     float32
+	Anchor   TextAnchor
+	Baseline TextBaseline
+	Shaping  TextShaping
+
+	Style Style
+	// The combined transform of all the object's ancestors. The
+	// geometry has already been transformed, but backends may
+	// use it for things like rotating text.
+	Transform *vec.Transform
+
+	// Attributes copied from the original object
+	Id      string
+	Classes []string
+	Title   string
+}
+
+// Flatten resolves styles and transforms for every object on the
+// canvas, returning a flat list of primitive drawing operations in
+// the order they should be drawn.
+//
+// Opacity is multiplied down the tree onto each op, which matches
+// the rendered result except where ops within a group overlap.
+// Stroke widths and font sizes are scaled by the transforms, non-
+// uniform scales use the average.
+func (c *Canvas) Flatten() []DrawOp {
+	if c == nil {
+		return nil
+	}
+
+	f := &flattener{
+		stylesheet: &c.Stylesheet,
+		symbols:    c.Symbols,
+	}
+
+	style, opacity := f.resolveStyle(&c.Attributes, NewStyle(), 1)
+	f.flattenChildren(c.Children, vec.NewIdentityTransform(), style, opacity)
+
+	return f.ops
+}
+
+type flattener struct {
+	stylesheet *Stylesheet
+	symbols    map[string]*Symbol
+	ops        []DrawOp
+}
+
+// Returns the style of an object with the given attributes, and the
+// opacity of it combined with its ancestors
+func (f *flattener) resolveStyle(attrs *Attributes, inherited *Style, opacity float32) (*Style, float32) {
+	style := NewStyle()
+	style.Merge(attrs.Style)
+	style.Merge(f.stylesheet.GetStyle(attrs.Classes))
+
+	if style.Opacity.Valid {
+		opacity *= style.Opacity.Value
+	}
+	style.Opacity.Valid = false
+
+	style.Merge(inherited)
+
+	return style, opacity
+}
+
+func (f *flattener) flattenChildren(children []Object, transform *vec.Transform, inherited *Style, opacity float32) {
+	for _, obj := range children {
+		if obj == nil {
+			continue
+		}
+		f.flattenObject(obj, transform, inherited, opacity)
+	}
+}
+
+func (f *flattener) flattenObject(obj Object, transform *vec.Transform, inherited *Style, opacity float32) {
+	attrs := obj.GetAttributes()
+	style, opacity := f.resolveStyle(attrs, inherited, opacity)
+	if style.Display == DisplayNone {
+		return
+	}
+	// Hidden objects aren't drawn, but their children might be
+	visible := style.Visibility != VisibilityHidden
+
+	var contours []Contour
+	var children []Object
+
+	switch o := obj.(type) {
+	case *Group:
+		if o.Transform != nil {
+			transform = o.Transform.Combine(transform)
+		}
+		f.flattenChildren(o.Children, transform, style, opacity)
+		return
+	case *Canvas:
+		f.flattenChildren(o.Children, transform, style, opacity)
+		return
+	case *Use:
+		symbol := f.symbols[o.Symbol]
+		if symbol == nil {
+			return
+		}
+		if t := o.symbolTransform(symbol); t != nil {
+			f.flattenChildren(symbol.Children, t.Combine(transform), style, opacity)
+		}
+		return
+	case *Text:
+		op := f.newOp(DrawOpText, attrs, style, opacity, transform)
+		op.Text = o.Text
+		op.Pos = transform.Apply(o.Pos)
+		op.Size = o.Size * transformScale(transform)
+		op.Anchor = o.Anchor
+		op.Baseline = o.Baseline
+		op.Shaping = o.Shaping
+		if visible {
+			f.ops = append(f.ops, op)
+		}
+		return
+	case *Rect:
+		contours = []Contour{rectContour(o)}
+		children = o.Children
+	case *Ellipse:
+		contours = []Contour{ellipseContour(o.Center, o.Rx, o.Ry)}
+		children = o.Children
+	case *Line:
+		contours = []Contour{{Points: []vec.Vec2{o.Start, o.End}}}
+		children = o.Children
+	case *Polygon:
+		points := make([]vec.Vec2, len(o.Points))
+		copy(points, o.Points)
+		contours = []Contour{{Points: points, Closed: true}}
+		children = o.Children
+	case *Path:
+		contours = pathContours(o)
+		children = o.Children
+	default:
+		// Unknown objects can't be flattened, skip them
+		return
+	}
+
+	for i := range contours {
+		for j, p := range contours[i].Points {
+			contours[i].Points[j] = transform.Apply(p)
+		}
+	}
+
+	if visible {
+		op := f.newOp(DrawOpShape, attrs, style, opacity, transform)
+		op.Contours = contours
+		f.ops = append(f.ops, op)
+	}
+
+	f.flattenChildren(children, transform, style, opacity)
+}
+
+func (f *flattener) newOp(ty DrawOpType, attrs *Attributes, style *Style, opacity float32, transform *vec.Transform) DrawOp {
+	op := DrawOp{
+		Type:      ty,
+		Style:     *style,
+		Transform: transform,
+		Id:        attrs.Id,
+		Classes:   attrs.Classes,
+		Title:     attrs.Title,
+	}
+
+	op.Style.Opacity.Value = opacity
+	op.Style.Opacity.Valid = true
+	if op.Style.StrokeWidth.Valid {
+		op.Style.StrokeWidth.Value *= transformScale(transform)
+	}
+
+	return op
+}
+
+// Returns the average amount the transform scales lengths by
+func transformScale(t *vec.Transform) float32 {
+	return f32.Sqrt(f32.Abs(t.A*t.D - t.B*t.C))
+}
+
+// Number of line segments used to approximate a full circle
+const circleSegments = 32
+
+func ellipseContour(center vec.Vec2, rx, ry float32) Contour {
+	points := make([]vec.Vec2, circleSegments)
+	for i := range points {
+		angle := 2 * math.Pi * float32(i) / circleSegments
+		points[i] = vec.Vec2{
+			X: center.X + rx*f32.Cos(angle),
+			Y: center.Y + ry*f32.Sin(angle),
+		}
+	}
+	return Contour{Points: points, Closed: true}
+}
+
+func rectContour(r *Rect) Contour {
+	min := r.Pos
+	max := r.Pos.Add(vec.Vec2{X: r.Width, Y: r.Height})
+
+	// As with SVG, a missing radius uses the other one and the
+	// radius is limited to half the size of the rectangle
+	rx, ry := r.Rx, r.Ry
+	if rx <= 0 {
+		rx = ry
+	}
+	if ry <= 0 {
+		ry = rx
+	}
+	rx = f32.Min(rx, f32.Abs(r.Width)/2)
+	ry = f32.Min(ry, f32.Abs(r.Height)/2)
+
+	if rx <= 0 || ry <= 0 {
+		return Contour{
+			Points: []vec.Vec2{
+				min,
+				{X: max.X, Y: min.Y},
+				max,
+				{X: min.X, Y: max.Y},
+			},
+			Closed: true,
+		}
+	}
+
+	// Trace a quarter ellipse at each corner, clockwise from the
+	// top-right
+	corners := []vec.Vec2{
+		{X: max.X - rx, Y: min.Y + ry},
+		{X: max.X - rx, Y: max.Y - ry},
+		{X: min.X + rx, Y: max.Y - ry},
+		{X: min.X + rx, Y: min.Y + ry},
+	}
+
+	quarter := circleSegments / 4
+	points := make([]vec.Vec2, 0, (quarter+1)*4)
+	for i, c := range corners {
+		for j := 0; j <= quarter; j++ {
+			angle := (float32(i-1) + float32(j)/float32(quarter)) * math.Pi / 2
+			points = append(points, vec.Vec2{
+				X: c.X + rx*f32.Cos(angle),
+				Y: c.Y + ry*f32.Sin(angle),
+			})
+		}
+	}
+
+	return Contour{Points: points, Closed: true}
+}
+
+// Converts the commands of a path into contours, starting a new
+// contour at each MoveTo
+func pathContours(p *Path) []Contour {
+	contours := []Contour{}
+	current := Contour{}
+
+	// Contours need at least two points to draw anything
+	finish := func() {
+		if len(current.Points) > 1 {
+			contours = append(contours, current)
+		}
+		current = Contour{}
+	}
+
+	for _, cmd := range p.Data {
+		switch cmd.Type {
+		case CommandClosePath:
+			current.Closed = true
+			start := vec.Vec2{}
+			if len(current.Points) > 0 {
+				start = current.Points[0]
+			}
+			finish()
+			// Drawing continues from the start of the closed contour
+			current.Points = []vec.Vec2{start}
+		case CommandMoveTo:
+			finish()
+			current.Points = append(current.Points, cmd.Pos)
+		case CommandLineTo:
+			current.Points = append(current.Points, cmd.Pos)
+		case CommandArcTo:
+			start := vec.Vec2{X: cmd.Args[0], Y: cmd.Args[1]}
+			end := vec.Vec2{X: cmd.Args[2], Y: cmd.Args[3]}
+			if len(current.Points) == 0 {
+				current.Points = append(current.Points, start)
+			}
+			current.Points = append(current.Points,
+				arcPoints(start, end, cmd.Args[4], cmd.Args[5] != 0)...)
+		case CommandCubicTo:
+			start := vec.Vec2{}
+			if len(current.Points) > 0 {
+				start = current.Points[len(current.Points)-1]
+			} else {
+				current.Points = append(current.Points, start)
+			}
+			c1 := vec.Vec2{X: cmd.Args[0], Y: cmd.Args[1]}
+			c2 := vec.Vec2{X: cmd.Args[2], Y: cmd.Args[3]}
+			current.Points = append(current.Points, cubicPoints(start, c1, c2, cmd.Pos)...)
+		}
+	}
+
+	finish()
+
+	return contours
+}
+
+// Approximates the smaller circular arc from start to end with
+// line segments, returning the points after start. If clockwise
+// is set, the arc is drawn clockwise on screen (with y pointing down).
+func arcPoints(start, end vec.Vec2, radius float32, clockwise bool) []vec.Vec2 {
+	chord := end.Sub(start)
+	dist := chord.Length()
+	if dist < 1e-8 {
+		return nil
+	}
+
+	// Radiuses too small to reach are scaled up, as in SVG
+	radius = f32.Max(radius, dist/2)
+
+	mid := start.Add(chord.Div(2))
+	offset := f32.Sqrt(f32.Max(radius*radius-dist*dist/4, 0))
+	normal := vec.Vec2{X: -chord.Y, Y: chord.X}.Div(dist)
+	if !clockwise {
+		normal = normal.Neg()
+	}
+	center := mid.Add(normal.Mul(offset))
+
+	startAngle := f32.Atan2(start.Y-center.Y, start.X-center.X)
+	endAngle := f32.Atan2(end.Y-center.Y, end.X-center.X)
+	sweep := endAngle - startAngle
+	if clockwise && sweep < 0 {
+		sweep += 2 * math.Pi
+	} else if !clockwise && sweep > 0 {
+		sweep -= 2 * math.Pi
+	}
+
+	segments := int(f32.Ceil(f32.Abs(sweep) / (2 * math.Pi) * circleSegments))
+	segments = max(segments, 1)
+
+	points := make([]vec.Vec2, 0, segments)
+	for i := 1; i < segments; i++ {
+		angle := startAngle + sweep*float32(i)/float32(segments)
+		points = append(points, vec.Vec2{
+			X: center.X + radius*f32.Cos(angle),
+			Y: center.Y + radius*f32.Sin(angle),
+		})
+	}
+
+	return append(points, end)
+}
+
+// Number of line segments used to approximate a cubic curve
+const cubicSegments = 16
+
+// Approximates the cubic Bézier curve with line segments, returning
+// the points after start
+func cubicPoints(start, c1, c2, end vec.Vec2) []vec.Vec2 {
+	points := make([]vec.Vec2, 0, cubicSegments)
+	for i := 1; i < cubicSegments; i++ {
+		t := float32(i) / cubicSegments
+		u := 1 - t
+		p := start.Mul(u * u * u).
+			Add(c1.Mul(3 * u * u * t)).
+			Add(c2.Mul(3 * u * t * t)).
+			Add(end.Mul(t * t * t))
+		points = append(points, p)
+	}
+
+	return append(points, end)
+}
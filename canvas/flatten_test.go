@@ -0,0 +1,185 @@
+package canvas_test
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/REANNZ/raumata/canvas"
+	"github.com/REANNZ/raumata/option"
+	"github.com/REANNZ/raumata/vec"
+)
+
+func TestFlatten(t *testing.T) {
+	c := NewCanvas()
+	c.Stylesheet.AddRule(Selector{"thick"}, &Style{
+		StrokeWidth: option.Float32{Value: 2, Valid: true},
+	})
+
+	group := NewGroup()
+	group.Transform = vec.NewScale(vec.Vec2{X: 2, Y: 2}).
+		Combine(vec.NewTranslate(vec.Vec2{X: 10, Y: 0}))
+	group.Attributes.Style = &Style{
+		Opacity:     option.Float32{Value: 0.5, Valid: true},
+		StrokeColor: NewStyleColor(RGB(1, 0, 0)),
+	}
+
+	line := NewLine(vec.Vec2{X: 0, Y: 0}, vec.Vec2{X: 1, Y: 1})
+	line.Attributes.AddClass("thick")
+	line.Attributes.Style = &Style{Opacity: option.Float32{Value: 0.5, Valid: true}}
+	group.AppendChild(line)
+
+	text := NewText(vec.Vec2{X: 1, Y: 0}, "hello")
+	group.AppendChild(text)
+
+	c.AppendChild(group)
+
+	ops := c.Flatten()
+	if len(ops) != 2 {
+		t.Fatalf("Expected 2 ops, got %d", len(ops))
+	}
+
+	lineOp := ops[0]
+	if lineOp.Type != DrawOpShape || len(lineOp.Contours) != 1 {
+		t.Fatalf("Expected a single contour shape, got %+v", lineOp)
+	}
+	points := lineOp.Contours[0].Points
+	if points[0] != (vec.Vec2{X: 10, Y: 0}) || points[1] != (vec.Vec2{X: 12, Y: 2}) {
+		t.Errorf("Line not transformed to world coordinates: %v", points)
+	}
+	if lineOp.Style.Opacity.Value != 0.25 {
+		t.Errorf("Expected opacity 0.25, got %v", lineOp.Style.Opacity.Value)
+	}
+	if lineOp.Style.StrokeWidth.Value != 4 {
+		t.Errorf("Expected scaled stroke width 4, got %v", lineOp.Style.StrokeWidth.Value)
+	}
+	if !ColorEqual(lineOp.Style.StrokeColor.Color(), RGB(1, 0, 0)) {
+		t.Errorf("Stroke color not inherited from group")
+	}
+
+	textOp := ops[1]
+	if textOp.Type != DrawOpText || textOp.Text != "hello" {
+		t.Fatalf("Expected a text op, got %+v", textOp)
+	}
+	if textOp.Pos != (vec.Vec2{X: 12, Y: 0}) || textOp.Size != 20 {
+		t.Errorf("Text not transformed: pos %v, size %v", textOp.Pos, textOp.Size)
+	}
+}
+
+func TestFlattenHidden(t *testing.T) {
+	c := NewCanvas()
+
+	hidden := NewGroup()
+	hidden.Attributes.Style = &Style{Display: DisplayNone}
+	hidden.AppendChild(NewLine(vec.Vec2{X: 0, Y: 0}, vec.Vec2{X: 1, Y: 1}))
+	c.AppendChild(hidden)
+
+	invisible := NewGroup()
+	invisible.Attributes.Style = &Style{Visibility: VisibilityHidden}
+	invisible.AppendChild(NewLine(vec.Vec2{X: 0, Y: 0}, vec.Vec2{X: 2, Y: 2}))
+	shown := NewText(vec.Vec2{X: 1, Y: 0}, "shown")
+	shown.Attributes.Style = &Style{Visibility: VisibilityVisible}
+	invisible.AppendChild(shown)
+	c.AppendChild(invisible)
+
+	ops := c.Flatten()
+	if len(ops) != 1 {
+		t.Fatalf("Expected 1 op, got %d", len(ops))
+	}
+	if ops[0].Type != DrawOpText || ops[0].Text != "shown" {
+		t.Errorf("Expected the visible text op, got %+v", ops[0])
+	}
+
+	out := &strings.Builder{}
+	r := NewSVGRenderer(out)
+	r.IncludeHeader = false
+	if err := c.Render(r); err != nil {
+		t.Fatalf("Error rendering canvas: %s", err)
+	}
+	svg := out.String()
+	if !strings.Contains(svg, `display="none"`) || !strings.Contains(svg, `visibility="hidden"`) {
+		t.Errorf("Expected hidden objects to stay in the document:\n%s", svg)
+	}
+}
+
+func TestFlattenPathArc(t *testing.T) {
+	c := NewCanvas()
+
+	path := NewPath()
+	path.MoveTo(vec.Vec2{X: 0, Y: 0})
+	path.Arc(vec.Vec2{X: 0, Y: 0}, vec.Vec2{X: 2, Y: 0}, 1)
+	path.ClosePath()
+	c.AppendChild(path)
+
+	ops := c.Flatten()
+	if len(ops) != 1 || len(ops[0].Contours) != 1 {
+		t.Fatalf("Expected a single contour, got %+v", ops)
+	}
+
+	contour := ops[0].Contours[0]
+	if !contour.Closed {
+		t.Errorf("Expected the contour to be closed")
+	}
+
+	// A clockwise half circle from (0,0) to (2,0) passes over the top
+	last := contour.Points[len(contour.Points)-1]
+	if !last.ApproxEq(vec.Vec2{X: 2, Y: 0}, 1e-5) {
+		t.Errorf("Arc doesn't end at (2, 0): %v", last)
+	}
+	for _, p := range contour.Points {
+		if p.Y > 1e-5 {
+			t.Errorf("Arc point below the chord: %v", p)
+		}
+	}
+}
+
+func TestFlattenPathCubic(t *testing.T) {
+	c := NewCanvas()
+
+	path := NewPath()
+	path.MoveTo(vec.Vec2{X: 0, Y: 0})
+	path.CubicTo(vec.Vec2{X: 0, Y: -3}, vec.Vec2{X: 3, Y: -3}, vec.Vec2{X: 3, Y: 0})
+	c.AppendChild(path)
+
+	ops := c.Flatten()
+	if len(ops) != 1 || len(ops[0].Contours) != 1 {
+		t.Fatalf("Expected a single contour, got %+v", ops)
+	}
+
+	points := ops[0].Contours[0].Points
+	if last := points[len(points)-1]; last != (vec.Vec2{X: 3, Y: 0}) {
+		t.Errorf("Curve doesn't end at (3, 0): %v", last)
+	}
+
+	// The curve bulges upwards to 3/4 of the control point height
+	minY := float32(0)
+	for _, p := range points {
+		minY = min(minY, p.Y)
+	}
+	if minY > -2.2 || minY < -2.3 {
+		t.Errorf("Expected the top of the curve at -2.25, got %v", minY)
+	}
+
+	bbox := path.GetAABB()
+	if min, max := bbox.Bounds(); min != (vec.Vec2{X: 0, Y: -3}) || max != (vec.Vec2{X: 3, Y: 0}) {
+		t.Errorf("Expected the bounding box to include the control points, got %v %v", min, max)
+	}
+}
+
+func TestFlattenUse(t *testing.T) {
+	c := NewCanvas()
+	symbol := NewSymbol()
+	symbol.AppendChild(NewLine(vec.Vec2{X: 0, Y: 0}, vec.Vec2{X: 2, Y: 1}))
+	c.AddSymbol("line", symbol)
+	// The symbol is scaled to fit the width, and centered vertically
+	c.AppendChild(NewUse("line", vec.Vec2{X: 10, Y: 10}, 4, 4))
+	c.AppendChild(NewUse("missing", vec.Vec2{}, 4, 4))
+
+	ops := c.Flatten()
+	if len(ops) != 1 {
+		t.Fatalf("Expected 1 op, got %d", len(ops))
+	}
+	points := ops[0].Contours[0].Points
+	if points[0] != (vec.Vec2{X: 10, Y: 11}) || points[1] != (vec.Vec2{X: 14, Y: 13}) {
+		t.Errorf("Symbol not placed in the use's rectangle: %v", points)
+	}
+}
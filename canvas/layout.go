@@ -0,0 +1,176 @@
+package canvas
+
+import (
+	"github.com/REANNZ/raumata/internal/f32"
+	"github.com/REANNZ/raumata/vec"
+)
+
+// A region of a [Layout] that objects can be assigned to
+type LayoutRegion int
+
+const (
+	// A bar across the top of the layout
+	LayoutTop LayoutRegion = iota
+	// A bar across the bottom of the layout
+	LayoutBottom
+	// A panel down the left side of the layout
+	LayoutLeft
+	// A panel down the right side of the layout
+	LayoutRight
+)
+
+// Layout arranges objects such as titles, legends and timestamps
+// around a main content object (typically the map).
+//
+// Objects in the top and bottom bars are stacked vertically and
+// centered horizontally. Objects in the left and right panels are
+// stacked vertically and aligned to the outside edge.
+//
+// If Width and Height are set, the content is scaled to fit the
+// area left over after placing the regions, otherwise the layout
+// grows to fit around the content.
+type Layout struct {
+	Spacing float32 // Space between objects, and between regions and the content
+	Width   float32 // The total width of the layout, <= 0 means automatic
+	Height  float32 // The total height of the layout, <= 0 means automatic
+	regions [4][]Object
+}
+
+func NewLayout() *Layout {
+	return &Layout{
+		Spacing: 10,
+	}
+}
+
+// Add appends obj to the given region. Objects are placed in
+// the order they are added, starting from the top.
+func (l *Layout) Add(region LayoutRegion, obj Object) {
+	if obj == nil || region < LayoutTop || region > LayoutRight {
+		return
+	}
+	l.regions[region] = append(l.regions[region], obj)
+}
+
+// Arrange positions the region objects and the content, returning
+// a group containing all of them. The top-left corner of the layout
+// is at the origin.
+func (l *Layout) Arrange(content Object) *Group {
+	group := NewGroup()
+
+	// Get the size of each region, all regions stack their
+	// objects vertically
+	var sizes [4]vec.Vec2
+	for i, objs := range l.regions {
+		for _, obj := range objs {
+			aabb := obj.GetAABB()
+			if aabb == nil {
+				continue
+			}
+			size := aabb.Size()
+			if sizes[i].Y > 0 {
+				sizes[i].Y += l.Spacing
+			}
+			sizes[i].Y += size.Y
+			sizes[i].X = f32.Max(sizes[i].X, size.X)
+		}
+	}
+
+	// Gaps between each region and the content, only applied
+	// when the region isn't empty
+	gap := func(region LayoutRegion) float32 {
+		if sizes[region].X > 0 || sizes[region].Y > 0 {
+			return l.Spacing
+		}
+		return 0
+	}
+
+	topH := sizes[LayoutTop].Y + gap(LayoutTop)
+	bottomH := sizes[LayoutBottom].Y + gap(LayoutBottom)
+	leftW := sizes[LayoutLeft].X + gap(LayoutLeft)
+	rightW := sizes[LayoutRight].X + gap(LayoutRight)
+
+	var contentMin, contentSize vec.Vec2
+	var contentAABB *AABB
+	if content != nil {
+		contentAABB = content.GetAABB()
+	}
+	if contentAABB != nil {
+		contentMin, _ = contentAABB.Bounds()
+		contentSize = contentAABB.Size()
+	}
+
+	var width, height, scale float32
+	if l.Width > 0 && l.Height > 0 {
+		width = l.Width
+		height = l.Height
+
+		availW := width - leftW - rightW
+		availH := height - topH - bottomH
+		scale = 1
+		if contentSize.X > 0 && contentSize.Y > 0 && availW > 0 && availH > 0 {
+			scale = f32.Min(availW/contentSize.X, availH/contentSize.Y)
+		}
+	} else {
+		scale = 1
+		width = leftW + contentSize.X + rightW
+		width = f32.Max(width, sizes[LayoutTop].X, sizes[LayoutBottom].X)
+		middleH := f32.Max(contentSize.Y, sizes[LayoutLeft].Y, sizes[LayoutRight].Y)
+		height = topH + middleH + bottomH
+	}
+
+	// Place the content in the center of the remaining area
+	if contentAABB != nil {
+		areaMin := vec.Vec2{X: leftW, Y: topH}
+		areaSize := vec.Vec2{
+			X: width - leftW - rightW,
+			Y: height - topH - bottomH,
+		}
+		scaledSize := contentSize.Mul(scale)
+		offset := areaMin.Add(areaSize.Sub(scaledSize).Div(2))
+
+		transform := vec.NewTranslate(contentMin.Neg()).
+			Combine(vec.NewScale(vec.Vec2{X: scale, Y: scale})).
+			Combine(vec.NewTranslate(offset))
+
+		contentGroup := NewGroup()
+		contentGroup.Transform = transform
+		contentGroup.AppendChild(content)
+		group.AppendChild(contentGroup)
+	}
+
+	// Place the region objects, each one is offset from
+	// the pos by its own alignment within the region
+	placeRegion := func(region LayoutRegion, pos vec.Vec2, align float32) {
+		y := pos.Y
+		for _, obj := range l.regions[region] {
+			aabb := obj.GetAABB()
+			if aabb == nil {
+				continue
+			}
+			objMin, _ := aabb.Bounds()
+			size := aabb.Size()
+
+			target := vec.Vec2{
+				X: pos.X + (sizes[region].X-size.X)*align,
+				Y: y,
+			}
+			if region == LayoutTop || region == LayoutBottom {
+				target.X = (width - size.X) * align
+			}
+
+			objGroup := NewGroup()
+			objGroup.Transform = vec.NewTranslate(target.Sub(objMin))
+			objGroup.AppendChild(obj)
+			group.AppendChild(objGroup)
+
+			y += size.Y + l.Spacing
+		}
+	}
+
+	placeRegion(LayoutTop, vec.Vec2{}, 0.5)
+	placeRegion(LayoutBottom, vec.Vec2{Y: height - sizes[LayoutBottom].Y}, 0.5)
+	placeRegion(LayoutLeft, vec.Vec2{Y: topH}, 0)
+	placeRegion(LayoutRight, vec.Vec2{X: width - sizes[LayoutRight].X, Y: topH}, 1)
+
+	return group
+}
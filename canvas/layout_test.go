@@ -0,0 +1,54 @@
+package canvas_test
+
+import (
+	"testing"
+
+	. "github.com/REANNZ/raumata/canvas"
+	"github.com/REANNZ/raumata/vec"
+)
+
+func TestLayoutAutoSize(t *testing.T) {
+	content := NewRect(vec.Vec2{X: 50, Y: 50}, 100, 100)
+	title := NewRect(vec.Vec2{}, 40, 10)
+	legend := NewRect(vec.Vec2{}, 20, 60)
+
+	layout := NewLayout()
+	layout.Spacing = 5
+	layout.Add(LayoutTop, title)
+	layout.Add(LayoutRight, legend)
+
+	g := layout.Arrange(content)
+
+	min, max := g.GetAABB().Bounds()
+	checkVec(t, min, vec.Vec2{X: 0, Y: 0})
+	checkVec(t, max, vec.Vec2{X: 125, Y: 115})
+
+	// Content is below the title and left of the legend
+	contentAABB := g.Children[0].GetAABB().Transform(g.Children[0].(*Group).Transform)
+	min, max = contentAABB.Bounds()
+	checkVec(t, min, vec.Vec2{X: 0, Y: 15})
+	checkVec(t, max, vec.Vec2{X: 100, Y: 115})
+}
+
+func TestLayoutFixedSize(t *testing.T) {
+	content := NewRect(vec.Vec2{}, 100, 50)
+	footer := NewRect(vec.Vec2{}, 10, 10)
+
+	layout := NewLayout()
+	layout.Spacing = 0
+	layout.Width = 200
+	layout.Height = 110
+	layout.Add(LayoutBottom, footer)
+
+	g := layout.Arrange(content)
+
+	// The content is scaled by 2 to fit the remaining 200x100 area
+	contentGroup := g.Children[0].(*Group)
+	min, max := contentGroup.GetAABB().Transform(contentGroup.Transform).Bounds()
+	checkVec(t, min, vec.Vec2{X: 0, Y: 0})
+	checkVec(t, max, vec.Vec2{X: 200, Y: 100})
+
+	footerGroup := g.Children[1].(*Group)
+	min, _ = footerGroup.GetAABB().Transform(footerGroup.Transform).Bounds()
+	checkVec(t, min, vec.Vec2{X: 95, Y: 100})
+}
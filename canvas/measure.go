@@ -0,0 +1,134 @@
+package canvas
+
+import (
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// The number of widths kept by a [TextCache] if its limit isn't set
+const defaultTextCacheLimit = 4096
+
+// TextShaping controls how the glyphs of [Text] are chosen and
+// spaced. The zero value uses the font's defaults.
+type TextShaping struct {
+	// Draw all digits the same width, so numbers in a column line up
+	// and changing values don't shift the rest of the text
+	TabularNumbers bool
+	// Turn off the font's kerning
+	NoKerning bool
+}
+
+// Returns the shaping as CSS, or "" for the defaults
+func (s TextShaping) css() string {
+	css := ""
+	if s.TabularNumbers {
+		css += "font-variant-numeric: tabular-nums;"
+	}
+	if s.NoKerning {
+		css += "font-kerning: none;"
+	}
+	return css
+}
+
+// TextMeasurer measures the width of text, such as from the metrics
+// of a font
+type TextMeasurer interface {
+	// Width returns the width of the text at a font size of 1, other
+	// sizes are scaled from it
+	Width(text string, shaping TextShaping) float32
+}
+
+// Estimates widths from the number of letters, ignoring the shaping
+type estimatedMetrics struct{}
+
+func (estimatedMetrics) Width(text string, shaping TextShaping) float32 {
+	return 0.65 * float32(utf8.RuneCountInString(text))
+}
+
+type measurerValue struct {
+	measurer TextMeasurer
+}
+
+var textMeasurer atomic.Value
+
+// SetTextMeasurer sets how the width of text is measured, for
+// [MeasureText] and the bounds of [Text]. If m is nil, widths are
+// estimated from the number of letters, which is the default.
+//
+// Text is measured often, so measurers that are slow, such as ones
+// laying out glyphs from a font, should be wrapped in a [TextCache].
+func SetTextMeasurer(m TextMeasurer) {
+	textMeasurer.Store(measurerValue{m})
+}
+
+// MeasureText returns the width of text drawn at the given font size
+// with the shaping, using the measurer set by [SetTextMeasurer]
+func MeasureText(text string, size float32, shaping TextShaping) float32 {
+	m, _ := textMeasurer.Load().(measurerValue)
+	if m.measurer == nil {
+		return estimatedMetrics{}.Width(text, shaping) * size
+	}
+	return m.measurer.Width(text, shaping) * size
+}
+
+type textCacheKey struct {
+	text    string
+	shaping TextShaping
+}
+
+// TextCache is a [TextMeasurer] that remembers the widths measured
+// by another, so text repeated across a map, such as link values, is
+// only measured once. It is safe to use from multiple goroutines.
+type TextCache struct {
+	measurer TextMeasurer
+	limit    int
+
+	mu     sync.Mutex
+	widths map[textCacheKey]float32
+}
+
+// NewTextCache returns a cache of the widths measured by m, keeping
+// at most limit widths. If limit is 0 a default is used.
+func NewTextCache(m TextMeasurer, limit int) *TextCache {
+	if limit <= 0 {
+		limit = defaultTextCacheLimit
+	}
+	return &TextCache{
+		measurer: m,
+		limit:    limit,
+		widths:   map[textCacheKey]float32{},
+	}
+}
+
+func (c *TextCache) Width(text string, shaping TextShaping) float32 {
+	key := textCacheKey{text, shaping}
+
+	c.mu.Lock()
+	width, ok := c.widths[key]
+	c.mu.Unlock()
+	if ok {
+		return width
+	}
+
+	// Measure without holding the lock, so slow measurements don't
+	// hold up other goroutines
+	width = c.measurer.Width(text, shaping)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Starting again when full is cheaper than tracking which
+	// widths are still used
+	if len(c.widths) >= c.limit {
+		clear(c.widths)
+	}
+	c.widths[key] = width
+	return width
+}
+
+// Len returns the number of widths in the cache
+func (c *TextCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.widths)
+}
@@ -12,6 +12,7 @@ const (
 	CommandMoveTo
 	CommandLineTo
 	CommandArcTo
+	CommandCubicTo
 )
 
 // Path is a generic path through space.
@@ -39,6 +40,9 @@ func NewPath() *Path {
 //     radius is the radius of the circle that the arc is of,
 //     sweepDir is the direction the arc is drawn in, 1 for clockwise,
 //     0 for counterclockwise
+//   - `CubicTo`: [c1.X, c1.Y, c2.X, c2.Y, end.X, end.Y], a cubic
+//     Bézier curve from the current position to end, with the
+//     control points c1 and c2
 type Command struct {
 	Type CommandType
 	Pos  vec.Vec2
@@ -90,6 +94,14 @@ func (p *Path) ArcNeg(start, end vec.Vec2, radius float32) *Path {
 	return p
 }
 
+// Draws a cubic Bézier curve from the current position to end,
+// with the control points c1 and c2
+func (p *Path) CubicTo(c1, c2, end vec.Vec2) *Path {
+	p.addCommand(CommandCubicTo, end,
+		c1.X, c1.Y, c2.X, c2.Y, end.X, end.Y)
+	return p
+}
+
 // Generates a rounded corner defined by start, end and peak with the radius
 func (p *Path) RoundCorner(radius float32, start, peak, end vec.Vec2) *Path {
 	if radius <= 0 {
@@ -167,6 +179,14 @@ func (p *Path) GetAABB() *AABB {
 		}
 		min = min.Min(cmd.Pos)
 		max = max.Max(cmd.Pos)
+		if cmd.Type == CommandCubicTo {
+			// The curve is always inside the control points
+			for i := 0; i < 4; i += 2 {
+				c := vec.Vec2{X: cmd.Args[i], Y: cmd.Args[i+1]}
+				min = min.Min(c)
+				max = max.Max(c)
+			}
+		}
 	}
 
 	return NewAABB(min, max)
@@ -172,3 +172,38 @@ func (p *Polygon) GetAABB() *AABB {
 func (Polygon *Polygon) Render(r Renderer) error {
 	return r.RenderPolygon(Polygon)
 }
+
+// Image is an external image, such as a logo, drawn in the
+// rectangle at Pos with the given width and height. Href is the
+// URL of the image, which can be a data URI.
+type Image struct {
+	Element
+	Pos    vec.Vec2
+	Width  float32
+	Height float32
+	Href   string
+}
+
+func NewImage(pos vec.Vec2, width, height float32, href string) *Image {
+	return &Image{
+		Pos:    pos,
+		Width:  width,
+		Height: height,
+		Href:   href,
+	}
+}
+
+func (i *Image) GetAABB() *AABB {
+	if i == nil {
+		return nil
+	}
+
+	return NewAABB(i.Pos, i.Pos.Add(vec.Vec2{X: i.Width, Y: i.Height}))
+}
+
+func (image *Image) Render(r Renderer) error {
+	if r, ok := r.(ImageRenderer); ok {
+		return r.RenderImage(image)
+	}
+	return nil
+}
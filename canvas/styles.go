@@ -91,6 +91,18 @@ func (c *StyleColor) String() string {
 	return c.color.ToRGB().String()
 }
 
+// MarshalJSON encodes the color as a string that can be decoded
+// again, an unset color is encoded as null
+func (c StyleColor) MarshalJSON() ([]byte, error) {
+	if c.IsZero() {
+		return []byte("null"), nil
+	}
+	if rgb, ok := c.color.(*RGBColor); ok {
+		return json.Marshal(rgb.ToHex())
+	}
+	return json.Marshal(c.String())
+}
+
 func mergeStyleColor(a, b StyleColor) StyleColor {
 	if a.color == nil && !a.isNone {
 		return b
@@ -114,11 +126,27 @@ type Style struct {
 	StrokeOpacity option.Float32 `json:"stroke-opacity,omitempty"`
 	// The width of the stroke/outline
 	StrokeWidth option.Float32 `json:"stroke-width,omitempty"`
+	// Lengths of alternating dashes and gaps used to paint the
+	// stroke/outline. A nil value means a solid line.
+	StrokeDashArray []float32 `json:"stroke-dasharray,omitempty"`
 
 	// The font family used for text
 	FontFamily string `json:"font-family,omitempty"`
+
+	// Whether the object is drawn, as in CSS. "none" leaves out the
+	// object and all of its children
+	Display string `json:"display,omitempty"`
+	// Whether the object is visible, as in CSS. "hidden" hides the
+	// object, but its children can still set "visible"
+	Visibility string `json:"visibility,omitempty"`
 }
 
+const (
+	DisplayNone       = "none"
+	VisibilityHidden  = "hidden"
+	VisibilityVisible = "visible"
+)
+
 func NewStyle() *Style {
 	return &Style{}
 }
@@ -145,9 +173,18 @@ func (s *Style) Merge(other *Style) {
 	if !s.StrokeWidth.Valid {
 		s.StrokeWidth = other.StrokeWidth
 	}
+	if s.StrokeDashArray == nil {
+		s.StrokeDashArray = other.StrokeDashArray
+	}
 	if s.FontFamily == "" {
 		s.FontFamily = other.FontFamily
 	}
+	if s.Display == "" {
+		s.Display = other.Display
+	}
+	if s.Visibility == "" {
+		s.Visibility = other.Visibility
+	}
 }
 
 // Return a style with only the values that have changed from
@@ -181,10 +218,19 @@ func (s *Style) Changed(other *Style) *Style {
 	if s.StrokeWidth != other.StrokeWidth {
 		newStyle.StrokeWidth = other.StrokeWidth
 	}
+	if !slices.Equal(s.StrokeDashArray, other.StrokeDashArray) {
+		newStyle.StrokeDashArray = other.StrokeDashArray
+	}
 
 	if s.FontFamily != other.FontFamily {
 		newStyle.FontFamily = other.FontFamily
 	}
+	if s.Display != other.Display {
+		newStyle.Display = other.Display
+	}
+	if s.Visibility != other.Visibility {
+		newStyle.Visibility = other.Visibility
+	}
 
 	return newStyle
 }
@@ -224,11 +270,26 @@ func (s *Style) MarshalJSON() ([]byte, error) {
 	if err := marshal("stroke-width", &s.StrokeWidth); err != nil {
 		return nil, err
 	}
+	if s.StrokeDashArray != nil {
+		if err := marshal("stroke-dasharray", s.StrokeDashArray); err != nil {
+			return nil, err
+		}
+	}
 	if s.FontFamily != "" {
 		if err := marshal("font-family", s.FontFamily); err != nil {
 			return nil, err
 		}
 	}
+	if s.Display != "" {
+		if err := marshal("display", s.Display); err != nil {
+			return nil, err
+		}
+	}
+	if s.Visibility != "" {
+		if err := marshal("visibility", s.Visibility); err != nil {
+			return nil, err
+		}
+	}
 
 	return json.Marshal(obj)
 }
@@ -239,6 +300,10 @@ func (s *Style) MarshalJSON() ([]byte, error) {
 //
 // It is loosely modeled on a simplified version of CSS, basically
 // only supporting classes.
+//
+// When several rules match, the rules with more classes in their
+// selector take priority. Between rules with the same number of
+// classes, the one added last takes priority, as in CSS.
 type Stylesheet struct {
 	rules []Rule
 }
@@ -252,7 +317,8 @@ type Rule struct {
 // The selection rule that matches classes to styles.
 type Selector []string
 
-// GetAllRules returns all the rules in the stylesheet
+// GetAllRules returns all the rules in the stylesheet, ordered from
+// the highest priority to the lowest
 func (ss *Stylesheet) GetAllRules() []Rule {
 	return ss.rules
 }
@@ -262,32 +328,41 @@ func (ss *Stylesheet) HasRules() bool {
 	return len(ss.rules) > 0
 }
 
-// AddRule adds a new rule to the stylesheet
+// AddRule adds a new rule to the stylesheet. The style is copied,
+// so later changes to it don't affect the stylesheet.
+//
+// If there is already a rule with the same selector, the two are
+// merged, with the values in style taking priority, and the merged
+// rule is treated as the last one added.
 func (ss *Stylesheet) AddRule(sel Selector, style *Style) {
 	if ss == nil || style == nil {
 		return
 	}
+
+	newStyle := NewStyle()
+	*newStyle = *style
+
+	idx := slices.IndexFunc(ss.rules, func(r Rule) bool {
+		return r.Selector.equal(sel)
+	})
+	if idx >= 0 {
+		newStyle.Merge(ss.rules[idx].Style)
+		ss.rules = slices.Delete(ss.rules, idx, idx+1)
+	}
+
 	r := Rule{
 		Selector: sel,
-		Style:    style,
+		Style:    newStyle,
 	}
 
-	ss.rules = append(ss.rules, r)
-
-	// Ensure the rules stay sorted as `GetStyle` relies on
-	// this property
-	slices.SortStableFunc(ss.rules, func(a, b Rule) int {
-		aLen := len(a.Selector)
-		bLen := len(b.Selector)
-
-		if aLen < bLen {
-			return 1
-		} else if aLen > bLen {
-			return -1
-		} else {
-			return 0
-		}
+	// Keep the rules sorted from most to least specific, as
+	// `GetStyle` relies on this property. The new rule goes
+	// before the others with the same specificity, so it takes
+	// priority over them.
+	pos, _ := slices.BinarySearchFunc(ss.rules, len(sel), func(r Rule, n int) int {
+		return n - len(r.Selector)
 	})
+	ss.rules = slices.Insert(ss.rules, pos, r)
 }
 
 // GetRules returns all the rules matching the given classes
@@ -324,6 +399,12 @@ func (ss *Stylesheet) GetStyle(classes []string) *Style {
 	return newStyle
 }
 
+// Returns whether the two selectors have the same classes,
+// ignoring the order
+func (s Selector) equal(other Selector) bool {
+	return len(s) == len(other) && s.Matches(other) && other.Matches(s)
+}
+
 // Matches returns true if this selector matches the given
 // classes
 func (s Selector) Matches(classes []string) bool {
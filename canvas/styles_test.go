@@ -1,9 +1,12 @@
 package canvas_test
 
 import (
+	"encoding/json"
+	"strings"
 	"testing"
 
 	. "github.com/REANNZ/raumata/canvas"
+	"github.com/REANNZ/raumata/vec"
 )
 
 func checkStyleEq(t *testing.T, expected, actual *Style) {
@@ -176,3 +179,101 @@ func TestStylesheet(t *testing.T) {
 
 	checkStyleEq(t, expectedStyle, style)
 }
+
+func TestStylesheetCascade(t *testing.T) {
+	stylesheet := Stylesheet{}
+
+	first := NewStyle()
+	first.FillColor.SetColor(RGB(1, 0, 0))
+	first.StrokeWidth.Set(1)
+	stylesheet.AddRule(Selector{"a"}, first)
+
+	other := NewStyle()
+	other.FillColor.SetColor(RGB(0, 0, 1))
+	stylesheet.AddRule(Selector{"b"}, other)
+
+	specific := NewStyle()
+	specific.StrokeWidth.Set(3)
+	stylesheet.AddRule(Selector{"a", "b"}, specific)
+
+	// The later rule with the same specificity wins
+	style := stylesheet.GetStyle([]string{"a", "b"})
+	if !ColorEqual(style.FillColor.Color(), RGB(0, 0, 1)) {
+		t.Errorf("Expected the later rule to take priority, got %s", &style.FillColor)
+	}
+	// The more specific rule wins regardless of order
+	if style.StrokeWidth.Value != 3 {
+		t.Errorf("Expected the more specific rule to take priority, got %v", style.StrokeWidth.Value)
+	}
+
+	// Adding the same selector again merges the rules, and makes
+	// the merged rule the latest
+	second := NewStyle()
+	second.FillColor.SetColor(RGB(0, 1, 0))
+	stylesheet.AddRule(Selector{"a"}, second)
+
+	rules := stylesheet.GetAllRules()
+	if len(rules) != 3 {
+		t.Fatalf("Expected 3 rules, got %d", len(rules))
+	}
+
+	style = stylesheet.GetStyle([]string{"a"})
+	if !ColorEqual(style.FillColor.Color(), RGB(0, 1, 0)) || style.StrokeWidth.Value != 1 {
+		t.Errorf("Rules not merged, got fill %s, stroke width %v", &style.FillColor, style.StrokeWidth.Value)
+	}
+	style = stylesheet.GetStyle([]string{"a", "b"})
+	if !ColorEqual(style.FillColor.Color(), RGB(0, 1, 0)) {
+		t.Errorf("Expected the merged rule to take priority, got %s", &style.FillColor)
+	}
+
+	// The styles are copied into the stylesheet
+	second.FillColor.SetColor(RGB(1, 1, 1))
+	style = stylesheet.GetStyle([]string{"a"})
+	if !ColorEqual(style.FillColor.Color(), RGB(0, 1, 0)) {
+		t.Errorf("Changing the added style changed the stylesheet")
+	}
+
+	// The rules are emitted in CSS order, lowest priority first
+	out := &strings.Builder{}
+	r := NewSVGRenderer(out)
+	r.IncludeHeader = false
+	r.StyleMode = SVGStyleInternal
+	c := NewCanvas()
+	c.Stylesheet = stylesheet
+	c.AppendChild(NewCircle(vec.Vec2{}, 1))
+	if err := c.Render(r); err != nil {
+		t.Fatalf("Error rendering canvas: %s", err)
+	}
+	svg := out.String()
+	a, b, ab := strings.Index(svg, ".a {"), strings.Index(svg, ".b {"), strings.Index(svg, ".a.b {")
+	if a < 0 || b < 0 || ab < 0 || !(b < a && a < ab) {
+		t.Errorf("Rules not in cascade order in %q", svg)
+	}
+}
+
+func TestStyleColorJSON(t *testing.T) {
+	colors := []StyleColor{
+		NewStyleColor(RGB(1, 0.2, 0)),
+		NewStyleColor(HSL(120, 0.5, 0.25)),
+		StyleColorNone,
+		{},
+	}
+
+	for _, color := range colors {
+		data, err := json.Marshal(color)
+		if err != nil {
+			t.Fatalf("Error encoding %s: %s", &color, err)
+		}
+
+		var decoded StyleColor
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("Error decoding %s: %s", data, err)
+		}
+
+		if decoded.IsZero() != color.IsZero() || decoded.IsNone() != color.IsNone() {
+			t.Errorf("%s decoded as %s", data, &decoded)
+		} else if !color.IsZero() && !color.IsNone() && !ColorEqual(decoded.Color(), color.Color()) {
+			t.Errorf("%s decoded as %s, expected %s", data, &decoded, &color)
+		}
+	}
+}
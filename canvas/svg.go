@@ -1,14 +1,17 @@
 package canvas
 
 import (
+	"encoding/xml"
 	"fmt"
 	"io"
+	"math"
 	"slices"
 	"strconv"
 	"strings"
 
 	"github.com/REANNZ/raumata/internal"
 	"github.com/REANNZ/raumata/internal/f32"
+	"github.com/REANNZ/raumata/option"
 	"github.com/REANNZ/raumata/vec"
 )
 
@@ -38,10 +41,19 @@ type SVGRenderer struct {
 	IncludeSize   bool
 	StyleMode     SVGStyleMode // Mode to use for rendering styles, defaults to SVGStyleNone
 	Precision     int          // Controls the precision used for printing floats
-	f             io.Writer
-	level         int
-	currentStyle  *Style
-	canvas        *Canvas
+	// Overrides Precision for transforms, small errors in rotations
+	// are noticeable on long rotated text
+	TransformPrecision option.Option[int]
+	// Overrides Precision for path data and polygon points
+	PathPrecision option.Option[int]
+	// Write numbers the same way everywhere, so the same canvas
+	// always gives the same bytes: negative zero is written as 0,
+	// and numbers in styles use Precision like everything else
+	Stable       bool
+	f            io.Writer
+	level        int
+	currentStyle *Style
+	canvas       *Canvas
 }
 
 // NewSVGRenderer returns a new renderer that writes an SVG to f
@@ -76,6 +88,9 @@ func (r *SVGRenderer) RenderCanvas(canvas *Canvas) error {
 	}
 
 	attrs := r.convertAttributes(&canvas.Attributes)
+	for key, value := range canvas.Metadata {
+		attrs["data-"+key] = value
+	}
 
 	aabb := canvas.GetAABB()
 
@@ -135,8 +150,9 @@ func (r *SVGRenderer) RenderCanvas(canvas *Canvas) error {
 	}
 
 	// Start rendering
-	if r.StyleMode != SVGStyleInternal || !canvas.Stylesheet.HasRules() {
-		return r.writeElement("svg", attrs, canvas.Children, nil)
+	writeStylesheet := r.StyleMode == SVGStyleInternal && canvas.Stylesheet.HasRules()
+	if !writeStylesheet && len(canvas.Symbols) == 0 {
+		return r.writeElement("svg", attrs, canvas.Attributes.Title, canvas.Children, nil)
 	} else {
 		err := r.writeOpenElement("svg", attrs, false)
 		if err != nil {
@@ -144,9 +160,21 @@ func (r *SVGRenderer) RenderCanvas(canvas *Canvas) error {
 		}
 
 		r.level += 1
-		err = r.writeStylesheet(canvas.Stylesheet)
-		if err != nil {
-			return err
+		if canvas.Attributes.Title != "" {
+			if err := r.writeTitle(canvas.Attributes.Title); err != nil {
+				return err
+			}
+		}
+
+		if writeStylesheet {
+			if err := r.writeStylesheet(canvas.Stylesheet); err != nil {
+				return err
+			}
+		}
+		if len(canvas.Symbols) > 0 {
+			if err := r.writeSymbols(canvas.Symbols); err != nil {
+				return err
+			}
 		}
 
 		RenderChildren(r, canvas.Children)
@@ -172,30 +200,32 @@ func (r *SVGRenderer) RenderGroup(group *Group) error {
 
 		trans, ok := t.GetTranslation()
 		if ok {
-			xStr := r.formatFloat32(trans.X)
-			yStr := r.formatFloat32(trans.Y)
+			xStr := r.formatTransform(trans.X)
+			yStr := r.formatTransform(trans.Y)
 			transformStr = fmt.Sprintf("translate(%s, %s)", xStr, yStr)
 		}
-		rot, ok := t.GetRotation()
-		if ok {
-			transformStr = fmt.Sprintf("rotate(%s)", r.formatFloat32(rot))
+		if _, ok := t.GetRotation(); ok {
+			// SVG rotations are in degrees, and GetRotation doesn't
+			// give the direction
+			deg := f32.Atan2(t.B, t.A) * 180 / math.Pi
+			transformStr = fmt.Sprintf("rotate(%s)", r.formatTransform(deg))
 		}
 
 		if transformStr == "" {
 			// Fallback to the matrix form
 			transformStr = fmt.Sprintf("matrix(%s,%s,%s,%s,%s,%s)",
-				r.formatFloat32(t.A),
-				r.formatFloat32(t.B),
-				r.formatFloat32(t.C),
-				r.formatFloat32(t.D),
-				r.formatFloat32(t.E),
-				r.formatFloat32(t.F))
+				r.formatTransform(t.A),
+				r.formatTransform(t.B),
+				r.formatTransform(t.C),
+				r.formatTransform(t.D),
+				r.formatTransform(t.E),
+				r.formatTransform(t.F))
 		}
 
 		attrs["transform"] = transformStr
 	}
 
-	return r.writeElement("g", attrs, group.Children, group.Attributes.Style)
+	return r.writeElement("g", attrs, group.Attributes.Title, group.Children, group.Attributes.Style)
 }
 
 // RenderRect renders a [Rect] object to a `<rect>` element
@@ -213,7 +243,31 @@ func (r *SVGRenderer) RenderRect(rect *Rect) error {
 	if rect.Ry > 0 {
 		attrs["ry"] = r.formatFloat32(rect.Ry)
 	}
-	return r.writeElement("rect", attrs, rect.Children, rect.Attributes.Style)
+	return r.writeElement("rect", attrs, rect.Attributes.Title, rect.Children, rect.Attributes.Style)
+}
+
+// RenderImage renders an [Image] object to an `<image>` element
+func (r *SVGRenderer) RenderImage(image *Image) error {
+	attrs := r.convertAttributes(&image.Attributes)
+
+	attrs["x"] = r.formatFloat32(image.Pos.X)
+	attrs["y"] = r.formatFloat32(image.Pos.Y)
+	attrs["width"] = r.formatFloat32(image.Width)
+	attrs["height"] = r.formatFloat32(image.Height)
+	attrs["href"] = image.Href
+	return r.writeElement("image", attrs, image.Attributes.Title, image.Children, image.Attributes.Style)
+}
+
+// RenderUse renders a [Use] object to a `<use>` element
+func (r *SVGRenderer) RenderUse(use *Use) error {
+	attrs := r.convertAttributes(&use.Attributes)
+
+	attrs["href"] = "#" + use.Symbol
+	attrs["x"] = r.formatFloat32(use.Pos.X)
+	attrs["y"] = r.formatFloat32(use.Pos.Y)
+	attrs["width"] = r.formatFloat32(use.Width)
+	attrs["height"] = r.formatFloat32(use.Height)
+	return r.writeElement("use", attrs, use.Attributes.Title, use.Children, use.Attributes.Style)
 }
 
 // RenderEllipse renders an [Ellipse] object to either an
@@ -233,7 +287,7 @@ func (r *SVGRenderer) RenderEllipse(ellipse *Ellipse) error {
 		attrs["rx"] = r.formatFloat32(ellipse.Rx)
 		attrs["ry"] = r.formatFloat32(ellipse.Ry)
 	}
-	return r.writeElement(name, attrs, ellipse.Children, ellipse.Attributes.Style)
+	return r.writeElement(name, attrs, ellipse.Attributes.Title, ellipse.Children, ellipse.Attributes.Style)
 }
 
 // RenderLine renders a [Line] object to a `<line>` element
@@ -246,7 +300,7 @@ func (r *SVGRenderer) RenderLine(line *Line) error {
 	attrs["x2"] = r.formatFloat32(line.End.X)
 	attrs["y2"] = r.formatFloat32(line.End.Y)
 
-	return r.writeElement("line", attrs, line.Children, line.Attributes.Style)
+	return r.writeElement("line", attrs, line.Attributes.Title, line.Children, line.Attributes.Style)
 }
 
 // RenderPolygon renders a [Polygon] object to a `<polygon>` element
@@ -256,20 +310,20 @@ func (r *SVGRenderer) RenderPolygon(polygon *Polygon) error {
 
 	points := ""
 	for _, p := range polygon.Points {
-		xStr := r.formatFloat32(p.X)
-		yStr := r.formatFloat32(p.Y)
+		xStr := r.formatPath(p.X)
+		yStr := r.formatPath(p.Y)
 		points += fmt.Sprintf("%s, %s ", xStr, yStr)
 	}
 
 	attrs["points"] = points
 
-	return r.writeElement("polygon", attrs, polygon.Children, polygon.Attributes.Style)
+	return r.writeElement("polygon", attrs, polygon.Attributes.Title, polygon.Children, polygon.Attributes.Style)
 }
 
 // RenderPath renders a [Path] object to a `<path>` object
 func (r *SVGRenderer) RenderPath(path *Path) error {
 
-	eps := f32.Pow(10, -(float32(r.Precision + 1)))
+	eps := f32.Pow(10, -(float32(r.pathPrecision() + 1)))
 
 	attrs := r.convertAttributes(&path.Attributes)
 
@@ -283,24 +337,24 @@ func (r *SVGRenderer) RenderPath(path *Path) error {
 			data += "Z"
 			prevCmdCode = "Z"
 		case CommandMoveTo:
-			data += fmt.Sprintf("M%s,%s ", r.formatFloat32(cmd.Args[0]), r.formatFloat32(cmd.Args[1]))
+			data += fmt.Sprintf("M%s,%s ", r.formatPath(cmd.Args[0]), r.formatPath(cmd.Args[1]))
 			prevCmdCode = "M"
 		case CommandLineTo:
 			if prevPos.ApproxEq(cmd.Pos, eps) {
 				continue
 			}
 			if prevPos.X == cmd.Pos.X {
-				data += fmt.Sprintf("V%s ", r.formatFloat32(cmd.Args[1]))
+				data += fmt.Sprintf("V%s ", r.formatPath(cmd.Args[1]))
 				prevCmdCode = "V"
 			} else if prevPos.Y == cmd.Pos.Y {
-				data += fmt.Sprintf("H%s ", r.formatFloat32(cmd.Args[0]))
+				data += fmt.Sprintf("H%s ", r.formatPath(cmd.Args[0]))
 				prevCmdCode = "H"
 			} else {
 				if prevCmdCode != "L" && prevCmdCode != "M" {
 					data += "L"
 					prevCmdCode = "L"
 				}
-				data += fmt.Sprintf("%s,%s ", r.formatFloat32(cmd.Args[0]), r.formatFloat32(cmd.Args[1]))
+				data += fmt.Sprintf("%s,%s ", r.formatPath(cmd.Args[0]), r.formatPath(cmd.Args[1]))
 			}
 		case CommandArcTo:
 			start := vec.Vec2{X: cmd.Args[0], Y: cmd.Args[1]}
@@ -315,17 +369,23 @@ func (r *SVGRenderer) RenderPath(path *Path) error {
 				radius = (dist / 2)
 			}
 
-			radStr := r.formatFloat32(radius)
+			radStr := r.formatPath(radius)
 			data += fmt.Sprintf("A%s,%s 0 0,%d %s,%s ",
-				radStr, radStr, sweep, r.formatFloat32(end.X), r.formatFloat32(end.Y))
+				radStr, radStr, sweep, r.formatPath(end.X), r.formatPath(end.Y))
 			prevCmdCode = "A"
+		case CommandCubicTo:
+			data += fmt.Sprintf("C%s,%s %s,%s %s,%s ",
+				r.formatPath(cmd.Args[0]), r.formatPath(cmd.Args[1]),
+				r.formatPath(cmd.Args[2]), r.formatPath(cmd.Args[3]),
+				r.formatPath(cmd.Args[4]), r.formatPath(cmd.Args[5]))
+			prevCmdCode = "C"
 		}
 		prevPos = cmd.Pos
 	}
 
 	attrs["d"] = data
 
-	return r.writeElement("path", attrs, path.Children, path.Attributes.Style)
+	return r.writeElement("path", attrs, path.Attributes.Title, path.Children, path.Attributes.Style)
 
 }
 
@@ -343,12 +403,20 @@ func (r *SVGRenderer) RenderText(text *Text) error {
 	if anchor != "" {
 		attrs["text-anchor"] = anchor
 	}
+	baseline := text.Baseline.String()
+	if baseline != "" {
+		attrs["dominant-baseline"] = baseline
+	}
+	// The shaping has no SVG attributes, so it is always CSS
+	if css := text.Shaping.css(); css != "" {
+		attrs["style"] += css
+	}
 
 	if err := r.writeOpenElement("text", attrs, false); err != nil {
 		return err
 	}
 
-	if _, err := io.WriteString(r.f, text.Text); err != nil {
+	if err := xml.EscapeText(r.f, []byte(text.Text)); err != nil {
 		return err
 	}
 
@@ -376,6 +444,8 @@ func (r *SVGRenderer) writeStylesheet(stylesheet Stylesheet) error {
 
 	copy(rules, ssRules)
 
+	// The stylesheet stores the highest priority rules first, but
+	// in CSS later rules take priority
 	slices.Reverse(rules)
 
 	for _, rule := range rules {
@@ -384,7 +454,7 @@ func (r *SVGRenderer) writeStylesheet(stylesheet Stylesheet) error {
 			return err
 		}
 
-		if _, err := io.WriteString(r.f, rule.Style.toCSS(r.Indent)); err != nil {
+		if _, err := io.WriteString(r.f, rule.Style.toCSS(r.Indent, r.cssFormat())); err != nil {
 			return err
 		}
 
@@ -409,10 +479,50 @@ func (r *SVGRenderer) writeStylesheet(stylesheet Stylesheet) error {
 	return err
 }
 
+// Writes the symbols as `<symbol>` elements in a `<defs>` element, in
+// order of their ids
+func (r *SVGRenderer) writeSymbols(symbols map[string]*Symbol) error {
+	if err := r.writeOpenElement("defs", nil, false); err != nil {
+		return err
+	}
+
+	ids := make([]string, 0, len(symbols))
+	for id := range symbols {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	r.level += 1
+	for _, id := range ids {
+		symbol := symbols[id]
+		attrs := r.convertAttributes(&symbol.Attributes)
+		attrs["id"] = id
+		if box := symbol.viewBox(); box != nil {
+			boxMin := box.min
+			size := box.Size()
+			attrs["viewBox"] = fmt.Sprintf("%s %s %s %s",
+				r.formatFloat32(boxMin.X),
+				r.formatFloat32(boxMin.Y),
+				r.formatFloat32(size.X),
+				r.formatFloat32(size.Y))
+		}
+		if err := r.writeElement("symbol", attrs, symbol.Attributes.Title, symbol.Children, symbol.Attributes.Style); err != nil {
+			return err
+		}
+	}
+	r.level -= 1
+
+	if err := r.newline(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(r.f, "</defs>")
+	return err
+}
+
 // Renders an arbitrary element to the document
 func (r *SVGRenderer) RenderElement(name string, attrs map[string]any, children []Object, style *Style) error {
 	stringAttrs := r.convertAttributeMap(attrs)
-	return r.writeElement(name, stringAttrs, children, style)
+	return r.writeElement(name, stringAttrs, "", children, style)
 }
 
 // Renders a string as a CDATA element
@@ -462,7 +572,13 @@ func (r *SVGRenderer) writeOpenElement(name string, attrs map[string]string, sel
 	})
 
 	for _, pair := range attrPairs {
-		if _, err := fmt.Fprintf(r.f, " %s=\"%s\"", pair.key, pair.val); err != nil {
+		if _, err := fmt.Fprintf(r.f, " %s=\"", pair.key); err != nil {
+			return err
+		}
+		if err := xml.EscapeText(r.f, []byte(pair.val)); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(r.f, "\""); err != nil {
 			return err
 		}
 	}
@@ -476,11 +592,20 @@ func (r *SVGRenderer) writeOpenElement(name string, attrs map[string]string, sel
 	return err
 }
 
-func (r *SVGRenderer) writeElement(name string, attrs map[string]string, children []Object, style *Style) error {
-	if err := r.writeOpenElement(name, attrs, len(children) == 0); err != nil {
+func (r *SVGRenderer) writeElement(name string, attrs map[string]string, title string, children []Object, style *Style) error {
+	hasContent := len(children) > 0 || title != ""
+	if err := r.writeOpenElement(name, attrs, !hasContent); err != nil {
 		return err
 	}
-	if len(children) > 0 {
+	if hasContent {
+		if title != "" {
+			r.level += 1
+			if err := r.writeTitle(title); err != nil {
+				return err
+			}
+			r.level -= 1
+		}
+
 		prevStyle := *r.currentStyle
 		if style != nil {
 			*r.currentStyle = *style
@@ -505,6 +630,18 @@ func (r *SVGRenderer) writeElement(name string, attrs map[string]string, childre
 	return nil
 }
 
+// Writes a `<title>` element, used by viewers to show tooltips
+func (r *SVGRenderer) writeTitle(title string) error {
+	if err := r.writeOpenElement("title", nil, false); err != nil {
+		return err
+	}
+	if err := xml.EscapeText(r.f, []byte(title)); err != nil {
+		return err
+	}
+	_, err := io.WriteString(r.f, "</title>")
+	return err
+}
+
 func (r *SVGRenderer) newline() error {
 	if r.Indent == 0 {
 		return nil
@@ -525,8 +662,36 @@ func (r *SVGRenderer) newline() error {
 	return err
 }
 
+func (r *SVGRenderer) formatFloat(f float64, prec int, bitSize int) string {
+	s := internal.FormatFloat(f, prec, bitSize)
+	// Rounding small negative numbers leaves "-0", which depends
+	// on which side of zero the error in the calculations fell
+	if r.Stable && s == "-0" {
+		return "0"
+	}
+	return s
+}
+
 func (r *SVGRenderer) formatFloat32(f float32) string {
-	return internal.FormatFloat32(f, r.Precision)
+	return r.formatFloat(float64(f), r.Precision, 32)
+}
+
+func (r *SVGRenderer) formatTransform(f float32) string {
+	if r.TransformPrecision.Valid {
+		return r.formatFloat(float64(f), r.TransformPrecision.Value, 32)
+	}
+	return r.formatFloat32(f)
+}
+
+func (r *SVGRenderer) pathPrecision() int {
+	if r.PathPrecision.Valid {
+		return r.PathPrecision.Value
+	}
+	return r.Precision
+}
+
+func (r *SVGRenderer) formatPath(f float32) string {
+	return r.formatFloat(float64(f), r.pathPrecision(), 32)
 }
 
 func (r *SVGRenderer) convertAttributeMap(attrs map[string]any) map[string]string {
@@ -551,7 +716,7 @@ func (r *SVGRenderer) convertAttributeMap(attrs map[string]any) map[string]strin
 		case float32:
 			out[attr] = r.formatFloat32(val)
 		case float64:
-			out[attr] = internal.FormatFloat(val, r.Precision, 64)
+			out[attr] = r.formatFloat(val, r.Precision, 64)
 		case string:
 			out[attr] = val
 		case []string:
@@ -646,13 +811,22 @@ func (r *SVGRenderer) convertAttributes(attrs *Attributes) map[string]string {
 		if style.StrokeWidth.Valid {
 			out["stroke-width"] = r.formatFloat32(style.StrokeWidth.Value)
 		}
+		if style.StrokeDashArray != nil {
+			out["stroke-dasharray"] = formatDashArray(style.StrokeDashArray, r.formatFloat32)
+		}
 		if style.FontFamily != "" {
 			out["font-family"] = style.FontFamily
 		}
+		if style.Display != "" {
+			out["display"] = style.Display
+		}
+		if style.Visibility != "" {
+			out["visibility"] = style.Visibility
+		}
 	} else {
 		// Only emit style values that have changed
 		style = r.currentStyle.Changed(style)
-		css := style.toCSS(0)
+		css := style.toCSS(0, r.cssFormat())
 		if css != "" {
 			out["style"] = css
 		}
@@ -665,12 +839,29 @@ func (r *SVGRenderer) convertAttributes(attrs *Attributes) map[string]string {
 	return out
 }
 
-func (s *Style) toCSS(indent int) string {
+// Returns the function used to format numbers in CSS, or nil to
+// write them as short as possible without losing precision
+func (r *SVGRenderer) cssFormat() func(float32) string {
+	if r.Stable {
+		return r.formatFloat32
+	}
+	return nil
+}
+
+// Converts the style to CSS, numbers are formatted with format if
+// it is set
+func (s *Style) toCSS(indent int, format func(float32) string) string {
 	if s == nil {
 		return ""
 	}
 	css := ""
 
+	if format == nil {
+		format = func(f float32) string {
+			return strconv.FormatFloat(float64(f), 'g', -1, 32)
+		}
+	}
+
 	indentStr := make([]byte, indent)
 	for i := 0; i < indent; i++ {
 		indentStr[i] = ' '
@@ -704,25 +895,49 @@ func (s *Style) toCSS(indent int) string {
 	}
 
 	if s.Opacity.Valid {
-		appendStyle("opacity", s.Opacity.String())
+		appendStyle("opacity", format(s.Opacity.Value))
 	}
 
 	appendColor("fill", s.FillColor)
 	if s.FillOpacity.Valid {
-		appendStyle("fill-opacity", s.FillOpacity.String())
+		appendStyle("fill-opacity", format(s.FillOpacity.Value))
 	}
 
 	appendColor("stroke", s.StrokeColor)
 
 	if s.StrokeOpacity.Valid {
-		appendStyle("stroke-opacity", s.StrokeOpacity.String())
+		appendStyle("stroke-opacity", format(s.StrokeOpacity.Value))
 	}
 	if s.StrokeWidth.Valid {
-		appendStyle("stroke-width", s.StrokeWidth.String())
+		appendStyle("stroke-width", format(s.StrokeWidth.Value))
+	}
+	if s.StrokeDashArray != nil {
+		appendStyle("stroke-dasharray", formatDashArray(s.StrokeDashArray, format))
 	}
 	if s.FontFamily != "" {
 		appendStyle("font-family", s.FontFamily)
 	}
+	if s.Display != "" {
+		appendStyle("display", s.Display)
+	}
+	if s.Visibility != "" {
+		appendStyle("visibility", s.Visibility)
+	}
 
 	return css
 }
+
+// Formats a dash array as a comma-separated list. An empty array
+// is a solid line, which is written as "none".
+func formatDashArray(dashes []float32, format func(float32) string) string {
+	if len(dashes) == 0 {
+		return "none"
+	}
+
+	strs := make([]string, len(dashes))
+	for i, d := range dashes {
+		strs[i] = format(d)
+	}
+
+	return strings.Join(strs, ",")
+}
@@ -0,0 +1,297 @@
+package canvas_test
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	. "github.com/REANNZ/raumata/canvas"
+	"github.com/REANNZ/raumata/option"
+	"github.com/REANNZ/raumata/vec"
+)
+
+func TestSVGTitle(t *testing.T) {
+	c := NewCanvas()
+
+	circle := NewCircle(vec.Vec2{X: 5, Y: 5}, 5)
+	circle.Attributes.Title = "a & b\nsite: <akl>"
+	c.AppendChild(circle)
+
+	out := &strings.Builder{}
+	r := NewSVGRenderer(out)
+	r.IncludeHeader = false
+
+	if err := c.Render(r); err != nil {
+		t.Fatalf("Error rendering canvas: %s", err)
+	}
+
+	svg := out.String()
+	expected := "<circle cx=\"5\" cy=\"5\" r=\"5\"><title>a &amp; b&#xA;site: &lt;akl&gt;</title></circle>"
+	if !strings.Contains(svg, expected) {
+		t.Errorf("Title not rendered correctly, expected %q in %q", expected, svg)
+	}
+}
+
+func TestSVGTextEscaped(t *testing.T) {
+	c := NewCanvas()
+	c.AppendChild(NewText(vec.Vec2{}, "a < b & c"))
+
+	out := &strings.Builder{}
+	r := NewSVGRenderer(out)
+	r.IncludeHeader = false
+
+	if err := c.Render(r); err != nil {
+		t.Fatalf("Error rendering canvas: %s", err)
+	}
+
+	svg := out.String()
+	expected := ">a &lt; b &amp; c</text>"
+	if !strings.Contains(svg, expected) {
+		t.Errorf("Text not escaped correctly, expected %q in %q", expected, svg)
+	}
+}
+
+func TestSVGTextBaseline(t *testing.T) {
+	c := NewCanvas()
+
+	text := NewText(vec.Vec2{X: 0, Y: 10}, "label")
+	text.Anchor = TextAnchorMiddle
+	text.Baseline = TextBaselineMiddle
+	text.Size = 10
+	c.AppendChild(text)
+
+	out := &strings.Builder{}
+	r := NewSVGRenderer(out)
+	r.IncludeHeader = false
+
+	if err := c.Render(r); err != nil {
+		t.Fatalf("Error rendering canvas: %s", err)
+	}
+
+	svg := out.String()
+	expected := `dominant-baseline="central"`
+	if !strings.Contains(svg, expected) {
+		t.Errorf("Baseline not rendered correctly, expected %q in %q", expected, svg)
+	}
+}
+
+func TestSVGImage(t *testing.T) {
+	c := NewCanvas()
+	c.AppendChild(NewImage(vec.Vec2{X: 1, Y: 2}, 30, 20, "logo.svg?a=1&b=2"))
+
+	out := &strings.Builder{}
+	r := NewSVGRenderer(out)
+	r.IncludeHeader = false
+
+	if err := c.Render(r); err != nil {
+		t.Fatalf("Error rendering canvas: %s", err)
+	}
+
+	svg := out.String()
+	expected := `<image height="20" href="logo.svg?a=1&amp;b=2" width="30" x="1" y="2"/>`
+	if !strings.Contains(svg, expected) {
+		t.Errorf("Image not rendered correctly, expected %q in %q", expected, svg)
+	}
+}
+
+func TestSVGRotate(t *testing.T) {
+	for angle, expected := range map[float32]string{
+		math.Pi / 2:  `transform="rotate(90)"`,
+		-math.Pi / 2: `transform="rotate(-90)"`,
+	} {
+		c := NewCanvas()
+		group := NewGroup()
+		group.Transform = vec.NewRotate(angle)
+		group.AppendChild(NewCircle(vec.Vec2{X: 5, Y: 5}, 5))
+		c.AppendChild(group)
+
+		out := &strings.Builder{}
+		r := NewSVGRenderer(out)
+		r.IncludeHeader = false
+		if err := c.Render(r); err != nil {
+			t.Fatalf("Error rendering canvas: %s", err)
+		}
+		if svg := out.String(); !strings.Contains(svg, expected) {
+			t.Errorf("Expected %q in %q", expected, svg)
+		}
+	}
+}
+
+func TestSVGPrecisionOverrides(t *testing.T) {
+	c := NewCanvas()
+
+	group := NewGroup()
+	group.Transform = vec.NewRotate(0.123456)
+	path := NewPath()
+	path.MoveTo(vec.Vec2{X: 1.23456, Y: 2.34567})
+	path.LineTo(vec.Vec2{X: 3.45678, Y: 4.56789})
+	group.AppendChild(path)
+	c.AppendChild(group)
+
+	out := &strings.Builder{}
+	r := NewSVGRenderer(out)
+	r.IncludeHeader = false
+	if err := c.Render(r); err != nil {
+		t.Fatalf("Error rendering canvas: %s", err)
+	}
+	svg := out.String()
+	for _, expected := range []string{`rotate(7.07)`, `d="M1.23,2.35 3.46,4.57 "`} {
+		if !strings.Contains(svg, expected) {
+			t.Errorf("Expected %q with the default precision in %q", expected, svg)
+		}
+	}
+
+	out.Reset()
+	r = NewSVGRenderer(out)
+	r.IncludeHeader = false
+	r.TransformPrecision.Set(4)
+	r.PathPrecision.Set(1)
+	if err := c.Render(r); err != nil {
+		t.Fatalf("Error rendering canvas: %s", err)
+	}
+	svg = out.String()
+	for _, expected := range []string{`rotate(7.0735)`, `d="M1.2,2.3 3.5,4.6 "`} {
+		if !strings.Contains(svg, expected) {
+			t.Errorf("Expected %q with the precision overrides in %q", expected, svg)
+		}
+	}
+}
+
+func TestSVGMetadata(t *testing.T) {
+	c := NewCanvas()
+	c.Metadata = map[string]string{
+		"generator": "make-map",
+		"input":     "a \"quoted\" & <escaped> name",
+	}
+	c.AppendChild(NewCircle(vec.Vec2{X: 5, Y: 5}, 5))
+
+	out := &strings.Builder{}
+	r := NewSVGRenderer(out)
+	r.IncludeHeader = false
+
+	if err := c.Render(r); err != nil {
+		t.Fatalf("Error rendering canvas: %s", err)
+	}
+
+	svg := out.String()
+	root := svg[:strings.Index(svg, ">")]
+	for _, expected := range []string{
+		`data-generator="make-map"`,
+		`data-input="a &#34;quoted&#34; &amp; &lt;escaped&gt; name"`,
+	} {
+		if !strings.Contains(root, expected) {
+			t.Errorf("Expected %s on the root element, got %q", expected, root)
+		}
+	}
+}
+
+func TestSVGStable(t *testing.T) {
+	c := NewCanvas()
+	c.Stylesheet.AddRule(Selector{"thin"}, &Style{
+		StrokeWidth: option.Float32{Value: 1.0 / 3, Valid: true},
+	})
+	path := NewPath()
+	path.MoveTo(vec.Vec2{X: -0.001, Y: 1})
+	path.LineTo(vec.Vec2{X: 2, Y: 3})
+	path.Attributes.AddClass("thin")
+	c.AppendChild(path)
+
+	render := func(stable bool) string {
+		out := &strings.Builder{}
+		r := NewSVGRenderer(out)
+		r.IncludeHeader = false
+		r.StyleMode = SVGStyleInternal
+		r.Stable = stable
+		if err := c.Render(r); err != nil {
+			t.Fatalf("Error rendering canvas: %s", err)
+		}
+		return out.String()
+	}
+
+	svg := render(false)
+	for _, expected := range []string{`d="M-0,1 2,3 "`, `stroke-width: 0.33333334;`} {
+		if !strings.Contains(svg, expected) {
+			t.Errorf("Expected %q by default in %q", expected, svg)
+		}
+	}
+
+	svg = render(true)
+	for _, expected := range []string{`d="M0,1 2,3 "`, `stroke-width: 0.33;`} {
+		if !strings.Contains(svg, expected) {
+			t.Errorf("Expected %q in stable output in %q", expected, svg)
+		}
+	}
+}
+
+func TestSVGSymbol(t *testing.T) {
+	c := NewCanvas()
+	symbol := NewSymbol()
+	symbol.ViewBox = NewAABB(vec.Vec2{}, vec.Vec2{X: 2, Y: 1})
+	symbol.AppendChild(NewImage(vec.Vec2{}, 2, 1, "router.svg"))
+	c.AddSymbol("router", symbol)
+	c.AppendChild(NewUse("router", vec.Vec2{X: 5, Y: 5}, 20, 10))
+
+	out := &strings.Builder{}
+	r := NewSVGRenderer(out)
+	r.IncludeHeader = false
+
+	if err := c.Render(r); err != nil {
+		t.Fatalf("Error rendering canvas: %s", err)
+	}
+
+	svg := out.String()
+	for _, expected := range []string{
+		`<defs>`,
+		`<symbol id="router" viewBox="0 0 2 1">`,
+		`<use height="10" href="#router" width="20" x="5" y="5"/>`,
+	} {
+		if !strings.Contains(svg, expected) {
+			t.Errorf("Symbol not rendered correctly, expected %q in %q", expected, svg)
+		}
+	}
+}
+
+func TestSVGTextShaping(t *testing.T) {
+	c := NewCanvas()
+	text := NewText(vec.Vec2{}, "10 Gb")
+	text.Shaping = TextShaping{TabularNumbers: true, NoKerning: true}
+	c.AppendChild(text)
+
+	out := &strings.Builder{}
+	r := NewSVGRenderer(out)
+	r.IncludeHeader = false
+
+	if err := c.Render(r); err != nil {
+		t.Fatalf("Error rendering canvas: %s", err)
+	}
+
+	svg := out.String()
+	expected := `style="font-variant-numeric: tabular-nums;font-kerning: none;"`
+	if !strings.Contains(svg, expected) {
+		t.Errorf("Shaping not rendered correctly, expected %q in %q", expected, svg)
+	}
+}
+
+// basicRenderer only has the methods of [Renderer], not the optional
+// image and use ones
+type basicRenderer struct {
+	Renderer
+}
+
+func TestRendererOptionalMethods(t *testing.T) {
+	out := &strings.Builder{}
+	r := NewSVGRenderer(out)
+	r.IncludeHeader = false
+
+	image := NewImage(vec.Vec2{}, 2, 1, "router.svg")
+	if err := image.Render(basicRenderer{r}); err != nil {
+		t.Errorf("Error rendering image: %s", err)
+	}
+	use := NewUse("router", vec.Vec2{}, 2, 1)
+	if err := use.Render(basicRenderer{r}); err != nil {
+		t.Errorf("Error rendering use: %s", err)
+	}
+	if svg := out.String(); svg != "" {
+		t.Errorf("Expected the image and use to be left out, got %q", svg)
+	}
+}
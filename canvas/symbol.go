@@ -0,0 +1,97 @@
+package canvas
+
+import (
+	"github.com/REANNZ/raumata/internal/f32"
+	"github.com/REANNZ/raumata/vec"
+)
+
+// Symbol is a drawing defined once on a canvas, in its own
+// coordinates, and drawn any number of times by [Use] objects. This
+// keeps large drawings, such as embedded icons, out of the output
+// for each place they are drawn.
+type Symbol struct {
+	Element
+	// The area of the symbol's coordinates drawn into the rectangle
+	// of each Use. If nil, the bounds of its children are used.
+	ViewBox *AABB
+}
+
+func NewSymbol() *Symbol {
+	return &Symbol{}
+}
+
+// Returns the area of the symbol's coordinates that is drawn
+func (s *Symbol) viewBox() *AABB {
+	if s.ViewBox != nil {
+		return s.ViewBox
+	}
+	return GetCombinedAABB(s.Children)
+}
+
+// AddSymbol adds the symbol to the canvas with the given id, for [Use]
+// objects to draw. A symbol already added with the id is replaced.
+func (c *Canvas) AddSymbol(id string, symbol *Symbol) {
+	if c.Symbols == nil {
+		c.Symbols = map[string]*Symbol{}
+	}
+	c.Symbols[id] = symbol
+}
+
+// Use draws the symbol with the given id from the canvas's symbols,
+// scaled to fit the rectangle at Pos with the given width and height
+// and centered in it, keeping its aspect ratio
+type Use struct {
+	Element
+	Symbol string
+	Pos    vec.Vec2
+	Width  float32
+	Height float32
+}
+
+func NewUse(symbol string, pos vec.Vec2, width, height float32) *Use {
+	return &Use{
+		Symbol: symbol,
+		Pos:    pos,
+		Width:  width,
+		Height: height,
+	}
+}
+
+func (u *Use) GetAABB() *AABB {
+	if u == nil {
+		return nil
+	}
+
+	return NewAABB(u.Pos, u.Pos.Add(vec.Vec2{X: u.Width, Y: u.Height}))
+}
+
+func (use *Use) Render(r Renderer) error {
+	if r, ok := r.(UseRenderer); ok {
+		return r.RenderUse(use)
+	}
+	return nil
+}
+
+// Returns the transform from the symbol's coordinates to the
+// rectangle of the use, or nil if the symbol has no area
+func (u *Use) symbolTransform(symbol *Symbol) *vec.Transform {
+	box := symbol.viewBox()
+	if box == nil {
+		return nil
+	}
+	boxMin, _ := box.Bounds()
+	size := box.Size()
+	if size.X <= 0 || size.Y <= 0 {
+		return nil
+	}
+
+	scale := f32.Min(u.Width/size.X, u.Height/size.Y)
+	// Center the symbol in the rectangle
+	offset := vec.Vec2{
+		X: (u.Width - size.X*scale) / 2,
+		Y: (u.Height - size.Y*scale) / 2,
+	}
+	return vec.NewTranslate(boxMin.Neg()).
+		Combine(vec.NewScale(vec.Vec2{X: scale, Y: scale})).
+		Combine(vec.NewTranslate(u.Pos.Add(offset)))
+}
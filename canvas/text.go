@@ -1,6 +1,10 @@
 package canvas
 
-import "github.com/REANNZ/raumata/vec"
+import (
+	"strings"
+
+	"github.com/REANNZ/raumata/vec"
+)
 
 type TextAnchor int
 
@@ -11,6 +15,22 @@ const (
 	TextAnchorEnd
 )
 
+// TextBaseline is the vertical alignment of text relative to
+// its position
+type TextBaseline int
+
+const (
+	// The text sits on its position, like text on a line
+	TextBaselineNone TextBaseline = iota
+	// The top of the text is at its position
+	TextBaselineTop
+	// The text is centered on its position
+	TextBaselineMiddle
+	// The bottom of the text, including descenders, is at its
+	// position
+	TextBaselineBottom
+)
+
 // Text is some text drawn to the canvas
 type Text struct {
 	Attributes Attributes
@@ -18,6 +38,8 @@ type Text struct {
 	Text       string
 	Size       float32
 	Anchor     TextAnchor
+	Baseline   TextBaseline
+	Shaping    TextShaping
 }
 
 func NewText(pos vec.Vec2, text string) *Text {
@@ -36,11 +58,19 @@ func (t *Text) GetAABB() *AABB {
 	// instead of these arbitrary heuristics
 	// golang.org/x/image/font would be the most useful.
 	ascender := t.Size * 0.85
-	advance := t.Size * 0.65
+
+	switch t.Baseline {
+	case TextBaselineTop:
+		ascender = 0
+	case TextBaselineMiddle:
+		ascender = t.Size / 2
+	case TextBaselineBottom:
+		ascender = t.Size
+	}
 
 	min := t.Pos.Sub(vec.Vec2{X: 0, Y: ascender})
 
-	width := advance * float32(len(t.Text))
+	width := MeasureText(t.Text, t.Size, t.Shaping)
 
 	switch t.Anchor {
 	case TextAnchorMiddle:
@@ -54,6 +84,61 @@ func (t *Text) GetAABB() *AABB {
 	return NewAABB(min, max)
 }
 
+// TextWidth returns the width of text drawn at the given font size,
+// with the default shaping, see [MeasureText]
+func TextWidth(text string, size float32) float32 {
+	return MeasureText(text, size, TextShaping{})
+}
+
+// WrapText splits text into lines no wider than maxWidth, as
+// measured by [TextWidth]. Lines are broken between words where
+// possible, words that don't fit on a line by themselves are broken
+// between letters.
+func WrapText(text string, size, maxWidth float32) []string {
+	return WrapShapedText(text, size, maxWidth, TextShaping{})
+}
+
+// WrapShapedText is [WrapText] for text drawn with the given shaping
+func WrapShapedText(text string, size, maxWidth float32, shaping TextShaping) []string {
+	lines := []string{}
+	line := ""
+
+	for _, word := range strings.Fields(text) {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if MeasureText(candidate, size, shaping) <= maxWidth {
+			line = candidate
+			continue
+		}
+
+		if line != "" {
+			lines = append(lines, line)
+			line = ""
+		}
+
+		// Break up words that are too long, with as many letters as
+		// fit on each line, and at least one
+		runes := []rune(word)
+		for MeasureText(string(runes), size, shaping) > maxWidth && len(runes) > 1 {
+			n := 1
+			for n < len(runes)-1 && MeasureText(string(runes[:n+1]), size, shaping) <= maxWidth {
+				n++
+			}
+			lines = append(lines, string(runes[:n]))
+			runes = runes[n:]
+		}
+		line = string(runes)
+	}
+
+	if line != "" || len(lines) == 0 {
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
 func (t *Text) Render(r Renderer) error {
 	return r.RenderText(t)
 }
@@ -74,3 +159,18 @@ func (a TextAnchor) String() string {
 		return ""
 	}
 }
+
+// String returns the matching value of the SVG
+// "dominant-baseline" attribute
+func (b TextBaseline) String() string {
+	switch b {
+	case TextBaselineTop:
+		return "text-before-edge"
+	case TextBaselineMiddle:
+		return "central"
+	case TextBaselineBottom:
+		return "text-after-edge"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,89 @@
+package canvas_test
+
+import (
+	"slices"
+	"testing"
+
+	. "github.com/REANNZ/raumata/canvas"
+	"github.com/REANNZ/raumata/vec"
+)
+
+func TestWrapText(t *testing.T) {
+	// At size 10 each letter is 6.5 wide, so 10 letters fit in 65
+	tests := []struct {
+		text     string
+		expected []string
+	}{
+		{"short", []string{"short"}},
+		{"", []string{""}},
+		{"Auckland to Wellington", []string{"Auckland", "to", "Wellington"}},
+		{"to the core", []string{"to the", "core"}},
+		{"Christchurch", []string{"Christchur", "ch"}},
+		{"a  Christchurch", []string{"a", "Christchur", "ch"}},
+	}
+
+	for _, test := range tests {
+		lines := WrapText(test.text, 10, 65)
+		if !slices.Equal(lines, test.expected) {
+			t.Errorf("Wrapping %q, expected %q, got %q", test.text, test.expected, lines)
+		}
+	}
+
+	// Always at least one letter per line
+	lines := WrapText("abc", 10, 1)
+	if !slices.Equal(lines, []string{"a", "b", "c"}) {
+		t.Errorf("Expected one letter per line, got %q", lines)
+	}
+}
+
+// Measures every letter as 1 wide, or 0.5 for digits with tabular
+// numbers, counting the measurements
+type countingMeasurer struct {
+	count int
+}
+
+func (m *countingMeasurer) Width(text string, shaping TextShaping) float32 {
+	m.count++
+	width := float32(0)
+	for _, c := range text {
+		if shaping.TabularNumbers && c >= '0' && c <= '9' {
+			width += 0.5
+		} else {
+			width += 1
+		}
+	}
+	return width
+}
+
+func TestTextMeasurer(t *testing.T) {
+	measurer := &countingMeasurer{}
+	cache := NewTextCache(measurer, 2)
+	SetTextMeasurer(cache)
+	defer SetTextMeasurer(nil)
+
+	if width := TextWidth("10 Gb", 10); width != 50 {
+		t.Errorf("Expected width 50, got %v", width)
+	}
+	if width := MeasureText("10 Gb", 10, TextShaping{TabularNumbers: true}); width != 40 {
+		t.Errorf("Expected tabular width 40, got %v", width)
+	}
+	text := NewText(vec.Vec2{}, "10 Gb")
+	text.Size = 20
+	if _, max := text.GetAABB().Bounds(); max.X != 100 {
+		t.Errorf("Expected text bounds to use the measurer, got %v", max)
+	}
+	if measurer.count != 2 || cache.Len() != 2 {
+		t.Errorf("Expected 2 measurements cached, got %d measured and %d cached", measurer.count, cache.Len())
+	}
+
+	// The cache starts again when full
+	TextWidth("other", 10)
+	if measurer.count != 3 || cache.Len() != 1 {
+		t.Errorf("Expected the full cache to be cleared, got %d measured and %d cached", measurer.count, cache.Len())
+	}
+
+	SetTextMeasurer(nil)
+	if width := TextWidth("10 Gb", 10); width != 32.5 {
+		t.Errorf("Expected the estimated width 32.5, got %v", width)
+	}
+}
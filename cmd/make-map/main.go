@@ -4,11 +4,99 @@ MakeMap generates a map from a topology.
 Usage:
 
 	make-map [flags] [input [output]]
+	make-map positions [flags] [input [output]]
+	make-map weathermap [flags] [input [output]]
 
 The flags are:
 
 		-c path
 		    Read config from the JSON-formatted file at path.
+		-title text
+		    Add a title to the top of the map.
+		-debug-density
+		    Shade grid cells by the number of links passing through them.
+		-debug-occupancy
+		    Shade grid cells by what the router knows is in them, such as
+		    nodes, labels and links, with a tooltip listing them.
+		-workers n
+		    Number of goroutines used to route links (default: number of CPUs).
+		-bundle
+		    Give links between the same nodes one route, drawn side by side.
+		-directed-pairs
+		    Give links running opposite ways between the same nodes one
+		    route, drawn side by side with each on the right of its direction.
+		-route-cache path
+		    Read routes from the cache file at path if the layout hasn't
+		    changed, otherwise route the links and save them to it.
+		-snap-vias
+		    Move via points that can't be routed through, such as those on
+		    nodes or outside the map, to the nearest free cell.
+		-order-vias
+		    Visit each link's via points in the order that gives the
+		    shortest route, instead of the order they are listed in.
+		-pull-taut
+		    Straighten the routes after routing, removing the zig-zags
+		    of grid steps where the cells along the straight line are free.
+		-node-clearance n
+		    Keep routes at least n cells away from the nodes they don't
+		    connect to (default 0).
+		-wide-links size
+		    Keep other links off the cells beside the routes of links
+		    drawn at least size wide, from their own style or their
+		    class's, so they don't pass under them (default 0, off).
+		-report path
+		    Write a report of the links, with their values, states and
+		    route lengths, to path. It is JSON if path ends in ".json",
+		    otherwise CSV.
+		-routed path
+		    Write the topology with the routes and route stats, such as
+		    the length and number of bends, as JSON to path.
+		-stats path
+		    Write statistics about the routing, such as the number of
+		    crossings and the total route length, as JSON to path.
+		-keep-going
+		    Leave out nodes and links that fail to render, printing a
+		    warning for each, instead of stopping.
+		-sanitize-ids
+		    Replace characters in node and link ids and classes that
+		    aren't valid in CSS selectors, such as spaces and slashes,
+		    with '_' and their hex code, e.g. "a b" becomes "a_20b".
+		    The original ids are kept in data attributes.
+		-metadata
+		    Record the program version, a hash of the topology and the
+		    time the map was made, as data attributes on the map.
+		-stable
+		    Make the same map for the same topology and config every time,
+		    for comparing maps against saved copies. Routes are found in
+		    a fixed order by a single worker, ignoring -workers, numbers
+		    are all written the same way, and only the hash of the topology
+		    is recorded by -metadata.
+		-data location
+		    Read the link data from the JSON file or http(s) URL at
+		    location, an object of from_data and to_data by link id.
+		-data-command command
+		    Run command to collect the link data. It is given the link
+		    ids as a JSON array on standard input, and writes the data
+		    to standard output in the same format as -data reads. The
+		    command is split into its arguments at spaces, unless -data-arg
+		    is given.
+		-data-arg arg
+		    Pass arg to the -data-command, which is then run as it is
+		    given, without splitting it. Repeat the flag for each argument,
+		    for arguments with spaces in them.
+		-delta-from path
+		    Color the links by the change in their values since the
+		    earlier data in the file at path, in the same format as -data
+		    reads, instead of by their values.
+		-png
+		    Also write the map, and each view, as a PNG with the same name
+		    as the output, e.g. "map.png" for "map.svg", for viewers that
+		    can't display SVG.
+		-png-command command
+		    Run command to convert the map to PNG. It is given the path of
+		    the map as SVG, in the output's directory so relative icons are
+		    found, and writes the PNG to standard output (default
+		    "rsvg-convert").
 	    -dumpconf
 		    Dump the config as JSON to stdout and exit.
 		-h, -help
@@ -16,25 +104,85 @@ The flags are:
 
 If the input arg is not set, then the topology is read from standard input.
 If the output arg is not set, then the output is written to standard output.
+If the config has views, each view is written next to the output, with the
+name of the view added to the file name, e.g. "map-core.svg".
+
+The positions subcommand finds positions for nodes that don't have one,
+minimizing link length and crossings, and writes out the updated topology.
+Nodes that already have a position are not moved. Its flags are:
+
+	-spacing n
+	    Number of cells between node positions (default 2).
+	-iterations n
+	    Number of placement moves to try (default 20000).
+	-seed n
+	    Seed for the random placement, the same seed gives the same result.
+
+The weathermap subcommand converts a PHP Network Weathermap config to a
+topology. Node positions are fitted to the grid, and nodes that end up in
+the same cell are moved apart, with a warning. Its flags are:
+
+	-cell-size n
+	    Number of pixels in each grid cell (default 10).
+	-config-out path
+	    Write a config with the map's icons and color scale to path.
+	-targets path
+	    Write the targets, bandwidths and info URLs of the links, by
+	    link id, as JSON to path.
 */
 package main
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
 
 	"github.com/REANNZ/raumata"
 	"github.com/REANNZ/raumata/canvas"
+	"github.com/REANNZ/raumata/datasource"
 	"github.com/REANNZ/raumata/vec"
 )
 
 var (
-	configPath string = ""
-	help       bool   = false
-	dumpConf   bool   = false
+	configPath     string = ""
+	help           bool   = false
+	dumpConf       bool   = false
+	title          string = ""
+	debugDensity   bool   = false
+	debugOccupancy bool   = false
+	workers        int    = runtime.NumCPU()
+	bundle         bool   = false
+	directed       bool   = false
+	routeCache     string = ""
+	snapVias       bool   = false
+	reportPath     string = ""
+	routedPath     string = ""
+	statsPath      string = ""
+	keepGoing      bool   = false
+	orderVias      bool   = false
+	sanitizeIds    bool   = false
+	metadata       bool   = false
+	pullTaut       bool   = false
+	nodeClearance  int    = 0
+	wideLinks      float64
+	stable         bool   = false
+	dataLocation   string = ""
+	dataCommand    string = ""
+	dataArgs       stringList
+	deltaFrom      string = ""
+	png            bool   = false
+	pngCommand     string = "rsvg-convert"
 )
 
 func init() {
@@ -42,9 +190,41 @@ func init() {
 	flag.BoolVar(&help, "h", false, "")
 	flag.BoolVar(&help, "help", false, "")
 	flag.BoolVar(&dumpConf, "dumpconf", false, "")
+	flag.StringVar(&title, "title", "", "title to add to the top of the map")
+	flag.BoolVar(&debugDensity, "debug-density", false, "shade cells by link density")
+	flag.BoolVar(&debugOccupancy, "debug-occupancy", false, "shade cells by what the router knows is in them")
+	flag.IntVar(&workers, "workers", workers, "number of goroutines used to route links")
+	flag.BoolVar(&bundle, "bundle", false, "bundle links between the same nodes")
+	flag.BoolVar(&directed, "directed-pairs", false, "pair up links running opposite ways between the same nodes")
+	flag.StringVar(&routeCache, "route-cache", "", "path to a file to cache routes in")
+	flag.BoolVar(&snapVias, "snap-vias", false, "move unusable via points to the nearest free cell")
+	flag.BoolVar(&orderVias, "order-vias", false, "visit via points in the order giving the shortest route")
+	flag.BoolVar(&pullTaut, "pull-taut", false, "straighten routes where the cells along them are free")
+	flag.IntVar(&nodeClearance, "node-clearance", 0, "number of cells routes keep away from other nodes")
+	flag.Float64Var(&wideLinks, "wide-links", 0, "size of links that other links keep off the sides of")
+	flag.StringVar(&reportPath, "report", "", "path to write a CSV or JSON report of the links to")
+	flag.StringVar(&routedPath, "routed", "", "path to write the routed topology to")
+	flag.StringVar(&statsPath, "stats", "", "path to write the router statistics to")
+	flag.BoolVar(&keepGoing, "keep-going", false, "leave out nodes and links that fail to render")
+	flag.BoolVar(&sanitizeIds, "sanitize-ids", false, "make node and link ids and classes safe for CSS selectors")
+	flag.BoolVar(&metadata, "metadata", false, "record the program, input and time in the map")
+	flag.BoolVar(&stable, "stable", false, "make the same map for the same input every time")
+	flag.StringVar(&dataLocation, "data", "", "file or URL to read the link data from")
+	flag.StringVar(&dataCommand, "data-command", "", "command to run to collect the link data")
+	flag.Var(&dataArgs, "data-arg", "argument to pass to the -data-command, can be repeated")
+	flag.StringVar(&deltaFrom, "delta-from", "", "path to earlier link data to show the change from")
+	flag.BoolVar(&png, "png", false, "also write the map as a PNG next to the output")
+	flag.StringVar(&pngCommand, "png-command", pngCommand, "command to run to convert the map to PNG")
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "positions" {
+		os.Exit(runPositions(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "weathermap" {
+		os.Exit(runWeathermap(os.Args[2:]))
+	}
+
 	flag.Parse()
 
 	if help {
@@ -58,24 +238,40 @@ func main() {
 func run() int {
 
 	renderConfig := raumata.DefaultRenderConfig()
+	routerConfig := raumata.DefaultRouterConfig()
+	labelConfig := raumata.DefaultLabelConfig()
+	var prometheus *datasource.Prometheus
 	if configPath != "" {
-		f, err := os.Open(configPath)
+		data, err := os.ReadFile(configPath)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error opening config file %s: %s\n",
 				configPath, err)
 			return 1
 		}
 
-		decoder := json.NewDecoder(f)
-		err = decoder.Decode(renderConfig)
+		err = json.Unmarshal(data, renderConfig)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error parsing config: %s\n", err)
 			return 1
 		}
+
+		// The router and label configs are in the "router" and
+		// "labels" fields of the same file, and the Prometheus data
+		// source in "prometheus"
+		routerField := struct {
+			Router     *raumata.RouterConfig   `json:"router"`
+			Labels     *raumata.LabelConfig    `json:"labels"`
+			Prometheus **datasource.Prometheus `json:"prometheus"`
+		}{routerConfig, labelConfig, &prometheus}
+		err = json.Unmarshal(data, &routerField)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing router config: %s\n", err)
+			return 1
+		}
 	}
 
 	if dumpConf {
-		dumpConfig(renderConfig)
+		dumpConfig(renderConfig, routerConfig, labelConfig)
 		return 0
 	}
 
@@ -121,37 +317,177 @@ func run() int {
 
 	topo := raumata.Topology{}
 
+	// The input is hashed as it is read, so the map can be traced
+	// back to it
+	inputHash := sha256.New()
+	in = io.TeeReader(in, inputHash)
+
 	decoder := json.NewDecoder(in)
 	if err := decoder.Decode(&topo); err != nil {
 		fmt.Fprintf(os.Stderr, "Error parsing topology: %s\n", err)
 		return 1
 	}
+	if metadata {
+		// The decoder might not have read to the end
+		if _, err := io.Copy(io.Discard, in); err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading topology: %s\n", err)
+			return 1
+		}
+	}
+	if err := topo.FitMembers(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error fitting nodes to their members: %s\n", err)
+		return 1
+	}
+
+	// The data is fetched before routing, as the link labels take up
+	// space on the map
+	var sources []raumata.DataSource
+	if prometheus != nil {
+		sources = append(sources, prometheus)
+	}
+	if dataLocation != "" {
+		sources = append(sources, &datasource.JSON{Location: dataLocation})
+	}
+	if len(dataArgs) > 0 {
+		if dataCommand == "" {
+			fmt.Fprintf(os.Stderr, "Error: -data-arg needs -data-command\n")
+			return 1
+		}
+		sources = append(sources, &datasource.Command{Name: dataCommand, Args: dataArgs})
+	} else if args := strings.Fields(dataCommand); len(args) > 0 {
+		sources = append(sources, &datasource.Command{Name: args[0], Args: args[1:]})
+	}
+	for _, source := range sources {
+		if err := topo.FetchData(context.Background(), source); err != nil {
+			fmt.Fprintf(os.Stderr, "Error fetching link data: %s\n", err)
+			return 1
+		}
+	}
+	if deltaFrom != "" {
+		after := topo.Snapshot()
+		ids := make([]raumata.LinkId, 0, len(after))
+		for id := range after {
+			ids = append(ids, id)
+		}
+		before, err := (&datasource.JSON{Location: deltaFrom}).FetchLinkData(context.Background(), ids)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading earlier link data: %s\n", err)
+			return 1
+		}
+		topo.ApplyData(raumata.DeltaData(before, after, nil))
+	}
+
+	linkRouter := raumata.NewLinkRouterWithConfig(&topo, routerConfig)
+	linkRouter.Workers = workers
+	if stable {
+		// Routing links one at a time keeps the routes from depending
+		// on which worker finishes first
+		linkRouter.Workers = 1
+	}
+	linkRouter.Bundle = bundle
+	linkRouter.PairDirected = directed
+	linkRouter.OrderVias = orderVias
+	linkRouter.PullTaut = pullTaut
+	linkRouter.NodeClearance = int16(nodeClearance)
+	linkRouter.WideLinkSize = float32(wideLinks)
+	linkRouter.LinkSize = raumata.NewRendererWithConfig(renderConfig).LinkSize
+	linkRouter.StableTies = stable
+
+	for _, problem := range linkRouter.CheckVias(snapVias) {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", problem)
+	}
+
+	cached := false
+	if routeCache != "" {
+		cached = loadRouteCache(linkRouter, routeCache)
+	}
 
-	linkRouter := raumata.NewLinkRouter(&topo)
-	min, max := linkRouter.GetExtents()
-	linkRouter.SetExtents(int(min.X-1), int(min.Y-1), int(max.X+1), int(max.Y+1))
 	linkRouter.RouteLinks()
+	for _, id := range linkRouter.Stats().UnroutedLinks {
+		fmt.Fprintf(os.Stderr, "Warning: No route found for link %s\n", id)
+	}
 
-	raumata.PlaceLabels(&topo)
+	if routeCache != "" && !cached {
+		saveRouteCache(linkRouter, routeCache)
+	}
 
-	renderer := raumata.NewRendererWithConfig(renderConfig)
-	c := canvas.NewCanvas()
-	c.Margin = vec.Vec2{X: 10, Y: 10}
+	raumata.PlaceLabelsWithConfig(&topo, labelConfig)
 
-	err := renderer.RenderTopologyToCanvas(&topo, c)
+	if (bundle || directed) && renderConfig.BundleSpacing == 0 {
+		// Leave a gap of half a link between the links
+		renderConfig.BundleSpacing = renderConfig.DefaultLinkStyle.Size * 1.5
+	}
+	if directed {
+		renderConfig.DirectedPairs = true
+	}
+
+	c, renderer, err := renderMap(&topo, renderConfig, linkRouter)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error rendering topology: %s\n", err)
 		return 1
 	}
+	if metadata {
+		c.Metadata = map[string]string{
+			"topology-hash": "sha256:" + hex.EncodeToString(inputHash.Sum(nil)),
+		}
+		// The version and time would change the map
+		if !stable {
+			c.Metadata["generator"] = "raumata make-map " + version()
+			c.Metadata["created"] = time.Now().UTC().Format(time.RFC3339)
+		}
+	}
 
-	svgRenderer := canvas.NewSVGRenderer(out)
-	svgRenderer.Indent = 2
-
-	if err := c.Render(svgRenderer); err != nil {
+	if err := c.Render(newSVGRenderer(out)); err != nil {
 		fmt.Fprintf(os.Stderr, "Error rendering to SVG: %s\n", err)
 		return 1
 	}
 
+	exporter := newExporter(filepath.Dir(dstFilename))
+	if exporter.RasterizePNG != nil {
+		// The PNG is made from the same canvas as the SVG, so the
+		// map is only routed and drawn once
+		if dstFilename == "" {
+			fmt.Fprintf(os.Stderr, "Warning: A PNG can't be written alongside standard output, leaving it out\n")
+		} else if pngPath := canvas.PNGPath(dstFilename); pngPath == dstFilename {
+			fmt.Fprintf(os.Stderr, "Error writing PNG: The output %s would be overwritten by it\n", dstFilename)
+			return 1
+		} else if err := exporter.WritePNG(c, pngPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing PNG %s: %s\n", pngPath, err)
+			return 1
+		}
+	}
+
+	if len(renderConfig.Views) > 0 {
+		if dstFilename == "" {
+			fmt.Fprintf(os.Stderr, "Warning: Views can't be written to standard output, leaving them out\n")
+		} else if err := writeViews(&topo, renderConfig, dstFilename, c.Metadata, exporter); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing views: %s\n", err)
+			return 1
+		}
+	}
+
+	if reportPath != "" {
+		if err := writeReport(renderer.LinkReport(&topo), reportPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing report %s: %s\n", reportPath, err)
+			return 1
+		}
+	}
+
+	if routedPath != "" {
+		renderer.SetCanvasLengths(&topo)
+		if err := writeJSON(&topo, routedPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing routed topology %s: %s\n", routedPath, err)
+			return 1
+		}
+	}
+
+	if statsPath != "" {
+		if err := writeJSON(linkRouter.Stats(), statsPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing router stats %s: %s\n", statsPath, err)
+			return 1
+		}
+	}
+
 	if tmpFile != nil {
 		if err := os.Rename(tmpFile.Name(), dstFilename); err != nil {
 			fmt.Fprintf(os.Stderr, "Error moving output to final location: %s\n", err)
@@ -163,6 +499,134 @@ func run() int {
 	return 0
 }
 
+// Draws the topology onto a new canvas with the title, and the
+// debug overlays if router is set. Returns the renderer as well,
+// for the link report.
+func renderMap(topo *raumata.Topology, config *raumata.RenderConfig, router *raumata.LinkRouter) (*canvas.Canvas, *raumata.Renderer, error) {
+	renderer := raumata.NewRendererWithConfig(config)
+	renderer.ContinueOnError = keepGoing
+	if sanitizeIds {
+		renderer.SanitizeId = raumata.SanitizeId
+	}
+	c := canvas.NewCanvas()
+	c.Margin = vec.Vec2{X: 10, Y: 10}
+
+	mapObj, err := renderer.RenderTopology(topo)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, err := range renderer.Errors() {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", err)
+	}
+
+	// The overlays are drawn from grid positions, so they are turned
+	// along with the map
+	overlay := func(obj canvas.Object) canvas.Object {
+		group := canvas.NewGroup()
+		group.Transform = renderer.MapTransform()
+		group.AppendChild(obj)
+		return group
+	}
+
+	if router != nil && debugDensity {
+		mapGroup := canvas.NewGroup()
+		mapGroup.AppendChild(overlay(renderer.RenderDensity(router.LinkDensity())))
+		mapGroup.AppendChild(mapObj)
+		mapObj = mapGroup
+	}
+
+	if router != nil && debugOccupancy {
+		// Drawn over the map, so the cells under nodes can be seen
+		mapGroup := canvas.NewGroup()
+		mapGroup.AppendChild(mapObj)
+		mapGroup.AppendChild(overlay(renderer.RenderOccupancy(router.Occupancy())))
+		mapObj = mapGroup
+	}
+
+	if title != "" {
+		titleText := canvas.NewText(vec.Vec2{}, title)
+		titleText.Size = config.NodeLabelStyle.Size * 1.5
+		titleText.Attributes.AddClass("node-label-text")
+
+		layout := canvas.NewLayout()
+		layout.Add(canvas.LayoutTop, titleText)
+		mapObj = layout.Arrange(mapObj)
+	}
+
+	c.AppendChild(mapObj)
+	renderer.SetStyles(c)
+
+	return c, renderer, nil
+}
+
+// Draws each of the views in the config from the routed topology,
+// writing them next to the map at path with the name of the view
+// added, e.g. "map-core.svg" for the view "core" of "map.svg"
+func writeViews(topo *raumata.Topology, config *raumata.RenderConfig, path string, metadata map[string]string, exporter *canvas.Exporter) error {
+	ext := filepath.Ext(path)
+	for i, view := range config.Views {
+		if view.Name == "" {
+			return fmt.Errorf("View %d has no name", i)
+		}
+		// The name goes in the file name, so it can't be allowed to
+		// point somewhere else
+		if strings.IndexFunc(view.Name, invalidViewRune) >= 0 {
+			return fmt.Errorf("View '%s': Names can only have letters, digits, '_' and '-'", view.Name)
+		}
+
+		// The debug overlays cover the whole grid, so they are
+		// left out of views
+		c, _, err := renderMap(view.Topology(topo), view.Config(config), nil)
+		if err != nil {
+			return fmt.Errorf("View '%s': %w", view.Name, err)
+		}
+		c.Metadata = metadata
+
+		viewPath := strings.TrimSuffix(path, ext) + "-" + view.Name + ext
+		if err := exporter.Export(c, viewPath); err != nil {
+			return fmt.Errorf("View '%s': %w", view.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// A flag that can be given more than once, collecting its values
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, " ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// Returns whether the character can't be used in a view name
+func invalidViewRune(c rune) bool {
+	return !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-')
+}
+
+// Returns an exporter writing maps with the SVG settings, and as PNG
+// too if -png is set. The maps are written to dir, which the PNGs'
+// relative hrefs are found from.
+func newExporter(dir string) *canvas.Exporter {
+	exporter := &canvas.Exporter{NewSVGRenderer: newSVGRenderer}
+	if args := strings.Fields(pngCommand); png && len(args) > 0 {
+		exporter.RasterizePNG = canvas.CommandRasterizer(dir, args[0], args[1:]...)
+	}
+	return exporter
+}
+
+// Returns an SVG renderer writing to w with the settings for maps
+func newSVGRenderer(w io.Writer) *canvas.SVGRenderer {
+	svgRenderer := canvas.NewSVGRenderer(w)
+	svgRenderer.Indent = 2
+	svgRenderer.Stable = stable
+	return svgRenderer
+}
+
 func printHelp() {
 
 	usage := `MakeMap generates a map from a topology.
@@ -170,11 +634,99 @@ func printHelp() {
 Usage:
 
     make-map [flags] [input [output]]
+    make-map positions [flags] [input [output]]
+    make-map weathermap [flags] [input [output]]
 
 The flags are:
 
     -c path
           Read config from the JSON-formatted file at path.
+    -title text
+          Add a title to the top of the map.
+    -debug-density
+          Shade grid cells by the number of links passing through them.
+    -debug-occupancy
+          Shade grid cells by what the router knows is in them, such as
+          nodes, labels and links, with a tooltip listing them.
+    -workers n
+          Number of goroutines used to route links (default: number of CPUs).
+    -bundle
+          Give links between the same nodes one route, drawn side by side.
+    -directed-pairs
+          Give links running opposite ways between the same nodes one
+          route, drawn side by side with each on the right of its direction.
+    -route-cache path
+          Read routes from the cache file at path if the layout hasn't
+          changed, otherwise route the links and save them to it.
+    -snap-vias
+          Move via points that can't be routed through, such as those on
+          nodes or outside the map, to the nearest free cell.
+    -order-vias
+          Visit each link's via points in the order that gives the
+          shortest route, instead of the order they are listed in.
+    -pull-taut
+          Straighten the routes after routing, removing the zig-zags
+          of grid steps where the cells along the straight line are free.
+    -node-clearance n
+          Keep routes at least n cells away from the nodes they don't
+          connect to (default 0).
+    -wide-links size
+          Keep other links off the cells beside the routes of links
+          drawn at least size wide, from their own style or their
+          class's, so they don't pass under them (default 0, off).
+    -report path
+          Write a report of the links, with their values, states and
+          route lengths, to path. It is JSON if path ends in ".json",
+          otherwise CSV.
+    -routed path
+          Write the topology with the routes and route stats, such as
+          the length and number of bends, as JSON to path.
+    -stats path
+          Write statistics about the routing, such as the number of
+          crossings and the total route length, as JSON to path.
+    -keep-going
+          Leave out nodes and links that fail to render, printing a
+          warning for each, instead of stopping.
+    -sanitize-ids
+          Replace characters in node and link ids and classes that
+          aren't valid in CSS selectors, such as spaces and slashes,
+          with '_' and their hex code, e.g. "a b" becomes "a_20b".
+          The original ids are kept in data attributes.
+    -metadata
+          Record the program version, a hash of the topology and the
+          time the map was made, as data attributes on the map.
+    -stable
+          Make the same map for the same topology and config every time,
+          for comparing maps against saved copies. Routes are found in
+          a fixed order by a single worker, ignoring -workers, numbers
+          are all written the same way, and only the hash of the topology
+          is recorded by -metadata.
+    -data location
+          Read the link data from the JSON file or http(s) URL at
+          location, an object of from_data and to_data by link id.
+    -data-command command
+          Run command to collect the link data. It is given the link
+          ids as a JSON array on standard input, and writes the data
+          to standard output in the same format as -data reads. The
+          command is split into its arguments at spaces, unless -data-arg
+          is given.
+    -data-arg arg
+          Pass arg to the -data-command, which is then run as it is
+          given, without splitting it. Repeat the flag for each argument,
+          for arguments with spaces in them.
+    -delta-from path
+          Color the links by the change in their values since the
+          earlier data in the file at path, in the same format as -data
+          reads, instead of by their values.
+    -png
+          Also write the map, and each view, as a PNG with the same name
+          as the output, e.g. "map.png" for "map.svg", for viewers that
+          can't display SVG.
+    -png-command command
+          Run command to convert the map to PNG. It is given the path of
+          the map as SVG, in the output's directory so relative icons are
+          found, and writes the PNG to standard output (default
+          "rsvg-convert").
     -dumpconf
           Dump the config as JSON to stdout and exit.
     -h, -help
@@ -186,14 +738,130 @@ If output isn't set, or has the value '-' the map is written
 to standard output.
 
 Otherwise, the arguments are paths to to the input and output files.
+If the config has views, each view is written next to the output, with
+the name of the view added to the file name, e.g. "map-core.svg".
+
+The positions subcommand finds positions for nodes that don't have one,
+minimizing link length and crossings, and writes out the updated topology.
+Nodes that already have a position are not moved. Its flags are:
+
+    -spacing n
+          Number of cells between node positions (default 2).
+    -iterations n
+          Number of placement moves to try (default 20000).
+    -seed n
+          Seed for the random placement, the same seed gives the same result.
+
+The weathermap subcommand converts a PHP Network Weathermap config to a
+topology. Node positions are fitted to the grid, and nodes that end up in
+the same cell are moved apart, with a warning. Its flags are:
+
+    -cell-size n
+          Number of pixels in each grid cell (default 10).
+    -config-out path
+          Write a config with the map's icons and color scale to path.
+    -targets path
+          Write the targets, bandwidths and info URLs of the links, by
+          link id, as JSON to path.
 `
 
 	io.WriteString(os.Stderr, usage)
 }
 
-func dumpConfig(conf *raumata.RenderConfig) {
+// Returns the version of the program, from the module it was built
+// from
+func version() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok || info.Main.Version == "" {
+		return "(unknown)"
+	}
+	return info.Main.Version
+}
+
+func dumpConfig(conf *raumata.RenderConfig, routerConf *raumata.RouterConfig, labelConf *raumata.LabelConfig) {
 	encoder := json.NewEncoder(os.Stdout)
 	encoder.SetIndent("", "  ")
 
-	encoder.Encode(conf)
+	encoder.Encode(struct {
+		*raumata.RenderConfig
+		Router *raumata.RouterConfig `json:"router"`
+		Labels *raumata.LabelConfig  `json:"labels"`
+	}{conf, routerConf, labelConf})
+}
+
+// Loads the routes from the cache file, returns whether they
+// were loaded
+func loadRouteCache(router *raumata.LinkRouter, path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			fmt.Fprintf(os.Stderr, "Error opening route cache %s: %s\n", path, err)
+		}
+		return false
+	}
+	defer f.Close()
+
+	err = router.LoadCache(f)
+	if err != nil {
+		if !errors.Is(err, raumata.ErrStaleCache) {
+			fmt.Fprintf(os.Stderr, "Error reading route cache %s: %s\n", path, err)
+		}
+		return false
+	}
+
+	return true
+}
+
+// Saves the routes to the cache file, failing to save the cache
+// is not fatal
+func saveRouteCache(router *raumata.LinkRouter, path string) {
+	f, err := os.Create(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating route cache %s: %s\n", path, err)
+		return
+	}
+	defer f.Close()
+
+	if err := router.SaveCache(f); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing route cache %s: %s\n", path, err)
+	}
+}
+
+// Writes the link report to path, as JSON if path has a ".json"
+// extension, otherwise as CSV
+func writeReport(report raumata.LinkReport, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = report.WriteJSON(f)
+	} else {
+		err = report.WriteCSV(f)
+	}
+	if err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+// Writes the topology to path as JSON
+// Writes v as indented JSON to path
+func writeJSON(v any, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	encoder := json.NewEncoder(f)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		return err
+	}
+
+	return f.Close()
 }
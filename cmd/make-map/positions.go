@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/REANNZ/raumata"
+)
+
+// Runs the "positions" subcommand, which fills in missing node
+// positions and writes the topology back out
+func runPositions(args []string) int {
+	config := raumata.DefaultPlacementConfig()
+
+	var spacing int
+	flags := flag.NewFlagSet("positions", flag.ContinueOnError)
+	flags.IntVar(&spacing, "spacing", int(config.Spacing), "cells between node positions")
+	flags.IntVar(&config.Iterations, "iterations", config.Iterations, "number of moves to try")
+	flags.Int64Var(&config.Seed, "seed", config.Seed, "random seed")
+	flags.Usage = printHelp
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	config.Spacing = int16(spacing)
+
+	var in io.Reader = os.Stdin
+	if flags.NArg() > 0 && flags.Arg(0) != "-" {
+		f, err := os.Open(flags.Arg(0))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening file %s: %s\n",
+				flags.Arg(0), err)
+			return 1
+		}
+		defer f.Close()
+		in = f
+	}
+
+	topo := raumata.Topology{}
+
+	decoder := json.NewDecoder(in)
+	if err := decoder.Decode(&topo); err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing topology: %s\n", err)
+		return 1
+	}
+
+	if err := raumata.PlaceNodes(&topo, config); err != nil {
+		fmt.Fprintf(os.Stderr, "Error placing nodes: %s\n", err)
+		return 1
+	}
+	if err := topo.FitMembers(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error fitting nodes to their members: %s\n", err)
+		return 1
+	}
+
+	var out io.Writer = os.Stdout
+	if flags.NArg() > 1 && flags.Arg(1) != "-" {
+		f, err := os.Create(flags.Arg(1))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening file %s: %s\n",
+				flags.Arg(1), err)
+			return 1
+		}
+		defer f.Close()
+		out = f
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(&topo); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing topology: %s\n", err)
+		return 1
+	}
+
+	return 0
+}
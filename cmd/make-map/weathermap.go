@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/REANNZ/raumata"
+	"github.com/REANNZ/raumata/weathermap"
+)
+
+// The data sources of a link in a Weathermap config, written out by
+// the weathermap subcommand for setting up a data source
+type weathermapTargets struct {
+	Targets      []string `json:"targets,omitempty"`
+	BandwidthIn  float64  `json:"bandwidth_in,omitempty"`
+	BandwidthOut float64  `json:"bandwidth_out,omitempty"`
+	InfoURL      string   `json:"infourl,omitempty"`
+}
+
+// Runs the "weathermap" subcommand, which converts a PHP Network
+// Weathermap config to a topology, and optionally a config
+func runWeathermap(args []string) int {
+	var opts weathermap.Options
+	var configOut, targetsOut string
+	flags := flag.NewFlagSet("weathermap", flag.ContinueOnError)
+	flags.IntVar(&opts.CellSize, "cell-size", 10, "pixels in each grid cell")
+	flags.StringVar(&configOut, "config-out", "", "path to write the converted config to")
+	flags.StringVar(&targetsOut, "targets", "", "path to write the link targets to")
+	flags.Usage = printHelp
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	var in io.Reader = os.Stdin
+	if flags.NArg() > 0 && flags.Arg(0) != "-" {
+		f, err := os.Open(flags.Arg(0))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening file %s: %s\n",
+				flags.Arg(0), err)
+			return 1
+		}
+		defer f.Close()
+		in = f
+	}
+
+	m, err := weathermap.Parse(in)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error parsing weathermap config: %s\n", err)
+		return 1
+	}
+
+	res := m.Convert(opts)
+	for _, warning := range res.Warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warning)
+	}
+	if m.Title != "" {
+		fmt.Fprintf(os.Stderr, "The map's title is %q, use -title to add it to the map\n", m.Title)
+	}
+
+	if configOut != "" {
+		if err := writeJSON(res.Config, configOut); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing config: %s\n", err)
+			return 1
+		}
+	}
+
+	if targetsOut != "" {
+		targets := map[string]weathermapTargets{}
+		for _, link := range m.Links {
+			if res.Topology.Links[raumata.LinkId(link.Name)] == nil {
+				continue
+			}
+			targets[link.Name] = weathermapTargets{
+				Targets:      link.Targets,
+				BandwidthIn:  link.BandwidthIn,
+				BandwidthOut: link.BandwidthOut,
+				InfoURL:      link.InfoURL,
+			}
+		}
+		if err := writeJSON(targets, targetsOut); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing targets: %s\n", err)
+			return 1
+		}
+	}
+
+	var out io.Writer = os.Stdout
+	if flags.NArg() > 1 && flags.Arg(1) != "-" {
+		f, err := os.Create(flags.Arg(1))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening file %s: %s\n",
+				flags.Arg(1), err)
+			return 1
+		}
+		defer f.Close()
+		out = f
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(res.Topology); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing topology: %s\n", err)
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,168 @@
+package raumata
+
+import (
+	"slices"
+
+	"github.com/REANNZ/raumata/grid"
+	"github.com/REANNZ/raumata/vec"
+)
+
+// Corridor is a fixed path across the grid that links can be made
+// to follow, such as a submarine cable carrying many circuits. Links
+// following a corridor are routed from their nodes to the nearest end
+// of the corridor, along it, then on to their other node.
+type Corridor struct {
+	// The cells the corridor passes through in order. Cells between
+	// consecutive cells are filled in with diagonal steps, then
+	// straight steps, so only the corners need to be given.
+	Cells [][2]int16 `json:"cells"`
+}
+
+// Path returns every cell along the corridor, in order
+func (c *Corridor) Path() []grid.Pos {
+	path := make([]grid.Pos, 0, len(c.Cells))
+
+	for i, cell := range c.Cells {
+		pos := grid.Pos{X: cell[0], Y: cell[1]}
+		if i == 0 {
+			path = append(path, pos)
+			continue
+		}
+
+		cur := path[len(path)-1]
+		for cur != pos {
+			cur.X += sign(pos.X - cur.X)
+			cur.Y += sign(pos.Y - cur.Y)
+			path = append(path, cur)
+		}
+	}
+
+	return path
+}
+
+// Returns the cells of the link's corridor in the order the link
+// follows it, or nil if the link doesn't follow a known corridor.
+//
+// The corridor is followed in the direction that needs the shortest
+// routes onto and off it, from the last anchor before the corridor,
+// or the "from" node, to the first anchor after it, or the "to" node.
+func (t *Topology) corridorPath(link *Link) []grid.Pos {
+	if link.Corridor == "" {
+		return nil
+	}
+	corridor := t.Corridors[link.Corridor]
+	if corridor == nil || len(corridor.Cells) == 0 {
+		return nil
+	}
+	path := corridor.Path()
+
+	var entry, exit *grid.Pos
+	if n := len(link.Via); n > 0 {
+		entry = &grid.Pos{X: link.Via[n-1][0], Y: link.Via[n-1][1]}
+	} else if n := len(link.RoutePrefix); n > 0 {
+		entry = &grid.Pos{X: link.RoutePrefix[n-1][0], Y: link.RoutePrefix[n-1][1]}
+	} else if from := t.GetNode(link.From); from != nil && from.Pos != nil {
+		entry = &grid.Pos{X: from.Pos[0], Y: from.Pos[1]}
+	}
+	if len(link.RouteSuffix) > 0 {
+		exit = &grid.Pos{X: link.RouteSuffix[0][0], Y: link.RouteSuffix[0][1]}
+	} else if to := t.GetNode(link.To); to != nil && to.Pos != nil {
+		exit = &grid.Pos{X: to.Pos[0], Y: to.Pos[1]}
+	}
+
+	if entry != nil && exit != nil {
+		first, last := path[0], path[len(path)-1]
+		forward := entry.EuclideanDistance(first) + last.EuclideanDistance(*exit)
+		reverse := entry.EuclideanDistance(last) + first.EuclideanDistance(*exit)
+		if reverse < forward {
+			slices.Reverse(path)
+		}
+	}
+
+	return path
+}
+
+func sign(v int16) int16 {
+	switch {
+	case v < 0:
+		return -1
+	case v > 0:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// The part of a link's route along a corridor shared with other
+// links, and how far to move it sideways so the links are drawn side
+// by side
+type corridorFan struct {
+	cells  map[grid.Pos]bool
+	offset float32
+}
+
+// Works out the offsets for links following the same corridor, so
+// they fan out along it, spacing apart, centered on the corridor.
+// The links must be sorted by id. Links are on the same side of the
+// corridor whichever way they follow it.
+func corridorFans(t *Topology, links []*Link, spacing float32) map[LinkId]corridorFan {
+	corridors := map[string][]*Link{}
+	for _, link := range links {
+		if len(link.Route) < 2 || t.Corridors[link.Corridor] == nil {
+			continue
+		}
+		corridors[link.Corridor] = append(corridors[link.Corridor], link)
+	}
+
+	fans := map[LinkId]corridorFan{}
+	for name, corridorLinks := range corridors {
+		if len(corridorLinks) < 2 {
+			continue
+		}
+
+		path := t.Corridors[name].Path()
+		cells := map[grid.Pos]bool{}
+		for _, pos := range path {
+			cells[pos] = true
+		}
+
+		center := float32(len(corridorLinks)-1) / 2
+		for i, link := range corridorLinks {
+			offset := (float32(i) - center) * spacing
+			if linkPath := t.corridorPath(link); len(linkPath) > 0 && linkPath[0] != path[0] {
+				offset = -offset
+			}
+			fans[link.Id] = corridorFan{cells: cells, offset: offset}
+		}
+	}
+
+	return fans
+}
+
+// Moves the part of the route along the corridor sideways by the
+// fan's offset, scale converts the offset to grid units
+func (f corridorFan) apply(route vec.Polyline, scale float32) vec.Polyline {
+	first, last := -1, -1
+	for i, p := range route {
+		if f.cells[grid.FromVec(p)] {
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+	}
+	// The ends stay attached to the nodes
+	first = max(first, 1)
+	last = min(last, len(route)-2)
+	if last-first < 1 || f.offset == 0 {
+		return route
+	}
+
+	section := route[first : last+1].Simplify().Offset(f.offset / scale)
+
+	fanned := make(vec.Polyline, 0, len(route))
+	fanned = append(fanned, route[:first]...)
+	fanned = append(fanned, section...)
+	fanned = append(fanned, route[last+1:]...)
+	return fanned
+}
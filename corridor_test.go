@@ -0,0 +1,193 @@
+package raumata_test
+
+import (
+	"encoding/json"
+	"math"
+	"slices"
+	"strings"
+	"testing"
+
+	. "github.com/REANNZ/raumata"
+	"github.com/REANNZ/raumata/canvas"
+	"github.com/REANNZ/raumata/grid"
+	"github.com/REANNZ/raumata/vec"
+)
+
+func TestCorridorPath(t *testing.T) {
+	corridor := &Corridor{Cells: [][2]int16{{0, 0}, {2, 3}, {5, 3}}}
+
+	expected := []grid.Pos{
+		{X: 0, Y: 0}, {X: 1, Y: 1}, {X: 2, Y: 2}, {X: 2, Y: 3},
+		{X: 3, Y: 3}, {X: 4, Y: 3}, {X: 5, Y: 3},
+	}
+	if path := corridor.Path(); !slices.Equal(path, expected) {
+		t.Errorf("Incorrect corridor path, expected %v, got %v", expected, path)
+	}
+}
+
+func TestLinkRouterCorridor(t *testing.T) {
+	data := `{
+		"nodes": {
+			"A": {"pos": [0, 0]},
+			"B": {"pos": [12, 0]},
+			"C": {"pos": [0, 6]},
+			"D": {"pos": [12, 6]}
+		},
+		"links": [
+			{"from": "A", "to": "B", "corridor": "cable"},
+			{"from": "D", "to": "C", "corridor": "cable"}
+		],
+		"corridors": {
+			"cable": {"cells": [[3, 3], [9, 3]]}
+		}
+	}`
+
+	topo := Topology{}
+	if err := json.Unmarshal([]byte(data), &topo); err != nil {
+		t.Fatalf("Error parsing topology: %s", err)
+	}
+
+	NewLinkRouter(&topo).RouteLinks()
+
+	cable := topo.Corridors["cable"].Path()
+	reversed := slices.Clone(cable)
+	slices.Reverse(reversed)
+
+	// Returns whether the route follows the cells in order
+	follows := func(id LinkId, cells []grid.Pos) bool {
+		route := topo.Links[id].Route
+		i := slices.IndexFunc(route, func(p vec.Vec2) bool {
+			return grid.FromVec(p) == cells[0]
+		})
+		if i < 0 || i+len(cells) > len(route) {
+			return false
+		}
+		for j, cell := range cells {
+			if grid.FromVec(route[i+j]) != cell {
+				return false
+			}
+		}
+		return true
+	}
+
+	if !follows("A-B", cable) {
+		t.Errorf("A-B doesn't follow the corridor, got %v", topo.Links["A-B"].Route)
+	}
+	// D is nearer the east end of the corridor, so D-C follows it
+	// from east to west
+	if !follows("D-C", reversed) {
+		t.Errorf("D-C doesn't follow the corridor backwards, got %v", topo.Links["D-C"].Route)
+	}
+
+	// Following a corridor that doesn't exist is an error
+	data = `{"nodes": {"A": {"pos": [0, 0]}, "B": {"pos": [4, 0]}},
+		"links": [{"from": "A", "to": "B", "corridor": "cabel"}]}`
+	err := json.Unmarshal([]byte(data), &Topology{})
+	if err == nil || !strings.Contains(err.Error(), "cabel") {
+		t.Errorf("Expected an error for the unknown corridor, got %v", err)
+	}
+}
+
+func TestLinkRouterCorridorSmooth(t *testing.T) {
+	data := `{
+		"nodes": {
+			"A": {"pos": [0, 0]},
+			"B": {"pos": [3, 3]}
+		},
+		"links": [
+			{"from": "A", "to": "B", "corridor": "stairs"}
+		],
+		"corridors": {
+			"stairs": {"cells": [[1, 0], [1, 1], [2, 1], [2, 2], [3, 2]]}
+		}
+	}`
+
+	topo := Topology{}
+	if err := json.Unmarshal([]byte(data), &topo); err != nil {
+		t.Fatalf("Error parsing topology: %s", err)
+	}
+
+	router := NewLinkRouter(&topo)
+	router.Smooth = true
+	router.RouteLinks()
+
+	// Smoothing would otherwise cut the corners of the staircase
+	route := topo.Links["A-B"].Route
+	for _, cell := range topo.Corridors["stairs"].Path() {
+		onRoute := slices.ContainsFunc(route, func(p vec.Vec2) bool {
+			return grid.FromVec(p) == cell
+		})
+		if !onRoute {
+			t.Errorf("Expected the smoothed route to follow the corridor through %v, got %v", cell, route)
+		}
+	}
+}
+
+func TestRenderCorridorFan(t *testing.T) {
+	data := `{
+		"nodes": {
+			"A": {"pos": [0, 0]},
+			"B": {"pos": [12, 0]},
+			"C": {"pos": [0, 6]},
+			"D": {"pos": [12, 6]}
+		},
+		"links": [
+			{"from": "A", "to": "B", "corridor": "cable"},
+			{"from": "D", "to": "C", "corridor": "cable"}
+		],
+		"corridors": {
+			"cable": {"cells": [[3, 3], [9, 3]]}
+		}
+	}`
+
+	topo := Topology{}
+	if err := json.Unmarshal([]byte(data), &topo); err != nil {
+		t.Fatalf("Error parsing topology: %s", err)
+	}
+	NewLinkRouter(&topo).RouteLinks()
+
+	renderer := NewRenderer()
+	renderer.SetScale(10)
+	renderer.Config.BundleSpacing = 4
+	if _, err := renderer.RenderTopology(&topo); err != nil {
+		t.Fatalf("Error rendering topology: %s", err)
+	}
+
+	// The average height of the drawn link in the middle of the
+	// corridor, where the links are split
+	middle := func(id LinkId) float32 {
+		obj, err := renderer.RenderLink(topo.Links[id])
+		if err != nil {
+			t.Fatalf("Error rendering link: %s", err)
+		}
+		c := canvas.NewCanvas()
+		c.AppendChild(obj)
+
+		var sum float32
+		count := 0
+		for _, op := range c.Flatten() {
+			for _, contour := range op.Contours {
+				for _, p := range contour.Points {
+					if p.X > 45 && p.X < 75 {
+						sum += p.Y
+						count++
+					}
+				}
+			}
+		}
+		if count == 0 {
+			t.Fatalf("No points in the middle of %s", id)
+		}
+		return sum / float32(count)
+	}
+
+	// The links are drawn either side of the corridor, even though
+	// they follow it in opposite directions
+	ab, dc := middle("A-B"), middle("D-C")
+	if d := math.Abs(float64(ab - dc)); d < 3.5 || d > 4.5 {
+		t.Errorf("Expected the links 4 apart along the corridor, got %v and %v", ab, dc)
+	}
+	if math.Abs(float64(ab+dc-60)) > 0.5 {
+		t.Errorf("Expected the links centered on the corridor, got %v and %v", ab, dc)
+	}
+}
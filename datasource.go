@@ -0,0 +1,65 @@
+package raumata
+
+import (
+	"context"
+	"slices"
+)
+
+// LinkDataUpdate is new data for both directions of a link.
+// Directions left nil keep their current data.
+type LinkDataUpdate struct {
+	FromData *LinkData `json:"from_data,omitempty"`
+	ToData   *LinkData `json:"to_data,omitempty"`
+}
+
+// DataSource fetches the current data of links, such as their
+// utilization, from a monitoring system. Links the source has no data
+// for are left out of the result. The datasource sub-package has
+// sources for common systems.
+type DataSource interface {
+	FetchLinkData(ctx context.Context, links []LinkId) (map[LinkId]LinkDataUpdate, error)
+}
+
+// DataSourceFunc is a function that can be used as a [DataSource]
+type DataSourceFunc func(ctx context.Context, links []LinkId) (map[LinkId]LinkDataUpdate, error)
+
+func (f DataSourceFunc) FetchLinkData(ctx context.Context, links []LinkId) (map[LinkId]LinkDataUpdate, error) {
+	return f(ctx, links)
+}
+
+// ApplyData sets the data of the links from the updates. Updates for
+// links not in the topology are ignored.
+func (t *Topology) ApplyData(updates map[LinkId]LinkDataUpdate) {
+	for id, update := range updates {
+		link := t.GetLink(id)
+		if link == nil {
+			continue
+		}
+		if update.FromData != nil {
+			link.FromData = update.FromData
+		}
+		if update.ToData != nil {
+			link.ToData = update.ToData
+		}
+	}
+}
+
+// FetchData fetches the data of all the links in the topology from
+// the source, and applies it
+func (t *Topology) FetchData(ctx context.Context, source DataSource) error {
+	links := make([]LinkId, 0, len(t.Links))
+	for id, link := range t.Links {
+		if link != nil {
+			links = append(links, id)
+		}
+	}
+	// Sources see the links in the same order every time
+	slices.Sort(links)
+
+	updates, err := source.FetchLinkData(ctx, links)
+	if err != nil {
+		return err
+	}
+	t.ApplyData(updates)
+	return nil
+}
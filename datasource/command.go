@@ -0,0 +1,46 @@
+package datasource
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/REANNZ/raumata"
+)
+
+// Command runs an external program to collect the link data. The ids
+// of the links are written to its standard input as a JSON array, and
+// it writes the data to its standard output in the same format as
+// [JSON] reads.
+type Command struct {
+	Name string
+	Args []string
+}
+
+func (c *Command) FetchLinkData(ctx context.Context, links []raumata.LinkId) (map[raumata.LinkId]raumata.LinkDataUpdate, error) {
+	ids, err := json.Marshal(links)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, c.Name, c.Args...)
+	cmd.Stdin = bytes.NewReader(ids)
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("Error running %s: %w: %s", c.Name, err, msg)
+		}
+		return nil, fmt.Errorf("Error running %s: %w", c.Name, err)
+	}
+
+	updates := map[raumata.LinkId]raumata.LinkDataUpdate{}
+	if err := json.Unmarshal(out, &updates); err != nil {
+		return nil, fmt.Errorf("Error parsing link data from %s: %w", c.Name, err)
+	}
+	return filter(updates, links), nil
+}
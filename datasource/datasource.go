@@ -0,0 +1,22 @@
+// Package datasource provides [raumata.DataSource] implementations,
+// fetching link data from files and URLs, external commands, and
+// Prometheus.
+//
+// Collectors for other systems, such as SNMP pollers, can be plugged
+// in without writing Go by running them as a [Command].
+package datasource
+
+import (
+	"github.com/REANNZ/raumata"
+)
+
+// Returns the updates for the links asked for
+func filter(updates map[raumata.LinkId]raumata.LinkDataUpdate, links []raumata.LinkId) map[raumata.LinkId]raumata.LinkDataUpdate {
+	filtered := make(map[raumata.LinkId]raumata.LinkDataUpdate, len(links))
+	for _, id := range links {
+		if update, ok := updates[id]; ok {
+			filtered[id] = update
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,102 @@
+package datasource_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/REANNZ/raumata"
+	"github.com/REANNZ/raumata/datasource"
+)
+
+var links = []raumata.LinkId{"A-B", "B-C"}
+
+func TestJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.json")
+	data := `{"A-B": {"from_data": {"value": 0.5, "label": "5G"}}, "X-Y": {"to_data": {"value": 1}}}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	updates, err := (&datasource.JSON{Location: path}).FetchLinkData(context.Background(), links)
+	if err != nil {
+		t.Fatalf("Error fetching data: %s", err)
+	}
+	if len(updates) != 1 || updates["A-B"].FromData == nil || updates["A-B"].FromData.Label != "5G" {
+		t.Errorf("Expected only the data for A-B, got %v", updates)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(data))
+	}))
+	defer ts.Close()
+	updates, err = (&datasource.JSON{Location: ts.URL}).FetchLinkData(context.Background(), links)
+	if err != nil || len(updates) != 1 {
+		t.Errorf("Expected the data for A-B from the URL, got %v, %v", updates, err)
+	}
+}
+
+func TestCommand(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("No shell to run the command with")
+	}
+
+	source := &datasource.Command{
+		Name: "sh",
+		Args: []string{"-c", `grep -q '"B-C"' && echo '{"B-C": {"to_data": {"value": 0.25}}}'`},
+	}
+	updates, err := source.FetchLinkData(context.Background(), links)
+	if err != nil {
+		t.Fatalf("Error fetching data: %s", err)
+	}
+	if data := updates["B-C"].ToData; data == nil || data.Value.Value != 0.25 {
+		t.Errorf("Expected the data for B-C, got %v", updates)
+	}
+
+	source.Args = []string{"-c", "echo broken >&2; exit 1"}
+	if _, err := source.FetchLinkData(context.Background(), links); err == nil {
+		t.Errorf("Expected an error from a failing command")
+	}
+}
+
+func TestPrometheus(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("query") {
+		case `out{link="A-B"}`:
+			w.Write([]byte(`{"status": "success", "data": {"resultType": "vector", "result": [{"metric": {}, "value": [1700000000, "0.75"]}]}}`))
+		case `bad{link="A-B"}`:
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"status": "error", "error": "parse error"}`))
+		default:
+			w.Write([]byte(`{"status": "success", "data": {"resultType": "vector", "result": []}}`))
+		}
+	}))
+	defer ts.Close()
+
+	source := &datasource.Prometheus{
+		URL:         ts.URL,
+		FromQuery:   `out{link="$link"}`,
+		ToQuery:     `in{link="$link"}`,
+		LabelFormat: "%.0f%%",
+	}
+	updates, err := source.FetchLinkData(context.Background(), links)
+	if err != nil {
+		t.Fatalf("Error fetching data: %s", err)
+	}
+	if len(updates) != 1 {
+		t.Errorf("Expected only data for A-B, got %v", updates)
+	}
+	update := updates["A-B"]
+	if update.FromData == nil || update.FromData.Value.Value != 0.75 || update.ToData != nil {
+		t.Errorf("Expected the from direction of A-B, got %+v", update)
+	}
+
+	source.FromQuery = `bad{link="$link"}`
+	if _, err := source.FetchLinkData(context.Background(), links); err == nil {
+		t.Errorf("Expected an error for a bad query")
+	}
+}
@@ -0,0 +1,61 @@
+package datasource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/REANNZ/raumata"
+)
+
+// JSON reads link data from a file or URL, as a JSON object of
+// [raumata.LinkDataUpdate] by link id. This is the same format the
+// server package takes for PUT /maps/{name}/data, for example:
+//
+//	{"A-B": {"from_data": {"value": 0.42, "label": "4.2G"}}}
+type JSON struct {
+	// The path of the file, or an http or https URL
+	Location string
+	// The client used to fetch URLs, http.DefaultClient if nil
+	Client *http.Client
+}
+
+func (j *JSON) FetchLinkData(ctx context.Context, links []raumata.LinkId) (map[raumata.LinkId]raumata.LinkDataUpdate, error) {
+	var in io.ReadCloser
+	if strings.HasPrefix(j.Location, "http://") || strings.HasPrefix(j.Location, "https://") {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.Location, nil)
+		if err != nil {
+			return nil, err
+		}
+		client := j.Client
+		if client == nil {
+			client = http.DefaultClient
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("Error fetching link data from %s: %s", j.Location, resp.Status)
+		}
+		in = resp.Body
+	} else {
+		f, err := os.Open(j.Location)
+		if err != nil {
+			return nil, err
+		}
+		in = f
+	}
+	defer in.Close()
+
+	updates := map[raumata.LinkId]raumata.LinkDataUpdate{}
+	if err := json.NewDecoder(in).Decode(&updates); err != nil {
+		return nil, fmt.Errorf("Error parsing link data from %s: %w", j.Location, err)
+	}
+	return filter(updates, links), nil
+}
@@ -0,0 +1,156 @@
+package datasource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/REANNZ/raumata"
+)
+
+// The most queries sent to Prometheus at once
+const prometheusConcurrency = 8
+
+// Prometheus queries a Prometheus server for the values of the links.
+// Each direction of each link is an instant query, with "$link" in
+// the query replaced by the id of the link, for example:
+//
+//	max(rate(ifHCOutOctets{link="$link"}[5m]) * 8 / ifSpeed{link="$link"})
+//
+// The id is escaped for use inside a quoted string. Queries with no
+// result leave the direction's data unchanged.
+type Prometheus struct {
+	// The base URL of the server, e.g. "http://prometheus:9090"
+	URL       string `json:"url"`
+	FromQuery string `json:"from-query,omitempty"`
+	ToQuery   string `json:"to-query,omitempty"`
+	// Formats the value as the label of the link, e.g. "%.2f". No
+	// label is set if empty.
+	LabelFormat string `json:"label-format,omitempty"`
+	// The client used for the queries, http.DefaultClient if nil
+	Client *http.Client `json:"-"`
+}
+
+// The parts of the query API response that are used
+type prometheusResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error"`
+	Data   struct {
+		Result []struct {
+			Value [2]any `json:"value"`
+		} `json:"result"`
+	} `json:"data"`
+}
+
+var promStringEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+func (p *Prometheus) FetchLinkData(ctx context.Context, links []raumata.LinkId) (map[raumata.LinkId]raumata.LinkDataUpdate, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	var firstErr error
+	updates := map[raumata.LinkId]raumata.LinkDataUpdate{}
+
+	sem := make(chan struct{}, prometheusConcurrency)
+	var wg sync.WaitGroup
+	for _, id := range links {
+		for _, toDir := range []bool{false, true} {
+			query := p.FromQuery
+			if toDir {
+				query = p.ToQuery
+			}
+			if query == "" {
+				continue
+			}
+			query = strings.ReplaceAll(query, "$link", promStringEscaper.Replace(string(id)))
+
+			wg.Add(1)
+			sem <- struct{}{}
+			go func() {
+				defer wg.Done()
+				defer func() { <-sem }()
+
+				data, err := p.query(ctx, query)
+
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					if firstErr == nil {
+						firstErr = fmt.Errorf("Error fetching data for link %s: %w", id, err)
+						cancel()
+					}
+					return
+				}
+				if data == nil {
+					return
+				}
+				update := updates[id]
+				if toDir {
+					update.ToData = data
+				} else {
+					update.FromData = data
+				}
+				updates[id] = update
+			}()
+		}
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return updates, nil
+}
+
+// Runs the instant query, returning the data from its first result,
+// or nil if it has none
+func (p *Prometheus) query(ctx context.Context, query string) (*raumata.LinkData, error) {
+	u := strings.TrimSuffix(p.URL, "/") + "/api/v1/query?" + url.Values{"query": {query}}.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result := prometheusResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("%s: %w", resp.Status, err)
+	}
+	if result.Status != "success" {
+		return nil, fmt.Errorf("%s: %s", resp.Status, result.Error)
+	}
+	if len(result.Data.Result) == 0 {
+		return nil, nil
+	}
+
+	// Values are sent as strings, to keep NaN and infinities
+	s, ok := result.Data.Result[0].Value[1].(string)
+	if !ok {
+		return nil, fmt.Errorf("Unexpected value %v", result.Data.Result[0].Value[1])
+	}
+	value, err := strconv.ParseFloat(s, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	data := &raumata.LinkData{}
+	data.Value.Set(float32(value))
+	if p.LabelFormat != "" {
+		data.Label = fmt.Sprintf(p.LabelFormat, value)
+	}
+	return data, nil
+}
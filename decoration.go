@@ -0,0 +1,92 @@
+package raumata
+
+import (
+	"github.com/REANNZ/raumata/canvas"
+	"github.com/REANNZ/raumata/vec"
+)
+
+// Decoration is something drawn at a fixed place on the map, such as
+// a logo or an inset box, that isn't part of the topology. Unlike
+// nodes, decorations are positioned and sized in canvas units, so
+// they aren't affected by the scale of the grid.
+//
+// A decoration is a box with an optional image and text in it. The
+// box is only drawn if it has a style.
+type Decoration struct {
+	Id string `json:"id,omitempty"`
+	// The corner or edge of the map the decoration is placed at, the
+	// same corner or edge of the decoration is put there. For
+	// example "ne" puts the decoration in the top-right corner. If
+	// not set, the top-left corner is used.
+	Anchor Direction `json:"anchor,omitempty"`
+	// The offset of the decoration from the anchor, in canvas units
+	Offset [2]float32 `json:"offset,omitempty"`
+	Width  float32    `json:"width"`
+	Height float32    `json:"height"`
+	// The URL of an image to fill the box, which can be a data URI
+	Image string `json:"image,omitempty"`
+	// Text drawn in the middle of the box
+	Text     string  `json:"text,omitempty"`
+	TextSize float32 `json:"text_size,omitempty"`
+	// A class added to the decoration, for styling
+	Class string        `json:"class,omitempty"`
+	Style *canvas.Style `json:"style,omitempty"`
+}
+
+// RenderDecorations renders the decorations placed around bounds,
+// which is typically the bounding box of the rendered topology.
+// Returns nil if there are no decorations.
+func (r *Renderer) RenderDecorations(decorations []*Decoration, bounds *canvas.AABB) canvas.Object {
+	if len(decorations) == 0 || bounds == nil {
+		return nil
+	}
+
+	minPos, maxPos := bounds.Bounds()
+
+	group := canvas.NewGroup()
+	group.Attributes.Id = "decorations"
+
+	for _, d := range decorations {
+		if d == nil {
+			continue
+		}
+
+		// The anchor picks a point on the map and the matching point
+		// on the decoration, e.g. the right edge for east
+		size := vec.Vec2{X: d.Width, Y: d.Height}
+		align := d.Anchor.AsVec().Add(vec.Vec2{X: 1, Y: 1}).Div(2)
+		if d.Anchor == DirectionNone {
+			align = vec.Vec2{}
+		}
+		extent := maxPos.Sub(minPos)
+		pos := vec.Vec2{
+			X: minPos.X + (extent.X-d.Width)*align.X + d.Offset[0],
+			Y: minPos.Y + (extent.Y-d.Height)*align.Y + d.Offset[1],
+		}
+
+		decoration := canvas.NewGroup()
+		decoration.Attributes.Id = r.svgName(d.Id)
+		decoration.Attributes.AddClass("decoration")
+		r.addClass(&decoration.Attributes, d.Class)
+
+		if d.Style != nil {
+			box := canvas.NewRect(pos, d.Width, d.Height)
+			box.Attributes.Style = d.Style
+			decoration.AppendChild(box)
+		}
+		if d.Image != "" {
+			decoration.AppendChild(canvas.NewImage(pos, d.Width, d.Height, d.Image))
+		}
+		if d.Text != "" {
+			text := canvas.NewText(pos.Add(size.Div(2)), d.Text)
+			text.Size = d.TextSize
+			text.Anchor = canvas.TextAnchorMiddle
+			text.Baseline = canvas.TextBaselineMiddle
+			decoration.AppendChild(text)
+		}
+
+		group.AppendChild(decoration)
+	}
+
+	return group
+}
@@ -0,0 +1,57 @@
+package raumata
+
+import (
+	"fmt"
+
+	"github.com/REANNZ/raumata/canvas"
+)
+
+// Snapshot returns the current data of the links, so it can be
+// compared with later data by [DeltaData]
+func (t *Topology) Snapshot() map[LinkId]LinkDataUpdate {
+	snapshot := make(map[LinkId]LinkDataUpdate, len(t.Links))
+	for id, link := range t.Links {
+		if link != nil {
+			snapshot[id] = LinkDataUpdate{FromData: link.FromData, ToData: link.ToData}
+		}
+	}
+	return snapshot
+}
+
+// DeltaData returns the change in the value of each direction of each
+// link from before to after, for drawing a map of where traffic has
+// moved, such as after a failover. Each direction's value is the
+// change, its color is the change on the scale, and its label is the
+// change as a percentage, e.g. "+25%". If scale is nil, a
+// [canvas.DivergingColorScale] is used.
+//
+// Every link in after is in the result. Directions without a value in
+// both snapshots have empty data, so applying the result to a topology
+// with [Topology.ApplyData] clears their old values.
+func DeltaData(before, after map[LinkId]LinkDataUpdate, scale *canvas.ColorScale) map[LinkId]LinkDataUpdate {
+	if scale == nil {
+		scale = canvas.DivergingColorScale()
+	}
+
+	delta := func(before, after *LinkData) *LinkData {
+		data := &LinkData{}
+		if before == nil || after == nil || !before.Value.Valid || !after.Value.Valid {
+			return data
+		}
+		change := after.Value.Value - before.Value.Value
+		data.Value.Set(change)
+		data.Color.SetColor(scale.GetColor(change))
+		data.Label = fmt.Sprintf("%+.0f%%", change*100)
+		return data
+	}
+
+	deltas := make(map[LinkId]LinkDataUpdate, len(after))
+	for id, a := range after {
+		b := before[id]
+		deltas[id] = LinkDataUpdate{
+			FromData: delta(b.FromData, a.FromData),
+			ToData:   delta(b.ToData, a.ToData),
+		}
+	}
+	return deltas
+}
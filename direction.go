@@ -1,92 +1,139 @@
 package raumata
 
 import (
+	"fmt"
 	"strings"
 
-	"github.com/REANNZ/raumata/internal"
+	"github.com/REANNZ/raumata/grid"
 	"github.com/REANNZ/raumata/vec"
 )
 
-// Helper type for handling compass directions
-type direction int
+// Direction is a compass direction on the grid, such as where a
+// node's label goes or which side of a node a link attaches to.
+//
+// In JSON, directions are strings such as "n" or "north", see
+// [ParseDirection].
+type Direction int
 
 const (
-	directionNone direction = iota
-	directionN
-	directionNE
-	directionE
-	directionSE
-	directionS
-	directionSW
-	directionW
-	directionNW
+	DirectionNone Direction = iota
+	DirectionN
+	DirectionNE
+	DirectionE
+	DirectionSE
+	DirectionS
+	DirectionSW
+	DirectionW
+	DirectionNW
+	// The middle of the node, only used for the titles of
+	// multi-cell nodes
+	DirectionCenter
 )
 
-func directionFromString(s string) direction {
+// ParseDirection parses a direction, either abbreviated, e.g. "ne",
+// or in full, e.g. "northeast" or "north-east", ignoring case. An
+// empty string is [DirectionNone], anything else unknown is an error.
+func ParseDirection(s string) (Direction, error) {
+	dir := directionFromString(s)
+	if dir == DirectionNone && s != "" {
+		return DirectionNone, fmt.Errorf("Unknown direction '%s'", s)
+	}
+	return dir, nil
+}
+
+func directionFromString(s string) Direction {
 	switch strings.ToLower(s) {
 	case "n", "north":
-		return directionN
+		return DirectionN
 	case "ne", "northeast", "north-east":
-		return directionNE
+		return DirectionNE
 	case "e", "east":
-		return directionE
+		return DirectionE
 	case "se", "southeast", "south-east":
-		return directionSE
+		return DirectionSE
 	case "s", "south":
-		return directionS
+		return DirectionS
 	case "sw", "southwest", "south-west":
-		return directionSW
+		return DirectionSW
 	case "w", "west":
-		return directionW
+		return DirectionW
 	case "nw", "northwest", "north-west":
-		return directionNW
+		return DirectionNW
+	case "c", "center", "centre":
+		return DirectionCenter
+	default:
+		return DirectionNone
+	}
+}
+
+// Returns the direction of a single step on the grid, with
+// Y-values increasing going south
+func directionFromStep(dx, dy int16) Direction {
+	switch {
+	case dx == 0 && dy < 0:
+		return DirectionN
+	case dx > 0 && dy < 0:
+		return DirectionNE
+	case dx > 0 && dy == 0:
+		return DirectionE
+	case dx > 0 && dy > 0:
+		return DirectionSE
+	case dx == 0 && dy > 0:
+		return DirectionS
+	case dx < 0 && dy > 0:
+		return DirectionSW
+	case dx < 0 && dy == 0:
+		return DirectionW
+	case dx < 0 && dy < 0:
+		return DirectionNW
 	default:
-		return directionNone
+		return DirectionNone
 	}
 }
 
-func (d direction) Opposite() direction {
+// Opposite returns the direction pointing the other way
+func (d Direction) Opposite() Direction {
 	switch d {
-	case directionN:
-		return directionS
-	case directionNE:
-		return directionSW
-	case directionE:
-		return directionW
-	case directionSE:
-		return directionNW
-	case directionS:
-		return directionN
-	case directionSW:
-		return directionNE
-	case directionW:
-		return directionE
-	case directionNW:
-		return directionSE
+	case DirectionN:
+		return DirectionS
+	case DirectionNE:
+		return DirectionSW
+	case DirectionE:
+		return DirectionW
+	case DirectionSE:
+		return DirectionNW
+	case DirectionS:
+		return DirectionN
+	case DirectionSW:
+		return DirectionNE
+	case DirectionW:
+		return DirectionE
+	case DirectionNW:
+		return DirectionSE
 	default:
 		return d
 	}
 }
 
-// Returns the direction as a vector.
+// AsVec returns the direction as a vector.
 // Y-values increase as you go south
-func (d direction) AsVec() vec.Vec2 {
+func (d Direction) AsVec() vec.Vec2 {
 	switch d {
-	case directionN:
+	case DirectionN:
 		return vec.Vec2{X: 0, Y: -1}
-	case directionNE:
+	case DirectionNE:
 		return vec.Vec2{X: 1, Y: -1}
-	case directionE:
+	case DirectionE:
 		return vec.Vec2{X: 1, Y: 0}
-	case directionSE:
+	case DirectionSE:
 		return vec.Vec2{X: 1, Y: 1}
-	case directionS:
+	case DirectionS:
 		return vec.Vec2{X: 0, Y: 1}
-	case directionSW:
+	case DirectionSW:
 		return vec.Vec2{X: -1, Y: 1}
-	case directionW:
+	case DirectionW:
 		return vec.Vec2{X: -1, Y: 0}
-	case directionNW:
+	case DirectionNW:
 		return vec.Vec2{X: -1, Y: -1}
 	default:
 		return vec.Vec2{}
@@ -94,34 +141,55 @@ func (d direction) AsVec() vec.Vec2 {
 }
 
 // Returns the given grid position moved by the direction
-func (d direction) moveGridPos(p internal.GridPos) internal.GridPos {
+func (d Direction) moveGridPos(p grid.Pos) grid.Pos {
 	v := d.AsVec()
 
-	return internal.GridPos{
+	return grid.Pos{
 		X: p.X + int16(v.X),
 		Y: p.Y + int16(v.Y),
 	}
 }
 
-func (d direction) String() string {
+func (d Direction) String() string {
 	switch d {
-	case directionN:
+	case DirectionN:
 		return "n"
-	case directionNE:
+	case DirectionNE:
 		return "ne"
-	case directionE:
+	case DirectionE:
 		return "e"
-	case directionSE:
+	case DirectionSE:
 		return "se"
-	case directionS:
+	case DirectionS:
 		return "s"
-	case directionSW:
+	case DirectionSW:
 		return "sw"
-	case directionW:
+	case DirectionW:
 		return "w"
-	case directionNW:
+	case DirectionNW:
 		return "nw"
+	case DirectionCenter:
+		return "c"
 	default:
 		return ""
 	}
 }
+
+// IsCardinal returns whether the direction is north, east, south
+// or west
+func (d Direction) IsCardinal() bool {
+	return d == DirectionN || d == DirectionE || d == DirectionS || d == DirectionW
+}
+
+func (d Direction) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Direction) UnmarshalText(text []byte) error {
+	dir, err := ParseDirection(string(text))
+	if err != nil {
+		return err
+	}
+	*d = dir
+	return nil
+}
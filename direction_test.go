@@ -0,0 +1,68 @@
+package raumata_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/REANNZ/raumata"
+	"github.com/REANNZ/raumata/vec"
+)
+
+func TestParseDirection(t *testing.T) {
+	tests := map[string]Direction{
+		"":           DirectionNone,
+		"n":          DirectionN,
+		"NE":         DirectionNE,
+		"east":       DirectionE,
+		"south-east": DirectionSE,
+		"southwest":  DirectionSW,
+		"c":          DirectionCenter,
+	}
+
+	for s, expected := range tests {
+		dir, err := ParseDirection(s)
+		if err != nil {
+			t.Errorf("Error parsing %q: %s", s, err)
+		} else if dir != expected {
+			t.Errorf("Expected %q to parse as %v, got %v", s, expected, dir)
+		}
+	}
+
+	if _, err := ParseDirection("up"); err == nil {
+		t.Errorf("Expected an error parsing an unknown direction")
+	}
+}
+
+func TestDirectionVectors(t *testing.T) {
+	if v := DirectionNW.AsVec(); v != (vec.Vec2{X: -1, Y: -1}) {
+		t.Errorf("Incorrect vector for nw, got %v", v)
+	}
+	if d := DirectionSW.Opposite(); d != DirectionNE {
+		t.Errorf("Expected the opposite of sw to be ne, got %v", d)
+	}
+	if !DirectionW.IsCardinal() || DirectionSE.IsCardinal() {
+		t.Errorf("Incorrect cardinal directions")
+	}
+}
+
+func TestDirectionJSON(t *testing.T) {
+	node := Node{}
+	if err := json.Unmarshal([]byte(`{"label_at": "north-west"}`), &node); err != nil {
+		t.Fatalf("Error parsing node: %s", err)
+	}
+	if node.LabelAt != DirectionNW {
+		t.Errorf("Expected the label at nw, got %v", node.LabelAt)
+	}
+
+	data, err := json.Marshal(&node)
+	if err != nil {
+		t.Fatalf("Error encoding node: %s", err)
+	}
+	if expected := `{"id":"","label_at":"nw"}`; string(data) != expected {
+		t.Errorf("Incorrect JSON, expected %s, got %s", expected, data)
+	}
+
+	if err := json.Unmarshal([]byte(`{"label_at": "up"}`), &node); err == nil {
+		t.Errorf("Expected an error parsing an unknown direction")
+	}
+}
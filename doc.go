@@ -3,5 +3,12 @@
 // links, placing node labels, and rendering the map to an image.
 //
 // The canvas sub-package provides a more general-purpose drawing interface, as
-// well as an SVG renderer.
+// well as an SVG renderer. The grid sub-package provides types for working with
+// positions in the layout grid. The geometry sub-package provides the arrow
+// shapes and split points links are drawn with, for custom link rendering.
+// The server sub-package provides HTTP handlers that cache routed layouts and
+// render maps as their link data changes. The datasource sub-package fetches
+// link data from monitoring systems. The testutil sub-package generates
+// synthetic topologies for benchmarking. The weathermap sub-package converts
+// PHP Network Weathermap configs to topologies.
 package raumata
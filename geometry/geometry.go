@@ -0,0 +1,392 @@
+// Package geometry provides the shapes raumata draws links with, so
+// custom link drawing can use the same arrows and split points as
+// the renderer.
+package geometry
+
+import (
+	"slices"
+
+	"github.com/REANNZ/raumata/canvas"
+	"github.com/REANNZ/raumata/internal/f32"
+	"github.com/REANNZ/raumata/vec"
+)
+
+// AutoRadius can be passed to [Arrow] as the radius to round each
+// corner as much as the width of the arrow, or less where the
+// segments either side of the corner are too short to fit it
+const AutoRadius float32 = -1
+
+// Arrow returns the outline of route drawn as an arrow of the given
+// width, pointing to the end of the route. Corners are rounded with
+// the given radius along the middle of the arrow, or to fit the
+// corner if it is [AutoRadius]. The arrowhead is
+// headLength long, but is shortened if needed to leave at least
+// minRun of straight line before it. Returns nil if the route has
+// fewer than two distinct points.
+func Arrow(route vec.Polyline, width, radius, headLength, minRun float32) *canvas.Path {
+	if len(route) < 2 {
+		return nil
+	}
+
+	path := canvas.NewPath()
+
+	path.Attributes.Style = canvas.NewStyle()
+
+	halfWidth := width / 2
+
+	route, arrowPoint := ArrowShaft(route, headLength, minRun)
+
+	route = route.Simplify()
+
+	if len(route) < 2 {
+		return nil
+	}
+
+	// Helper function for adding points to the path
+	addPoint := func(prevIdx, curIdx, nextIdx int) {
+		curPoint := route[curIdx]
+
+		if prevIdx < 0 || prevIdx >= len(route) {
+			// curPoint is the first point in the path
+			nextPoint := route[nextIdx]
+			dir := nextPoint.Sub(curPoint).Normalized()
+
+			curPoint = curPoint.Add(dir.Norm().Mul(halfWidth))
+			// LineTo works here because the first LineTo is actually
+			// a MoveTo
+			path.LineTo(curPoint)
+		} else if nextIdx < 0 || nextIdx >= len(route) {
+			// curPoint is the last point in the path
+			prevPoint := route[prevIdx]
+			dir := curPoint.Sub(prevPoint).Normalized()
+
+			curPoint = curPoint.Add(dir.Norm().Mul(halfWidth))
+			path.LineTo(curPoint)
+		} else {
+			// curPoint is in the middle of the path
+			prevPoint := route[prevIdx]
+			nextPoint := route[nextIdx]
+
+			prevDir := curPoint.Sub(prevPoint).Normalized()
+			nextDir := nextPoint.Sub(curPoint).Normalized()
+
+			// Unless the neighbour points are the ends of the
+			// route, we need to ensure that the path doesn't
+			// double-back on itself. We do this by taking the mid
+			// points of the neighbours and curPoint as the maximum
+			// extents of the corner.
+			if prevIdx > 0 && prevIdx < len(route)-1 {
+				prevPoint = prevPoint.Add(curPoint).Div(2)
+			}
+
+			if nextIdx > 0 && nextIdx < len(route)-1 {
+				nextPoint = curPoint.Add(nextPoint).Div(2)
+			}
+
+			prevNorm := prevDir.Norm()
+			nextNorm := nextDir.Norm()
+
+			cornerStart := prevPoint.Add(prevNorm.Mul(halfWidth))
+			cornerEnd := nextPoint.Add(nextNorm.Mul(halfWidth))
+
+			offsetVec := prevNorm.Add(nextNorm).Normalized()
+			cornerOffset := halfWidth / offsetVec.Dot(prevNorm)
+
+			cornerPeak := curPoint.Add(offsetVec.Mul(cornerOffset))
+
+			r := radius
+			if radius == AutoRadius {
+				// The ends of the route are kept straight for a
+				// little, so the ends and the arrowhead stay square
+				prevLen := curPoint.Sub(prevPoint).Length()
+				if prevIdx == 0 || prevIdx == len(route)-1 {
+					prevLen -= halfWidth
+				}
+				nextLen := nextPoint.Sub(curPoint).Length()
+				if nextIdx == 0 || nextIdx == len(route)-1 {
+					nextLen -= halfWidth
+				}
+				r = autoRadius(prevDir, nextDir, f32.Min(prevLen, nextLen), width)
+			}
+
+			cornerNorm := cornerEnd.Sub(cornerStart).Norm()
+			if cornerNorm.Dot(cornerPeak.Sub(cornerStart)) > 0 {
+				r += halfWidth
+			} else {
+				r -= halfWidth
+			}
+
+			path.RoundCorner(r, cornerStart, cornerPeak, cornerEnd)
+		}
+	}
+
+	// Go around one side of the arrow
+	for i := 0; i < len(route); i++ {
+		addPoint(i-1, i, i+1)
+	}
+
+	// Draw a line to the point of the arrow
+	path.LineTo(arrowPoint)
+
+	// Draw the other size of the arrow
+	for i := len(route) - 1; i >= 0; i-- {
+		addPoint(i+1, i, i-1)
+	}
+
+	// Finish
+	return path.ClosePath()
+}
+
+// Returns the largest radius, up to width, of a corner turning from
+// prevDir to nextDir that keeps the outside of an arrow width wide
+// within length of the corner
+func autoRadius(prevDir, nextDir vec.Vec2, length, width float32) float32 {
+	// The angle between the two sides of the corner
+	cosAngle := f32.Max(f32.Min(prevDir.Neg().Dot(nextDir), 1), -1)
+	halfAngle := f32.Acos(cosAngle) / 2
+
+	fit := length*f32.Tan(halfAngle) - width/2
+	return f32.Max(f32.Min(width, fit), 0)
+}
+
+// ArrowShaft shortens route to leave room for an arrowhead headLength
+// long, returning the shortened route and the point of the arrow. The
+// arrowhead is shortened if needed to leave at least minRun of
+// straight line before it. route must have at least two points, and
+// isn't changed.
+func ArrowShaft(route vec.Polyline, headLength, minRun float32) (vec.Polyline, vec.Vec2) {
+	route = slices.Clone(route)
+
+	// The last point on the line is the point of the arrow
+	// We essentially remove that point and replace it with
+	// one offset from the end
+	arrowPoint := route[len(route)-1]
+	prevPoint := route[len(route)-2]
+
+	dir := arrowPoint.Sub(prevPoint)
+	dirLen := dir.Length()
+	dir = dir.Div(dirLen)
+
+	if minRun > 0 && dirLen < headLength+minRun {
+		headLength = f32.Max(dirLen-minRun, 0)
+	}
+
+	if dirLen > headLength {
+		// The common case where we have enough room to simply
+		// move the point back without crashing into an existing
+		// point
+		route[len(route)-1] = arrowPoint.Sub(dir.Mul(headLength))
+	} else {
+		// If we don't have enough room to move the end point back,
+		// we need to fallback to the general solution of finding
+		// the point to split at and using that instead.
+		backOffT := headLength / route.Length()
+
+		route, _ = route.SplitAt(1 - backOffT)
+
+	}
+
+	return route, arrowPoint
+}
+
+// CurvedArrow is like [Arrow], but with the route turned into a
+// smooth curve instead of having rounded corners. A "catmull-rom"
+// curve passes through every point of the route, a "bezier" curve
+// uses the corners as control points. Returns nil if curve isn't a
+// known type of curve.
+func CurvedArrow(route vec.Polyline, width, headLength, minRun float32, curve string) *canvas.Path {
+	if len(route) < 2 {
+		return nil
+	}
+
+	route, arrowPoint := ArrowShaft(route, headLength, minRun)
+	route = route.Simplify()
+
+	segments := curveSegments(route, curve)
+	if len(segments) == 0 {
+		return nil
+	}
+
+	halfWidth := width / 2
+
+	path := canvas.NewPath()
+	path.Attributes.Style = canvas.NewStyle()
+
+	// Go along one side of the curve
+	for _, seg := range segments {
+		seg = offsetCubic(seg, halfWidth)
+		// LineTo works here because the first LineTo is actually
+		// a MoveTo, and the segments join up, so the others are
+		// skipped
+		path.LineTo(seg[0])
+		path.CubicTo(seg[1], seg[2], seg[3])
+	}
+
+	// Draw a line to the point of the arrow
+	path.LineTo(arrowPoint)
+
+	// Come back along the other side
+	for i := len(segments) - 1; i >= 0; i-- {
+		seg := segments[i]
+		seg = offsetCubic([4]vec.Vec2{seg[3], seg[2], seg[1], seg[0]}, halfWidth)
+		path.LineTo(seg[0])
+		path.CubicTo(seg[1], seg[2], seg[3])
+	}
+
+	return path.ClosePath()
+}
+
+// Converts route into a smooth curve made of cubic Bézier segments,
+// each given as the start, the two control points and the end.
+//
+// A "catmull-rom" curve passes through every point of the route,
+// a "bezier" curve uses the corners of the route as control points
+// instead, cutting the corners more. Other curve types return nil.
+func curveSegments(route vec.Polyline, curve string) [][4]vec.Vec2 {
+	if len(route) < 2 {
+		return nil
+	}
+
+	// A straight line from a to b, as a cubic segment
+	line := func(a, b vec.Vec2) [4]vec.Vec2 {
+		third := b.Sub(a).Div(3)
+		return [4]vec.Vec2{a, a.Add(third), b.Sub(third), b}
+	}
+
+	segments := [][4]vec.Vec2{}
+
+	switch curve {
+	case "catmull-rom":
+		// Limits the length of v, so short segments next to long
+		// ones don't overshoot and loop back on themselves
+		limit := func(v vec.Vec2, length float32) vec.Vec2 {
+			if l := v.Length(); l > length {
+				return v.Mul(length / l)
+			}
+			return v
+		}
+
+		n := len(route)
+		for i := 0; i < n-1; i++ {
+			p0 := route[max(i-1, 0)]
+			p1 := route[i]
+			p2 := route[i+1]
+			p3 := route[min(i+2, n-1)]
+
+			maxHandle := p2.Sub(p1).Length() / 3
+			segments = append(segments, [4]vec.Vec2{
+				p1,
+				p1.Add(limit(p2.Sub(p0).Div(6), maxHandle)),
+				p2.Sub(limit(p3.Sub(p1).Div(6), maxHandle)),
+				p2,
+			})
+		}
+	case "bezier":
+		// Each corner is replaced by a curve between the midpoints
+		// of the segments either side of it
+		prev := route[0]
+		for i := 1; i < len(route)-1; i++ {
+			start := route[i-1].Add(route[i]).Div(2)
+			end := route[i].Add(route[i+1]).Div(2)
+			if !prev.ApproxEq(start, 1e-6) {
+				segments = append(segments, line(prev, start))
+			}
+
+			// The cubic equivalent of a quadratic curve with the
+			// corner as the control point
+			segments = append(segments, [4]vec.Vec2{
+				start,
+				start.Add(route[i].Sub(start).Mul(2.0 / 3)),
+				end.Add(route[i].Sub(end).Mul(2.0 / 3)),
+				end,
+			})
+			prev = end
+		}
+		segments = append(segments, line(prev, route[len(route)-1]))
+	default:
+		return nil
+	}
+
+	return segments
+}
+
+// Moves the cubic segment sideways by dist, to the same side that
+// [vec.Vec2.Norm] points to. The result is an approximation, but is
+// close when the curve doesn't bend too sharply.
+func offsetCubic(seg [4]vec.Vec2, dist float32) [4]vec.Vec2 {
+	// The direction at each end, falling back to the other
+	// points when a control point is on the end
+	startDir := seg[1].Sub(seg[0])
+	if startDir.Length() < 1e-6 {
+		startDir = seg[2].Sub(seg[0])
+	}
+	endDir := seg[3].Sub(seg[2])
+	if endDir.Length() < 1e-6 {
+		endDir = seg[3].Sub(seg[1])
+	}
+
+	startOffset := startDir.Normalized().Norm().Mul(dist)
+	endOffset := endDir.Normalized().Norm().Mul(dist)
+
+	return [4]vec.Vec2{
+		seg[0].Add(startOffset),
+		seg[1].Add(startOffset),
+		seg[2].Add(endOffset),
+		seg[3].Add(endOffset),
+	}
+}
+
+// FindSplit finds a split point along route near startPos, a fraction
+// of the length of the route, and returns the two halves, with the
+// second one reversed so both start at an end of the route.
+//
+// FindSplit avoids split points closer than splitTolerance to a
+// corner, so neither half ends with a very short segment.
+func FindSplit(route vec.Polyline, startPos float32, splitTolerance float32) (vec.Polyline, vec.Polyline) {
+	route = route.Simplify()
+
+	route1, route2 := route.SplitAt(startPos)
+
+	// Check if the split point is itself a corner
+	splitP := route2[0]
+	for _, p := range route {
+		if p == splitP {
+			// The split point is a corner, move the split point a tiny amount
+			// and split again
+			route1, route2 = route.SplitAt(startPos + 0.005)
+			break
+		}
+	}
+
+	route1 = route1.Simplify()
+	route2 = route2.Simplify()
+
+	seg1Length := route1[len(route1)-1].Sub(route1[len(route1)-2]).Length()
+	seg2Length := route2[0].Sub(route2[1]).Length()
+
+	didAdjust := false
+	if seg1Length < splitTolerance {
+		adjustment := (splitTolerance - seg1Length) / route1.Length()
+		newPos := startPos + adjustment
+		if newPos < 1 && newPos > 0 {
+			route1, route2 = route.SplitAt(newPos)
+			didAdjust = true
+		}
+	}
+	if !didAdjust && seg2Length < splitTolerance {
+		adjustment := (splitTolerance - seg2Length) / route2.Length()
+		newPos := startPos - adjustment
+		if newPos < 1 && newPos > 0 {
+			route1, route2 = route.SplitAt(newPos)
+			didAdjust = true
+		}
+	}
+
+	if didAdjust {
+		route1 = route1.Simplify()
+		route2 = route2.Simplify()
+	}
+
+	slices.Reverse(route2)
+	return route1, route2
+}
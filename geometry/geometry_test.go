@@ -0,0 +1,76 @@
+package geometry_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/REANNZ/raumata/canvas"
+	"github.com/REANNZ/raumata/geometry"
+	"github.com/REANNZ/raumata/vec"
+)
+
+func TestFindSplit(t *testing.T) {
+	route := vec.Polyline{{X: 0, Y: 0}, {X: 10, Y: 0}, {X: 10, Y: 10}}
+
+	a, b := geometry.FindSplit(route, 0.5, 1)
+	if a[0] != route[0] || b[0] != route[2] {
+		t.Fatalf("Expected the halves to start at the ends of the route, got %v and %v", a, b)
+	}
+	if a[len(a)-1] != b[len(b)-1] {
+		t.Errorf("Expected the halves to meet, got %v and %v", a, b)
+	}
+
+	// The middle of the route is the corner, which is moved away
+	// from so neither half ends with a short segment
+	split := a[len(a)-1]
+	if split.Sub(route[1]).Length() < 1 {
+		t.Errorf("Expected the split to be at least 1 from the corner, got %v", split)
+	}
+}
+
+func TestArrow(t *testing.T) {
+	route := vec.Polyline{{X: 0, Y: 0}, {X: 10, Y: 0}, {X: 10, Y: 10}}
+	original := slices.Clone(route)
+
+	shaft, point := geometry.ArrowShaft(route, 2, 0)
+	if point != route[2] || shaft[len(shaft)-1] != (vec.Vec2{X: 10, Y: 8}) {
+		t.Errorf("Expected the shaft to stop 2 before the point, got %v and %v", shaft, point)
+	}
+
+	if geometry.Arrow(route, 2, 1, 2, 0) == nil {
+		t.Errorf("Expected an arrow")
+	}
+	if geometry.CurvedArrow(route, 2, 2, 0, "bezier") == nil {
+		t.Errorf("Expected a curved arrow")
+	}
+	if geometry.CurvedArrow(route, 2, 2, 0, "spiral") != nil {
+		t.Errorf("Expected no arrow for an unknown curve")
+	}
+	if !slices.Equal(route, original) {
+		t.Errorf("Expected the route not to be changed, got %v", route)
+	}
+}
+
+func TestArrowAutoRadius(t *testing.T) {
+	// Returns the radius of the largest arc of the arrow
+	largestArc := func(route vec.Polyline) float32 {
+		path := geometry.Arrow(route, 2, geometry.AutoRadius, 2, 0)
+		largest := float32(0)
+		for _, cmd := range path.Data {
+			if cmd.Type == canvas.CommandArcTo {
+				largest = max(largest, cmd.Args[4])
+			}
+		}
+		return largest
+	}
+
+	// With room, corners are as round as the arrow is wide, measured
+	// along its middle
+	if r := largestArc(vec.Polyline{{X: 0, Y: 0}, {X: 20, Y: 0}, {X: 20, Y: 20}}); r != 3 {
+		t.Errorf("Expected the outside of the corner to have radius 3, got %v", r)
+	}
+	// A short first segment leaves no room to round the corner
+	if r := largestArc(vec.Polyline{{X: 0, Y: 0}, {X: 2, Y: 0}, {X: 2, Y: 20}}); r > 1 {
+		t.Errorf("Expected the corner by the short segment to be tight, got radius %v", r)
+	}
+}
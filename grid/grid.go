@@ -0,0 +1,141 @@
+// Package grid provides types for working with positions in the
+// layout grid used by raumata topologies.
+package grid
+
+import (
+	"github.com/REANNZ/raumata/internal/f32"
+	"github.com/REANNZ/raumata/vec"
+)
+
+// A simple abstraction of an infinite(ish) grid using a map
+// to store values
+type Grid[T any] map[Pos]T
+
+// Type representing positions in a grid
+type Pos struct {
+	X, Y int16
+}
+
+// Returns the grid position nearest to v
+func FromVec(v vec.Vec2) Pos {
+	v = v.Round()
+	return Pos{
+		X: int16(v.X),
+		Y: int16(v.Y),
+	}
+}
+
+// Returns a [vec.Vec2] with the same values as the
+// grid position
+func (g Pos) ToVec() vec.Vec2 {
+	return vec.Vec2{
+		X: float32(g.X),
+		Y: float32(g.Y),
+	}
+}
+
+func (g Pos) Min(p Pos) Pos {
+	minPos := Pos{}
+	if g.X < p.X {
+		minPos.X = g.X
+	} else {
+		minPos.X = p.X
+	}
+	if g.Y < p.Y {
+		minPos.Y = g.Y
+	} else {
+		minPos.Y = p.Y
+	}
+
+	return minPos
+}
+
+func (g Pos) Max(p Pos) Pos {
+	maxPos := Pos{}
+	if g.X > p.X {
+		maxPos.X = g.X
+	} else {
+		maxPos.X = p.X
+	}
+	if g.Y > p.Y {
+		maxPos.Y = g.Y
+	} else {
+		maxPos.Y = p.Y
+	}
+
+	return maxPos
+}
+
+// Returns the Chebyshev distance between two points
+//
+//	d = max(abs(a.X-b.X), abs(a.Y-b.Y))
+func (a Pos) ChebyshevDistance(b Pos) float32 {
+	dx := a.X - b.X
+	dy := a.Y - b.Y
+
+	if dx < 0 {
+		dx *= -1
+	}
+	if dy < 0 {
+		dy *= -1
+	}
+
+	if dx > dy {
+		return float32(dx)
+	} else {
+		return float32(dy)
+	}
+}
+
+
+// Returns the "Taxicab" distance between two points
+// aka L0 metric
+//
+//	d = abs(a.X-b.X) + abs(a.Y-b.Y)
+func (a Pos) TaxicabDistance(b Pos) float32 {
+	dx := a.X - b.X
+	dy := a.Y - b.Y
+
+	if dx < 0 {
+		dx *= -1
+	}
+	if dy < 0 {
+		dy *= -1
+	}
+
+	return float32(dx + dy)
+}
+
+// Returns the Euclidean distance between two points
+//
+//	d = sqrt((a.X-b.X)^2 + (a.Y-b.Y)^2)
+func (a Pos) EuclideanDistance(b Pos) float32 {
+	dx := float32(a.X - b.X)
+	dy := float32(a.Y - b.Y)
+
+	return f32.Sqrt(dx*dx + dy*dy)
+}
+
+// Returns the "octile" distance between two points, which
+// is the length of the shortest path between them when
+// straight moves cost 1 and diagonal moves cost diagCost
+//
+//	d = max(dx, dy) - min(dx, dy) + diagCost*min(dx, dy)
+func (a Pos) OctileDistance(b Pos, diagCost float32) float32 {
+	dx := a.X - b.X
+	dy := a.Y - b.Y
+
+	if dx < 0 {
+		dx *= -1
+	}
+	if dy < 0 {
+		dy *= -1
+	}
+
+	maxD, minD := dx, dy
+	if dy > dx {
+		maxD, minD = dy, dx
+	}
+
+	return float32(maxD-minD) + diagCost*float32(minD)
+}
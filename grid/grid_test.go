@@ -0,0 +1,57 @@
+package grid_test
+
+import (
+	"testing"
+
+	. "github.com/REANNZ/raumata/grid"
+	"github.com/REANNZ/raumata/vec"
+)
+
+func TestDistances(t *testing.T) {
+	a := Pos{X: 1, Y: 2}
+	b := Pos{X: -2, Y: 4}
+
+	if d := a.ChebyshevDistance(b); d != 3 {
+		t.Errorf("Incorrect Chebyshev distance, expected 3, got %f", d)
+	}
+	if d := a.TaxicabDistance(b); d != 5 {
+		t.Errorf("Incorrect Taxicab distance, expected 5, got %f", d)
+	}
+}
+
+func TestMinMax(t *testing.T) {
+	a := Pos{X: 1, Y: -2}
+	b := Pos{X: -2, Y: 4}
+
+	if m := a.Min(b); m != (Pos{X: -2, Y: -2}) {
+		t.Errorf("Incorrect Min, got %v", m)
+	}
+	if m := a.Max(b); m != (Pos{X: 1, Y: 4}) {
+		t.Errorf("Incorrect Max, got %v", m)
+	}
+}
+
+func TestFromVec(t *testing.T) {
+	p := FromVec(vec.Vec2{X: 1.4, Y: -2.6})
+	if p != (Pos{X: 1, Y: -3}) {
+		t.Errorf("Incorrect position from vector, got %v", p)
+	}
+	if v := p.ToVec(); v != (vec.Vec2{X: 1, Y: -3}) {
+		t.Errorf("Incorrect vector from position, got %s", v)
+	}
+}
+
+func TestEuclideanOctileDistances(t *testing.T) {
+	a := Pos{X: 0, Y: 0}
+	b := Pos{X: 3, Y: 4}
+
+	if d := a.EuclideanDistance(b); d != 5 {
+		t.Errorf("Incorrect Euclidean distance, expected 5, got %f", d)
+	}
+	if d := a.OctileDistance(b, 1); d != 4 {
+		t.Errorf("Incorrect octile distance, expected 4, got %f", d)
+	}
+	if d := a.OctileDistance(b, 2); d != 7 {
+		t.Errorf("Incorrect octile distance, expected 7, got %f", d)
+	}
+}
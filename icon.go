@@ -0,0 +1,80 @@
+package raumata
+
+import (
+	"math"
+
+	"github.com/REANNZ/raumata/canvas"
+	"github.com/REANNZ/raumata/vec"
+)
+
+// Icon is an image, such as a router or firewall symbol, drawn on the
+// nodes whose style names it. The image is embedded into the canvas
+// once, as a symbol, and drawn at the center of each node.
+type Icon struct {
+	// The URL of the image, an SVG or PNG file or a data URL
+	Href string `json:"href"`
+	// The size the icon is drawn at. If not set, icons replacing the
+	// node's shape are as wide as the node, and other icons fit
+	// inside its circle.
+	Width  float32 `json:"width,omitempty"`
+	Height float32 `json:"height,omitempty"`
+	// Draw the icon instead of the node's shape
+	Replace bool `json:"replace,omitempty"`
+}
+
+// Returns the id of the canvas symbol for the icon with the given name
+func (r *Renderer) iconSymbolId(name string) string {
+	return r.svgName("icon-" + name)
+}
+
+// Returns the icon of a single cell node with the given style, with
+// its size filled in. Returns false if the node has no icon, or the
+// icon isn't configured.
+func (r *Renderer) nodeIcon(node *Node, style *NodeStyle) (Icon, bool) {
+	if style.Icon == "" || node.IsMultiCell() {
+		return Icon{}, false
+	}
+	icon, ok := r.Config.Icons[style.Icon]
+	if !ok {
+		return Icon{}, false
+	}
+
+	size := style.Size
+	if !icon.Replace {
+		// The largest square inside the node's circle
+		size = style.Size / math.Sqrt2
+	}
+	if icon.Width <= 0 && icon.Height <= 0 {
+		icon.Width, icon.Height = size, size
+	} else if icon.Width <= 0 {
+		icon.Width = icon.Height
+	} else if icon.Height <= 0 {
+		icon.Height = icon.Width
+	}
+	return icon, true
+}
+
+// Renders the icon centered on pos
+func (r *Renderer) renderIcon(name string, icon Icon, pos vec.Vec2) canvas.Object {
+	corner := pos.Sub(vec.Vec2{X: icon.Width / 2, Y: icon.Height / 2})
+	use := canvas.NewUse(r.iconSymbolId(name), corner, icon.Width, icon.Height)
+	use.Attributes.AddClass("node-icon")
+	return use
+}
+
+// Adds a symbol for each of the configured icons to the canvas. The
+// symbols have the icon's aspect ratio, and are scaled to the size of
+// each node's icon.
+func (r *Renderer) addIconSymbols(c *canvas.Canvas) {
+	for _, name := range sortedKeys(r.Config.Icons) {
+		icon := r.Config.Icons[name]
+		size := vec.Vec2{X: 1, Y: 1}
+		if icon.Width > 0 && icon.Height > 0 {
+			size = vec.Vec2{X: icon.Width / icon.Height, Y: 1}
+		}
+		symbol := canvas.NewSymbol()
+		symbol.ViewBox = canvas.NewAABB(vec.Vec2{}, size)
+		symbol.AppendChild(canvas.NewImage(vec.Vec2{}, size.X, size.Y, icon.Href))
+		c.AddSymbol(r.iconSymbolId(name), symbol)
+	}
+}
@@ -24,6 +24,12 @@ func Atan(x float32) float32 {
 	return float32(math.Atan(float64(x)))
 }
 
+// Returns the arctangent, in radians, of y/x, using the signs
+// of the two to determine the quadrant.
+func Atan2(y, x float32) float32 {
+	return float32(math.Atan2(float64(y), float64(x)))
+}
+
 // Returns the least integer value greather than or equal to x.
 func Ceil(x float32) float32 {
 	return float32(math.Ceil(float64(x)))
@@ -5,12 +5,17 @@ import "container/heap"
 // PriorityQueue is a heap-based priority queue
 // using the standard library heap
 type PriorityQueue[T any] struct {
-	data minHeap[T]
+	// Pop items with the same priority in the order they were
+	// pushed. Otherwise the order of ties depends on the heap
+	Stable bool
+	data   minHeap[T]
+	seq    uint64
 }
 
 type item[T any] struct {
 	value    T
 	priority int
+	seq      uint64
 }
 
 type minHeap[T any] []*item[T]
@@ -20,6 +25,9 @@ func (h minHeap[T]) Len() int {
 }
 
 func (h minHeap[T]) Less(i, j int) bool {
+	if h[i].priority == h[j].priority {
+		return h[i].seq < h[j].seq
+	}
 	return h[i].priority < h[j].priority
 }
 
@@ -47,9 +55,15 @@ func (h *minHeap[T]) Pop() any {
 
 // Push a new element with the given priority
 func (pq *PriorityQueue[T]) Push(data T, priority int) {
+	// Without Stable every item has the same sequence number, so
+	// ties are left to the heap
+	if pq.Stable {
+		pq.seq++
+	}
 	heap.Push(&pq.data, &item[T]{
 		value:    data,
 		priority: priority,
+		seq:      pq.seq,
 	})
 }
 
@@ -1,31 +1,99 @@
 package raumata
 
 import (
-	"github.com/REANNZ/raumata/internal"
+	"slices"
+
+	"github.com/REANNZ/raumata/grid"
 )
 
-// Determine good placement for node labels
+// Controls how [PlaceLabels] positions node labels
+type LabelConfig struct {
+	// Keep node labels off the cells either side of where link
+	// labels are expected to be drawn, halfway along each side of
+	// the link's split point. The link label boxes are wider than
+	// the links, so spill into these cells (default false)
+	AvoidLinkLabels bool `json:"avoid-link-labels"`
+}
+
+func DefaultLabelConfig() *LabelConfig {
+	return &LabelConfig{}
+}
+
+// Determine good placement for node labels, setting
+// [Node.LabelAt] for nodes that don't have it set
 func PlaceLabels(topo *Topology) {
+	PlaceLabelsWithConfig(topo, nil)
+}
+
+// PlaceLabelsWithConfig is like [PlaceLabels], but with settings
+// for the placement. If config is nil, the default config is used.
+func PlaceLabelsWithConfig(topo *Topology, config *LabelConfig) {
+	for id, labelAt := range LabelPlacements(topo, config) {
+		topo.Nodes[id].LabelAt = labelAt
+	}
+}
+
+// LabelPlacements works out where the labels go for nodes without
+// [Node.LabelAt] set, like [PlaceLabelsWithConfig], but returns the
+// directions by node id instead of changing the topology. It only
+// reads the topology, so it can be called while other goroutines
+// read it too.
+//
+// The nodes are placed in order of their ids, so the same topology
+// always gets the same placements.
+func LabelPlacements(topo *Topology, config *LabelConfig) map[NodeId]Direction {
+	if config == nil {
+		config = DefaultLabelConfig()
+	}
+
+	placements := map[NodeId]Direction{}
+
 	// Records squares that are occupied
-	fillGrid := internal.Grid[bool]{}
+	fillGrid := grid.Grid[bool]{}
+
+	ids := make([]NodeId, 0, len(topo.Nodes))
+	for id, node := range topo.Nodes {
+		if node != nil && node.Pos != nil {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+
+	nodes := make([]*Node, len(ids))
+	for i, id := range ids {
+		nodes[i] = topo.Nodes[id]
+	}
 
 	// Record all the node positions and the positions
 	// of existing labels
-	for _, node := range topo.Nodes {
-		if node != nil && node.Pos != nil {
-			pos := internal.GridPos{
-				X: node.Pos[0],
-				Y: node.Pos[1],
-			}
-			fillGrid[pos] = true
+	var nodesMin, nodesMax grid.Pos
+	for i, node := range nodes {
+		pos := grid.Pos{
+			X: node.Pos[0],
+			Y: node.Pos[1],
+		}
+		fillGrid[pos] = true
 
-			dir := directionFromString(node.LabelAt)
+		if i == 0 {
+			nodesMin, nodesMax = pos, pos
+		}
+		nodesMin, nodesMax = nodesMin.Min(pos), nodesMax.Max(pos)
 
-			labelAt := dir.moveGridPos(pos)
+		labelAt := node.LabelAt.moveGridPos(pos)
 
-			if labelAt != pos {
-				fillGrid[labelAt] = true
-			}
+		if labelAt != pos {
+			fillGrid[labelAt] = true
+		}
+	}
+
+	// Obstacles are never used for labels. Labels are placed next
+	// to their nodes, and scored by the cells next to them, so only
+	// the cells within two of a node matter
+	nodesMin = grid.Pos{X: nodesMin.X - 2, Y: nodesMin.Y - 2}
+	nodesMax = grid.Pos{X: nodesMax.X + 2, Y: nodesMax.Y + 2}
+	for _, obstacle := range topo.Obstacles {
+		for _, pos := range obstacle.CellsWithin(nodesMin, nodesMax) {
+			fillGrid[pos] = true
 		}
 	}
 
@@ -36,54 +104,64 @@ func PlaceLabels(topo *Topology) {
 		}
 
 		for _, p := range link.Route {
-			pos := internal.GridPos{
+			pos := grid.Pos{
 				X: int16(p.X),
 				Y: int16(p.Y),
 			}
 
 			fillGrid[pos] = true
 		}
+
+		if config.AvoidLinkLabels {
+			for _, pos := range link.labelCells(link.Route) {
+				fillGrid[pos] = true
+				fillGrid[grid.Pos{X: pos.X - 1, Y: pos.Y}] = true
+				fillGrid[grid.Pos{X: pos.X + 1, Y: pos.Y}] = true
+			}
+		}
 	}
 
 	// Do the label placement
-	for id, node := range topo.Nodes {
-		if node == nil || node.Pos == nil {
-			continue
-		}
-		if node.LabelAt != "" {
+	for i, node := range nodes {
+		id := ids[i]
+		if node.LabelAt != DirectionNone {
 			// Skip labels that have already been placed
 			continue
 		}
 
-		pos := internal.GridPos{
+		pos := grid.Pos{
 			X: node.Pos[0],
 			Y: node.Pos[1],
 		}
 
 		// For each valid position, calculate a score and use the position
 		// with the lowest score
-		bestDir := directionNone
+		bestDir := DirectionNone
 		var bestScore float32
-		for i := directionN; i <= directionNW; i++ {
+		for i := DirectionN; i <= DirectionNW; i++ {
 			candidatePos := i.moveGridPos(pos)
 			if _, ok := fillGrid[candidatePos]; !ok {
-				score := evaluatePosition(candidatePos, i, id, topo.Nodes, fillGrid)
-				if bestDir == directionNone || score < bestScore {
+				score := evaluatePosition(candidatePos, i, node, nodes, fillGrid)
+				if bestDir == DirectionNone || score < bestScore {
 					bestScore = score
 					bestDir = i
 				}
 			}
 		}
 
-		if bestDir != directionNone {
-			node.LabelAt = bestDir.String()
+		if bestDir != DirectionNone {
+			placements[id] = bestDir
 			labelPos := bestDir.moveGridPos(pos)
 			fillGrid[labelPos] = true
 		}
 	}
+
+	return placements
 }
 
-func evaluatePosition(pos internal.GridPos, dir direction, id NodeId, nodes map[NodeId]*Node, fillGrid internal.Grid[bool]) float32 {
+// Scores placing the label for node at pos, lower is better.
+// The nodes must all have positions.
+func evaluatePosition(pos grid.Pos, dir Direction, node *Node, nodes []*Node, fillGrid grid.Grid[bool]) float32 {
 	var score float32 = 0
 	testPos := pos.ToVec()
 
@@ -92,7 +170,7 @@ func evaluatePosition(pos internal.GridPos, dir direction, id NodeId, nodes map[
 	// diagonal placement (NE, SE, SW, or NW)
 	var dirCost float32
 	switch dir {
-	case directionN, directionE, directionS, directionW:
+	case DirectionN, DirectionE, DirectionS, DirectionW:
 		dirCost = 50
 	default:
 		dirCost = 100
@@ -101,16 +179,13 @@ func evaluatePosition(pos internal.GridPos, dir direction, id NodeId, nodes map[
 	// Each node contributes to the score proportional
 	// to the inverse of the distance to the node, squared
 	// cost * (1/d^2)
-	for nid, node := range nodes {
-		if nid == id {
-			continue
-		}
-		if node == nil || node.Pos == nil {
+	for _, other := range nodes {
+		if other == node {
 			continue
 		}
-		p := internal.GridPos{
-			X: node.Pos[0],
-			Y: node.Pos[1],
+		p := grid.Pos{
+			X: other.Pos[0],
+			Y: other.Pos[1],
 		}
 
 		nPos := p.ToVec()
@@ -120,7 +195,7 @@ func evaluatePosition(pos internal.GridPos, dir direction, id NodeId, nodes map[
 
 	// Apply a penalty for each occupied cell around the
 	// candidate position
-	for d := directionN; d <= directionNW; d += 1 {
+	for d := DirectionN; d <= DirectionNW; d += 1 {
 		if d == dir.Opposite() {
 			// If the cell we're looking at is the node the label
 			// is for, don't penalize that location
@@ -133,7 +208,7 @@ func evaluatePosition(pos internal.GridPos, dir direction, id NodeId, nodes map[
 			// If the occupied cell is to the left or right of
 			// the node apply a higher penalty, since it's more
 			// likely to overlap with the text.
-			if d == directionE || d == directionW {
+			if d == DirectionE || d == DirectionW {
 				penalty = 50
 			} else {
 				penalty = 5
@@ -0,0 +1,94 @@
+package raumata_test
+
+import (
+	"fmt"
+	"maps"
+	"sync"
+	"testing"
+
+	. "github.com/REANNZ/raumata"
+	"github.com/REANNZ/raumata/vec"
+)
+
+func TestLabelPlacements(t *testing.T) {
+	// A symmetric layout, so many of the positions score the same
+	topo := &Topology{Nodes: map[NodeId]*Node{}}
+	for y := int16(0); y < 4; y++ {
+		for x := int16(0); x < 4; x++ {
+			id := NodeId(fmt.Sprintf("N%d-%d", x, y))
+			topo.Nodes[id] = &Node{Id: id, Pos: &[2]int16{x * 2, y * 2}}
+		}
+	}
+	topo.Nodes["N0-0"].LabelAt = DirectionW
+
+	expected := LabelPlacements(topo, nil)
+	if len(expected) != 15 {
+		t.Fatalf("Expected 15 placements, got %v", expected)
+	}
+	if _, ok := expected["N0-0"]; ok {
+		t.Errorf("Expected the placed label to be left alone")
+	}
+
+	// The topology is only read, so it can be shared
+	var wg sync.WaitGroup
+	results := make([]map[NodeId]Direction, 20)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = LabelPlacements(topo, nil)
+		}()
+	}
+	wg.Wait()
+
+	for _, result := range results {
+		if !maps.Equal(result, expected) {
+			t.Fatalf("Placements differ between runs: %v != %v", result, expected)
+		}
+	}
+	if label := topo.Nodes["N1-1"].LabelAt; label != DirectionNone {
+		t.Errorf("Expected the topology to be unchanged, got label at %q", label)
+	}
+
+	PlaceLabels(topo)
+	for id, labelAt := range expected {
+		if topo.Nodes[id].LabelAt != labelAt {
+			t.Errorf("Expected %s label at %q, got %q", id, labelAt, topo.Nodes[id].LabelAt)
+		}
+	}
+}
+
+func TestLabelPlacementsAvoidLinkLabels(t *testing.T) {
+	route := vec.Polyline{}
+	for y := float32(0); y <= 8; y++ {
+		route = append(route, vec.Vec2{X: 0, Y: y})
+	}
+
+	// The from label of A-B is drawn at (0, 2), and everywhere
+	// around C is taken except (1, 2) next to it
+	topo := &Topology{
+		Nodes: map[NodeId]*Node{
+			"A": {Id: "A", Pos: &[2]int16{0, 0}, LabelAt: DirectionN},
+			"B": {Id: "B", Pos: &[2]int16{0, 8}, LabelAt: DirectionS},
+			"C": {Id: "C", Pos: &[2]int16{2, 2}},
+		},
+		Links: map[LinkId]*Link{
+			"A-B": {Id: "A-B", From: "A", To: "B", Route: route, FromData: &LinkData{Label: "10G"}},
+		},
+		Obstacles: []*Obstacle{
+			{Rect: &[2][2]int16{{2, 1}, {3, 3}}},
+			{Rect: &[2][2]int16{{1, 1}, {1, 1}}},
+			{Rect: &[2][2]int16{{1, 3}, {1, 3}}},
+		},
+	}
+
+	if labelAt := LabelPlacements(topo, nil)["C"]; labelAt != DirectionW {
+		t.Errorf("Expected the label next to the link label without the option, got %q", labelAt)
+	}
+
+	config := DefaultLabelConfig()
+	config.AvoidLinkLabels = true
+	if labelAt, ok := LabelPlacements(topo, config)["C"]; ok {
+		t.Errorf("Expected no place for the label, got %q", labelAt)
+	}
+}
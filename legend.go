@@ -0,0 +1,197 @@
+package raumata
+
+import (
+	"fmt"
+
+	"github.com/REANNZ/raumata/canvas"
+	"github.com/REANNZ/raumata/vec"
+)
+
+// The number of strips used to draw a smooth gradient, canvases
+// don't have gradient fills
+const legendGradientStrips = 64
+
+// LegendOptions controls how [Renderer.RenderLegend] draws and
+// places a legend
+type LegendOptions struct {
+	// The area the legend is placed in, typically the bounding box
+	// of the rendered map. If nil, the legend is placed at the
+	// origin.
+	Bounds *canvas.AABB
+	// The corner or edge of Bounds the legend is placed at, the same
+	// corner or edge of the legend is put there, as for a
+	// [Decoration]. If not set, the top-left corner is used.
+	Corner Direction
+	// The offset of the legend from the corner, in canvas units
+	Offset vec.Vec2
+	// Draw the bar upright, with the lowest value at the bottom,
+	// instead of left to right
+	Vertical bool
+	// The length and thickness of the bar, 200 by 12 if not set
+	Length    float32
+	Thickness float32
+	// The values at either end of the bar, 0 to 1 if they are the
+	// same
+	Min, Max float32
+	// Split the bar into this many swatches of a single color. 0
+	// draws a smooth gradient.
+	Swatches int
+	// The values to label along the bar. If nil, the ends and every
+	// quarter in between are labelled.
+	Ticks []float32
+	// Formats the tick labels, as percentages if nil
+	FormatTick func(value float32) string
+	// The font size of the labels, 10 if not set
+	TextSize float32
+	// Text drawn above the bar, such as "Utilization"
+	Title string
+}
+
+// RenderLegend renders a bar showing the colors of scale, with
+// labelled ticks, placed at a corner of opts.Bounds so it can be
+// drawn over the map. If scale is nil, Config.LinkColorScale is used.
+func (r *Renderer) RenderLegend(scale *canvas.ColorScale, opts LegendOptions) canvas.Object {
+	if scale == nil {
+		scale = r.Config.LinkColorScale
+	}
+	if opts.Length <= 0 {
+		opts.Length = 200
+	}
+	if opts.Thickness <= 0 {
+		opts.Thickness = 12
+	}
+	if opts.Min == opts.Max {
+		opts.Min, opts.Max = 0, 1
+	}
+	if opts.Ticks == nil {
+		for i := range 5 {
+			opts.Ticks = append(opts.Ticks, opts.Min+(opts.Max-opts.Min)*float32(i)/4)
+		}
+	}
+	if opts.FormatTick == nil {
+		opts.FormatTick = func(value float32) string {
+			return fmt.Sprintf("%g%%", value*100)
+		}
+	}
+	if opts.TextSize <= 0 {
+		opts.TextSize = 10
+	}
+
+	// The labels stick out past the bar by amounts that depend on
+	// their text, so the legend is laid out once to measure it, then
+	// again in its place
+	legend := r.layoutLegend(scale, &opts, vec.Vec2{})
+	if opts.Bounds == nil {
+		return legend
+	}
+
+	legendMin, legendMax := legend.GetAABB().Bounds()
+	size := legendMax.Sub(legendMin)
+	minPos, maxPos := opts.Bounds.Bounds()
+	extent := maxPos.Sub(minPos)
+
+	align := opts.Corner.AsVec().Add(vec.Vec2{X: 1, Y: 1}).Div(2)
+	if opts.Corner == DirectionNone {
+		align = vec.Vec2{}
+	}
+	pos := vec.Vec2{
+		X: minPos.X + (extent.X-size.X)*align.X,
+		Y: minPos.Y + (extent.Y-size.Y)*align.Y,
+	}
+	return r.layoutLegend(scale, &opts, pos.Add(opts.Offset).Sub(legendMin))
+}
+
+// Lays out the legend with the start of the bar at origin
+func (r *Renderer) layoutLegend(scale *canvas.ColorScale, opts *LegendOptions, origin vec.Vec2) *canvas.Group {
+	group := canvas.NewGroup()
+	group.Attributes.Id = "legend"
+	group.Attributes.AddClass("legend")
+
+	// Returns the point along the bar for the value, at the given
+	// distance across it
+	along := func(value, across float32) vec.Vec2 {
+		t := (value - opts.Min) / (opts.Max - opts.Min)
+		if opts.Vertical {
+			return origin.Add(vec.Vec2{X: across, Y: opts.Length * (1 - t)})
+		}
+		return origin.Add(vec.Vec2{X: opts.Length * t, Y: across})
+	}
+	// Returns the part of the bar between the two values
+	section := func(from, to float32) *canvas.Rect {
+		a := along(from, 0)
+		b := along(to, opts.Thickness)
+		pos := vec.Vec2{X: min(a.X, b.X), Y: min(a.Y, b.Y)}
+		size := b.Sub(a)
+		return canvas.NewRect(pos, max(size.X, -size.X), max(size.Y, -size.Y))
+	}
+
+	strips := opts.Swatches
+	if strips <= 0 {
+		strips = legendGradientStrips
+	}
+	bar := canvas.NewGroup()
+	bar.Attributes.AddClass("legend-bar")
+	step := (opts.Max - opts.Min) / float32(strips)
+	for i := range strips {
+		from := opts.Min + step*float32(i)
+		to := from + step
+		// Gradient strips overlap their neighbours slightly, so
+		// there are no seams between them
+		if opts.Swatches <= 0 && i < strips-1 {
+			to += step / 2
+		}
+		rect := section(from, to)
+		style := canvas.NewStyle()
+		style.FillColor.SetColor(scale.GetColor(from + step/2))
+		rect.Attributes.Style = style
+		bar.AppendChild(rect)
+	}
+
+	outline := section(opts.Min, opts.Max)
+	outlineStyle := canvas.NewStyle()
+	outlineStyle.FillColor.SetNone()
+	outlineStyle.StrokeColor.SetColor(canvas.RGB(0, 0, 0))
+	outlineStyle.StrokeWidth.Set(1)
+	outline.Attributes.Style = outlineStyle
+	bar.AppendChild(outline)
+	group.AppendChild(bar)
+
+	tickLength := opts.Thickness / 3
+	for _, value := range opts.Ticks {
+		if value < min(opts.Min, opts.Max) || value > max(opts.Min, opts.Max) {
+			continue
+		}
+
+		tick := canvas.NewLine(along(value, opts.Thickness), along(value, opts.Thickness+tickLength))
+		tick.Attributes.AddClass("legend-tick")
+		tick.Attributes.Style = outlineStyle
+		group.AppendChild(tick)
+
+		label := canvas.NewText(along(value, opts.Thickness+tickLength*2), opts.FormatTick(value))
+		label.Size = opts.TextSize
+		if opts.Vertical {
+			label.Anchor = canvas.TextAnchorStart
+			label.Baseline = canvas.TextBaselineMiddle
+		} else {
+			label.Anchor = canvas.TextAnchorMiddle
+			label.Baseline = canvas.TextBaselineTop
+		}
+		label.Attributes.AddClass("legend-label")
+		group.AppendChild(label)
+	}
+
+	if opts.Title != "" {
+		top := along(opts.Min, 0)
+		if opts.Vertical {
+			top = along(opts.Max, 0)
+		}
+		title := canvas.NewText(top.Sub(vec.Vec2{Y: opts.TextSize / 2}), opts.Title)
+		title.Size = opts.TextSize
+		title.Anchor = canvas.TextAnchorStart
+		title.Baseline = canvas.TextBaselineBottom
+		title.Attributes.AddClass("legend-title")
+		group.AppendChild(title)
+	}
+
+	return group
+}
@@ -1,76 +1,443 @@
 package raumata
 
 import (
+	"cmp"
+	"context"
+	"encoding/json"
 	"fmt"
+	"math"
 	"os"
 	"slices"
+	"strings"
+	"sync"
 
+	"github.com/REANNZ/raumata/grid"
 	"github.com/REANNZ/raumata/internal"
 	"github.com/REANNZ/raumata/internal/f32"
+	"github.com/REANNZ/raumata/option"
 	"github.com/REANNZ/raumata/vec"
 )
 
 const (
-	// Cap on the number of iterations the search algorithm does
+	// Default cap on the number of iterations the search algorithm does
 	searchLimit = 8192
-	// Cap on the number of iterations the fix-point pass does
+	// Default cap on the number of iterations the fix-point pass does
 	routeIterLimit = 32
-	// The weight to apply to the link-crossing penalty.
+	// The default weight to apply to the link-crossing penalty.
 	// The higher this number, the further a route will go
 	// out of it's way to avoid crossing.
 	linkPenaltyWeight = 10.0
+	// The default penalty for each step through a cell kept clear
+	// by another node, high enough that routes go a long way around
+	keepOutWeight = 100.0
+	// Default cap on the number of cells the automatically
+	// determined extents are grown by while routing
+	extentGrowthLimit = 8
 )
 
+// Metric measures the distance between two grid positions.
+//
+// Metrics used by the [LinkRouter] should satisfy the triangle
+// inequality, otherwise routes may not be the shortest.
+type Metric func(from, to grid.Pos) float32
+
+var (
+	// Diagonal steps cost the same as straight ones
+	MetricChebyshev Metric = grid.Pos.ChebyshevDistance
+	// Diagonal steps cost the same as two straight ones
+	MetricManhattan Metric = grid.Pos.TaxicabDistance
+	// Diagonal steps cost √2 times a straight one
+	MetricEuclidean Metric = grid.Pos.EuclideanDistance
+)
+
+// HeuristicFunc estimates the cost of a route from pos to goal.
+//
+// Estimates that are never more than the real cost give the shortest
+// routes. Larger estimates, such as a weighted distance, search fewer
+// cells but can give longer routes.
+type HeuristicFunc func(pos, goal grid.Pos) float32
+
+// ProgressFunc reports the progress of [LinkRouter.RouteLinks].
+// It is called after each link is routed, pass counts up from 0 for
+// each pass over the links, and done of the total links in the pass
+// have been routed.
+type ProgressFunc func(id LinkId, pass, done, total int)
+
+// Heuristic selects the distance estimate used to guide the
+// route search.
+//
+// Whichever heuristic is chosen, it is scaled to never overestimate
+// the cost of a route given the router's DiagonalCost.
+type Heuristic int
+
+const (
+	// The larger of the horizontal and vertical distances
+	HeuristicChebyshev Heuristic = iota
+	// Straight distance plus diagonal distance, weighted by the
+	// diagonal step cost. Exact on an empty grid
+	HeuristicOctile
+	// The straight-line distance
+	HeuristicEuclidean
+)
+
+// RouterConfig holds the costs and limits used when searching
+// for routes, which trade off avoiding other links against
+// keeping routes short and direct.
+//
+// The zero value is not usable, instead it is better to
+// create one with [DefaultRouterConfig] and modify it.
+type RouterConfig struct {
+	// Cap on the number of steps the search for each route takes
+	SearchLimit    int     `json:"search-limit"`
+	// Cap on the number of passes re-routing links to improve them
+	IterationLimit int     `json:"iteration-limit"`
+	// The weight of the penalty for crossing or sharing cells with
+	// other links. The higher this is, the further a route will go
+	// out of its way to avoid other links
+	CrossingWeight float32 `json:"crossing-weight"`
+	// The cost of a 45° turn
+	TurnCost       float32 `json:"turn-cost"`
+	// The cost of a 45° turn straight after another one, making
+	// this more than TurnCost spaces out the turns
+	SharpTurnCost  float32 `json:"sharp-turn-cost"`
+	// The penalty for running next to another link, as a fraction
+	// of CrossingWeight. Only used if SpreadLinks is set
+	SpreadPenalty  float32 `json:"spread-penalty"`
+	// The penalty for passing through a cell where another link's
+	// label is expected to be drawn. 0 doesn't keep the cells clear
+	LinkLabelWeight float32 `json:"link-label-weight"`
+	// The penalty for each step through a cell kept clear by a node
+	// other than the link's own, see [Node.KeepOut] and
+	// [LinkRouter.NodeClearance]. Routes only pass through the cells
+	// when there's no way around them, such as when one of the
+	// link's nodes is next to the node
+	KeepOutWeight  float32 `json:"keep-out-weight"`
+	// Costs for the links of each class, overriding the costs above
+	LinkClasses    map[string]*ClassCosts `json:"link-classes,omitempty"`
+}
+
+// ClassCosts are the route search costs for the links of a class,
+// see [RouterConfig.LinkClasses]. Unset costs are taken from the
+// RouterConfig.
+type ClassCosts struct {
+	// Overrides RouterConfig.CrossingWeight for the links
+	CrossingWeight option.Float32 `json:"crossing-weight"`
+	// Overrides RouterConfig.TurnCost for the links
+	TurnCost       option.Float32 `json:"turn-cost"`
+	// Overrides RouterConfig.SharpTurnCost for the links
+	SharpTurnCost  option.Float32 `json:"sharp-turn-cost"`
+	// Multiplies the penalty other links pay for crossing or
+	// sharing cells with the links, so they go around them.
+	// Defaults to 1
+	AvoidWeight    option.Float32 `json:"avoid-weight"`
+}
+
+// Checks the search limit is positive and none of the other limits
+// and costs are negative
+func (c *RouterConfig) UnmarshalJSON(data []byte) error {
+	type routerConfig RouterConfig
+	if err := json.Unmarshal(data, (*routerConfig)(c)); err != nil {
+		return err
+	}
+	if c.SearchLimit < 1 {
+		return fmt.Errorf("Invalid search-limit %d, it must be at least 1", c.SearchLimit)
+	}
+	if c.IterationLimit < 0 {
+		return fmt.Errorf("Invalid iteration-limit %d, it must not be negative", c.IterationLimit)
+	}
+	for _, cost := range []struct {
+		name  string
+		value float32
+	}{
+		{"crossing-weight", c.CrossingWeight},
+		{"turn-cost", c.TurnCost},
+		{"sharp-turn-cost", c.SharpTurnCost},
+		{"spread-penalty", c.SpreadPenalty},
+		{"link-label-weight", c.LinkLabelWeight},
+		{"keep-out-weight", c.KeepOutWeight},
+	} {
+		if cost.value < 0 {
+			return fmt.Errorf("Invalid %s %v, it must not be negative", cost.name, cost.value)
+		}
+	}
+	return nil
+}
+
+// Checks none of the costs are negative, which would let the route
+// search prefer longer routes
+func (c *ClassCosts) UnmarshalJSON(data []byte) error {
+	type classCosts ClassCosts
+	if err := json.Unmarshal(data, (*classCosts)(c)); err != nil {
+		return err
+	}
+	for _, cost := range []struct {
+		name  string
+		value option.Float32
+	}{
+		{"crossing-weight", c.CrossingWeight},
+		{"turn-cost", c.TurnCost},
+		{"sharp-turn-cost", c.SharpTurnCost},
+		{"avoid-weight", c.AvoidWeight},
+	} {
+		if cost.value.Valid && cost.value.Value < 0 {
+			return fmt.Errorf("Invalid %s %v, it must not be negative", cost.name, cost.value.Value)
+		}
+	}
+	return nil
+}
+
+// DefaultRouterConfig returns the config used by [NewLinkRouter]
+func DefaultRouterConfig() *RouterConfig {
+	return &RouterConfig{
+		SearchLimit:    searchLimit,
+		IterationLimit: routeIterLimit,
+		CrossingWeight: linkPenaltyWeight,
+		TurnCost:       2,
+		SharpTurnCost:  4,
+		SpreadPenalty:  1.0 / 16,
+		KeepOutWeight:  keepOutWeight,
+	}
+}
+
 // LinkRouter routes links through a grid.
 // The zero value is not usable.
 type LinkRouter struct {
+	// Costs and limits for the route search
+	Config            *RouterConfig
 	// Avoid other nodes when routing (default true)
 	AvoidNodes        bool
 	// Attach to multi-cell nodes in cardinal directions (default true)
 	AttachMultiCellsCardinal bool
 	// Encourage links to space themselves out (default true)
 	SpreadLinks       bool
+	// Don't let two links leave a node in the same direction,
+	// unless the link can't be routed otherwise (default false)
+	SeparateLinks     bool
+	// Only route links with horizontal and vertical steps, links
+	// can override this with their Routing field (default false)
 	Orthogonal        bool
+	// Replace staircase-like jogs with diagonals after routing (default false)
+	Smooth            bool
+	// Pull routes taut after routing, replacing the zig-zags of grid
+	// steps with straight lines at any angle where the cells along
+	// them are free. Like locked routes, only the corners of the
+	// new routes are recorded as taken (default false)
+	PullTaut          bool
+	// Route links between the same pair of nodes once and give them
+	// all the same route, so they can be drawn as a bundle. Links with
+	// via points or route anchors are routed separately (default false)
+	Bundle            bool
+	// Route each link once with the first link running the other way
+	// between the same pair of nodes, giving them the same route so
+	// they can be drawn as a directed pair. Bundle implies this for
+	// all links between the pair (default false)
+	PairDirected      bool
+	// Break ties between equal cost cells and routes in a fixed
+	// order, so the routes don't depend on the internal order of
+	// the search queue or of the topology's maps (default false)
+	StableTies        bool
+	// Visit each link's via points in the order that gives the
+	// shortest path through them, instead of the order they are
+	// listed in. The route prefix, suffix and corridor keep their
+	// places (default false)
+	OrderVias         bool
+	// Links with a Style.Size of at least this also take up the
+	// cells on each side of their route, so other links don't pass
+	// under them. The size is in canvas units, the same as the
+	// style. 0 turns this off (default 0)
+	WideLinkSize      float32
+	// Returns the size a link is drawn at, for finding the wide
+	// links, e.g. [Renderer.LinkSize] to include the sizes of the
+	// link classes. If nil, only the size in the link's own style
+	// is used (default nil)
+	LinkSize          func(link *Link) float32
+	// Keep routes at least this many cells away from nodes other
+	// than the ones they connect, so links don't run along the edges
+	// of nodes. Nodes with a larger KeepOut keep that (default 0)
+	NodeClearance     int16
+	// Don't take diagonal steps between two nodes that touch at
+	// their corners, since the drawn link would cut across the
+	// corners of both (default false)
+	AvoidCornerSqueeze bool
+	// Cells added around the topology when the extents are
+	// determined automatically (default 1)
+	ExtentBorder      int16
+	// Grow automatically determined extents when routes are
+	// constrained by them (default true)
+	AutoExpand        bool
+	// The most cells AutoExpand grows the extents by on each side,
+	// on top of ExtentBorder (default 8)
+	MaxExtentGrowth   int16
+	// The distance metric used for the cost of each step. If set,
+	// it is also used as the search heuristic, and Heuristic and
+	// DiagonalCost are ignored (default nil)
+	Metric            Metric
+	// The heuristic used to guide the search (default Chebyshev)
+	Heuristic         Heuristic
+	// Replaces the heuristic used to guide the search, overriding
+	// Heuristic and Metric. When Workers is more than 1 it is called
+	// concurrently (default nil)
+	CustomHeuristic   HeuristicFunc
+	// The cost of a diagonal step relative to a straight one,
+	// values less than 1 are treated as 1 (default 1)
+	DiagonalCost      float32
+	// The number of goroutines used to find the initial routes,
+	// values less than 2 route the links one at a time (default 1)
+	Workers           int
+	// Called after each link is routed, calls are never concurrent,
+	// even when Workers is more than 1 (default nil)
+	Progress          ProgressFunc
 	topo              *Topology
-	nodes             internal.Grid[NodeId]
-	nodeLabels        internal.Grid[bool]
-	linkMap           internal.Grid[[]LinkId]
-	extentMin         internal.GridPos
-	extentMax         internal.GridPos
-	linkPenaltyWeight float32
+	nodes             grid.Grid[NodeId]
+	nodeLabels        grid.Grid[bool]
+	// The cells expected to have link labels, by the link they belong to
+	linkLabels        grid.Grid[[]LinkId]
+	// The cells beside the routes of wide links, by the link
+	wideCells         grid.Grid[[]LinkId]
+	// The links leaving each single-cell node in each direction
+	attachSides       map[NodeId]map[Direction][]LinkId
+	// The nodes each node is a member of
+	containers        map[NodeId][]NodeId
+	keepOut           grid.Grid[[]NodeId]
+	// Checked cell by cell, as an obstacle can cover far more cells
+	// than are ever routed through
+	obstacles         []*Obstacle
+	linkMap           grid.Grid[[]LinkId]
+	extentMin         grid.Pos
+	extentMax         grid.Pos
+	explicitExtents   bool
+	// The extents of the nodes and their labels, without vias or routes
+	nodeExtentMin     grid.Pos
+	nodeExtentMax     grid.Pos
+	// How far the automatically determined extents have grown.
+	// It is only changed between routing links, never while links
+	// are being routed concurrently
+	extentGrowth      int16
+	// Set when the routes were loaded with LoadCache
+	cacheLoaded       bool
+	// Statistics for the last run, guarded by statsMu while
+	// routing concurrently
+	stats             RouterStats
+	searchLimited     map[LinkId]bool
+	statsMu           sync.Mutex
+	// The cost of each link's route when it was last routed, for
+	// deciding whether a new route is better in Update
+	weights           map[LinkId]float32
+}
+
+// RouterStats summarises a run of [LinkRouter.RouteLinks], to help
+// spot maps whose routing has got worse, see [LinkRouter.Stats]
+type RouterStats struct {
+	// The number of passes re-routing links to improve them, at
+	// most the IterationLimit of the config
+	Iterations    int      `json:"iterations"`
+	// The links whose route search stopped at the SearchLimit of
+	// the config at least once, sorted by id
+	SearchLimited []LinkId `json:"search_limited"`
+	// The number of links with and without routes
+	Routed        int      `json:"routed"`
+	Unrouted      int      `json:"unrouted"`
+	// The links without routes, sorted by id
+	UnroutedLinks []LinkId `json:"unrouted_links"`
+	// The number of times two routes cross or share a cell, not
+	// counting the cells of nodes
+	Crossings     int      `json:"crossings"`
+	// The total length of the routes in grid cells
+	TotalLength   float32  `json:"total_length"`
 }
 
 func NewLinkRouter(topo *Topology) *LinkRouter {
+	return NewLinkRouterWithConfig(topo, DefaultRouterConfig())
+}
+
+// NewLinkRouterWithConfig is like [NewLinkRouter], but searches for
+// routes with the given costs and limits. A nil config uses
+// [DefaultRouterConfig].
+func NewLinkRouterWithConfig(topo *Topology, config *RouterConfig) *LinkRouter {
+	if config == nil {
+		config = DefaultRouterConfig()
+	}
 	router := &LinkRouter{
+		Config:            config,
 		AvoidNodes:        true,
 		AttachMultiCellsCardinal: true,
 		SpreadLinks:       true,
+		DiagonalCost:      1,
+		Workers:           1,
+		ExtentBorder:      1,
+		AutoExpand:        true,
+		MaxExtentGrowth:   extentGrowthLimit,
 		topo:              topo,
-		nodes:             internal.Grid[NodeId]{},
-		nodeLabels:        map[internal.GridPos]bool{},
-		linkMap:           map[internal.GridPos][]LinkId{},
-		linkPenaltyWeight: linkPenaltyWeight,
+		nodes:             grid.Grid[NodeId]{},
+		nodeLabels:        map[grid.Pos]bool{},
+		linkLabels:        grid.Grid[[]LinkId]{},
+		wideCells:         grid.Grid[[]LinkId]{},
+		attachSides:       map[NodeId]map[Direction][]LinkId{},
+		containers:        map[NodeId][]NodeId{},
+		searchLimited:     map[LinkId]bool{},
+		weights:           map[LinkId]float32{},
+		keepOut:           grid.Grid[[]NodeId]{},
+		linkMap:           map[grid.Pos][]LinkId{},
 	}
+	router.Reset(topo)
+
+	return router
+}
+
+// Reset prepares the router to route topo, which can be the same
+// topology with changed positions or a different one entirely. The
+// settings are kept, but everything learnt from the previous
+// topology is dropped, including extents set with
+// [LinkRouter.SetExtents] and routes loaded with
+// [LinkRouter.LoadCache].
+//
+// This allows one router to be reused for repeated renders, e.g. in
+// a long-running service, without reallocating its grids each time.
+func (r *LinkRouter) Reset(topo *Topology) {
+	r.topo = topo
+	clear(r.nodes)
+	clear(r.nodeLabels)
+	clear(r.linkLabels)
+	clear(r.wideCells)
+	clear(r.attachSides)
+	clear(r.containers)
+	clear(r.keepOut)
+	r.obstacles = nil
+	clear(r.linkMap)
+	r.extentMin = grid.Pos{}
+	r.extentMax = grid.Pos{}
+	r.explicitExtents = false
+	r.extentGrowth = 0
+	r.cacheLoaded = false
+	r.stats = RouterStats{}
+	clear(r.searchLimited)
+	clear(r.weights)
 
 	setExtents := false
+	// Nodes with members are added after the other nodes, see below
+	containers := []*Node{}
 	// Add all the nodes
 	for _, node := range topo.Nodes {
 		if node != nil && node.Pos != nil {
-			pos := internal.GridPos{
+			pos := grid.Pos{
 				X: node.Pos[0],
 				Y: node.Pos[1],
 			}
 
 			if !setExtents {
-				router.extentMin = pos
-				router.extentMax = pos
+				r.extentMin = pos
+				r.extentMax = pos
 				setExtents = true
 			} else {
-				router.extentMin = router.extentMin.Min(pos)
-				router.extentMax = router.extentMax.Max(pos)
+				r.extentMin = r.extentMin.Min(pos)
+				r.extentMax = r.extentMax.Max(pos)
 			}
 
-			router.nodes[pos] = node.Id
+			if len(node.Members) > 0 {
+				containers = append(containers, node)
+			} else {
+				r.nodes[pos] = node.Id
+			}
 			if node.IsMultiCell() {
 				w := node.Extents.Width
 				h := node.Extents.Height
@@ -85,59 +452,66 @@ func NewLinkRouter(topo *Topology) *LinkRouter {
 
 					for x := minX; x < maxX; x++ {
 						for y := minY; y < maxY; y++ {
-							p := internal.GridPos{
+							p := grid.Pos{
 								X: x,
 								Y: y,
 							}
 
-							router.nodes[p] = node.Id
+							if len(node.Members) == 0 {
+								r.nodes[p] = node.Id
+							}
 						}
 					}
 
-					router.extentMin = router.extentMin.Min(internal.GridPos{
+					r.extentMin = r.extentMin.Min(grid.Pos{
 						X: minX,
 						Y: minY,
 					})
-					router.extentMax = router.extentMax.Max(internal.GridPos{
+					r.extentMax = r.extentMax.Max(grid.Pos{
 						X: maxX,
 						Y: maxY,
 					})
 				}
 			}
 
-			labelAt := pos
-			switch node.LabelAt {
-			case "n":
-				labelAt.Y -= 1
-			case "ne":
-				labelAt.X += 1
-				labelAt.Y -= 1
-			case "e":
-				labelAt.X += 1
-			case "se":
-				labelAt.X += 1
-				labelAt.Y += 1
-			case "s":
-				labelAt.Y += 1
-			case "sw":
-				labelAt.X -= 1
-				labelAt.Y += 1
-			case "w":
-				labelAt.X -= 1
-			case "nw":
-				labelAt.X -= 1
-				labelAt.Y -= 1
-			}
+			labelAt := node.LabelAt.moveGridPos(pos)
 
 			if labelAt != pos {
-				router.nodeLabels[labelAt] = true
+				r.nodeLabels[labelAt] = true
 
-				router.extentMin = router.extentMin.Min(labelAt)
-				router.extentMax = router.extentMax.Max(labelAt)
+				r.extentMin = r.extentMin.Min(labelAt)
+				r.extentMax = r.extentMax.Max(labelAt)
 			}
 		}
 	}
 
+	// Nodes with members only take the cells not taken by their
+	// members, smallest first so nested nodes keep their cells
+	slices.SortFunc(containers, func(a, b *Node) int {
+		return cmp.Or(cmp.Compare(len(a.cells()), len(b.cells())), strings.Compare(string(a.Id), string(b.Id)))
+	})
+	for _, node := range containers {
+		for _, p := range node.cells() {
+			if _, ok := r.nodes[p]; !ok {
+				r.nodes[p] = node.Id
+			}
+		}
+		for _, member := range node.Members {
+			r.containers[member] = append(r.containers[member], node.Id)
+		}
+	}
+
+	r.resetKeepOut()
+
+	r.nodeExtentMin = r.extentMin
+	r.nodeExtentMax = r.extentMax
+
+	for _, obstacle := range topo.Obstacles {
+		if obstacle != nil {
+			r.obstacles = append(r.obstacles, obstacle)
+		}
+	}
+
 	// Add the links at the start, end and via points
 	for id, link := range topo.Links {
 		if link == nil {
@@ -146,59 +520,59 @@ func NewLinkRouter(topo *Topology) *LinkRouter {
 
 		// If the link already has a route, add it
 		if len(link.Route) > 0 {
-			router.addRoute(id, link.Route)
+			r.addRoute(id, link.Route)
 			continue
 		}
 
 		// Adding link at the via points helps to nudge
 		// routes away from those locations during initial
 		// routing
-		for _, via := range link.Via {
-			pos := internal.GridPos{
+		for _, via := range topo.routeAnchors(link) {
+			pos := grid.Pos{
 				X: via[0],
 				Y: via[1],
 			}
 
-			router.addLink(pos, id)
+			r.addLink(pos, id)
 		}
 
 		from := topo.GetNode(link.From)
 		if from != nil && from.Pos != nil {
-			pos := internal.GridPos{
+			pos := grid.Pos{
 				X: from.Pos[0],
 				Y: from.Pos[1],
 			}
 
-			router.addLink(pos, id)
+			r.addLink(pos, id)
 		}
 
 		to := topo.GetNode(link.To)
 		if to != nil && to.Pos != nil {
-			pos := internal.GridPos{
+			pos := grid.Pos{
 				X: to.Pos[0],
 				Y: to.Pos[1],
 			}
 
-			router.addLink(pos, id)
+			r.addLink(pos, id)
 		}
 	}
-
-	return router
 }
 
 // Set the minimum and maximum extents of the grid
 //
 // These are otherwise determined by the positions of nodes and
-// vias in the topology.
+// vias in the topology, plus ExtentBorder cells, and grown as
+// needed while routing. Explicitly set extents are never grown.
 //
 // Setting the extents such that nodes lie outside the grid will
 // cause links to fail to route
 func (r *LinkRouter) SetExtents(minX, minY, maxX, maxY int) {
-	min := internal.GridPos{
+	r.explicitExtents = true
+	min := grid.Pos{
 		X: int16(minX),
 		Y: int16(minY),
 	}
-	max := internal.GridPos{
+	max := grid.Pos{
 		X: int16(maxX),
 		Y: int16(maxY),
 	}
@@ -207,12 +581,328 @@ func (r *LinkRouter) SetExtents(minX, minY, maxX, maxY int) {
 }
 
 func (r *LinkRouter) GetExtents() (min, max vec.Vec2) {
-	return r.extentMin.ToVec(), r.extentMax.ToVec()
+	extMin, extMax := r.bounds(r.extentGrowth)
+	return extMin.ToVec(), extMax.ToVec()
+}
+
+// Returns the extents used for routing, including any border and
+// the given growth when the extents are determined automatically
+func (r *LinkRouter) bounds(growth int16) (min, max grid.Pos) {
+	if r.explicitExtents {
+		return r.extentMin, r.extentMax
+	}
+
+	border := r.ExtentBorder + growth
+	min = grid.Pos{X: r.extentMin.X - border, Y: r.extentMin.Y - border}
+	max = grid.Pos{X: r.extentMax.X + border, Y: r.extentMax.Y + border}
+	return min, max
+}
+
+// Returns whether any obstacle covers the cell
+func (r *LinkRouter) inObstacle(pos grid.Pos) bool {
+	for _, obstacle := range r.obstacles {
+		if obstacle.Contains(pos) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns whether the route runs along the edge of the extents
+// with the given growth
+func (r *LinkRouter) touchesBounds(path vec.Polyline, growth int16) bool {
+	extMin, extMax := r.bounds(growth)
+	for _, p := range path {
+		pos := grid.FromVec(p)
+		if pos.X <= extMin.X || pos.Y <= extMin.Y || pos.X >= extMax.X || pos.Y >= extMax.Y {
+			return true
+		}
+	}
+	return false
 }
 
 // Route all the links in the topology and update the
 // links.
+//
+// Links that already have a route start from it, but may be
+// re-routed if a better route is found, unless [Link.LockRoute]
+// is set.
+//
+// If routes were loaded with [LinkRouter.LoadCache], nothing is
+// routed.
+//
+// Links between two multi-cell nodes can't be routed. Like links
+// that no route is found for, they are listed in
+// [RouterStats.UnroutedLinks].
+//
+// Afterwards, [Link.RouteStats] is set for each link with a route.
 func (r *LinkRouter) RouteLinks() {
+	r.RouteLinksContext(context.Background())
+}
+
+// RouteLink routes a single link around the current routes of the
+// other links, for example after one of its via points is moved in
+// an editor. The link's Route and RouteStats are updated, and the
+// route is returned. If no route is found, the link's current route
+// is left as it is and an error is returned.
+//
+// Unlike [LinkRouter.RouteLinks], the other links aren't re-routed
+// to make room, and the link's bundle isn't updated.
+func (r *LinkRouter) RouteLink(id LinkId) (vec.Polyline, error) {
+	link := r.topo.GetLink(id)
+	if link == nil {
+		return nil, fmt.Errorf("Unknown link '%s'", id)
+	}
+	if link.LockRoute {
+		return nil, fmt.Errorf("Link '%s' has a locked route", id)
+	}
+	for _, nodeId := range []NodeId{link.From, link.To} {
+		if node := r.topo.GetNode(nodeId); node == nil || node.Pos == nil {
+			return nil, fmt.Errorf("Link '%s' has no position for node '%s'", id, nodeId)
+		}
+	}
+	if r.topo.GetNode(link.From).IsMultiCell() && r.topo.GetNode(link.To).IsMultiCell() {
+		return nil, fmt.Errorf("Link '%s' is between two multi-cell nodes", id)
+	}
+
+	r.resetWideCells()
+	r.resetKeepOut()
+	route := r.routeLink(id)
+	if route == nil {
+		return nil, fmt.Errorf("No route found for link '%s'", id)
+	}
+
+	path := route.path
+	if r.Smooth && !link.isOrthogonal(r.Orthogonal) {
+		r.moveRoute(id, link.Route, path)
+		link.Route = path
+		path = r.smoothRoute(id, path)
+	}
+	r.moveRoute(id, link.Route, path)
+	link.Route = path
+	r.weights[id] = route.weight
+	if r.PullTaut {
+		r.pullRoutesTaut([]LinkId{id})
+		path = link.Route
+	}
+	link.RouteStats = newRouteStats(path)
+
+	return path, nil
+}
+
+// Update re-routes the given links after the topology changes, e.g.
+// when links are added, removed or given new via points, without
+// re-routing the whole map. Whatever is recorded for the changed
+// links is removed from the grid and they are routed again. The links
+// that crossed or shared cells with them, or pass through the area
+// around their old routes, are then re-routed too, since their cost
+// could improve, and take their new route only if it costs less.
+//
+// Ids of links no longer in the topology just have their routes
+// removed, and links with locked routes keep them. Moving or adding
+// nodes still needs [LinkRouter.Reset] and a full
+// [LinkRouter.RouteLinks].
+//
+// Like [LinkRouter.RouteLink], bundles aren't updated. The
+// RouteStats of the re-routed links are updated, but not the totals
+// from [LinkRouter.Stats]. If any changed links can't be routed,
+// they are left without routes and an error naming them is returned.
+func (r *LinkRouter) Update(changed []LinkId) error {
+	r.resetWideCells()
+	r.resetKeepOut()
+
+	changed = sortedIds(changed)
+	changed = slices.Compact(changed)
+
+	neighbours := map[LinkId]bool{}
+	for _, id := range changed {
+		for _, other := range r.forgetLink(id) {
+			neighbours[other] = true
+		}
+	}
+	for _, id := range changed {
+		delete(neighbours, id)
+	}
+
+	failed := []string{}
+	routed := []LinkId{}
+	for _, id := range changed {
+		link := r.topo.GetLink(id)
+		if link == nil {
+			continue
+		}
+		if link.LockRoute {
+			r.addRoute(id, link.Route)
+			continue
+		}
+
+		link.Route = nil
+		link.RouteStats = nil
+		from, to := r.topo.GetNode(link.From), r.topo.GetNode(link.To)
+		if from != nil && to != nil && from.IsMultiCell() && to.IsMultiCell() {
+			failed = append(failed, string(id))
+			continue
+		}
+		route := r.routeLink(id)
+		if route == nil {
+			failed = append(failed, string(id))
+			continue
+		}
+		r.addRoute(id, route.path)
+		link.Route = route.path
+		r.weights[id] = route.weight
+		routed = append(routed, id)
+	}
+
+	// Removing or moving the changed routes can only make the
+	// neighbours' routes cheaper, so they only move if that opens
+	// up a better route
+	others := make([]LinkId, 0, len(neighbours))
+	for id := range neighbours {
+		others = append(others, id)
+	}
+	for _, id := range sortedIds(others) {
+		link := r.topo.GetLink(id)
+		if link == nil || link.LockRoute {
+			continue
+		}
+		route := r.routeLink(id)
+		if route == nil {
+			continue
+		}
+		if weight, ok := r.weights[id]; ok && route.weight >= weight {
+			continue
+		}
+		r.moveRoute(id, link.Route, route.path)
+		link.Route = route.path
+		r.weights[id] = route.weight
+		routed = append(routed, id)
+	}
+
+	if r.Smooth {
+		for _, id := range routed {
+			link := r.topo.GetLink(id)
+			if link.isOrthogonal(r.Orthogonal) {
+				continue
+			}
+			smoothed := r.smoothRoute(id, link.Route)
+			r.moveRoute(id, link.Route, smoothed)
+			link.Route = smoothed
+		}
+	}
+	if r.PullTaut {
+		r.pullRoutesTaut(routed)
+	}
+	for _, id := range routed {
+		link := r.topo.GetLink(id)
+		link.RouteStats = newRouteStats(link.Route)
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("No route found for links: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// How many cells around the bounding box of a forgotten route the
+// links are re-routed by [LinkRouter.Update], since links passing
+// close by may have been kept away by it
+const updateMargin = 1
+
+// Removes the link from every cell it is recorded in, whatever its
+// current route is, and returns the other links it shared cells
+// with or that pass near it
+func (r *LinkRouter) forgetLink(id LinkId) []LinkId {
+	others := []LinkId{}
+	isOther := func(l LinkId) bool {
+		return l != id && !slices.Contains(others, l)
+	}
+
+	found := false
+	var boxMin, boxMax grid.Pos
+	for pos, ids := range r.linkMap {
+		if !slices.Contains(ids, id) {
+			continue
+		}
+		if !found {
+			boxMin, boxMax = pos, pos
+			found = true
+		}
+		boxMin, boxMax = boxMin.Min(pos), boxMax.Max(pos)
+		r.removeLink(pos, id)
+	}
+	if found {
+		near := func(v, min, max int16) bool {
+			return int(v) >= int(min)-updateMargin && int(v) <= int(max)+updateMargin
+		}
+		for pos, ids := range r.linkMap {
+			if !near(pos.X, boxMin.X, boxMax.X) || !near(pos.Y, boxMin.Y, boxMax.Y) {
+				continue
+			}
+			for _, l := range ids {
+				if isOther(l) {
+					others = append(others, l)
+				}
+			}
+		}
+	}
+	for pos, ids := range r.wideCells {
+		if !slices.Contains(ids, id) {
+			continue
+		}
+		for _, l := range ids {
+			if isOther(l) {
+				others = append(others, l)
+			}
+		}
+		ids = slices.DeleteFunc(ids, func(l LinkId) bool {
+			return l == id
+		})
+		if len(ids) > 0 {
+			r.wideCells[pos] = ids
+		} else {
+			delete(r.wideCells, pos)
+		}
+	}
+	for pos, ids := range r.linkLabels {
+		ids = slices.DeleteFunc(ids, func(l LinkId) bool {
+			return l == id
+		})
+		if len(ids) > 0 {
+			r.linkLabels[pos] = ids
+		} else {
+			delete(r.linkLabels, pos)
+		}
+	}
+	for _, sides := range r.attachSides {
+		for side, ids := range sides {
+			sides[side] = slices.DeleteFunc(ids, func(l LinkId) bool {
+				return l == id
+			})
+		}
+	}
+	delete(r.weights, id)
+
+	return others
+}
+
+// RouteLinksContext is like [LinkRouter.RouteLinks], but stops
+// routing and returns the context's error if ctx is cancelled.
+// Links may then be left without routes, or with routes that
+// haven't been improved by the later passes.
+func (r *LinkRouter) RouteLinksContext(ctx context.Context) error {
+	r.stats = RouterStats{}
+	clear(r.searchLimited)
+	clear(r.weights)
+	defer r.updateRouteStats()
+	r.resetWideCells()
+	r.resetKeepOut()
+
+	// Cached routes are already the final routes
+	if r.cacheLoaded {
+		return nil
+	}
+
 	routes := []*route{}
 	links := r.topo.Links
 
@@ -233,23 +923,64 @@ func (r *LinkRouter) RouteLinks() {
 	// previous pass where re-routing a later link allows a better
 	// path for an earlier link.
 
+	// Links that will share the route of another link
+	var followers map[LinkId]LinkId
+	if r.Bundle || r.PairDirected {
+		followers = r.bundleFollowers()
+	}
+
 	// Find the initial routes
+	unrouted := []LinkId{}
+	seeded := []*route{}
 	for id, link := range links {
+		// Links between two multi-cell nodes can't be routed, so
+		// they're left as they are and counted as unrouted if they
+		// have no route
+		from, to := r.topo.GetNode(link.From), r.topo.GetNode(link.To)
+		if from != nil && to != nil && from.IsMultiCell() && to.IsMultiCell() {
+			continue
+		}
 		if len(link.Route) > 0 {
-			// Don't re-route links that have already been routed
+			// Existing routes are used as the initial route, and are
+			// only left alone by the later passes if they are locked
+			if !link.LockRoute {
+				seeded = append(seeded, &route{
+					id:     id,
+					path:   link.Route,
+					weight: link.Route.Length(),
+				})
+			}
 			continue
 		}
-		route := r.routeLink(id)
+		if _, ok := followers[id]; ok {
+			continue
+		}
+		unrouted = append(unrouted, id)
+	}
+	if r.StableTies {
+		// Links with routes of equal weight are then taken in id
+		// order by the later passes
+		slices.Sort(unrouted)
+		slices.SortFunc(seeded, func(a, b *route) int {
+			return strings.Compare(string(a.id), string(b.id))
+		})
+	}
+
+	// Add the links to the grid cells as they're set, seeded
+	// routes were added when the router was created. This happens
+	// even if routing was cancelled so the grid matches the links.
+	initial, err := r.routeInitial(ctx, unrouted)
+	for _, route := range initial {
 		if route != nil {
 			routes = append(routes, route)
-			link.Route = route.path
+			links[route.id].Route = route.path
+			r.addRoute(route.id, route.path)
 		}
 	}
-
-	// Add the links to the grid cells
-	for _, route := range routes {
-		r.addRoute(route.id, route.path)
+	if err != nil {
+		return err
 	}
+	routes = append(routes, seeded...)
 
 	// Sort the routes by their weight. Since the results of the
 	// next pass is dependent on the order we route the links,
@@ -265,63 +996,575 @@ func (r *LinkRouter) RouteLinks() {
 		}
 	})
 
-	newRoutes := []*route{}
-	for _, initRoute := range routes {
-		route := r.routeLink(initRoute.id)
-		if route != nil {
-			r.moveRoute(route.id, initRoute.path, route.path)
+	newRoutes := []*route{}
+	for i, initRoute := range routes {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		route := r.routeLink(initRoute.id)
+		r.reportProgress(initRoute.id, 1, i+1, len(routes))
+		if route != nil {
+			r.moveRoute(route.id, initRoute.path, route.path)
+
+			// Set the route on the link
+			link := r.topo.GetLink(route.id)
+			if link != nil {
+				link.Route = route.path
+				newRoutes = append(newRoutes, route)
+			}
+		}
+	}
+
+	// Sort again, this favours improving short links
+	// over long ones, which works because short links
+	// tend to have less flexibility in possible routes
+	slices.SortStableFunc(newRoutes, func(a, b *route) int {
+		aWeightRatio := float32(a.path.Length()) / float32(a.weight)
+		bWeightRatio := float32(b.path.Length()) / float32(b.weight)
+		d := aWeightRatio - bWeightRatio
+		if d < 0 {
+			return -1
+		} else if d > 0 {
+			return 1
+		} else {
+			return 0
+		}
+	})
+
+	// Iterate until a fix-point or we reach the iteration limit.
+	// In practise this loop only tends to run once or twice.
+	for iter := 0; iter < r.Config.IterationLimit; iter++ {
+		r.stats.Iterations = iter + 1
+		updated := false
+		for i, rt := range newRoutes {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			route := r.routeLink(rt.id)
+			r.reportProgress(rt.id, iter+2, i+1, len(newRoutes))
+			if route != nil {
+				if route.weight < rt.weight {
+					link := r.topo.GetLink(route.id)
+					if link != nil {
+						r.moveRoute(route.id, rt.path, route.path)
+						link.Route = route.path
+						newRoutes[i] = route
+						updated = true
+					}
+				}
+			}
+		}
+
+		if !updated {
+			break
+		}
+	}
+
+	for _, rt := range newRoutes {
+		r.weights[rt.id] = rt.weight
+	}
+
+	if r.Smooth {
+		for _, rt := range newRoutes {
+			link := r.topo.GetLink(rt.id)
+			if link == nil || link.isOrthogonal(r.Orthogonal) {
+				continue
+			}
+			smoothed := r.smoothRoute(rt.id, link.Route)
+			r.moveRoute(rt.id, link.Route, smoothed)
+			link.Route = smoothed
+		}
+	}
+
+	if r.PullTaut {
+		ids := make([]LinkId, len(newRoutes))
+		for i, rt := range newRoutes {
+			ids[i] = rt.id
+		}
+		r.pullRoutesTaut(ids)
+	}
+
+	// Copy the routes to the rest of each bundle
+	for id, leaderId := range followers {
+		link := links[id]
+		leader := links[leaderId]
+		if len(leader.Route) == 0 {
+			continue
+		}
+
+		route := slices.Clone(leader.Route)
+		if link.From != leader.From {
+			route = route.Reverse()
+		}
+		link.Route = route
+		r.addRoute(id, route)
+	}
+
+	return nil
+}
+
+// Sets the route stats of the links from their current routes, and
+// the totals for the run
+func (r *LinkRouter) updateRouteStats() {
+	// The links passing through each cell, and making each diagonal
+	// step, by its two cells in order
+	cellLinks := map[grid.Pos][]LinkId{}
+	diagonals := map[[2]grid.Pos][]LinkId{}
+
+	for id, link := range r.topo.Links {
+		if link == nil {
+			continue
+		}
+		if len(link.Route) < 2 {
+			link.RouteStats = nil
+			r.stats.Unrouted++
+			r.stats.UnroutedLinks = append(r.stats.UnroutedLinks, id)
+			continue
+		}
+		link.RouteStats = newRouteStats(link.Route)
+		r.stats.Routed++
+		r.stats.TotalLength += link.RouteStats.Length
+
+		// Routes pulled taut only keep their corners, so the crossings
+		// are found from every cell they pass through
+		cells := routeCells(link.Route)
+		for i, pos := range cells {
+			if !slices.Contains(cellLinks[pos], id) {
+				cellLinks[pos] = append(cellLinks[pos], id)
+			}
+			if i == 0 {
+				continue
+			}
+			prev := cells[i-1]
+			if prev.X != pos.X && prev.Y != pos.Y {
+				step := [2]grid.Pos{prev, pos}
+				if pos.Y < prev.Y {
+					step = [2]grid.Pos{pos, prev}
+				}
+				diagonals[step] = append(diagonals[step], id)
+			}
+		}
+	}
+
+	for pos, links := range cellLinks {
+		if _, isNode := r.nodes[pos]; !isNode {
+			r.stats.Crossings += len(links) * (len(links) - 1) / 2
+		}
+	}
+	// Diagonal steps heading south-east cross the step heading
+	// south-west through the same four cells
+	for step, links := range diagonals {
+		if step[1].X < step[0].X {
+			continue
+		}
+		other := [2]grid.Pos{{X: step[1].X, Y: step[0].Y}, {X: step[0].X, Y: step[1].Y}}
+		for _, l1 := range links {
+			for _, l2 := range diagonals[other] {
+				if l1 != l2 {
+					r.stats.Crossings++
+				}
+			}
+		}
+	}
+
+	slices.Sort(r.stats.UnroutedLinks)
+
+	r.stats.SearchLimited = make([]LinkId, 0, len(r.searchLimited))
+	for id := range r.searchLimited {
+		r.stats.SearchLimited = append(r.stats.SearchLimited, id)
+	}
+	slices.Sort(r.stats.SearchLimited)
+}
+
+// Returns the stats of a route with at least two points
+func newRouteStats(path vec.Polyline) *RouteStats {
+	return &RouteStats{
+		Length: path.Length(),
+		Bends:  len(path.Simplify()) - 2,
+	}
+}
+
+// Stats returns statistics for the last call to
+// [LinkRouter.RouteLinks] or [LinkRouter.RouteLinksContext], such
+// as the number of crossings and the total length of the routes.
+// Comparing them between runs can show when a change to the
+// topology or settings makes the map worse.
+func (r *LinkRouter) Stats() RouterStats {
+	stats := r.stats
+	stats.SearchLimited = slices.Clone(stats.SearchLimited)
+	stats.UnroutedLinks = slices.Clone(stats.UnroutedLinks)
+	return stats
+}
+
+// Groups links between the same pair of nodes into bundles, returning
+// a map from each link that follows another link's route to the link
+// that is routed. The link with the lowest id in each bundle is the
+// one routed.
+//
+// Without Bundle, only directed pairs are grouped: each bundle is a
+// link and the next link running the other way.
+func (r *LinkRouter) bundleFollowers() map[LinkId]LinkId {
+	type nodePair struct {
+		a, b       NodeId
+		orthogonal bool
+	}
+
+	ids := make([]LinkId, 0, len(r.topo.Links))
+	for id, link := range r.topo.Links {
+		// Links with their own constraints can't be bundled
+		if link == nil || len(link.Route) > 0 || len(r.topo.routeAnchors(link)) > 0 ||
+			link.AttachFrom != DirectionNone || link.AttachTo != DirectionNone {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	// The links routed for each pair of nodes that other links can
+	// still follow
+	leaders := map[nodePair][]LinkId{}
+	followers := map[LinkId]LinkId{}
+	for _, id := range ids {
+		link := r.topo.Links[id]
+		pair := nodePair{a: link.From, b: link.To, orthogonal: link.isOrthogonal(r.Orthogonal)}
+		if pair.b < pair.a {
+			pair.a, pair.b = pair.b, pair.a
+		}
+
+		waiting := leaders[pair]
+		if r.Bundle {
+			if len(waiting) > 0 {
+				followers[id] = waiting[0]
+			} else {
+				leaders[pair] = []LinkId{id}
+			}
+			continue
+		}
+
+		// Pair the link with the first waiting link running the
+		// other way
+		i := slices.IndexFunc(waiting, func(leader LinkId) bool {
+			return r.topo.Links[leader].From != link.From
+		})
+		if i >= 0 {
+			followers[id] = waiting[i]
+			leaders[pair] = slices.Delete(waiting, i, i+1)
+		} else {
+			leaders[pair] = append(waiting, id)
+		}
+	}
+
+	return followers
+}
+
+// Finds the initial routes for the links. The routes are independent
+// of each other, so they are found using multiple goroutines if
+// Workers is set.
+//
+// If ctx is cancelled, the routes found so far are returned along
+// with the context's error.
+func (r *LinkRouter) routeInitial(ctx context.Context, ids []LinkId) ([]*route, error) {
+	routes := make([]*route, len(ids))
+
+	// Every link is routed within the same extents, and the extents
+	// grow by what the links needed afterwards, so the routes don't
+	// depend on the order the workers finish in
+	growth := r.extentGrowth
+	growths := make([]int16, len(ids))
+	defer func() {
+		for _, g := range growths {
+			r.extentGrowth = max(r.extentGrowth, g)
+		}
+	}()
+
+	if r.Workers < 2 || len(ids) < 2 {
+		for i, id := range ids {
+			if err := ctx.Err(); err != nil {
+				return routes, err
+			}
+			routes[i], growths[i] = r.findRoute(id, growth)
+			r.reportProgress(id, 0, i+1, len(ids))
+		}
+		return routes, nil
+	}
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+
+	// Serializes the progress calls
+	var progressMu sync.Mutex
+	done := 0
+
+	for w := 0; w < min(r.Workers, len(ids)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				routes[i], growths[i] = r.findRoute(ids[i], growth)
+
+				progressMu.Lock()
+				done++
+				r.reportProgress(ids[i], 0, done, len(ids))
+				progressMu.Unlock()
+			}
+		}()
+	}
+
+	var err error
+	for i := range ids {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	return routes, err
+}
+
+func (r *LinkRouter) reportProgress(id LinkId, pass, done, total int) {
+	if r.Progress != nil {
+		r.Progress(id, pass, done, total)
+	}
+}
+
+// Replaces staircase sequences in the path, that is, alternating
+// single-cell horizontal and vertical steps, with diagonal steps.
+//
+// A corner is only cut if the cell on the other side of the
+// diagonal is free and the diagonal doesn't cross another link.
+func (r *LinkRouter) smoothRoute(id LinkId, path vec.Polyline) vec.Polyline {
+	if len(path) < 4 {
+		return path
+	}
+
+	points := make([]grid.Pos, len(path))
+	for i, p := range path {
+		points[i] = grid.FromVec(p)
+	}
+
+	step := func(i int) grid.Pos {
+		if i < 0 || i+1 >= len(points) {
+			return grid.Pos{}
+		}
+		return grid.Pos{
+			X: points[i+1].X - points[i].X,
+			Y: points[i+1].Y - points[i].Y,
+		}
+	}
+
+	isCardinal := func(d grid.Pos) bool {
+		return (d.X == 0) != (d.Y == 0)
+	}
+
+	// Via points, the route prefix and suffix and any corridor must
+	// stay on the route, as must the first and last steps if the link
+	// attaches to a particular side of its nodes
+	vias := map[grid.Pos]bool{}
+	if link := r.topo.GetLink(id); link != nil {
+		for _, anchor := range r.topo.routeAnchors(link) {
+			vias[grid.Pos{X: anchor[0], Y: anchor[1]}] = true
+		}
+		if link.AttachFrom != DirectionNone {
+			vias[points[1]] = true
+		}
+		if link.AttachTo != DirectionNone {
+			vias[points[len(points)-2]] = true
+		}
+	}
+
+	canCut := func(corner, other grid.Pos) bool {
+		if vias[corner] {
+			return false
+		}
+		if _, isNode := r.nodes[other]; isNode {
+			return false
+		}
+		if _, isLabel := r.nodeLabels[other]; isLabel {
+			return false
+		}
+		// The diagonal would cross any link that passes through
+		// both the corner and the other cell
+		for _, l1 := range r.linkMap[corner] {
+			if l1 == id {
+				continue
+			}
+			for _, l2 := range r.linkMap[other] {
+				if l1 == l2 {
+					return false
+				}
+			}
+		}
+		return true
+	}
+
+	smoothed := vec.Polyline{path[0]}
+	for i := 0; i < len(points)-1; i++ {
+		d1 := step(i)
+		d2 := step(i + 1)
+
+		// Only cut corners that are part of a staircase, where the
+		// step before or after repeats the direction of the corner
+		isStair := isCardinal(d1) && isCardinal(d2) && d1.X*d2.X+d1.Y*d2.Y == 0 &&
+			(step(i-1) == d2 || step(i+2) == d1)
+
+		if isStair {
+			corner := points[i+1]
+			other := grid.Pos{X: points[i].X + d2.X, Y: points[i].Y + d2.Y}
+			if canCut(corner, other) {
+				smoothed = append(smoothed, path[i+2])
+				i += 1
+				continue
+			}
+		}
+
+		smoothed = append(smoothed, path[i+1])
+	}
+
+	return smoothed
+}
+
+// Works out the cells kept clear by each node again, since
+// NodeClearance can be changed after the topology is added
+func (r *LinkRouter) resetKeepOut() {
+	clear(r.keepOut)
+	for _, node := range r.topo.Nodes {
+		if node == nil || node.Pos == nil {
+			continue
+		}
+		dist := node.KeepOut
+		// Links pass through the nodes containing their own nodes,
+		// so those only keep the distance they ask for
+		if len(node.Members) == 0 {
+			dist = max(dist, r.NodeClearance)
+		}
+		if dist > 0 {
+			r.addKeepOut(node, dist)
+		}
+	}
+}
+
+// Records the cells within dist of the node
+func (r *LinkRouter) addKeepOut(node *Node, dist int16) {
+	minVec, maxVec := node.GetExtents()
 
-			// Set the route on the link
-			link := r.topo.GetLink(route.id)
-			if link != nil {
-				link.Route = route.path
-				newRoutes = append(newRoutes, route)
-			}
+	minX := int16(f32.Ceil(minVec.X)) - dist
+	minY := int16(f32.Ceil(minVec.Y)) - dist
+	maxX := int16(f32.Ceil(maxVec.X)) + dist
+	maxY := int16(f32.Ceil(maxVec.Y)) + dist
+
+	for x := minX; x < maxX; x++ {
+		for y := minY; y < maxY; y++ {
+			p := grid.Pos{X: x, Y: y}
+			r.keepOut[p] = append(r.keepOut[p], node.Id)
 		}
 	}
+}
 
-	// Sort again, this favours improving short links
-	// over long ones, which works because short links
-	// tend to have less flexibility in possible routes
-	slices.SortStableFunc(newRoutes, func(a, b *route) int {
-		aWeightRatio := float32(a.path.Length()) / float32(a.weight)
-		bWeightRatio := float32(b.path.Length()) / float32(b.weight)
-		d := aWeightRatio - bWeightRatio
-		if d < 0 {
-			return -1
-		} else if d > 0 {
-			return 1
-		} else {
-			return 0
+// Returns whether the position is kept clear by a node
+// other than the start or goal of the current route
+func (f *routeFinder) inKeepOut(pos grid.Pos) bool {
+	for _, id := range f.router.keepOut[pos] {
+		if id != f.startNode && id != f.goalNode {
+			return true
 		}
-	})
+	}
+	return false
+}
 
-	// Iterate until a fix-point or we reach the iteration limit.
-	// In practise this loop only tends to run once or twice.
-	for i := 0; i < routeIterLimit; i++ {
-		updated := false
-		for i, rt := range newRoutes {
-			route := r.routeLink(rt.id)
-			if route != nil {
-				if route.weight < rt.weight {
-					link := r.topo.GetLink(route.id)
-					if link != nil {
-						r.moveRoute(route.id, rt.path, route.path)
-						link.Route = route.path
-						newRoutes[i] = route
-						updated = true
-					}
-				}
-			}
+// CellOccupancy is what the router knows about a grid cell, see
+// [LinkRouter.Occupancy]
+type CellOccupancy struct {
+	// The node covering the cell, links other than its own can't
+	// pass through it when AvoidNodes is set
+	Node       NodeId
+	// Whether the cell has a node label, which links avoid
+	NodeLabel  bool
+	// Whether the cell is covered by an obstacle
+	Obstacle   bool
+	// The nodes whose keep-out covers the cell
+	KeepOut    []NodeId
+	// The links whose labels are expected in the cell
+	LinkLabels []LinkId
+	// The links passing through the cell, each adds to the cost
+	// of routing other links through it
+	Links      []LinkId
+	// The wide links running beside the cell, which cost the same
+	// as links passing through it
+	WideLinks  []LinkId
+}
+
+// Occupancy returns everything that affects the cost of routing
+// through each cell, for the cells that have anything in them. This
+// is intended for debugging why a link took the route it did, see
+// [Renderer.RenderOccupancy].
+func (r *LinkRouter) Occupancy() grid.Grid[CellOccupancy] {
+	cells := grid.Grid[CellOccupancy]{}
+	update := func(pos grid.Pos, fn func(c *CellOccupancy)) {
+		cell := cells[pos]
+		fn(&cell)
+		cells[pos] = cell
+	}
+
+	for pos, id := range r.nodes {
+		update(pos, func(c *CellOccupancy) { c.Node = id })
+	}
+	for pos := range r.nodeLabels {
+		update(pos, func(c *CellOccupancy) { c.NodeLabel = true })
+	}
+	// Only the part of each obstacle that routes could reach matters
+	extMin, extMax := r.bounds(max(r.extentGrowth, r.MaxExtentGrowth))
+	for _, obstacle := range r.obstacles {
+		for _, pos := range obstacle.CellsWithin(extMin, extMax) {
+			update(pos, func(c *CellOccupancy) { c.Obstacle = true })
+		}
+	}
+	for pos, ids := range r.keepOut {
+		if len(ids) > 0 {
+			update(pos, func(c *CellOccupancy) { c.KeepOut = sortedIds(ids) })
+		}
+	}
+	for pos, ids := range r.linkLabels {
+		if len(ids) > 0 {
+			update(pos, func(c *CellOccupancy) { c.LinkLabels = sortedIds(ids) })
+		}
+	}
+	for pos, ids := range r.linkMap {
+		if len(ids) > 0 {
+			update(pos, func(c *CellOccupancy) { c.Links = sortedIds(ids) })
+		}
+	}
+	for pos, ids := range r.wideCells {
+		if len(ids) > 0 {
+			update(pos, func(c *CellOccupancy) { c.WideLinks = sortedIds(ids) })
 		}
+	}
 
-		if !updated {
-			break
+	return cells
+}
+
+// Returns a sorted copy of ids
+func sortedIds[T ~string](ids []T) []T {
+	ids = slices.Clone(ids)
+	slices.Sort(ids)
+	return ids
+}
+
+// LinkDensity returns the number of links passing through each
+// occupied grid cell. After routing this reflects the final routes.
+func (r *LinkRouter) LinkDensity() grid.Grid[int] {
+	density := grid.Grid[int]{}
+	for pos, links := range r.linkMap {
+		if len(links) > 0 {
+			density[pos] = len(links)
 		}
 	}
+
+	return density
 }
 
-func (r *LinkRouter) addLink(pos internal.GridPos, id LinkId) {
+func (r *LinkRouter) addLink(pos grid.Pos, id LinkId) {
 	curLinks := r.linkMap[pos]
 	// Check that it's not already in the list
 	for _, lid := range curLinks {
@@ -336,7 +1579,7 @@ func (r *LinkRouter) addLink(pos internal.GridPos, id LinkId) {
 	r.extentMax = r.extentMax.Max(pos)
 }
 
-func (r *LinkRouter) removeLink(pos internal.GridPos, id LinkId) {
+func (r *LinkRouter) removeLink(pos grid.Pos, id LinkId) {
 	curLinks, ok := r.linkMap[pos]
 	if !ok {
 		return
@@ -356,24 +1599,216 @@ func (r *LinkRouter) removeLink(pos internal.GridPos, id LinkId) {
 
 func (r *LinkRouter) addRoute(id LinkId, path vec.Polyline) {
 	for _, point := range path {
-		pos := internal.GridPos{
+		pos := grid.Pos{
 			X: int16(point.X),
 			Y: int16(point.Y),
 		}
 
 		r.addLink(pos, id)
 	}
+
+	for _, pos := range r.labelCells(id, path) {
+		if !slices.Contains(r.linkLabels[pos], id) {
+			r.linkLabels[pos] = append(r.linkLabels[pos], id)
+		}
+	}
+
+	for _, pos := range r.wideLinkCells(id, path) {
+		if !slices.Contains(r.wideCells[pos], id) {
+			r.wideCells[pos] = append(r.wideCells[pos], id)
+		}
+	}
+
+	r.forEachAttachSide(path, func(node NodeId, side Direction) {
+		sides := r.attachSides[node]
+		if sides == nil {
+			sides = map[Direction][]LinkId{}
+			r.attachSides[node] = sides
+		}
+		if !slices.Contains(sides[side], id) {
+			sides[side] = append(sides[side], id)
+		}
+	})
 }
 
 func (r *LinkRouter) removeRoute(id LinkId, path vec.Polyline) {
 	for _, point := range path {
-		pos := internal.GridPos{
+		pos := grid.Pos{
 			X: int16(point.X),
 			Y: int16(point.Y),
 		}
 
 		r.removeLink(pos, id)
 	}
+
+	for _, pos := range r.labelCells(id, path) {
+		labels := slices.DeleteFunc(r.linkLabels[pos], func(l LinkId) bool {
+			return l == id
+		})
+		if len(labels) > 0 {
+			r.linkLabels[pos] = labels
+		} else {
+			delete(r.linkLabels, pos)
+		}
+	}
+
+	for _, pos := range r.wideLinkCells(id, path) {
+		ids := slices.DeleteFunc(r.wideCells[pos], func(l LinkId) bool {
+			return l == id
+		})
+		if len(ids) > 0 {
+			r.wideCells[pos] = ids
+		} else {
+			delete(r.wideCells, pos)
+		}
+	}
+
+	r.forEachAttachSide(path, func(node NodeId, side Direction) {
+		sides := r.attachSides[node]
+		sides[side] = slices.DeleteFunc(sides[side], func(l LinkId) bool {
+			return l == id
+		})
+	})
+}
+
+// Calls fn with the side of the node each end of the path leaves
+// from, for the ends at single-cell nodes
+func (r *LinkRouter) forEachAttachSide(path vec.Polyline, fn func(node NodeId, side Direction)) {
+	if len(path) < 2 {
+		return
+	}
+
+	ends := [][2]grid.Pos{
+		{grid.FromVec(path[0]), grid.FromVec(path[1])},
+		{grid.FromVec(path[len(path)-1]), grid.FromVec(path[len(path)-2])},
+	}
+	for _, end := range ends {
+		nodeId, ok := r.nodes[end[0]]
+		if !ok {
+			continue
+		}
+		if node := r.topo.GetNode(nodeId); node == nil || node.IsMultiCell() {
+			continue
+		}
+		fn(nodeId, directionFromStep(end[1].X-end[0].X, end[1].Y-end[0].Y))
+	}
+}
+
+// Returns the nodes the given nodes are members of, including
+// through other nodes, or nil if there are none
+func (r *LinkRouter) containing(ids ...NodeId) map[NodeId]bool {
+	var found map[NodeId]bool
+	for len(ids) > 0 {
+		id := ids[len(ids)-1]
+		ids = ids[:len(ids)-1]
+		for _, container := range r.containers[id] {
+			if found[container] {
+				continue
+			}
+			if found == nil {
+				found = map[NodeId]bool{}
+			}
+			found[container] = true
+			ids = append(ids, container)
+		}
+	}
+	return found
+}
+
+// Returns whether a link other than id leaves the node from side
+func (r *LinkRouter) sideTaken(node NodeId, side Direction, id LinkId) bool {
+	for _, l := range r.attachSides[node][side] {
+		if l != id {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the cells where the renderer will put the labels of the
+// link if it takes the given path, or nothing if LinkLabelWeight
+// isn't set. Each label goes halfway along its half of the link.
+func (r *LinkRouter) labelCells(id LinkId, path vec.Polyline) []grid.Pos {
+	link := r.topo.GetLink(id)
+	if r.Config.LinkLabelWeight <= 0 || link == nil {
+		return nil
+	}
+	return link.labelCells(path)
+}
+
+// Returns how much other links avoid the link, from the AvoidWeight
+// of its class
+func (r *LinkRouter) avoidWeight(id LinkId) float32 {
+	if len(r.Config.LinkClasses) == 0 {
+		return 1
+	}
+	link := r.topo.GetLink(id)
+	if link == nil || link.Class == "" {
+		return 1
+	}
+	if costs := r.Config.LinkClasses[link.Class]; costs != nil && costs.AvoidWeight.Valid {
+		return costs.AvoidWeight.Value
+	}
+	return 1
+}
+
+// Returns whether the link is drawn wide enough that it takes up
+// the cells beside its route, see WideLinkSize
+func (r *LinkRouter) isWide(id LinkId) bool {
+	link := r.topo.GetLink(id)
+	if r.WideLinkSize <= 0 || link == nil {
+		return false
+	}
+	if r.LinkSize != nil {
+		return r.LinkSize(link) >= r.WideLinkSize
+	}
+	return link.Style != nil && link.Style.Size >= r.WideLinkSize
+}
+
+// Works out the cells beside the current routes of wide links again,
+// since WideLinkSize can be changed after the routes are added
+func (r *LinkRouter) resetWideCells() {
+	clear(r.wideCells)
+	for id, link := range r.topo.Links {
+		if link == nil {
+			continue
+		}
+		for _, pos := range r.wideLinkCells(id, link.Route) {
+			if !slices.Contains(r.wideCells[pos], id) {
+				r.wideCells[pos] = append(r.wideCells[pos], id)
+			}
+		}
+	}
+}
+
+// Returns the cells on each side of the path if the link is wide,
+// or nothing if it isn't. The sides are taken across each step, so
+// corners are covered on both sides.
+func (r *LinkRouter) wideLinkCells(id LinkId, path vec.Polyline) []grid.Pos {
+	if len(path) < 2 || !r.isWide(id) {
+		return nil
+	}
+
+	// Routes can skip cells along straight runs, e.g. locked
+	// routes from the topology, so each segment is walked a cell
+	// at a time
+	cells := []grid.Pos{}
+	for i := 1; i < len(path); i++ {
+		a, b := path[i-1], path[i]
+		steps := int(f32.Ceil(max(f32.Abs(b.X-a.X), f32.Abs(b.Y-a.Y))))
+		if steps == 0 {
+			continue
+		}
+		step := b.Sub(a).Div(float32(steps))
+		dx, dy := int16(f32.Round(step.X)), int16(f32.Round(step.Y))
+		for j := 0; j <= steps; j++ {
+			pos := grid.FromVec(a.Add(step.Mul(float32(j))))
+			cells = append(cells,
+				grid.Pos{X: pos.X - dy, Y: pos.Y + dx},
+				grid.Pos{X: pos.X + dy, Y: pos.Y - dx})
+		}
+	}
+	return cells
 }
 
 func (r *LinkRouter) moveRoute(id LinkId, oldPath, newPath vec.Polyline) {
@@ -381,19 +1816,30 @@ func (r *LinkRouter) moveRoute(id LinkId, oldPath, newPath vec.Polyline) {
 	r.addRoute(id, newPath)
 }
 
+// Routes the link, growing the extents if it needs more room
 func (r *LinkRouter) routeLink(id LinkId) *route {
+	route, growth := r.findRoute(id, r.extentGrowth)
+	r.extentGrowth = max(r.extentGrowth, growth)
+	return route
+}
+
+// Finds a route for the link within the extents grown by growth,
+// growing them further if the route needs more room. Returns the
+// route and the growth it was found with, the router's extents
+// aren't changed, so links can be routed concurrently.
+func (r *LinkRouter) findRoute(id LinkId, growth int16) (*route, int16) {
 	link := r.topo.GetLink(id)
 	if link == nil {
-		return nil
+		return nil, growth
 	}
 
 	start := r.topo.GetNode(link.From)
 	if start == nil || start.Pos == nil {
-		return nil
+		return nil, growth
 	}
 	goal := r.topo.GetNode(link.To)
 	if goal == nil || goal.Pos == nil {
-		return nil
+		return nil, growth
 	}
 
 	startNode := link.From
@@ -414,35 +1860,140 @@ func (r *LinkRouter) routeLink(id LinkId) *route {
 		startNode: startNode,
 		goalNode:  goalNode,
 		goalIsMulti: goal.IsMultiCell(),
+		orthogonal: link.isOrthogonal(r.Orthogonal),
+		startSide: link.AttachFrom,
+		goalSide:  link.AttachTo,
 		linkId:    id,
 		router:    r,
+		growth:    growth,
+	}
+	if swapped {
+		finder.startSide, finder.goalSide = finder.goalSide, finder.startSide
+	}
+	finder.separate = r.SeparateLinks
+	finder.passable = r.containing(startNode, goalNode)
+
+	finder.crossingWeight = r.Config.CrossingWeight
+	finder.turnCost = r.Config.TurnCost
+	finder.sharpTurnCost = r.Config.SharpTurnCost
+	if costs := r.Config.LinkClasses[link.Class]; costs != nil && link.Class != "" {
+		if costs.CrossingWeight.Valid {
+			finder.crossingWeight = costs.CrossingWeight.Value
+		}
+		if costs.TurnCost.Valid {
+			finder.turnCost = costs.TurnCost.Value
+		}
+		if costs.SharpTurnCost.Valid {
+			finder.sharpTurnCost = costs.SharpTurnCost.Value
+		}
+	}
+
+	if goal.IsMultiCell() {
+		for _, side := range goal.AttachSides {
+			if side != DirectionNone {
+				finder.goalSides = append(finder.goalSides, side)
+			}
+		}
+		minVec, maxVec := goal.GetExtents()
+		finder.goalMin = grid.Pos{X: int16(f32.Ceil(minVec.X)), Y: int16(f32.Ceil(minVec.Y))}
+		finder.goalMax = grid.Pos{X: int16(f32.Ceil(maxVec.X)) - 1, Y: int16(f32.Ceil(maxVec.Y)) - 1}
 	}
 
-	vias := make([]internal.GridPos, len(link.Via))
+	// The route prefix and suffix are anchored by treating them
+	// as via points before and after the regular via points.
+	anchors := r.topo.routeAnchors(link)
+	vias := make([]grid.Pos, len(anchors))
 
-	for i, via := range link.Via {
-		vias[i] = internal.GridPos{
+	for i, via := range anchors {
+		vias[i] = grid.Pos{
 			X: via[0],
 			Y: via[1],
 		}
 
 	}
 
-	startPos := internal.GridPos{
+	// Only the via points themselves can have a radius, they come
+	// after the route prefix
+	finder.viaRadii = make([]int16, len(anchors))
+	for i := range link.Via {
+		finder.viaRadii[len(link.RoutePrefix)+i] = link.viaRadius(i)
+	}
+
+	if r.OrderVias && len(link.Via) > 1 {
+		r.orderVias(link, vias, finder.viaRadii)
+	}
+
+	// The vias are ordered from the "from" node to the "to" node,
+	// so they need to be reversed when routing the other way
+	if swapped {
+		slices.Reverse(vias)
+		slices.Reverse(finder.viaRadii)
+	}
+
+	startPos := grid.Pos{
 		X: start.Pos[0],
 		Y: start.Pos[1],
 	}
 
-	goalPos := internal.GridPos{
+	goalPos := grid.Pos{
 		X: goal.Pos[0],
 		Y: goal.Pos[1],
 	}
 
 	route := finder.run(startPos, goalPos, vias)
-	if swapped {
+
+	// Sharing a side with another link is better than no route
+	if route == nil && finder.separate {
+		finder.separate = false
+		route = finder.run(startPos, goalPos, vias)
+	}
+
+	// If the search was limited by the extents, grow them
+	// and try again, keeping the better route
+	canGrow := r.AutoExpand && !r.explicitExtents
+	for canGrow && finder.hitBounds {
+		if route != nil && !r.touchesBounds(route.path, finder.growth) {
+			break
+		}
+		if finder.growth >= r.MaxExtentGrowth {
+			break
+		}
+		finder.growth = min(finder.growth+max(r.ExtentBorder, 1), r.MaxExtentGrowth)
+
+		newRoute := finder.run(startPos, goalPos, vias)
+		if newRoute == nil {
+			continue
+		}
+		if route == nil || newRoute.weight < route.weight {
+			route = newRoute
+		} else {
+			break
+		}
+	}
+
+	// If the route goes too far out of its way to avoid other
+	// links, route it again ignoring them
+	if route != nil && link.MaxDetour > 0 {
+		direct := float32(0)
+		prev := startPos
+		for _, pos := range append(slices.Clone(vias), goalPos) {
+			direct += prev.EuclideanDistance(pos)
+			prev = pos
+		}
+
+		if route.path.Length() > link.MaxDetour*direct {
+			finder.ignoreLinks = true
+			newRoute := finder.run(startPos, goalPos, vias)
+			if newRoute != nil && newRoute.path.Length() < route.path.Length() {
+				route = newRoute
+			}
+		}
+	}
+
+	if swapped && route != nil {
 		route.path = route.path.Reverse()
 	}
-	return route
+	return route, finder.growth
 }
 
 type route struct {
@@ -473,19 +2024,51 @@ type routeFinder struct {
 	startNode, goalNode NodeId
 	start, goal         gridNode
 	goalIsMulti         bool
-	vias                []internal.GridPos
+	// The sides of a multi-cell goal node the route can arrive
+	// at, any side if empty, and the cells the node covers
+	goalSides           []Direction
+	goalMin, goalMax    grid.Pos
+	orthogonal          bool
+	// The sides of the start and goal nodes the route must
+	// attach to, DirectionNone allows any side
+	startSide, goalSide Direction
+	// Avoid the sides of the start and goal nodes other links
+	// already leave from
+	separate            bool
+	// The nodes containing the start and goal nodes, which the
+	// route can pass through
+	passable            map[NodeId]bool
+	vias                []grid.Pos
+	// How close the route must pass to each via point, by
+	// Chebyshev distance, 0 is through it
+	viaRadii            []int16
 	linkId              LinkId
 	router              *LinkRouter
 	cameFrom            map[gridNode]gridNode
+	extMin, extMax      grid.Pos
+	// How far the extents are grown for the search
+	growth              int16
+	hitBounds           bool
+	// Route without the penalties for other links
+	ignoreLinks         bool
+	// The costs for the link, from the config and the link's class
+	crossingWeight      float32
+	turnCost            float32
+	sharpTurnCost       float32
 }
 
 // Represents a node in the implicit graph we are traversing
 type gridNode struct {
-	gridPos    internal.GridPos // The grid positions
+	gridPos    grid.Pos // The grid positions
 	dirX, dirY int16            // The current direction
 	via        int              // Which via point we need to head to next
 }
 
+// Returns the direction the node is heading
+func (g gridNode) direction() Direction {
+	return directionFromStep(g.dirX, g.dirY)
+}
+
 // This is the start of the route finding algorithm.
 //
 // The algorithm works by finding a path through an implicit graph defined
@@ -496,11 +2079,12 @@ type gridNode struct {
 // via position. The start node is then placed on the highest grid and
 // the goal node placed on the lowest grid, forcing the path to traverse
 // the via points by construction.
-func (f *routeFinder) run(start, goal internal.GridPos, vias []internal.GridPos) *route {
+func (f *routeFinder) run(start, goal grid.Pos, vias []grid.Pos) *route {
 	f.start = gridNode{gridPos: start, via: len(vias)}
 	f.goal = gridNode{gridPos: goal, via: 0}
 	f.vias = vias
-
+	f.extMin, f.extMax = f.router.bounds(f.growth)
+	f.hitBounds = false
 
 	// Used to estimate the initial size of the datastructures used
 	// in path finding
@@ -508,14 +2092,14 @@ func (f *routeFinder) run(start, goal internal.GridPos, vias []internal.GridPos)
 
 	// Create datastructures for path finding
 	f.cameFrom = make(map[gridNode]gridNode, minDist*2)
-	openSet := internal.PriorityQueue[gridNode]{}
+	openSet := internal.PriorityQueue[gridNode]{Stable: f.router.StableTies}
 	weights := make(map[gridNode]float32, minDist*2)
 
 	openSet.Push(f.start, 0)
 	weights[f.start] = 0
 
 	iterNum := 0
-	for !openSet.Empty() && iterNum < searchLimit {
+	for !openSet.Empty() && iterNum < f.router.Config.SearchLimit {
 
 		curP, _ := openSet.Pop()
 		current := *curP
@@ -557,11 +2141,18 @@ func (f *routeFinder) run(start, goal internal.GridPos, vias []internal.GridPos)
 		iterNum += 1
 	}
 
+	if iterNum >= f.router.Config.SearchLimit {
+		f.router.statsMu.Lock()
+		f.router.searchLimited[f.linkId] = true
+		f.router.statsMu.Unlock()
+	}
+
 	return nil
 }
 
 func (f *routeFinder) buildRoute(pos gridNode, weight float32) *route {
-	path := []internal.GridPos{pos.gridPos}
+	path := []grid.Pos{pos.gridPos}
+	nodes := []gridNode{pos}
 
 	c, ok := f.cameFrom[pos]
 	if !ok {
@@ -574,6 +2165,7 @@ func (f *routeFinder) buildRoute(pos gridNode, weight float32) *route {
 	i := 0
 	for i < maxIter && ok {
 		path = append(path, c.gridPos)
+		nodes = append(nodes, c)
 		prev := c
 		c, ok = f.cameFrom[c]
 		if ok && c == prev {
@@ -589,6 +2181,17 @@ func (f *routeFinder) buildRoute(pos gridNode, weight float32) *route {
 		panic("buildRoute could not build route!")
 	}
 
+	// A route found ignoring other links is weighed with them like
+	// any other route, so the weights can be compared
+	if f.ignoreLinks {
+		f.ignoreLinks = false
+		weight = 0
+		for i := len(nodes) - 1; i > 0; i-- {
+			weight += f.weight(nodes[i], nodes[i-1])
+		}
+		f.ignoreLinks = true
+	}
+
 	// Reverse the path of grid positions and turn it into
 	// a vec.Polyline
 	line := vec.Polyline(make([]vec.Vec2, 0, len(path)))
@@ -606,18 +2209,71 @@ func (f *routeFinder) buildRoute(pos gridNode, weight float32) *route {
 	}
 }
 
-func (f *routeFinder) getVia(n int) (internal.GridPos, bool) {
+func (f *routeFinder) getVia(n int) (grid.Pos, bool) {
 	if n == 0 || n > len(f.vias) {
-		return internal.GridPos{}, false
+		return grid.Pos{}, false
 	} else {
 		return f.vias[len(f.vias)-n], true
 	}
 }
 
+// Returns whether pos is close enough to via point n to have
+// passed it
+func (f *routeFinder) reachesVia(n int, pos grid.Pos) bool {
+	via, ok := f.getVia(n)
+	if !ok {
+		return false
+	}
+	radius := int16(0)
+	if len(f.viaRadii) == len(f.vias) {
+		radius = f.viaRadii[len(f.vias)-n]
+	}
+	return pos.ChebyshevDistance(via) <= float32(radius)
+}
+
+// Returns whether a step from pos into the multi-cell goal node
+// crosses one of the sides the route can arrive at
+func (f *routeFinder) crossesGoalSide(pos grid.Pos) bool {
+	if len(f.goalSides) == 0 {
+		return true
+	}
+
+	for _, side := range f.goalSides {
+		switch side {
+		case DirectionN:
+			if pos.Y < f.goalMin.Y {
+				return true
+			}
+		case DirectionE:
+			if pos.X > f.goalMax.X {
+				return true
+			}
+		case DirectionS:
+			if pos.Y > f.goalMax.Y {
+				return true
+			}
+		case DirectionW:
+			if pos.X < f.goalMin.X {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returns whether a diagonal step passes between different nodes
+// in the cells either side of it. Nodes the link is allowed to pass
+// through, such as its containers, don't count.
+func (f *routeFinder) squeezesBetweenNodes(side1, side2 grid.Pos) bool {
+	node1, ok1 := f.router.nodes[side1]
+	node2, ok2 := f.router.nodes[side2]
+	return ok1 && ok2 && node1 != node2 && !f.passable[node1] && !f.passable[node2]
+}
+
 // Produces the set of neighbours of the given node
 func (f *routeFinder) neighbours(pos gridNode, fn func(gridNode)) {
-	extMin := f.router.extentMin
-	extMax := f.router.extentMax
+	extMin := f.extMin
+	extMax := f.extMax
 
 	// Helper function to prune the graph a little
 	produce := func(g gridNode) {
@@ -631,13 +2287,47 @@ func (f *routeFinder) neighbours(pos gridNode, fn func(gridNode)) {
 			return
 		}
 
-		via, ok := f.getVia(pos.via)
-		if ok && g.gridPos == via {
+		// Never pass through obstacles, including squeezing
+		// diagonally between two of them
+		if f.router.inObstacle(g.gridPos) && g.gridPos != f.goal.gridPos {
+			return
+		}
+		if g.dirX != 0 && g.dirY != 0 {
+			side1 := grid.Pos{X: pos.gridPos.X + g.dirX, Y: pos.gridPos.Y}
+			side2 := grid.Pos{X: pos.gridPos.X, Y: pos.gridPos.Y + g.dirY}
+			if f.router.inObstacle(side1) && f.router.inObstacle(side2) {
+				return
+			}
+			if f.router.AvoidCornerSqueeze && f.squeezesBetweenNodes(side1, side2) {
+				return
+			}
+		}
+
+		// The first step has to leave from the start side
+		if pos == f.start && f.startSide != DirectionNone && g.direction() != f.startSide {
+			return
+		}
+		if pos == f.start && f.separate && f.router.sideTaken(f.startNode, g.direction(), f.linkId) {
+			return
+		}
+
+		if f.reachesVia(pos.via, g.gridPos) {
 			g.via -= 1
 		}
 
 		nodeId := f.router.nodes[g.gridPos]
 		if g.gridPos == f.goal.gridPos || nodeId == f.goalNode {
+			// Arriving at the goal side means heading the
+			// opposite way
+			if f.goalSide != DirectionNone && g.direction() != f.goalSide.Opposite() {
+				return
+			}
+			if f.separate && f.router.sideTaken(f.goalNode, g.direction().Opposite(), f.linkId) {
+				return
+			}
+			if f.goalIsMulti && !f.crossesGoalSide(pos.gridPos) {
+				return
+			}
 			if f.goalIsMulti && f.router.AttachMultiCellsCardinal {
 				if g.dirX == 0 || g.dirY == 0 {
 					fn(g)
@@ -655,11 +2345,15 @@ func (f *routeFinder) neighbours(pos gridNode, fn func(gridNode)) {
 			// (The target node is handled by the check above)
 			_, isNode := f.router.nodes[gridPos]
 
-			isNode = f.router.AvoidNodes && isNode
+			isNode = f.router.AvoidNodes && isNode && !f.passable[nodeId]
 
 			// Skip over neighbours that have node labels in them
 			_, isLabel := f.router.nodeLabels[gridPos]
 
+			if !inBounds {
+				f.hitBounds = true
+			}
+
 			if inBounds && !isNode && !isLabel {
 				fn(g)
 			}
@@ -704,7 +2398,7 @@ func (f *routeFinder) neighbours(pos gridNode, fn func(gridNode)) {
 			}
 		}
 
-		if !f.router.Orthogonal {
+		if !f.orthogonal {
 			// Now produce the diagonals
 			for dx := int16(-1); dx <= 1; dx++ {
 				for dy := int16(-1); dy <= 1; dy++ {
@@ -725,7 +2419,7 @@ func (f *routeFinder) neighbours(pos gridNode, fn func(gridNode)) {
 		return
 	}
 
-	if f.router.Orthogonal {
+	if f.orthogonal {
 		if pos.dirX == 0 {
 			n := pos
 			n.dirY = 0
@@ -777,25 +2471,26 @@ func (f *routeFinder) weight(fromNode, toNode gridNode) float32 {
 
 	toNodeId := f.router.nodes[to]
 
-	// This currently always returns 1, but if JPS is implemented,
-	// the nodes won't be adjacent cells
-	dist := from.ChebyshevDistance(to)
+	// This currently always returns 1 (or the diagonal cost), but
+	// if JPS is implemented, the nodes won't be adjacent cells
+	dist := f.router.stepDistance(from, to)
 	var linkPenalty float32 = 0
+	var labelPenalty float32 = 0
 
 	// If the grid positions are the same, it's a turn
 	if from == to {
 		// Penalize turns more than single steps
-		dist = 2
+		dist = f.turnCost
 		cur := fromNode
 		prevNode, ok := f.cameFrom[cur]
 		// If the previous step was also a turn, then
-		// increase the penalty, this encourages two 45deg turns
-		// spaced apart (a total weight of 4) over a single 90deg turn
-		// (a total weight of 6)
+		// increase the penalty, by default this encourages two
+		// 45deg turns spaced apart (a total weight of 4) over a
+		// single 90deg turn (a total weight of 6)
 		if ok && prevNode.gridPos == cur.gridPos {
-			dist = 4
+			dist = f.sharpTurnCost
 		}
-	} else if to != f.goal.gridPos && toNodeId != f.goalNode {
+	} else if !f.ignoreLinks && to != f.goal.gridPos && toNodeId != f.goalNode {
 		// Add a penalty to cells that contain links, this is
 		// primarily to avoid having multiple paths take the
 		// same route when other optimal paths exist.
@@ -805,7 +2500,14 @@ func (f *routeFinder) weight(fromNode, toNode gridNode) float32 {
 			if l != f.linkId {
 				// Apply a penalty for each link, but make
 				// the penalty smaller for each successive link.
-				linkPenalty += 1 / n
+				linkPenalty += f.router.avoidWeight(l) / n
+				n *= 2
+			}
+		}
+		// Wide links are drawn over the cells beside them too
+		for _, l := range f.router.wideCells[to] {
+			if l != f.linkId && !slices.Contains(links, l) {
+				linkPenalty += f.router.avoidWeight(l) / n
 				n *= 2
 			}
 		}
@@ -851,28 +2553,35 @@ func (f *routeFinder) weight(fromNode, toNode gridNode) float32 {
 
 			for _, l := range linksIntersection {
 				if l != f.linkId {
-					linkPenalty += 1 / n
+					linkPenalty += f.router.avoidWeight(l) / n
 					n *= 2
 				}
 			}
 		}
 
+		// Keep clear of the cells where other links' labels go
+		for _, l := range f.router.linkLabels[to] {
+			if l != f.linkId {
+				labelPenalty += f.router.Config.LinkLabelWeight
+			}
+		}
+
 		// Apply a penalty for being adjacent to other links,
 		// this is to try and spread out links radially at the
 		// start and end nodes since otherwise they can bunch
 		// up weird ways.
-		addPenalty := func(at internal.GridPos) {
+		addPenalty := func(at grid.Pos) {
 			if !f.router.SpreadLinks {
 				return
 			}
 			links := f.router.linkMap[at]
 			// Start the penalty fairly low, since we really
 			// just want to pick between otherwise-equal paths
-			var n float32 = 16
+			penalty := f.router.Config.SpreadPenalty
 			for _, l := range links {
 				if l != f.linkId {
-					linkPenalty += 1 / n
-					n *= 2
+					linkPenalty += penalty
+					penalty /= 2
 				}
 			}
 		}
@@ -910,7 +2619,14 @@ func (f *routeFinder) weight(fromNode, toNode gridNode) float32 {
 		}
 	}
 
-	weight := dist + (linkPenalty * f.router.linkPenaltyWeight)
+	// Cells kept clear by other nodes are only passed through if
+	// there's no other way
+	var keepOutPenalty float32 = 0
+	if from != to && to != f.goal.gridPos && f.inKeepOut(to) {
+		keepOutPenalty = f.router.Config.KeepOutWeight
+	}
+
+	weight := dist + (linkPenalty * f.crossingWeight) + labelPenalty + keepOutPenalty
 
 	return weight
 }
@@ -932,12 +2648,12 @@ func (f *routeFinder) goalDistance(fromNode gridNode) float32 {
 
 		for x := minX; x < maxX; x++ {
 			for y := minY; y < maxY; y++ {
-				pos := internal.GridPos{
+				pos := grid.Pos{
 					X: x,
 					Y: y,
 				}
 
-				d := from.ChebyshevDistance(pos)
+				d := f.router.heuristic(from, pos)
 
 				if dist < 0 || d < dist {
 					dist = d
@@ -947,6 +2663,41 @@ func (f *routeFinder) goalDistance(fromNode gridNode) float32 {
 
 		return dist
 	} else {
-		return from.ChebyshevDistance(f.goal.gridPos)
+		return f.router.heuristic(from, f.goal.gridPos)
+	}
+}
+
+func (r *LinkRouter) diagonalCost() float32 {
+	return f32.Max(r.DiagonalCost, 1)
+}
+
+// Returns the cost of a step from a to b, ignoring penalties
+func (r *LinkRouter) stepDistance(a, b grid.Pos) float32 {
+	if r.Metric != nil {
+		return r.Metric(a, b)
+	}
+	return a.OctileDistance(b, r.diagonalCost())
+}
+
+// Estimates the cost of travelling from a to b
+func (r *LinkRouter) heuristic(a, b grid.Pos) float32 {
+	if r.CustomHeuristic != nil {
+		return r.CustomHeuristic(a, b)
+	}
+	if r.Metric != nil {
+		return r.Metric(a, b)
+	}
+	diagCost := r.diagonalCost()
+	switch r.Heuristic {
+	case HeuristicOctile:
+		// A diagonal step can always be replaced by two straight
+		// steps and turns costing at least 2
+		return a.OctileDistance(b, f32.Min(diagCost, 2))
+	case HeuristicEuclidean:
+		// Scale the distance down so that a diagonal step is
+		// never estimated as more than it costs
+		return a.EuclideanDistance(b) * f32.Min(1, diagCost/math.Sqrt2)
+	default:
+		return a.ChebyshevDistance(b)
 	}
 }
@@ -1,9 +1,20 @@
 package raumata_test
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
 	"testing"
 
 	. "github.com/REANNZ/raumata"
+	"github.com/REANNZ/raumata/canvas"
+	"github.com/REANNZ/raumata/grid"
+	"github.com/REANNZ/raumata/option"
+	"github.com/REANNZ/raumata/testutil"
 	"github.com/REANNZ/raumata/vec"
 )
 
@@ -14,31 +25,31 @@ func TestLinkRouter1(t *testing.T) {
 				Id:      "A",
 				Pos:     &[2]int16{0, 0},
 				Label:   "A",
-				LabelAt: "n",
+				LabelAt: DirectionN,
 			},
 			"B": {
 				Id:      "B",
 				Pos:     &[2]int16{0, 5},
 				Label:   "B",
-				LabelAt: "w",
+				LabelAt: DirectionW,
 			},
 			"C": {
 				Id:      "C",
 				Pos:     &[2]int16{0, 10},
 				Label:   "C",
-				LabelAt: "s",
+				LabelAt: DirectionS,
 			},
 			"D": {
 				Id:      "D",
 				Pos:     &[2]int16{8, 5},
 				Label:   "D",
-				LabelAt: "s",
+				LabelAt: DirectionS,
 			},
 			"E": {
 				Id:      "E",
 				Pos:     &[2]int16{10, 10},
 				Label:   "E",
-				LabelAt: "e",
+				LabelAt: DirectionE,
 			},
 		},
 		Links: map[LinkId]*Link{
@@ -136,3 +147,1655 @@ func BenchmarkLinkRouter(b *testing.B) {
 		linkRouter.RouteLinks()
 	}
 }
+
+func TestLinkRouterHeuristics(t *testing.T) {
+	for _, heuristic := range []Heuristic{HeuristicChebyshev, HeuristicOctile, HeuristicEuclidean} {
+		topo := Topology{
+			Nodes: map[NodeId]*Node{
+				"A": {Id: "A", Pos: &[2]int16{0, 0}},
+				"B": {Id: "B", Pos: &[2]int16{6, 3}},
+				"C": {Id: "C", Pos: &[2]int16{3, 1}},
+			},
+			Links: map[LinkId]*Link{
+				"A-B": {Id: "A-B", From: "A", To: "B"},
+			},
+		}
+
+		linkRouter := NewLinkRouter(&topo)
+		linkRouter.Heuristic = heuristic
+		linkRouter.DiagonalCost = 1.5
+		linkRouter.RouteLinks()
+
+		route := topo.Links["A-B"].Route
+		if len(route) < 2 {
+			t.Errorf("No route for link with heuristic %d", heuristic)
+			continue
+		}
+		if route[len(route)-1] != (vec.Vec2{X: 6, Y: 3}) {
+			t.Errorf("Route does not end at 'to' node with heuristic %d", heuristic)
+		}
+	}
+}
+
+func TestLinkRouterRoutePrefix(t *testing.T) {
+	topo := Topology{
+		Nodes: map[NodeId]*Node{
+			"A": {Id: "A", Pos: &[2]int16{0, 0}},
+			"B": {Id: "B", Pos: &[2]int16{6, 0}},
+		},
+		Links: map[LinkId]*Link{
+			"A-B": {
+				Id:          "A-B",
+				From:        "A",
+				To:          "B",
+				RoutePrefix: [][2]int16{{0, 1}, {0, 2}},
+				RouteSuffix: [][2]int16{{6, -1}},
+			},
+		},
+	}
+
+	linkRouter := NewLinkRouter(&topo)
+	linkRouter.SetExtents(-2, -3, 8, 3)
+	linkRouter.RouteLinks()
+
+	route := topo.Links["A-B"].Route
+	if len(route) < 4 {
+		t.Fatalf("Route is too short: %v", route)
+	}
+
+	expectedStart := vec.Polyline{{X: 0, Y: 0}, {X: 0, Y: 1}, {X: 0, Y: 2}}
+	for i, p := range expectedStart {
+		if route[i] != p {
+			t.Errorf("Route does not start with prefix, expected %s at %d, got %s", p, i, route[i])
+		}
+	}
+
+	if route[len(route)-2] != (vec.Vec2{X: 6, Y: -1}) {
+		t.Errorf("Route does not end with suffix, got %s", route[len(route)-2])
+	}
+}
+
+func TestLinkRouterKeepOut(t *testing.T) {
+	topo := Topology{
+		Nodes: map[NodeId]*Node{
+			"A":    {Id: "A", Pos: &[2]int16{0, 0}},
+			"B":    {Id: "B", Pos: &[2]int16{8, 0}},
+			"core": {Id: "core", Pos: &[2]int16{4, 2}, KeepOut: 2},
+		},
+		Links: map[LinkId]*Link{
+			"A-B":    {Id: "A-B", From: "A", To: "B"},
+			"A-core": {Id: "A-core", From: "A", To: "core"},
+		},
+	}
+
+	linkRouter := NewLinkRouter(&topo)
+	linkRouter.SetExtents(-1, -3, 9, 5)
+	linkRouter.RouteLinks()
+
+	for _, p := range topo.Links["A-B"].Route {
+		if p.X >= 2 && p.X <= 6 && p.Y >= 0 && p.Y <= 4 {
+			t.Errorf("Route for A-B passes through keep-out area at %s", p)
+		}
+	}
+
+	route := topo.Links["A-core"].Route
+	if len(route) < 2 || route[len(route)-1] != (vec.Vec2{X: 4, Y: 2}) {
+		t.Errorf("Link to node with keep-out area not routed: %v", route)
+	}
+}
+
+func TestLinkRouterKeepOutNeighbour(t *testing.T) {
+	// C is inside A's keep-out area, so C-D can only leave C through it
+	topo := Topology{
+		Nodes: map[NodeId]*Node{
+			"A": {Id: "A", Pos: &[2]int16{4, 2}, KeepOut: 2},
+			"C": {Id: "C", Pos: &[2]int16{3, 2}},
+			"D": {Id: "D", Pos: &[2]int16{0, 2}},
+		},
+		Links: map[LinkId]*Link{
+			"C-D": {Id: "C-D", From: "C", To: "D"},
+		},
+	}
+
+	linkRouter := NewLinkRouter(&topo)
+	linkRouter.RouteLinks()
+
+	route := topo.Links["C-D"].Route
+	if len(route) < 2 || route[0] != (vec.Vec2{X: 3, Y: 2}) || route[len(route)-1] != (vec.Vec2{X: 0, Y: 2}) {
+		t.Errorf("Link next to a node with a keep-out area not routed: %v", route)
+	}
+	if stats := linkRouter.Stats(); stats.Unrouted != 0 || len(stats.UnroutedLinks) != 0 {
+		t.Errorf("Expected no unrouted links, got %v", stats.UnroutedLinks)
+	}
+}
+
+func TestLinkRouterNodeClearance(t *testing.T) {
+	newTopo := func() *Topology {
+		return &Topology{
+			Nodes: map[NodeId]*Node{
+				"A": {Id: "A", Pos: &[2]int16{0, 0}},
+				"B": {Id: "B", Pos: &[2]int16{6, 0}},
+				"C": {Id: "C", Pos: &[2]int16{3, 1}},
+			},
+			Links: map[LinkId]*Link{
+				"A-B": {Id: "A-B", From: "A", To: "B"},
+				"A-C": {Id: "A-C", From: "A", To: "C"},
+			},
+		}
+	}
+
+	// Without a clearance A-B runs right past C
+	topo := newTopo()
+	NewLinkRouter(topo).RouteLinks()
+	if length := topo.Links["A-B"].Route.Length(); length != 6 {
+		t.Fatalf("Expected A-B to run straight past C, got %v", topo.Links["A-B"].Route)
+	}
+
+	topo = newTopo()
+	linkRouter := NewLinkRouter(topo)
+	linkRouter.NodeClearance = 1
+	linkRouter.RouteLinks()
+
+	for _, p := range topo.Links["A-B"].Route {
+		if p.X >= 2 && p.X <= 4 && p.Y >= 0 && p.Y <= 2 {
+			t.Errorf("Route for A-B passes within a cell of C at %s", p)
+		}
+	}
+
+	// Links to C can still reach it
+	route := topo.Links["A-C"].Route
+	if len(route) < 2 || route[len(route)-1] != (vec.Vec2{X: 3, Y: 1}) {
+		t.Errorf("Link to C not routed: %v", route)
+	}
+}
+
+func TestLinkRouterExtentGrowth(t *testing.T) {
+	// A wall of nodes between A and B, the link must be routed
+	// around the end of the wall, outside the initial extents
+	topo := Topology{
+		Nodes: map[NodeId]*Node{
+			"A": {Id: "A", Pos: &[2]int16{0, 0}},
+			"B": {Id: "B", Pos: &[2]int16{4, 0}},
+		},
+		Links: map[LinkId]*Link{
+			"A-B": {Id: "A-B", From: "A", To: "B"},
+		},
+	}
+	for y := int16(-2); y <= 2; y++ {
+		id := NodeId(fmt.Sprintf("wall%d", y))
+		topo.Nodes[id] = &Node{Id: id, Pos: &[2]int16{2, y}}
+	}
+
+	linkRouter := NewLinkRouter(&topo)
+	linkRouter.ExtentBorder = 0
+	linkRouter.RouteLinks()
+
+	if len(topo.Links["A-B"].Route) < 2 {
+		t.Errorf("Link was not routed around the wall")
+	}
+
+	min, max := linkRouter.GetExtents()
+	if min.Y > -3 && max.Y < 3 {
+		t.Errorf("Extents were not grown, got %s - %s", min, max)
+	}
+}
+
+func TestLinkRouterExtentGrowthWorkers(t *testing.T) {
+	// Several links around walls, each needing the extents grown by
+	// a different amount
+	newTopo := func() *Topology {
+		topo := &Topology{Nodes: map[NodeId]*Node{}, Links: map[LinkId]*Link{}}
+		for i := int16(0); i < 6; i++ {
+			a, b := NodeId(fmt.Sprintf("A%d", i)), NodeId(fmt.Sprintf("B%d", i))
+			topo.Nodes[a] = &Node{Id: a, Pos: &[2]int16{i * 4, 0}}
+			topo.Nodes[b] = &Node{Id: b, Pos: &[2]int16{i*4 + 2, 0}}
+			id := LinkId(fmt.Sprintf("%s-%s", a, b))
+			topo.Links[id] = &Link{Id: id, From: a, To: b}
+			for y := -i; y <= i; y++ {
+				wall := NodeId(fmt.Sprintf("wall%d,%d", i, y))
+				topo.Nodes[wall] = &Node{Id: wall, Pos: &[2]int16{i*4 + 1, y}}
+			}
+		}
+		return topo
+	}
+
+	route := func(workers int) map[LinkId]string {
+		topo := newTopo()
+		linkRouter := NewLinkRouter(topo)
+		linkRouter.ExtentBorder = 0
+		linkRouter.Workers = workers
+		linkRouter.StableTies = true
+		linkRouter.RouteLinks()
+		routes := map[LinkId]string{}
+		for id, link := range topo.Links {
+			routes[id] = fmt.Sprint(link.Route)
+		}
+		return routes
+	}
+
+	expected := route(1)
+	for run := 0; run < 20; run++ {
+		if routes := route(8); !maps.Equal(routes, expected) {
+			t.Fatalf("Routes with 8 workers differ from 1 worker on run %d:\n%v\n%v", run, routes, expected)
+		}
+	}
+}
+
+func TestLinkRouterMaxExtentGrowth(t *testing.T) {
+	// As above, but without any room to grow the extents
+	topo := Topology{
+		Nodes: map[NodeId]*Node{
+			"A": {Id: "A", Pos: &[2]int16{0, 0}},
+			"B": {Id: "B", Pos: &[2]int16{4, 0}},
+		},
+		Links: map[LinkId]*Link{
+			"A-B": {Id: "A-B", From: "A", To: "B"},
+		},
+	}
+	for y := int16(-2); y <= 2; y++ {
+		id := NodeId(fmt.Sprintf("wall%d", y))
+		topo.Nodes[id] = &Node{Id: id, Pos: &[2]int16{2, y}}
+	}
+
+	linkRouter := NewLinkRouter(&topo)
+	linkRouter.ExtentBorder = 0
+	linkRouter.MaxExtentGrowth = 0
+	minBefore, maxBefore := linkRouter.GetExtents()
+	linkRouter.RouteLinks()
+
+	if len(topo.Links["A-B"].Route) > 0 {
+		t.Errorf("Expected no route around the wall, got %v", topo.Links["A-B"].Route)
+	}
+	if min, max := linkRouter.GetExtents(); min != minBefore || max != maxBefore {
+		t.Errorf("Expected the extents not to grow, got %s - %s", min, max)
+	}
+}
+
+func TestLinkRouterDensity(t *testing.T) {
+	topo := Topology{
+		Nodes: map[NodeId]*Node{
+			"A": {Id: "A", Pos: &[2]int16{0, 0}},
+			"B": {Id: "B", Pos: &[2]int16{3, 0}},
+		},
+		Links: map[LinkId]*Link{
+			"A-B":   {Id: "A-B", From: "A", To: "B"},
+			"A-B-2": {Id: "A-B-2", From: "A", To: "B"},
+		},
+	}
+
+	linkRouter := NewLinkRouter(&topo)
+	linkRouter.RouteLinks()
+
+	density := linkRouter.LinkDensity()
+	if n := density[grid.Pos{X: 0, Y: 0}]; n != 2 {
+		t.Errorf("Expected 2 links at node A, got %d", n)
+	}
+
+	total := 0
+	for _, link := range topo.Links {
+		total += len(link.Route)
+	}
+	sum := 0
+	for _, n := range density {
+		sum += n
+	}
+	if sum != total {
+		t.Errorf("Density doesn't match routes, expected %d, got %d", total, sum)
+	}
+}
+
+func TestLinkRouterMetric(t *testing.T) {
+	metrics := map[string]Metric{
+		"chebyshev": MetricChebyshev,
+		"manhattan": MetricManhattan,
+		"euclidean": MetricEuclidean,
+		"custom": func(from, to grid.Pos) float32 {
+			return 2 * from.EuclideanDistance(to)
+		},
+	}
+
+	for name, metric := range metrics {
+		topo := Topology{
+			Nodes: map[NodeId]*Node{
+				"A": {Id: "A", Pos: &[2]int16{0, 0}},
+				"B": {Id: "B", Pos: &[2]int16{4, 3}},
+			},
+			Links: map[LinkId]*Link{
+				"A-B": {Id: "A-B", From: "A", To: "B"},
+			},
+		}
+
+		linkRouter := NewLinkRouter(&topo)
+		linkRouter.Metric = metric
+		linkRouter.RouteLinks()
+
+		route := topo.Links["A-B"].Route
+		if len(route) < 2 || route[len(route)-1] != (vec.Vec2{X: 4, Y: 3}) {
+			t.Errorf("Link not routed with %s metric: %v", name, route)
+		}
+	}
+}
+
+func TestLinkRouterCustomHeuristic(t *testing.T) {
+	topo := testutil.Mesh(4, 4, 6, 1)
+
+	calls := 0
+	linkRouter := NewLinkRouter(topo)
+	// Weighted A*, overestimating the distance
+	linkRouter.CustomHeuristic = func(pos, goal grid.Pos) float32 {
+		calls += 1
+		return 3 * pos.ChebyshevDistance(goal)
+	}
+	linkRouter.RouteLinks()
+
+	if calls == 0 {
+		t.Errorf("Custom heuristic was not used")
+	}
+	for id, link := range topo.Links {
+		to := topo.Nodes[link.To]
+		if len(link.Route) < 2 || grid.FromVec(link.Route[len(link.Route)-1]) != (grid.Pos{X: to.Pos[0], Y: to.Pos[1]}) {
+			t.Errorf("Link %s not routed: %v", id, link.Route)
+		}
+	}
+}
+
+func benchmarkRouteTopology(b *testing.B, topo *Topology, workers int) {
+	for i := 0; i < b.N; i++ {
+		for _, link := range topo.Links {
+			link.Route = nil
+		}
+		linkRouter := NewLinkRouter(topo)
+		linkRouter.Workers = workers
+		linkRouter.RouteLinks()
+	}
+}
+
+func BenchmarkLinkRouterRing(b *testing.B) {
+	benchmarkRouteTopology(b, testutil.Ring(40), 1)
+}
+
+func BenchmarkLinkRouterMesh(b *testing.B) {
+	benchmarkRouteTopology(b, testutil.Mesh(8, 8, 20, 1), 1)
+}
+
+func BenchmarkLinkRouterMeshWorkers(b *testing.B) {
+	benchmarkRouteTopology(b, testutil.Mesh(8, 8, 20, 1), 4)
+}
+
+func BenchmarkLinkRouterTwoTier(b *testing.B) {
+	benchmarkRouteTopology(b, testutil.TwoTier(3, 4), 1)
+}
+
+func TestLinkRouterWorkers(t *testing.T) {
+	topo := testutil.Mesh(5, 5, 10, 1)
+
+	linkRouter := NewLinkRouter(topo)
+	linkRouter.Workers = 4
+	linkRouter.RouteLinks()
+
+	for id, link := range topo.Links {
+		if len(link.Route) < 2 {
+			t.Errorf("Link %s not routed", id)
+			continue
+		}
+		from := topo.Nodes[link.From]
+		to := topo.Nodes[link.To]
+		if grid.FromVec(link.Route[0]) != (grid.Pos{X: from.Pos[0], Y: from.Pos[1]}) ||
+			grid.FromVec(link.Route[len(link.Route)-1]) != (grid.Pos{X: to.Pos[0], Y: to.Pos[1]}) {
+			t.Errorf("Route for link %s doesn't connect its nodes: %v", id, link.Route)
+		}
+	}
+}
+
+func TestLinkRouterObstacles(t *testing.T) {
+	// A wall between the two nodes with a gap at the bottom
+	wall := &Obstacle{Rect: &[2][2]int16{{3, -3}, {3, 2}}}
+	topo := Topology{
+		Nodes: map[NodeId]*Node{
+			"A": {Id: "A", Pos: &[2]int16{0, 0}},
+			"B": {Id: "B", Pos: &[2]int16{6, 0}},
+		},
+		Links: map[LinkId]*Link{
+			"A-B": {Id: "A-B", From: "A", To: "B"},
+		},
+		Obstacles: []*Obstacle{wall},
+	}
+
+	linkRouter := NewLinkRouter(&topo)
+	linkRouter.RouteLinks()
+
+	route := topo.Links["A-B"].Route
+	if len(route) < 2 {
+		t.Fatalf("Link not routed")
+	}
+
+	blocked := grid.Grid[bool]{}
+	for _, p := range wall.Cells() {
+		blocked[p] = true
+	}
+
+	prev := grid.FromVec(route[0])
+	for _, p := range route[1:] {
+		pos := grid.FromVec(p)
+		// Step through every cell between the points
+		for prev != pos {
+			if pos.X > prev.X {
+				prev.X += 1
+			} else if pos.X < prev.X {
+				prev.X -= 1
+			}
+			if pos.Y > prev.Y {
+				prev.Y += 1
+			} else if pos.Y < prev.Y {
+				prev.Y -= 1
+			}
+			if blocked[prev] {
+				t.Errorf("Route passes through obstacle at %v: %v", prev, route)
+			}
+		}
+	}
+}
+
+func TestLinkRouterPerLinkRouting(t *testing.T) {
+	isOrthogonal := func(route vec.Polyline) bool {
+		for i := 1; i < len(route); i++ {
+			d := route[i].Sub(route[i-1])
+			if d.X != 0 && d.Y != 0 {
+				return false
+			}
+		}
+		return true
+	}
+
+	for _, routerOrthogonal := range []bool{false, true} {
+		topo := Topology{
+			Nodes: map[NodeId]*Node{
+				"A": {Id: "A", Pos: &[2]int16{0, 0}},
+				"B": {Id: "B", Pos: &[2]int16{4, 4}},
+				"C": {Id: "C", Pos: &[2]int16{0, 8}},
+				"D": {Id: "D", Pos: &[2]int16{4, 12}},
+			},
+			Links: map[LinkId]*Link{
+				"A-B": {Id: "A-B", From: "A", To: "B", Routing: "orthogonal"},
+				"C-D": {Id: "C-D", From: "C", To: "D", Routing: "any"},
+			},
+		}
+
+		linkRouter := NewLinkRouter(&topo)
+		linkRouter.Orthogonal = routerOrthogonal
+		linkRouter.RouteLinks()
+
+		if !isOrthogonal(topo.Links["A-B"].Route) {
+			t.Errorf("Orthogonal link has diagonal steps: %v", topo.Links["A-B"].Route)
+		}
+		if isOrthogonal(topo.Links["C-D"].Route) {
+			t.Errorf("Link allowing any routing has no diagonal steps: %v", topo.Links["C-D"].Route)
+		}
+	}
+}
+
+func TestLinkRouterBundle(t *testing.T) {
+	topo := Topology{
+		Nodes: map[NodeId]*Node{
+			"A": {Id: "A", Pos: &[2]int16{0, 0}},
+			"B": {Id: "B", Pos: &[2]int16{6, 3}},
+		},
+		Links: map[LinkId]*Link{
+			"A-B":   {Id: "A-B", From: "A", To: "B"},
+			"A-B-2": {Id: "A-B-2", From: "A", To: "B"},
+			"B-A":   {Id: "B-A", From: "B", To: "A"},
+		},
+	}
+
+	linkRouter := NewLinkRouter(&topo)
+	linkRouter.Bundle = true
+	linkRouter.RouteLinks()
+
+	expected := topo.Links["A-B"].Route
+	if len(expected) < 2 {
+		t.Fatalf("Link A-B not routed")
+	}
+	if route := topo.Links["A-B-2"].Route; !slices.Equal(route, expected) {
+		t.Errorf("Bundled link has a different route: %v != %v", route, expected)
+	}
+	if route := topo.Links["B-A"].Route; !slices.Equal(route.Reverse(), expected) {
+		t.Errorf("Reversed bundled link has a different route: %v != %v", route, expected)
+	}
+}
+
+func TestLinkRouterPairDirected(t *testing.T) {
+	topo := Topology{
+		Nodes: map[NodeId]*Node{
+			"A": {Id: "A", Pos: &[2]int16{0, 0}},
+			"B": {Id: "B", Pos: &[2]int16{6, 3}},
+		},
+		Links: map[LinkId]*Link{
+			"A-B":   {Id: "A-B", From: "A", To: "B"},
+			"A-B-2": {Id: "A-B-2", From: "A", To: "B"},
+			"B-A":   {Id: "B-A", From: "B", To: "A"},
+		},
+	}
+
+	linkRouter := NewLinkRouter(&topo)
+	linkRouter.PairDirected = true
+	linkRouter.RouteLinks()
+
+	expected := topo.Links["A-B"].Route
+	if len(expected) < 2 {
+		t.Fatalf("Link A-B not routed")
+	}
+	if route := topo.Links["B-A"].Route; !slices.Equal(route.Reverse(), expected) {
+		t.Errorf("Paired link has a different route: %v != %v", route, expected)
+	}
+	// Links running the same way aren't paired, so are spread out
+	if route := topo.Links["A-B-2"].Route; slices.Equal(route, expected) {
+		t.Errorf("Link in the same direction was paired: %v", route)
+	}
+}
+
+func TestLinkRouterLockRoute(t *testing.T) {
+	detour := vec.Polyline{{X: 0, Y: 0}, {X: 0, Y: 3}, {X: 6, Y: 3}, {X: 6, Y: 0}}
+	topo := Topology{
+		Nodes: map[NodeId]*Node{
+			"A": {Id: "A", Pos: &[2]int16{0, 0}},
+			"B": {Id: "B", Pos: &[2]int16{6, 0}},
+		},
+		Links: map[LinkId]*Link{
+			"locked": {Id: "locked", From: "A", To: "B", Route: slices.Clone(detour), LockRoute: true},
+			"free":   {Id: "free", From: "A", To: "B", Route: slices.Clone(detour)},
+		},
+	}
+
+	linkRouter := NewLinkRouter(&topo)
+	linkRouter.RouteLinks()
+
+	if !slices.Equal(topo.Links["locked"].Route, detour) {
+		t.Errorf("Locked route was changed to %v", topo.Links["locked"].Route)
+	}
+	if route := topo.Links["free"].Route; route.Length() >= detour.Length() {
+		t.Errorf("Expected the unlocked route to be improved, got %v", route)
+	}
+}
+
+func TestLinkRouterConfig(t *testing.T) {
+	newTopo := func() *Topology {
+		return &Topology{
+			Nodes: map[NodeId]*Node{
+				"A": {Id: "A", Pos: &[2]int16{0, 0}},
+				"B": {Id: "B", Pos: &[2]int16{6, 0}},
+				"C": {Id: "C", Pos: &[2]int16{3, -3}},
+				"D": {Id: "D", Pos: &[2]int16{3, 3}},
+			},
+			Links: map[LinkId]*Link{
+				"A-B": {Id: "A-B", From: "A", To: "B"},
+				"C-D": {
+					Id:   "C-D",
+					From: "C",
+					To:   "D",
+					Route: vec.Polyline{
+						{X: 3, Y: -3}, {X: 3, Y: -2}, {X: 3, Y: -1}, {X: 3, Y: 0},
+						{X: 3, Y: 1}, {X: 3, Y: 2}, {X: 3, Y: 3},
+					},
+					LockRoute: true,
+				},
+			},
+		}
+	}
+
+	// Whether the route passes between C and D
+	crosses := func(route vec.Polyline) bool {
+		for i := 1; i < len(route); i++ {
+			a, b := route[i-1], route[i]
+			if (a.X-3)*(b.X-3) > 0 || a.X == b.X {
+				continue
+			}
+			y := a.Y + (b.Y-a.Y)*(3-a.X)/(b.X-a.X)
+			if y > -3 && y < 3 {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Without a crossing penalty, the link goes straight across
+	config := DefaultRouterConfig()
+	config.CrossingWeight = 0
+	topo := newTopo()
+	NewLinkRouterWithConfig(topo, config).RouteLinks()
+	if route := topo.Links["A-B"].Route; !crosses(route) {
+		t.Errorf("Expected a straight route with no crossing penalty, got %v", route)
+	}
+
+	// With a high penalty, it goes around
+	config.CrossingWeight = 1000
+	topo = newTopo()
+	NewLinkRouterWithConfig(topo, config).RouteLinks()
+	if route := topo.Links["A-B"].Route; len(route) < 2 || crosses(route) {
+		t.Errorf("Expected the route to avoid crossing, got %v", route)
+	}
+
+	// The search gives up at the search limit
+	config = DefaultRouterConfig()
+	config.SearchLimit = 1
+	topo = newTopo()
+	NewLinkRouterWithConfig(topo, config).RouteLinks()
+	if route := topo.Links["A-B"].Route; len(route) > 0 {
+		t.Errorf("Expected no route with a search limit of 1, got %v", route)
+	}
+}
+
+func TestLinkRouterLinkLabelCells(t *testing.T) {
+	newTopo := func() *Topology {
+		return &Topology{
+			Nodes: map[NodeId]*Node{
+				"A": {Id: "A", Pos: &[2]int16{0, 2}},
+				"B": {Id: "B", Pos: &[2]int16{8, 2}},
+				"C": {Id: "C", Pos: &[2]int16{2, 0}},
+				"D": {Id: "D", Pos: &[2]int16{2, 4}},
+			},
+			Links: map[LinkId]*Link{
+				"A-B": {
+					Id:   "A-B",
+					From: "A",
+					To:   "B",
+					Route: vec.Polyline{
+						{X: 0, Y: 2}, {X: 1, Y: 2}, {X: 2, Y: 2}, {X: 3, Y: 2},
+						{X: 4, Y: 2}, {X: 5, Y: 2}, {X: 6, Y: 2}, {X: 7, Y: 2},
+						{X: 8, Y: 2},
+					},
+					LockRoute: true,
+					FromData:  &LinkData{Label: "10G"},
+				},
+				"C-D": {Id: "C-D", From: "C", To: "D"},
+			},
+		}
+	}
+
+	passesLabel := func(route vec.Polyline) bool {
+		return slices.Contains(route, vec.Vec2{X: 2, Y: 2})
+	}
+
+	// By default, the link goes straight through the label
+	topo := newTopo()
+	NewLinkRouter(topo).RouteLinks()
+	if route := topo.Links["C-D"].Route; !passesLabel(route) {
+		t.Errorf("Expected the route to go straight, got %v", route)
+	}
+
+	// Reserving the label cell moves the crossing
+	config := DefaultRouterConfig()
+	config.LinkLabelWeight = 100
+	topo = newTopo()
+	NewLinkRouterWithConfig(topo, config).RouteLinks()
+	if route := topo.Links["C-D"].Route; len(route) == 0 || passesLabel(route) {
+		t.Errorf("Expected the route to avoid the label of A-B, got %v", route)
+	}
+}
+
+func TestLinkRouterRouteLinksContext(t *testing.T) {
+	for _, workers := range []int{1, 4} {
+		// Cancelling before routing leaves the links unrouted
+		topo := testutil.Mesh(4, 4, 6, 1)
+		router := NewLinkRouter(topo)
+		router.Workers = workers
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := router.RouteLinksContext(ctx); !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected a cancelled error with %d workers, got %v", workers, err)
+		}
+		for id, link := range topo.Links {
+			if len(link.Route) > 0 {
+				t.Errorf("Expected link %s not to be routed with %d workers", id, workers)
+			}
+		}
+
+		// Cancelling from the progress callback stops routing part
+		// way through the first pass
+		topo = testutil.Mesh(4, 4, 6, 1)
+		router = NewLinkRouter(topo)
+		router.Workers = workers
+
+		ctx, cancel = context.WithCancel(context.Background())
+		calls := 0
+		router.Progress = func(id LinkId, pass, done, total int) {
+			calls++
+			if pass != 0 || total != len(topo.Links) {
+				t.Errorf("Expected the first pass over %d links, got pass %d of %d links",
+					len(topo.Links), pass, total)
+			}
+			if done == 3 {
+				cancel()
+			}
+		}
+		if err := router.RouteLinksContext(ctx); !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected a cancelled error with %d workers, got %v", workers, err)
+		}
+		if calls < 3 || calls >= len(topo.Links) {
+			t.Errorf("Expected routing to stop early with %d workers, got %d calls", workers, calls)
+		}
+
+		// The routes that were found are on the grid between the
+		// nodes, and the others aren't
+		onGrid := map[LinkId]bool{}
+		for _, cell := range router.Occupancy() {
+			if cell.Node != "" {
+				continue
+			}
+			for _, id := range cell.Links {
+				onGrid[id] = true
+			}
+		}
+		for id, link := range topo.Links {
+			if routed := len(link.Route) > 0; routed != onGrid[id] {
+				t.Errorf("Expected link %s to be on the grid only if routed with %d workers, got routed %v",
+					id, workers, routed)
+			}
+		}
+	}
+}
+
+func TestLinkRouterProgress(t *testing.T) {
+	topo := testutil.Ring(6)
+	router := NewLinkRouter(topo)
+
+	passes := map[int]int{}
+	router.Progress = func(id LinkId, pass, done, total int) {
+		if topo.Links[id] == nil {
+			t.Errorf("Unknown link %s", id)
+		}
+		if done != passes[pass]+1 {
+			t.Errorf("Expected progress %d in pass %d, got %d", passes[pass]+1, pass, done)
+		}
+		passes[pass] = done
+		if total != len(topo.Links) {
+			t.Errorf("Expected %d links in pass %d, got %d", len(topo.Links), pass, total)
+		}
+	}
+	if err := router.RouteLinksContext(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if passes[0] != len(topo.Links) || passes[1] != len(topo.Links) {
+		t.Errorf("Expected all links to be reported in the first passes, got %v", passes)
+	}
+}
+
+func TestLinkRouterMaxDetour(t *testing.T) {
+	newTopo := func(maxDetour float32) *Topology {
+		return &Topology{
+			Nodes: map[NodeId]*Node{
+				"A": {Id: "A", Pos: &[2]int16{0, 0}},
+				"B": {Id: "B", Pos: &[2]int16{6, 0}},
+				"C": {Id: "C", Pos: &[2]int16{3, -3}},
+				"D": {Id: "D", Pos: &[2]int16{3, 3}},
+			},
+			Links: map[LinkId]*Link{
+				"A-B": {Id: "A-B", From: "A", To: "B", MaxDetour: maxDetour},
+				"C-D": {
+					Id:   "C-D",
+					From: "C",
+					To:   "D",
+					Route: vec.Polyline{
+						{X: 3, Y: -3}, {X: 3, Y: -2}, {X: 3, Y: -1}, {X: 3, Y: 0},
+						{X: 3, Y: 1}, {X: 3, Y: 2}, {X: 3, Y: 3},
+					},
+					LockRoute: true,
+				},
+			},
+		}
+	}
+
+	// Crossing C-D is expensive enough that A-B goes around it
+	config := DefaultRouterConfig()
+	config.CrossingWeight = 1000
+
+	topo := newTopo(0)
+	NewLinkRouterWithConfig(topo, config).RouteLinks()
+	if length := topo.Links["A-B"].Route.Length(); length <= 9 {
+		t.Fatalf("Expected A-B to detour around C-D, got %v", topo.Links["A-B"].Route)
+	}
+
+	// Unless the detour is too long
+	topo = newTopo(1.5)
+	NewLinkRouterWithConfig(topo, config).RouteLinks()
+	if length := topo.Links["A-B"].Route.Length(); length != 6 {
+		t.Errorf("Expected A-B to go straight across C-D, got %v", topo.Links["A-B"].Route)
+	}
+}
+
+func TestLinkRouterMaxDetourUpdate(t *testing.T) {
+	// C-D is a U reaching up to top, through every cell on the way
+	uRoute := func(top float32) vec.Polyline {
+		route := vec.Polyline{}
+		for y := float32(8); y > top; y-- {
+			route = append(route, vec.Vec2{X: 2, Y: y})
+		}
+		route = append(route, vec.Vec2{X: 2, Y: top}, vec.Vec2{X: 3, Y: top})
+		for y := top; y <= 8; y++ {
+			route = append(route, vec.Vec2{X: 4, Y: y})
+		}
+		return route
+	}
+
+	// A-B crosses the U twice since going around it is too long
+	topo := &Topology{
+		Nodes: map[NodeId]*Node{
+			"A": {Id: "A", Pos: &[2]int16{0, 0}},
+			"B": {Id: "B", Pos: &[2]int16{6, 0}},
+			"C": {Id: "C", Pos: &[2]int16{2, 8}},
+			"D": {Id: "D", Pos: &[2]int16{4, 8}},
+		},
+		Links: map[LinkId]*Link{
+			"A-B": {Id: "A-B", From: "A", To: "B", MaxDetour: 2},
+			"C-D": {
+				Id:        "C-D",
+				From:      "C",
+				To:        "D",
+				Route:     uRoute(-8),
+				LockRoute: true,
+			},
+		},
+	}
+	config := DefaultRouterConfig()
+	config.CrossingWeight = 1000
+
+	router := NewLinkRouterWithConfig(topo, config)
+	router.RouteLinks()
+	if length := topo.Links["A-B"].Route.Length(); length != 6 {
+		t.Fatalf("Expected A-B to go straight across C-D, got %v", topo.Links["A-B"].Route)
+	}
+
+	// Once C-D is short enough to go around, A-B's crossings cost
+	// more than the detour
+	topo.Links["C-D"].Route = uRoute(-1)
+	if err := router.Update([]LinkId{"C-D"}); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	for _, p := range topo.Links["A-B"].Route {
+		if p.Y == 0 && p.X >= 2 && p.X <= 4 {
+			t.Fatalf("Expected A-B to go around C-D, got %v", topo.Links["A-B"].Route)
+		}
+	}
+}
+
+func TestLinkRouterLinkClasses(t *testing.T) {
+	newTopo := func() *Topology {
+		return &Topology{
+			Nodes: map[NodeId]*Node{
+				"A": {Id: "A", Pos: &[2]int16{0, 0}},
+				"B": {Id: "B", Pos: &[2]int16{6, 0}},
+				"C": {Id: "C", Pos: &[2]int16{3, -3}},
+				"D": {Id: "D", Pos: &[2]int16{3, 3}},
+			},
+			Links: map[LinkId]*Link{
+				"A-B": {Id: "A-B", From: "A", To: "B", Class: "access"},
+				"C-D": {
+					Id:    "C-D",
+					From:  "C",
+					To:    "D",
+					Class: "backbone",
+					Route: vec.Polyline{
+						{X: 3, Y: -3}, {X: 3, Y: -2}, {X: 3, Y: -1}, {X: 3, Y: 0},
+						{X: 3, Y: 1}, {X: 3, Y: 2}, {X: 3, Y: 3},
+					},
+					LockRoute: true,
+				},
+			},
+		}
+	}
+
+	// By default A-B goes straight across C-D
+	topo := newTopo()
+	NewLinkRouter(topo).RouteLinks()
+	if length := topo.Links["A-B"].Route.Length(); length != 6 {
+		t.Fatalf("Expected A-B to go straight across C-D, got %v", topo.Links["A-B"].Route)
+	}
+
+	// Other links go around the backbone
+	config := DefaultRouterConfig()
+	config.LinkClasses = map[string]*ClassCosts{
+		"backbone": {AvoidWeight: option.Float32{Value: 100, Valid: true}},
+	}
+	topo = newTopo()
+	NewLinkRouterWithConfig(topo, config).RouteLinks()
+	if length := topo.Links["A-B"].Route.Length(); length <= 9 {
+		t.Errorf("Expected A-B to go around the backbone, got %v", topo.Links["A-B"].Route)
+	}
+
+	// Unless their own class makes crossing it cheap
+	config.LinkClasses["access"] = &ClassCosts{CrossingWeight: option.Float32{Value: 0.01, Valid: true}}
+	topo = newTopo()
+	NewLinkRouterWithConfig(topo, config).RouteLinks()
+	if length := topo.Links["A-B"].Route.Length(); length != 6 {
+		t.Errorf("Expected A-B to go straight across the backbone, got %v", topo.Links["A-B"].Route)
+	}
+}
+
+func TestRouterConfigJSON(t *testing.T) {
+	config := DefaultRouterConfig()
+	if err := json.Unmarshal([]byte(`{"turn-cost": 3, "iteration-limit": 0}`), config); err != nil {
+		t.Fatalf("Error parsing config: %s", err)
+	}
+	if config.TurnCost != 3 || config.IterationLimit != 0 || config.SearchLimit != DefaultRouterConfig().SearchLimit {
+		t.Errorf("Expected only the given fields to change, got %+v", config)
+	}
+
+	for data, expected := range map[string]string{
+		`{"search-limit": 0}`:       "search-limit",
+		`{"iteration-limit": -1}`:   "iteration-limit",
+		`{"crossing-weight": -1}`:   "crossing-weight",
+		`{"turn-cost": -1}`:         "turn-cost",
+		`{"sharp-turn-cost": -1}`:   "sharp-turn-cost",
+		`{"spread-penalty": -1}`:    "spread-penalty",
+		`{"link-label-weight": -1}`: "link-label-weight",
+		`{"keep-out-weight": -1}`:   "keep-out-weight",
+	} {
+		config := DefaultRouterConfig()
+		if err := json.Unmarshal([]byte(data), config); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected an error about %s for %s, got %v", expected, data, err)
+		}
+	}
+}
+
+func TestLinkRouterNilConfig(t *testing.T) {
+	topo := testutil.Ring(4)
+	router := NewLinkRouterWithConfig(topo, nil)
+	router.RouteLinks()
+	if router.Config == nil || router.Stats().Unrouted != 0 {
+		t.Errorf("Expected the default config to route the links, got %+v", router.Stats())
+	}
+}
+
+func TestClassCostsJSON(t *testing.T) {
+	config := DefaultRouterConfig()
+	data := `{"link-classes": {"backbone": {"turn-cost": 4, "avoid-weight": 0}}}`
+	if err := json.Unmarshal([]byte(data), config); err != nil {
+		t.Fatalf("Error parsing config: %s", err)
+	}
+	if costs := config.LinkClasses["backbone"]; !costs.TurnCost.Valid || !costs.AvoidWeight.Valid || costs.CrossingWeight.Valid {
+		t.Errorf("Expected the turn cost and avoid weight to be set, got %+v", costs)
+	}
+
+	for _, field := range []string{"crossing-weight", "turn-cost", "sharp-turn-cost", "avoid-weight"} {
+		config := DefaultRouterConfig()
+		data := `{"link-classes": {"backbone": {"` + field + `": -1}}}`
+		if err := json.Unmarshal([]byte(data), config); err == nil || !strings.Contains(err.Error(), field) {
+			t.Errorf("Expected an error for a negative %s, got %v", field, err)
+		}
+	}
+}
+
+func TestLinkRouterAttachSides(t *testing.T) {
+	for _, smooth := range []bool{false, true} {
+		topo := &Topology{
+			Nodes: map[NodeId]*Node{
+				"A": {Id: "A", Pos: &[2]int16{0, 0}},
+				"B": {Id: "B", Pos: &[2]int16{4, 0}},
+			},
+			Links: map[LinkId]*Link{
+				"A-B": {Id: "A-B", From: "A", To: "B", AttachFrom: DirectionN, AttachTo: DirectionS},
+			},
+		}
+
+		router := NewLinkRouter(topo)
+		router.Smooth = smooth
+		router.RouteLinks()
+
+		route := topo.Links["A-B"].Route
+		if len(route) < 3 {
+			t.Fatalf("Expected A-B to be routed, got %v", route)
+		}
+		if first := route[1]; first != (vec.Vec2{X: 0, Y: -1}) {
+			t.Errorf("Expected the route to leave A to the north, got %v", route)
+		}
+		if last := route[len(route)-2]; last != (vec.Vec2{X: 4, Y: 1}) {
+			t.Errorf("Expected the route to arrive at B from the south, got %v", route)
+		}
+	}
+}
+
+func TestLinkRouterSmoothPrefixSuffix(t *testing.T) {
+	topo := &Topology{
+		Nodes: map[NodeId]*Node{
+			"A": {Id: "A", Pos: &[2]int16{0, 0}},
+			"B": {Id: "B", Pos: &[2]int16{3, 3}},
+		},
+		Links: map[LinkId]*Link{
+			"A-B": {
+				Id: "A-B", From: "A", To: "B",
+				RoutePrefix: [][2]int16{{1, 0}, {1, 1}, {2, 1}},
+				RouteSuffix: [][2]int16{{2, 2}, {3, 2}},
+			},
+		},
+	}
+
+	router := NewLinkRouter(topo)
+	router.Smooth = true
+	router.RouteLinks()
+
+	// The prefix and suffix make a staircase, which smoothing would
+	// otherwise cut into a diagonal
+	route := topo.Links["A-B"].Route
+	for _, cell := range []vec.Vec2{{X: 1, Y: 0}, {X: 1, Y: 1}, {X: 2, Y: 1}, {X: 2, Y: 2}, {X: 3, Y: 2}} {
+		if !slices.Contains(route, cell) {
+			t.Errorf("Expected the smoothed route to pass through %v, got %v", cell, route)
+		}
+	}
+}
+
+func TestLinkRouterSeparateLinks(t *testing.T) {
+	newTopo := func() *Topology {
+		return &Topology{
+			Nodes: map[NodeId]*Node{
+				"A": {Id: "A", Pos: &[2]int16{0, 0}},
+				"B": {Id: "B", Pos: &[2]int16{6, 0}},
+				"C": {Id: "C", Pos: &[2]int16{6, 1}},
+				"D": {Id: "D", Pos: &[2]int16{6, -1}},
+			},
+			Links: map[LinkId]*Link{
+				"A-B": {Id: "A-B", From: "A", To: "B"},
+				"A-C": {Id: "A-C", From: "A", To: "C"},
+				"A-D": {Id: "A-D", From: "A", To: "D"},
+			},
+		}
+	}
+
+	firstSteps := func(topo *Topology) map[vec.Vec2]int {
+		steps := map[vec.Vec2]int{}
+		for _, link := range topo.Links {
+			if len(link.Route) < 2 {
+				t.Fatalf("Expected link %s to be routed", link.Id)
+			}
+			steps[link.Route[1]]++
+		}
+		return steps
+	}
+
+	// Without penalties for sharing cells, the links all take the
+	// shortest route, leaving A the same way
+	config := DefaultRouterConfig()
+	config.CrossingWeight = 0
+
+	topo := newTopo()
+	NewLinkRouterWithConfig(topo, config).RouteLinks()
+	if steps := firstSteps(topo); len(steps) == 3 {
+		t.Errorf("Expected some links to leave A the same way, got %v", steps)
+	}
+
+	topo = newTopo()
+	router := NewLinkRouterWithConfig(topo, config)
+	router.SeparateLinks = true
+	router.RouteLinks()
+	if steps := firstSteps(topo); len(steps) != 3 {
+		t.Errorf("Expected each link to leave A a different way, got %v", steps)
+	}
+}
+
+func TestLinkRouterRouteStats(t *testing.T) {
+	topo := Topology{
+		Nodes: map[NodeId]*Node{
+			"A": {Id: "A", Pos: &[2]int16{0, 0}},
+			"B": {Id: "B", Pos: &[2]int16{4, 4}},
+			"C": {Id: "C", Pos: &[2]int16{8, 4}},
+		},
+		Links: map[LinkId]*Link{
+			"A-B": {Id: "A-B", From: "A", To: "B", Via: [][2]int16{{4, 0}}},
+			"B-C": {Id: "B-C", From: "B", To: "C"},
+			"A-X": {Id: "A-X", From: "A", To: "X"},
+		},
+	}
+
+	NewLinkRouter(&topo).RouteLinks()
+
+	stats := topo.Links["A-B"].RouteStats
+	if stats == nil {
+		t.Fatalf("Expected route stats for A-B")
+	}
+	if stats.Length != 8 || stats.Bends != 1 {
+		t.Errorf("Expected A-B to be 8 long with 1 bend, got %+v", *stats)
+	}
+	if stats := topo.Links["B-C"].RouteStats; stats == nil || stats.Length != 4 || stats.Bends != 0 {
+		t.Errorf("Expected B-C to be 4 long with no bends, got %+v", stats)
+	}
+	// Links that can't be routed have no stats
+	if stats := topo.Links["A-X"].RouteStats; stats != nil {
+		t.Errorf("Expected no stats for the unrouted link, got %+v", *stats)
+	}
+}
+
+func TestLinkRouterViaRadius(t *testing.T) {
+	newTopo := func(radius []int16) *Topology {
+		return &Topology{
+			Nodes: map[NodeId]*Node{
+				"A": {Id: "A", Pos: &[2]int16{0, 0}},
+				"B": {Id: "B", Pos: &[2]int16{10, 0}},
+			},
+			Links: map[LinkId]*Link{
+				"A-B": {Id: "A-B", From: "A", To: "B", Via: [][2]int16{{5, 4}}, ViaRadius: radius},
+			},
+		}
+	}
+
+	hard := newTopo(nil)
+	NewLinkRouter(hard).RouteLinks()
+	soft := newTopo([]int16{2})
+	NewLinkRouter(soft).RouteLinks()
+
+	via := grid.Pos{X: 5, Y: 4}
+	if !slices.ContainsFunc(hard.Links["A-B"].Route, func(p vec.Vec2) bool {
+		return grid.FromVec(p) == via
+	}) {
+		t.Errorf("Expected the route through the via, got %v", hard.Links["A-B"].Route)
+	}
+
+	route := soft.Links["A-B"].Route
+	if !slices.ContainsFunc(route, func(p vec.Vec2) bool {
+		return grid.FromVec(p).ChebyshevDistance(via) <= 2
+	}) {
+		t.Errorf("Expected the route within 2 cells of the via, got %v", route)
+	}
+	if route.Length() >= hard.Links["A-B"].Route.Length() {
+		t.Errorf("Expected a shorter route with a via radius, got %v", route)
+	}
+}
+
+func TestLinkRouterMultiCellAttachSides(t *testing.T) {
+	newTopo := func(sides []Direction) *Topology {
+		return &Topology{
+			Nodes: map[NodeId]*Node{
+				"A": {Id: "A", Pos: &[2]int16{5, 0}},
+				"M": {
+					Id:          "M",
+					Pos:         &[2]int16{5, 5},
+					Extents:     &NodeExtents{Width: 5, Height: 1},
+					AttachSides: sides,
+				},
+			},
+			Links: map[LinkId]*Link{
+				"A-M": {Id: "A-M", From: "A", To: "M"},
+				"M-A": {Id: "M-A", From: "M", To: "A"},
+			},
+		}
+	}
+
+	// Without restrictions, the links arrive from the north,
+	// facing A
+	topo := newTopo(nil)
+	NewLinkRouter(topo).RouteLinks()
+	route := topo.Links["A-M"].Route
+	if len(route) < 2 || route[len(route)-2].Y >= 5 {
+		t.Errorf("Expected A-M to attach to the north side, got %v", route)
+	}
+
+	topo = newTopo([]Direction{DirectionS})
+	NewLinkRouter(topo).RouteLinks()
+	route = topo.Links["A-M"].Route
+	if len(route) < 2 || route[len(route)-2].Y <= 5 {
+		t.Errorf("Expected A-M to attach to the south side, got %v", route)
+	}
+	route = topo.Links["M-A"].Route
+	if len(route) < 2 || route[1].Y <= 5 {
+		t.Errorf("Expected M-A to leave from the south side, got %v", route)
+	}
+}
+
+func TestLinkRouterReset(t *testing.T) {
+	newTopo := func(bx int16) *Topology {
+		return &Topology{
+			Nodes: map[NodeId]*Node{
+				"A": {Id: "A", Pos: &[2]int16{0, 0}},
+				"B": {Id: "B", Pos: &[2]int16{bx, 4}},
+				"C": {Id: "C", Pos: &[2]int16{0, 8}},
+			},
+			Links: map[LinkId]*Link{
+				"A-B": {Id: "A-B", From: "A", To: "B"},
+				"A-C": {Id: "A-C", From: "A", To: "C"},
+				"B-C": {Id: "B-C", From: "B", To: "C"},
+			},
+		}
+	}
+
+	router := NewLinkRouter(newTopo(6))
+	router.SetExtents(-1, -1, 7, 9)
+	router.RouteLinks()
+
+	// After moving B, a reset router routes the same as a new one
+	expected := newTopo(10)
+	NewLinkRouter(expected).RouteLinks()
+
+	topo := newTopo(10)
+	router.Reset(topo)
+	router.RouteLinks()
+
+	for id, link := range topo.Links {
+		if !slices.Equal(link.Route, expected.Links[id].Route) {
+			t.Errorf("Route for %s differs after reset, expected %v, got %v",
+				id, expected.Links[id].Route, link.Route)
+		}
+	}
+}
+
+func TestLinkRouterStableTies(t *testing.T) {
+	// A grid of nodes linked across the middle has many routes of
+	// equal cost
+	newTopo := func() *Topology {
+		topo := &Topology{Nodes: map[NodeId]*Node{}, Links: map[LinkId]*Link{}}
+		for i := int16(0); i < 4; i++ {
+			from := NodeId(fmt.Sprintf("W%d", i))
+			to := NodeId(fmt.Sprintf("E%d", i))
+			topo.Nodes[from] = &Node{Id: from, Pos: &[2]int16{0, i * 3}}
+			topo.Nodes[to] = &Node{Id: to, Pos: &[2]int16{9, 9 - i*3}}
+			id := LinkId(fmt.Sprintf("%s-%s", from, to))
+			topo.Links[id] = &Link{Id: id, From: from, To: to}
+		}
+		return topo
+	}
+
+	route := func(workers int) *Topology {
+		topo := newTopo()
+		router := NewLinkRouter(topo)
+		router.Workers = workers
+		router.StableTies = true
+		router.RouteLinks()
+		return topo
+	}
+
+	expected := route(1)
+	for id, link := range expected.Links {
+		if len(link.Route) < 2 {
+			t.Fatalf("No route for %s", id)
+		}
+	}
+	// Routing with several workers gives the same routes as one
+	for _, workers := range []int{1, 4, 8} {
+		for i := 0; i < 10; i++ {
+			topo := route(workers)
+			for id, link := range topo.Links {
+				if !slices.Equal(link.Route, expected.Links[id].Route) {
+					t.Fatalf("Route for %s differs between runs with %d workers, expected %v, got %v",
+						id, workers, expected.Links[id].Route, link.Route)
+				}
+			}
+		}
+	}
+}
+
+func TestLinkRouterStats(t *testing.T) {
+	newTopo := func() *Topology {
+		return &Topology{
+			Nodes: map[NodeId]*Node{
+				"A": {Id: "A", Pos: &[2]int16{0, 2}},
+				"B": {Id: "B", Pos: &[2]int16{4, 2}},
+				"C": {Id: "C", Pos: &[2]int16{2, 0}},
+				"D": {Id: "D", Pos: &[2]int16{2, 4}},
+			},
+			Links: map[LinkId]*Link{
+				"A-B": {Id: "A-B", From: "A", To: "B"},
+				"C-D": {Id: "C-D", From: "C", To: "D"},
+				"A-X": {Id: "A-X", From: "A", To: "X"},
+			},
+		}
+	}
+
+	// The links have to cross, and can't be made shorter
+	router := NewLinkRouter(newTopo())
+	router.RouteLinks()
+
+	stats := router.Stats()
+	if stats.Routed != 2 || stats.Unrouted != 1 {
+		t.Errorf("Expected 2 routed and 1 unrouted links, got %d and %d", stats.Routed, stats.Unrouted)
+	}
+	if !slices.Equal(stats.UnroutedLinks, []LinkId{"A-X"}) {
+		t.Errorf("Expected A-X to be reported as unrouted, got %v", stats.UnroutedLinks)
+	}
+	if stats.Crossings != 1 {
+		t.Errorf("Expected 1 crossing, got %d", stats.Crossings)
+	}
+	if stats.TotalLength != 8 {
+		t.Errorf("Expected a total length of 8, got %v", stats.TotalLength)
+	}
+	if stats.Iterations < 1 || len(stats.SearchLimited) != 0 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+
+	// Taut routes only keep their ends, the crossing is between them
+	topo := newTopo()
+	router = NewLinkRouter(topo)
+	router.PullTaut = true
+	router.RouteLinks()
+	if route := topo.Links["A-B"].Route; len(route) > 2 {
+		t.Fatalf("Expected A-B to be pulled straight, got %v", route)
+	}
+	if crossings := router.Stats().Crossings; crossings != 1 {
+		t.Errorf("Expected 1 crossing with taut routes, got %d", crossings)
+	}
+
+	config := DefaultRouterConfig()
+	config.SearchLimit = 2
+	router = NewLinkRouterWithConfig(newTopo(), config)
+	router.RouteLinks()
+	if limited := router.Stats().SearchLimited; !slices.Equal(limited, []LinkId{"A-B", "C-D"}) {
+		t.Errorf("Expected both links to hit the search limit, got %v", limited)
+	}
+}
+
+func TestLinkRouterMultiCellLink(t *testing.T) {
+	topo := &Topology{
+		Nodes: map[NodeId]*Node{
+			"A": {Id: "A", Pos: &[2]int16{0, 0}, Extents: &NodeExtents{Width: 2, Height: 2}},
+			"B": {Id: "B", Pos: &[2]int16{6, 0}, Extents: &NodeExtents{Width: 2, Height: 2}},
+			"C": {Id: "C", Pos: &[2]int16{3, 4}},
+		},
+		Links: map[LinkId]*Link{
+			"A-B": {Id: "A-B", From: "A", To: "B"},
+			"A-C": {Id: "A-C", From: "A", To: "C"},
+		},
+	}
+
+	// The link between the two multi-cell nodes is skipped, with
+	// or without workers
+	for _, workers := range []int{1, 2} {
+		router := NewLinkRouter(topo)
+		router.Workers = workers
+		router.RouteLinks()
+
+		if stats := router.Stats(); !slices.Equal(stats.UnroutedLinks, []LinkId{"A-B"}) {
+			t.Errorf("Expected A-B to be reported as unrouted with %d workers, got %v", workers, stats.UnroutedLinks)
+		}
+		if len(topo.Links["A-C"].Route) < 2 {
+			t.Errorf("Expected A-C to be routed with %d workers", workers)
+		}
+		topo.Links["A-C"].Route = nil
+	}
+}
+
+func TestLinkRouterOccupancy(t *testing.T) {
+	topo := &Topology{
+		Nodes: map[NodeId]*Node{
+			"A": {Id: "A", Pos: &[2]int16{0, 0}, LabelAt: DirectionN, KeepOut: 1},
+			"B": {Id: "B", Pos: &[2]int16{6, 0}},
+		},
+		Links: map[LinkId]*Link{
+			"A-B": {Id: "A-B", From: "A", To: "B"},
+		},
+		Obstacles: []*Obstacle{{Rect: &[2][2]int16{{3, 2}, {3, 2}}}},
+	}
+
+	router := NewLinkRouter(topo)
+	router.RouteLinks()
+	occupancy := router.Occupancy()
+
+	if cell := occupancy[grid.Pos{X: 0, Y: 0}]; cell.Node != "A" || !slices.Equal(cell.Links, []LinkId{"A-B"}) {
+		t.Errorf("Expected node A and link A-B at A, got %+v", cell)
+	}
+	if cell := occupancy[grid.Pos{X: 0, Y: -1}]; !cell.NodeLabel || !slices.Equal(cell.KeepOut, []NodeId{"A"}) {
+		t.Errorf("Expected A's label and keep-out north of A, got %+v", cell)
+	}
+	if cell := occupancy[grid.Pos{X: 3, Y: 2}]; !cell.Obstacle {
+		t.Errorf("Expected the obstacle, got %+v", cell)
+	}
+	if _, ok := occupancy[grid.Pos{X: 3, Y: 4}]; ok {
+		t.Errorf("Expected empty cells to be left out")
+	}
+
+	overlay := NewRenderer().RenderOccupancy(occupancy).(*canvas.Group)
+	if len(overlay.Children) != len(occupancy) {
+		t.Fatalf("Expected a square for each of the %d cells, got %d", len(occupancy), len(overlay.Children))
+	}
+	titles := []string{}
+	for _, obj := range overlay.Children {
+		titles = append(titles, obj.GetAttributes().Title)
+	}
+	if !slices.Contains(titles, "node A\nkeep out of A\nlinks A-B") {
+		t.Errorf("Expected a title for A's cell, got %q", titles)
+	}
+}
+
+func TestLinkRouterRouteLink(t *testing.T) {
+	topo := &Topology{
+		Nodes: map[NodeId]*Node{
+			"A": {Id: "A", Pos: &[2]int16{0, 0}},
+			"B": {Id: "B", Pos: &[2]int16{6, 0}},
+			"C": {Id: "C", Pos: &[2]int16{0, 4}},
+			"D": {Id: "D", Pos: &[2]int16{6, 4}},
+		},
+		Links: map[LinkId]*Link{
+			"A-B": {Id: "A-B", From: "A", To: "B"},
+			"C-D": {Id: "C-D", From: "C", To: "D"},
+			"A-X": {Id: "A-X", From: "A", To: "X"},
+		},
+	}
+
+	router := NewLinkRouter(topo)
+	router.RouteLinks()
+	other := slices.Clone(topo.Links["C-D"].Route)
+
+	// Move A-B's via point and route just that link
+	topo.Links["A-B"].Via = [][2]int16{{3, 2}}
+	route, err := router.RouteLink("A-B")
+	if err != nil {
+		t.Fatalf("Error routing link: %s", err)
+	}
+	if !slices.Contains(route, vec.Vec2{X: 3, Y: 2}) {
+		t.Errorf("Expected the route through the via point, got %v", route)
+	}
+	if !slices.Equal(topo.Links["A-B"].Route, route) || topo.Links["A-B"].RouteStats.Length != route.Length() {
+		t.Errorf("Expected the link's route and stats to be updated")
+	}
+	if !slices.Equal(topo.Links["C-D"].Route, other) {
+		t.Errorf("Expected C-D to be left alone, got %v", topo.Links["C-D"].Route)
+	}
+
+	for _, id := range []LinkId{"A-X", "missing"} {
+		if _, err := router.RouteLink(id); err == nil {
+			t.Errorf("Expected an error routing %s", id)
+		}
+	}
+}
+
+func TestLinkRouterWideLinks(t *testing.T) {
+	newTopo := func() *Topology {
+		route := vec.Polyline{}
+		for x := range 9 {
+			route = append(route, vec.Vec2{X: float32(x)})
+		}
+		return &Topology{
+			Nodes: map[NodeId]*Node{
+				"A": {Id: "A", Pos: &[2]int16{0, 0}},
+				"B": {Id: "B", Pos: &[2]int16{8, 0}},
+				"C": {Id: "C", Pos: &[2]int16{0, 1}},
+				"D": {Id: "D", Pos: &[2]int16{8, 1}},
+			},
+			Links: map[LinkId]*Link{
+				"A-B": {
+					Id: "A-B", From: "A", To: "B",
+					Style:     &LinkStyle{Size: 16},
+					Route:     route,
+					LockRoute: true,
+				},
+				"C-D": {Id: "C-D", From: "C", To: "D"},
+			},
+		}
+	}
+
+	// Without spreading, C-D normally runs right next to A-B
+	topo := newTopo()
+	router := NewLinkRouter(topo)
+	router.SpreadLinks = false
+	router.RouteLinks()
+	for _, p := range topo.Links["C-D"].Route {
+		if p.Y != 1 {
+			t.Fatalf("Expected C-D to run straight, got %v", topo.Links["C-D"].Route)
+		}
+	}
+
+	// A wide A-B takes up the cells beside it, so C-D keeps clear
+	topo = newTopo()
+	router = NewLinkRouter(topo)
+	router.SpreadLinks = false
+	router.WideLinkSize = 12
+	router.RouteLinks()
+	route := topo.Links["C-D"].Route
+	if p := route.Interpolate(0.5); p.Y < 2 {
+		t.Errorf("Expected C-D to keep clear of A-B, got %v", route)
+	}
+
+	occupancy := router.Occupancy()
+	if cell := occupancy[grid.Pos{X: 4, Y: 1}]; !slices.Equal(cell.WideLinks, []LinkId{"A-B"}) {
+		t.Errorf("Expected the cell below A-B to be taken by it, got %+v", cell)
+	}
+
+	// The size can come from the link's class, by way of a renderer
+	topo = newTopo()
+	topo.Links["A-B"].Style = nil
+	topo.Links["A-B"].Class = "trunk"
+	config := DefaultRenderConfig()
+	config.LinkStyles["trunk"] = LinkStyle{Size: 16}
+	router = NewLinkRouter(topo)
+	router.SpreadLinks = false
+	router.WideLinkSize = 12
+	router.LinkSize = NewRendererWithConfig(config).LinkSize
+	router.RouteLinks()
+	if p := topo.Links["C-D"].Route.Interpolate(0.5); p.Y < 2 {
+		t.Errorf("Expected C-D to keep clear of A-B's class size, got %v", topo.Links["C-D"].Route)
+	}
+}
+
+func TestLinkRouterAvoidCornerSqueeze(t *testing.T) {
+	newTopo := func() *Topology {
+		return &Topology{
+			Nodes: map[NodeId]*Node{
+				"A": {Id: "A", Pos: &[2]int16{0, 0}},
+				"B": {Id: "B", Pos: &[2]int16{3, 3}},
+				// Touching at the corner on the diagonal from A to B
+				"X": {Id: "X", Pos: &[2]int16{2, 1}},
+				"Y": {Id: "Y", Pos: &[2]int16{1, 2}},
+			},
+			Links: map[LinkId]*Link{
+				"A-B": {Id: "A-B", From: "A", To: "B"},
+			},
+		}
+	}
+
+	squeezes := func(route vec.Polyline) bool {
+		for i := 1; i < len(route); i++ {
+			if route[i-1] == (vec.Vec2{X: 1, Y: 1}) && route[i] == (vec.Vec2{X: 2, Y: 2}) {
+				return true
+			}
+		}
+		return false
+	}
+
+	topo := newTopo()
+	NewLinkRouter(topo).RouteLinks()
+	if !squeezes(topo.Links["A-B"].Route) {
+		t.Fatalf("Expected the route to go straight between X and Y, got %v", topo.Links["A-B"].Route)
+	}
+
+	topo = newTopo()
+	router := NewLinkRouter(topo)
+	router.AvoidCornerSqueeze = true
+	router.RouteLinks()
+	route := topo.Links["A-B"].Route
+	if len(route) == 0 || squeezes(route) {
+		t.Errorf("Expected the route to go around X and Y, got %v", route)
+	}
+}
+
+func TestLinkRouterUpdate(t *testing.T) {
+	topo := &Topology{
+		Nodes: map[NodeId]*Node{
+			"A": {Id: "A", Pos: &[2]int16{0, 0}},
+			"B": {Id: "B", Pos: &[2]int16{6, 0}},
+			"C": {Id: "C", Pos: &[2]int16{0, 4}},
+			"D": {Id: "D", Pos: &[2]int16{6, 4}},
+		},
+		Links: map[LinkId]*Link{
+			"A-B1": {Id: "A-B1", From: "A", To: "B"},
+			"A-B2": {Id: "A-B2", From: "A", To: "B"},
+			"C-D":  {Id: "C-D", From: "C", To: "D"},
+		},
+	}
+
+	router := NewLinkRouter(topo)
+	router.StableTies = true
+	router.RouteLinks()
+	other := slices.Clone(topo.Links["C-D"].Route)
+
+	straight, detour := LinkId("A-B1"), LinkId("A-B2")
+	if topo.Links[straight].Route.Length() > topo.Links[detour].Route.Length() {
+		straight, detour = detour, straight
+	}
+
+	// Removing the straight link lets the other one take its place
+	delete(topo.Links, straight)
+	if err := router.Update([]LinkId{straight}); err != nil {
+		t.Fatalf("Error updating routes: %s", err)
+	}
+	route := topo.Links[detour].Route
+	if route.Length() != 6 {
+		t.Errorf("Expected %s to straighten out, got %v", detour, route)
+	}
+	if topo.Links[detour].RouteStats.Length != 6 {
+		t.Errorf("Expected the route stats of %s to be updated", detour)
+	}
+	if !slices.Equal(topo.Links["C-D"].Route, other) {
+		t.Errorf("Expected C-D to be left alone, got %v", topo.Links["C-D"].Route)
+	}
+	for pos, cell := range router.Occupancy() {
+		if slices.Contains(cell.Links, straight) {
+			t.Errorf("Expected %s to be removed from the grid, found at %v", straight, pos)
+		}
+	}
+
+	// New links are routed, those that can't be are reported
+	topo.Links["B-D"] = &Link{Id: "B-D", From: "B", To: "D"}
+	topo.Links["A-X"] = &Link{Id: "A-X", From: "A", To: "X"}
+	err := router.Update([]LinkId{"B-D", "A-X"})
+	if err == nil || !strings.Contains(err.Error(), "A-X") {
+		t.Errorf("Expected an error for A-X, got %v", err)
+	}
+	if len(topo.Links["B-D"].Route) == 0 || topo.Links["B-D"].RouteStats == nil {
+		t.Errorf("Expected B-D to be routed")
+	}
+}
+
+func TestLinkRouterUpdateNearby(t *testing.T) {
+	wall := vec.Polyline{}
+	for y := float32(-5); y <= 5; y++ {
+		wall = append(wall, vec.Vec2{X: 3, Y: y})
+	}
+	topo := &Topology{
+		Nodes: map[NodeId]*Node{
+			"A": {Id: "A", Pos: &[2]int16{0, 0}},
+			"B": {Id: "B", Pos: &[2]int16{6, 0}},
+			"C": {Id: "C", Pos: &[2]int16{3, -5}},
+			"D": {Id: "D", Pos: &[2]int16{3, 5}},
+		},
+		Links: map[LinkId]*Link{
+			"A-B": {Id: "A-B", From: "A", To: "B"},
+			"C-D": {Id: "C-D", From: "C", To: "D", Route: wall, LockRoute: true},
+		},
+	}
+	config := DefaultRouterConfig()
+	config.CrossingWeight = 1000
+
+	// A-B goes around C-D without sharing any cells with it
+	router := NewLinkRouterWithConfig(topo, config)
+	router.RouteLinks()
+	for _, p := range topo.Links["A-B"].Route {
+		if p.X == 3 && p.Y >= -5 && p.Y <= 5 {
+			t.Fatalf("Expected A-B to go around C-D, got %v", topo.Links["A-B"].Route)
+		}
+	}
+
+	// Removing C-D lets A-B straighten out, since it passed close by
+	delete(topo.Links, "C-D")
+	if err := router.Update([]LinkId{"C-D"}); err != nil {
+		t.Fatalf("Error updating routes: %s", err)
+	}
+	if route := topo.Links["A-B"].Route; route.Length() != 6 {
+		t.Errorf("Expected A-B to straighten out, got %v", route)
+	}
+}
@@ -0,0 +1,97 @@
+package raumata
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/REANNZ/raumata/grid"
+	"github.com/REANNZ/raumata/internal/f32"
+)
+
+// FitMembers sets the position and extents of each node with
+// [Node.Members] so it covers the cells of its members, plus
+// [Node.MemberPadding] cells on each side. Members can have members
+// of their own, these are fitted first.
+//
+// Members without a position are ignored, and a node without any
+// positioned members is left as it is. It is an error for a member
+// not to be in the topology, or for a node to contain itself.
+//
+// It should be called once the nodes have their positions, before
+// [PlaceLabels] and before the [LinkRouter] is created.
+func (t *Topology) FitMembers() error {
+	ids := make([]NodeId, 0, len(t.Nodes))
+	for id, node := range t.Nodes {
+		if node != nil && len(node.Members) > 0 {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+
+	fitted := map[NodeId]bool{}
+	for _, id := range ids {
+		if err := t.fitMembers(id, fitted, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Fits the node with the given id, after fitting any of its members
+// that have members. path holds the nodes being fitted that contain
+// this one.
+func (t *Topology) fitMembers(id NodeId, fitted map[NodeId]bool, path []NodeId) error {
+	if fitted[id] {
+		return nil
+	}
+	if slices.Contains(path, id) {
+		return fmt.Errorf("Node '%s' contains itself", id)
+	}
+	path = append(path, id)
+
+	node := t.Nodes[id]
+	var minPos, maxPos grid.Pos
+	found := false
+	for _, memberId := range node.Members {
+		member := t.GetNode(memberId)
+		if member == nil {
+			return fmt.Errorf("Node '%s' has unknown member '%s'", id, memberId)
+		}
+		if len(member.Members) > 0 {
+			if err := t.fitMembers(memberId, fitted, path); err != nil {
+				return err
+			}
+		}
+		if member.Pos == nil {
+			continue
+		}
+
+		minVec, maxVec := member.GetExtents()
+		memberMin := grid.Pos{X: int16(f32.Ceil(minVec.X)), Y: int16(f32.Ceil(minVec.Y))}
+		memberMax := grid.Pos{X: int16(f32.Ceil(maxVec.X)) - 1, Y: int16(f32.Ceil(maxVec.Y)) - 1}
+		if !found {
+			minPos, maxPos = memberMin, memberMax
+			found = true
+		} else {
+			minPos = minPos.Min(memberMin)
+			maxPos = maxPos.Max(memberMax)
+		}
+	}
+	fitted[id] = true
+
+	if !found {
+		return nil
+	}
+
+	padding := max(node.MemberPadding, 0)
+	width := maxPos.X - minPos.X + 1 + 2*padding
+	height := maxPos.Y - minPos.Y + 1 + 2*padding
+
+	// Positions are the center of the node, rounded towards the
+	// bottom right for even sizes, see [Node.GetExtents]
+	node.Pos = &[2]int16{minPos.X - padding + width/2, minPos.Y - padding + height/2}
+	node.Extents = &NodeExtents{Width: width, Height: height}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package raumata_test
+
+import (
+	"testing"
+
+	. "github.com/REANNZ/raumata"
+)
+
+func TestFitMembers(t *testing.T) {
+	topo := &Topology{
+		Nodes: map[NodeId]*Node{
+			"A":      {Id: "A", Pos: &[2]int16{2, 3}},
+			"B":      {Id: "B", Pos: &[2]int16{5, 4}},
+			"C":      {Id: "C", Pos: &[2]int16{9, 9}},
+			"D":      {Id: "D"},
+			"site":   {Id: "site", Members: []NodeId{"A", "B", "D"}, MemberPadding: 1},
+			"region": {Id: "region", Members: []NodeId{"site", "C"}},
+		},
+	}
+
+	if err := topo.FitMembers(); err != nil {
+		t.Fatalf("Error fitting members: %s", err)
+	}
+
+	// The site covers (1, 2) to (6, 5), and the region covers the
+	// site and C
+	checkCells := func(id NodeId, minX, minY, maxX, maxY float32) {
+		min, max := topo.Nodes[id].GetExtents()
+		if min.X != minX-0.5 || min.Y != minY-0.5 || max.X != maxX+0.5 || max.Y != maxY+0.5 {
+			t.Errorf("Incorrect extents for %s, expected (%v, %v) to (%v, %v), got %v to %v",
+				id, minX, minY, maxX, maxY, min, max)
+		}
+	}
+	checkCells("site", 1, 2, 6, 5)
+	checkCells("region", 1, 2, 9, 9)
+
+	topo.Nodes["D"].Members = []NodeId{"region"}
+	if err := topo.FitMembers(); err == nil {
+		t.Errorf("Expected an error for a node containing itself")
+	}
+
+	topo.Nodes["D"].Members = []NodeId{"E"}
+	if err := topo.FitMembers(); err == nil {
+		t.Errorf("Expected an error for an unknown member")
+	}
+}
+
+func TestLinkRouterMembers(t *testing.T) {
+	// A is inside the site, so its link to B has to cross it
+	topo := &Topology{
+		Nodes: map[NodeId]*Node{
+			"A":    {Id: "A", Pos: &[2]int16{0, 0}},
+			"A2":   {Id: "A2", Pos: &[2]int16{2, 0}},
+			"B":    {Id: "B", Pos: &[2]int16{8, 0}},
+			"C":    {Id: "C", Pos: &[2]int16{-4, 2}},
+			"D":    {Id: "D", Pos: &[2]int16{8, 2}},
+			"site": {Id: "site", Members: []NodeId{"A", "A2"}, MemberPadding: 2},
+		},
+		Links: map[LinkId]*Link{
+			"A-B": {Id: "A-B", From: "A", To: "B"},
+			"C-D": {Id: "C-D", From: "C", To: "D"},
+		},
+	}
+	if err := topo.FitMembers(); err != nil {
+		t.Fatalf("Error fitting members: %s", err)
+	}
+
+	NewLinkRouter(topo).RouteLinks()
+
+	if len(topo.Links["A-B"].Route) < 2 {
+		t.Errorf("Expected a route out of the site for A-B")
+	}
+
+	// Other links still go around the site
+	for _, p := range topo.Links["C-D"].Route {
+		if p.X >= -2 && p.X <= 4 && p.Y >= -2 && p.Y <= 2 {
+			t.Errorf("C-D passes through the site at %v", p)
+		}
+	}
+}
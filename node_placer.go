@@ -0,0 +1,449 @@
+package raumata
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"slices"
+
+	"github.com/REANNZ/raumata/grid"
+	"github.com/REANNZ/raumata/internal/f32"
+)
+
+// Controls how [PlaceNodes] positions nodes
+type PlacementConfig struct {
+	// Nodes are placed on positions that are multiples of the
+	// spacing, leaving room for links between them (default 2)
+	Spacing int16
+	// The size of the area nodes are placed in, 0 means it is
+	// determined from the number of nodes (default 0)
+	Width  int16
+	Height int16
+	// The number of moves tried during the search (default 20000)
+	Iterations int
+	// The cost of each unit of link length (default 1)
+	LengthWeight float32
+	// The cost of each pair of crossing links (default 10)
+	CrossingWeight float32
+	// Seed for the random number generator, the same seed and
+	// topology will always give the same positions (default 1)
+	Seed int64
+}
+
+func DefaultPlacementConfig() *PlacementConfig {
+	return &PlacementConfig{
+		Spacing:        2,
+		Iterations:     20000,
+		LengthWeight:   1,
+		CrossingWeight: 10,
+		Seed:           1,
+	}
+}
+
+// PlaceNodes finds positions for nodes that don't have one, using
+// simulated annealing to minimize the total link length and the
+// number of crossing links. Nodes that already have a position are
+// left where they are. Nodes with members aren't placed, they can
+// be fitted around their members with [Topology.FitMembers].
+//
+// If config is nil, the default config is used.
+func PlaceNodes(topo *Topology, config *PlacementConfig) error {
+	if config == nil {
+		config = DefaultPlacementConfig()
+	}
+
+	p := newNodePlacer(topo, config)
+	if len(p.movable) == 0 {
+		return nil
+	}
+
+	if err := p.initialPlacement(); err != nil {
+		return err
+	}
+	p.anneal()
+
+	for _, id := range p.movable {
+		pos := p.pos[id]
+		topo.Nodes[id].Pos = &[2]int16{pos.X, pos.Y}
+	}
+
+	return nil
+}
+
+type placerLink struct {
+	from, to NodeId
+}
+
+type nodePlacer struct {
+	topo    *Topology
+	config  *PlacementConfig
+	rand    *rand.Rand
+	spacing int16
+
+	// Current position of every node
+	pos map[NodeId]grid.Pos
+	// Which node occupies each cell
+	occupied grid.Grid[NodeId]
+	// Nodes without a fixed position, sorted by id so the
+	// result is deterministic
+	movable []NodeId
+	isFixed map[NodeId]bool
+
+	links     []placerLink
+	nodeLinks map[NodeId][]int
+
+	// The area candidate positions are chosen from
+	areaMin, areaMax grid.Pos
+}
+
+func newNodePlacer(topo *Topology, config *PlacementConfig) *nodePlacer {
+	p := &nodePlacer{
+		topo:      topo,
+		config:    config,
+		rand:      rand.New(rand.NewSource(config.Seed)),
+		spacing:   max(config.Spacing, 1),
+		pos:       map[NodeId]grid.Pos{},
+		occupied:  grid.Grid[NodeId]{},
+		isFixed:   map[NodeId]bool{},
+		nodeLinks: map[NodeId][]int{},
+	}
+
+	for id, node := range topo.Nodes {
+		// Nodes with members are fitted around them afterwards
+		if node == nil || len(node.Members) > 0 {
+			continue
+		}
+		if node.Pos == nil {
+			p.movable = append(p.movable, id)
+		} else {
+			pos := grid.Pos{X: node.Pos[0], Y: node.Pos[1]}
+			p.isFixed[id] = true
+			p.pos[id] = pos
+			p.occupy(id, pos)
+		}
+	}
+	slices.Sort(p.movable)
+
+	linkIds := make([]LinkId, 0, len(topo.Links))
+	for id, link := range topo.Links {
+		if link == nil || link.From == link.To {
+			continue
+		}
+		from, to := topo.Nodes[link.From], topo.Nodes[link.To]
+		if from == nil || to == nil || len(from.Members) > 0 || len(to.Members) > 0 {
+			continue
+		}
+		linkIds = append(linkIds, id)
+	}
+	slices.Sort(linkIds)
+
+	for _, id := range linkIds {
+		link := topo.Links[id]
+		idx := len(p.links)
+		p.links = append(p.links, placerLink{from: link.From, to: link.To})
+		p.nodeLinks[link.From] = append(p.nodeLinks[link.From], idx)
+		p.nodeLinks[link.To] = append(p.nodeLinks[link.To], idx)
+	}
+
+	p.computeArea()
+
+	return p
+}
+
+// Works out the area to place nodes in. The area always covers the
+// fixed nodes and is large enough for the movable nodes to fit in
+// with room to spare.
+func (p *nodePlacer) computeArea() {
+	count := len(p.movable) + len(p.isFixed)
+	side := int16(math.Ceil(math.Sqrt(float64(count)*2))) * p.spacing
+
+	width, height := side, side
+	if p.config.Width > 0 {
+		width = p.config.Width
+	}
+	if p.config.Height > 0 {
+		height = p.config.Height
+	}
+
+	if len(p.isFixed) == 0 {
+		p.areaMin = grid.Pos{}
+		p.areaMax = grid.Pos{X: width - 1, Y: height - 1}
+		return
+	}
+
+	first := true
+	var fixedMin, fixedMax grid.Pos
+	for _, pos := range p.pos {
+		if first {
+			fixedMin, fixedMax = pos, pos
+			first = false
+		}
+		fixedMin = fixedMin.Min(pos)
+		fixedMax = fixedMax.Max(pos)
+	}
+
+	// Grow the fixed node area out evenly to the requested size
+	extraX := max(width-1-(fixedMax.X-fixedMin.X), 0)
+	extraY := max(height-1-(fixedMax.Y-fixedMin.Y), 0)
+	p.areaMin = grid.Pos{X: fixedMin.X - extraX/2, Y: fixedMin.Y - extraY/2}
+	p.areaMax = grid.Pos{X: fixedMax.X + (extraX+1)/2, Y: fixedMax.Y + (extraY+1)/2}
+
+	// Align the area so candidate positions are multiples of the spacing
+	p.areaMin.X -= mod(p.areaMin.X, p.spacing)
+	p.areaMin.Y -= mod(p.areaMin.Y, p.spacing)
+}
+
+// Returns a mod b, always in the range [0, b)
+func mod(a, b int16) int16 {
+	return ((a % b) + b) % b
+}
+
+// Returns the cells a node covers when placed at pos
+func (p *nodePlacer) cells(id NodeId, pos grid.Pos) []grid.Pos {
+	node := p.topo.Nodes[id]
+	if !node.IsMultiCell() {
+		return []grid.Pos{pos}
+	}
+
+	width := max(node.Extents.Width, 1)
+	height := max(node.Extents.Height, 1)
+	minPos := grid.Pos{X: pos.X - width/2, Y: pos.Y - height/2}
+
+	cells := make([]grid.Pos, 0, width*height)
+	for y := minPos.Y; y < minPos.Y+height; y++ {
+		for x := minPos.X; x < minPos.X+width; x++ {
+			cells = append(cells, grid.Pos{X: x, Y: y})
+		}
+	}
+	return cells
+}
+
+func (p *nodePlacer) occupy(id NodeId, pos grid.Pos) {
+	for _, cell := range p.cells(id, pos) {
+		p.occupied[cell] = id
+	}
+}
+
+func (p *nodePlacer) vacate(id NodeId, pos grid.Pos) {
+	for _, cell := range p.cells(id, pos) {
+		if p.occupied[cell] == id {
+			delete(p.occupied, cell)
+		}
+	}
+}
+
+// Checks whether the node can be placed at pos, ignoring any of
+// the nodes in ignore. Nodes must have a free cell between them.
+func (p *nodePlacer) canPlace(id NodeId, pos grid.Pos, ignore ...NodeId) bool {
+	for _, cell := range p.cells(id, pos) {
+		for y := cell.Y - 1; y <= cell.Y+1; y++ {
+			for x := cell.X - 1; x <= cell.X+1; x++ {
+				other, ok := p.occupied[grid.Pos{X: x, Y: y}]
+				if !ok || other == id {
+					continue
+				}
+				ignored := false
+				for _, ig := range ignore {
+					if other == ig {
+						ignored = true
+					}
+				}
+				if !ignored {
+					return false
+				}
+			}
+		}
+	}
+	return true
+}
+
+// Returns a random position in the area aligned to the spacing
+func (p *nodePlacer) randomPos() grid.Pos {
+	cols := int((p.areaMax.X-p.areaMin.X)/p.spacing) + 1
+	rows := int((p.areaMax.Y-p.areaMin.Y)/p.spacing) + 1
+	return grid.Pos{
+		X: p.areaMin.X + int16(p.rand.Intn(cols))*p.spacing,
+		Y: p.areaMin.Y + int16(p.rand.Intn(rows))*p.spacing,
+	}
+}
+
+// Gives each movable node a random free position
+func (p *nodePlacer) initialPlacement() error {
+	cols := int((p.areaMax.X-p.areaMin.X)/p.spacing) + 1
+	rows := int((p.areaMax.Y-p.areaMin.Y)/p.spacing) + 1
+
+	for _, id := range p.movable {
+		placed := false
+		for attempt := 0; attempt < cols*rows*4 && !placed; attempt++ {
+			pos := p.randomPos()
+			if p.canPlace(id, pos) {
+				p.pos[id] = pos
+				p.occupy(id, pos)
+				placed = true
+			}
+		}
+		if !placed {
+			return errors.New("Not enough room to place all the nodes")
+		}
+	}
+
+	return nil
+}
+
+// Returns the cost of the given links, their length plus the number
+// of other links each one crosses. Crossings between two of the
+// given links are only counted once.
+func (p *nodePlacer) cost(links []int) float32 {
+	inSet := map[int]bool{}
+	for _, l := range links {
+		inSet[l] = true
+	}
+
+	var length float32
+	crossings := 0
+	for _, l := range links {
+		a, b := p.pos[p.links[l].from], p.pos[p.links[l].to]
+		length += a.EuclideanDistance(b)
+
+		for other := range p.links {
+			if other == l || (inSet[other] && other < l) {
+				continue
+			}
+			if p.linksCross(l, other) {
+				crossings += 1
+			}
+		}
+	}
+
+	return length*p.config.LengthWeight + float32(crossings)*p.config.CrossingWeight
+}
+
+func (p *nodePlacer) linksCross(l1, l2 int) bool {
+	a, b := p.links[l1], p.links[l2]
+	// Links sharing a node meet at the node, they don't cross
+	if a.from == b.from || a.from == b.to || a.to == b.from || a.to == b.to {
+		return false
+	}
+	return segmentsCross(p.pos[a.from], p.pos[a.to], p.pos[b.from], p.pos[b.to])
+}
+
+// Checks if the segments a-b and c-d intersect
+func segmentsCross(a, b, c, d grid.Pos) bool {
+	orient := func(p, q, r grid.Pos) int {
+		v := (int32(q.X)-int32(p.X))*(int32(r.Y)-int32(p.Y)) -
+			(int32(q.Y)-int32(p.Y))*(int32(r.X)-int32(p.X))
+		switch {
+		case v > 0:
+			return 1
+		case v < 0:
+			return -1
+		}
+		return 0
+	}
+	onSegment := func(p, q, r grid.Pos) bool {
+		return min(p.X, q.X) <= r.X && r.X <= max(p.X, q.X) &&
+			min(p.Y, q.Y) <= r.Y && r.Y <= max(p.Y, q.Y)
+	}
+
+	o1, o2 := orient(a, b, c), orient(a, b, d)
+	o3, o4 := orient(c, d, a), orient(c, d, b)
+
+	if o1 != o2 && o3 != o4 {
+		return true
+	}
+
+	return (o1 == 0 && onSegment(a, b, c)) ||
+		(o2 == 0 && onSegment(a, b, d)) ||
+		(o3 == 0 && onSegment(c, d, a)) ||
+		(o4 == 0 && onSegment(c, d, b))
+}
+
+// Returns the links connected to any of the nodes, without duplicates
+func (p *nodePlacer) affectedLinks(ids ...NodeId) []int {
+	links := []int{}
+	seen := map[int]bool{}
+	for _, id := range ids {
+		for _, l := range p.nodeLinks[id] {
+			if !seen[l] {
+				seen[l] = true
+				links = append(links, l)
+			}
+		}
+	}
+	return links
+}
+
+func (p *nodePlacer) anneal() {
+	iterations := p.config.Iterations
+	if iterations <= 0 || len(p.links) == 0 {
+		return
+	}
+
+	// Start hot enough to accept moves that make a link a few
+	// cells longer, and cool down to only accepting improvements
+	startTemp := float32(p.spacing) * 4 * f32.Max(p.config.LengthWeight, 0.1)
+	endTemp := startTemp / 1000
+	cooling := math.Pow(float64(endTemp/startTemp), 1/float64(iterations))
+
+	temp := float64(startTemp)
+	for i := 0; i < iterations; i++ {
+		temp *= cooling
+
+		id := p.movable[p.rand.Intn(len(p.movable))]
+		oldPos := p.pos[id]
+		newPos := p.randomPos()
+		if newPos == oldPos {
+			continue
+		}
+
+		// Moving onto another movable node swaps the two
+		other, ok := p.occupied[newPos]
+		swap := ok && other != id && !p.isFixed[other] && p.pos[other] == newPos
+
+		if swap {
+			p.vacate(id, oldPos)
+			p.vacate(other, newPos)
+			if !p.canPlace(id, newPos, other) || !p.canPlace(other, oldPos, id) {
+				p.occupy(id, oldPos)
+				p.occupy(other, newPos)
+				continue
+			}
+			p.occupy(id, oldPos)
+			p.occupy(other, newPos)
+		} else if !p.canPlace(id, newPos) {
+			continue
+		}
+
+		var links []int
+		if swap {
+			links = p.affectedLinks(id, other)
+		} else {
+			links = p.affectedLinks(id)
+		}
+
+		before := p.cost(links)
+		p.move(id, oldPos, newPos, other, swap)
+		after := p.cost(links)
+
+		delta := float64(after - before)
+		if delta <= 0 || p.rand.Float64() < math.Exp(-delta/temp) {
+			continue
+		}
+
+		// Rejected, undo the move
+		p.move(id, newPos, oldPos, other, swap)
+	}
+}
+
+// Moves the node from oldPos to newPos, if swap is set then the
+// other node is moved from newPos to oldPos
+func (p *nodePlacer) move(id NodeId, oldPos, newPos grid.Pos, other NodeId, swap bool) {
+	p.vacate(id, oldPos)
+	if swap {
+		p.vacate(other, newPos)
+		p.pos[other] = oldPos
+		p.occupy(other, oldPos)
+	}
+	p.pos[id] = newPos
+	p.occupy(id, newPos)
+}
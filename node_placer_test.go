@@ -0,0 +1,76 @@
+package raumata_test
+
+import (
+	"testing"
+
+	. "github.com/REANNZ/raumata"
+)
+
+func placementTopology() *Topology {
+	return &Topology{
+		Nodes: map[NodeId]*Node{
+			"A": {Id: "A", Pos: &[2]int16{0, 0}},
+			"B": {Id: "B"},
+			"C": {Id: "C"},
+			"D": {Id: "D"},
+			"E": {Id: "E"},
+		},
+		Links: map[LinkId]*Link{
+			"A-B": {Id: "A-B", From: "A", To: "B"},
+			"B-C": {Id: "B-C", From: "B", To: "C"},
+			"C-D": {Id: "C-D", From: "C", To: "D"},
+			"D-A": {Id: "D-A", From: "D", To: "A"},
+			"E-B": {Id: "E-B", From: "E", To: "B"},
+		},
+	}
+}
+
+func TestPlaceNodes(t *testing.T) {
+	topo := placementTopology()
+
+	if err := PlaceNodes(topo, nil); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if *topo.Nodes["A"].Pos != [2]int16{0, 0} {
+		t.Errorf("Fixed node moved to %v", *topo.Nodes["A"].Pos)
+	}
+
+	seen := map[[2]int16]NodeId{}
+	for id, node := range topo.Nodes {
+		if node.Pos == nil {
+			t.Errorf("Node %s wasn't placed", id)
+			continue
+		}
+		if other, ok := seen[*node.Pos]; ok {
+			t.Errorf("Nodes %s and %s placed at the same position", id, other)
+		}
+		seen[*node.Pos] = id
+
+		if node.Pos[0]%2 != 0 || node.Pos[1]%2 != 0 {
+			t.Errorf("Node %s not aligned to spacing: %v", id, *node.Pos)
+		}
+	}
+
+	// The same seed must give the same positions
+	again := placementTopology()
+	PlaceNodes(again, nil)
+	for id, node := range topo.Nodes {
+		if *node.Pos != *again.Nodes[id].Pos {
+			t.Errorf("Node %s placed differently with the same seed: %v != %v",
+				id, *node.Pos, *again.Nodes[id].Pos)
+		}
+	}
+}
+
+func TestPlaceNodesNoRoom(t *testing.T) {
+	topo := placementTopology()
+
+	config := DefaultPlacementConfig()
+	config.Width = 1
+	config.Height = 1
+
+	if err := PlaceNodes(topo, config); err == nil {
+		t.Errorf("Expected an error placing nodes in a tiny area")
+	}
+}
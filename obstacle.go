@@ -0,0 +1,163 @@
+package raumata
+
+import (
+	"github.com/REANNZ/raumata/grid"
+)
+
+// Obstacle is an area of the grid that links are never routed
+// through and that node labels avoid, for example where external
+// artwork is overlaid on the map.
+//
+// The area is either a rectangle or a polygon, if both are set
+// then the obstacle covers both areas.
+type Obstacle struct {
+	Id string `json:"id,omitempty"`
+	// Two opposite corners of a rectangle, the cells at the
+	// corners are included
+	Rect *[2][2]int16 `json:"rect,omitempty"`
+	// The vertices of a polygon, cells inside or on the
+	// edge of the polygon are included
+	Polygon [][2]int16 `json:"polygon,omitempty"`
+}
+
+// Reserve adds an obstacle covering the rectangle with corners a
+// and b, for an area that a decoration such as a legend or title
+// block will be drawn over. Links are routed around the area and
+// node labels avoid it. Returns the new obstacle.
+//
+// The area must be reserved before the [LinkRouter] is created and
+// before [PlaceLabels] is called.
+func (t *Topology) Reserve(id string, a, b grid.Pos) *Obstacle {
+	obstacle := &Obstacle{
+		Id:   id,
+		Rect: &[2][2]int16{{a.X, a.Y}, {b.X, b.Y}},
+	}
+	t.Obstacles = append(t.Obstacles, obstacle)
+	return obstacle
+}
+
+// Cells returns all the grid cells covered by the obstacle. A large
+// obstacle has a great many cells, use [Obstacle.CellsWithin] or
+// [Obstacle.Contains] to only look at the part that matters.
+func (o *Obstacle) Cells() []grid.Pos {
+	min, max, ok := o.bounds()
+	if !ok {
+		return nil
+	}
+	return o.CellsWithin(min, max)
+}
+
+// CellsWithin returns the grid cells covered by the obstacle in the
+// rectangle from min to max, including the cells at the corners
+func (o *Obstacle) CellsWithin(min, max grid.Pos) []grid.Pos {
+	oMin, oMax, ok := o.bounds()
+	if !ok {
+		return nil
+	}
+	min, max = min.Max(oMin), max.Min(oMax)
+
+	cells := []grid.Pos{}
+	for y := int(min.Y); y <= int(max.Y); y++ {
+		for x := int(min.X); x <= int(max.X); x++ {
+			p := grid.Pos{X: int16(x), Y: int16(y)}
+			if o.Contains(p) {
+				cells = append(cells, p)
+			}
+		}
+	}
+	return cells
+}
+
+// Contains returns whether the obstacle covers the cell
+func (o *Obstacle) Contains(p grid.Pos) bool {
+	if o == nil {
+		return false
+	}
+	if o.Rect != nil && o.inRect(p) {
+		return true
+	}
+	if len(o.Polygon) > 0 {
+		min, max := o.polygonBounds()
+		if p.X >= min.X && p.X <= max.X && p.Y >= min.Y && p.Y <= max.Y {
+			return o.inPolygon(p)
+		}
+	}
+	return false
+}
+
+// Returns the corners of the smallest rectangle covering the
+// obstacle, or false if it covers nothing
+func (o *Obstacle) bounds() (min, max grid.Pos, ok bool) {
+	if o == nil {
+		return min, max, false
+	}
+	if o.Rect != nil {
+		a := grid.Pos{X: o.Rect[0][0], Y: o.Rect[0][1]}
+		b := grid.Pos{X: o.Rect[1][0], Y: o.Rect[1][1]}
+		min, max, ok = a.Min(b), a.Max(b), true
+	}
+	if len(o.Polygon) > 0 {
+		pMin, pMax := o.polygonBounds()
+		if ok {
+			pMin, pMax = pMin.Min(min), pMax.Max(max)
+		}
+		min, max, ok = pMin, pMax, true
+	}
+	return min, max, ok
+}
+
+func (o *Obstacle) polygonBounds() (min, max grid.Pos) {
+	min = grid.Pos{X: o.Polygon[0][0], Y: o.Polygon[0][1]}
+	max = min
+	for _, v := range o.Polygon {
+		p := grid.Pos{X: v[0], Y: v[1]}
+		min = min.Min(p)
+		max = max.Max(p)
+	}
+	return min, max
+}
+
+func (o *Obstacle) inRect(p grid.Pos) bool {
+	a := grid.Pos{X: o.Rect[0][0], Y: o.Rect[0][1]}
+	b := grid.Pos{X: o.Rect[1][0], Y: o.Rect[1][1]}
+	min, max := a.Min(b), a.Max(b)
+
+	return p.X >= min.X && p.X <= max.X && p.Y >= min.Y && p.Y <= max.Y
+}
+
+// Checks if p is inside the polygon using the even-odd rule,
+// points on the edges count as inside
+func (o *Obstacle) inPolygon(p grid.Pos) bool {
+	inside := false
+	px, py := int32(p.X), int32(p.Y)
+
+	n := len(o.Polygon)
+	for i := 0; i < n; i++ {
+		ax, ay := int32(o.Polygon[i][0]), int32(o.Polygon[i][1])
+		bx, by := int32(o.Polygon[(i+1)%n][0]), int32(o.Polygon[(i+1)%n][1])
+
+		// On the edge a-b
+		cross := (bx-ax)*(py-ay) - (by-ay)*(px-ax)
+		if cross == 0 &&
+			min(ax, bx) <= px && px <= max(ax, bx) &&
+			min(ay, by) <= py && py <= max(ay, by) {
+			return true
+		}
+
+		// Count crossings of a ray heading in the +X direction
+		if (ay > py) != (by > py) {
+			// The x position where the edge crosses y = py,
+			// compared without dividing
+			lhs := (px - ax) * (by - ay)
+			rhs := (bx - ax) * (py - ay)
+			if by-ay < 0 {
+				lhs, rhs = -lhs, -rhs
+			}
+			if lhs < rhs {
+				inside = !inside
+			}
+		}
+	}
+
+	return inside
+}
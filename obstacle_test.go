@@ -0,0 +1,123 @@
+package raumata_test
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+
+	. "github.com/REANNZ/raumata"
+	"github.com/REANNZ/raumata/canvas"
+	"github.com/REANNZ/raumata/grid"
+	"github.com/REANNZ/raumata/vec"
+)
+
+func TestObstacleCells(t *testing.T) {
+	rect := Obstacle{Rect: &[2][2]int16{{2, 1}, {0, 0}}}
+	if cells := rect.Cells(); len(cells) != 6 {
+		t.Errorf("Expected 6 cells in rect, got %d: %v", len(cells), cells)
+	}
+
+	// A right-angled triangle, the hypotenuse runs from (0, 2)
+	// to (2, 0), so (1, 1) is on the edge and (2, 2) is outside
+	triangle := Obstacle{Polygon: [][2]int16{{0, 0}, {2, 0}, {0, 2}}}
+	cells := triangle.Cells()
+	for _, p := range []grid.Pos{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 0, Y: 1}, {X: 1, Y: 1}, {X: 2, Y: 0}} {
+		if !slices.Contains(cells, p) {
+			t.Errorf("Expected triangle to contain %v", p)
+		}
+	}
+	for _, p := range []grid.Pos{{X: 2, Y: 1}, {X: 2, Y: 2}, {X: 1, Y: 2}} {
+		if slices.Contains(cells, p) {
+			t.Errorf("Expected triangle not to contain %v", p)
+		}
+	}
+}
+
+func TestUnmarshalObstacles(t *testing.T) {
+	jsonBlob := `{
+  "nodes": {"a": {"pos": [0, 0]}},
+  "links": {},
+  "obstacles": [
+    {"id": "logo", "rect": [[2, 2], [4, 4]]},
+    {"polygon": [[0, 5], [3, 5], [0, 8]]}
+  ]
+}`
+
+	topo := Topology{}
+	if err := json.Unmarshal([]byte(jsonBlob), &topo); err != nil {
+		t.Fatalf("Error unmarshalling into Topology: %s", err)
+	}
+
+	if len(topo.Obstacles) != 2 || topo.Obstacles[0].Id != "logo" {
+		t.Errorf("Obstacles not parsed correctly: %+v", topo.Obstacles)
+	}
+}
+
+func TestTopologyReserve(t *testing.T) {
+	topo := &Topology{
+		Nodes: map[NodeId]*Node{
+			"A": {Id: "A", Pos: &[2]int16{0, 2}},
+			"B": {Id: "B", Pos: &[2]int16{6, 2}},
+		},
+		Links: map[LinkId]*Link{
+			"A-B": {Id: "A-B", From: "A", To: "B"},
+		},
+	}
+
+	// A legend 60x60 at (100, 20) on the canvas, with a scale of
+	// 50 it covers cells (2, 0) to (3, 2)
+	renderer := NewRenderer()
+	renderer.SetScale(50)
+	legend := canvas.NewAABB(vec.Vec2{X: 100, Y: 20}, vec.Vec2{X: 160, Y: 80})
+	obstacle := renderer.ReserveArea(topo, "legend", legend)
+	if *obstacle.Rect != [2][2]int16{{2, 0}, {3, 2}} {
+		t.Errorf("Expected the reserved area to be (2, 0)-(3, 2), got %v", *obstacle.Rect)
+	}
+	if len(topo.Obstacles) != 1 || topo.Obstacles[0] != obstacle {
+		t.Fatalf("Expected the area to be added to the obstacles")
+	}
+
+	NewLinkRouter(topo).RouteLinks()
+	route := topo.Links["A-B"].Route
+	if len(route) == 0 {
+		t.Fatalf("Expected A-B to be routed")
+	}
+	for _, p := range route {
+		if slices.Contains(obstacle.Cells(), grid.FromVec(p)) {
+			t.Errorf("Expected the route to avoid the reserved area, got %v", route)
+			break
+		}
+	}
+}
+
+func TestObstacleLarge(t *testing.T) {
+	// Far too many cells to list, only the part near the nodes is
+	// looked at
+	huge := &Obstacle{Rect: &[2][2]int16{{-32000, 2}, {32000, 32000}}}
+	if !huge.Contains(grid.Pos{X: 1000, Y: 1000}) || huge.Contains(grid.Pos{X: 0, Y: 1}) {
+		t.Errorf("Expected the obstacle to cover the cells below y = 2")
+	}
+	if cells := huge.CellsWithin(grid.Pos{X: 0, Y: 0}, grid.Pos{X: 3, Y: 3}); len(cells) != 8 {
+		t.Errorf("Expected 8 cells within the rectangle, got %v", cells)
+	}
+
+	topo := &Topology{
+		Nodes: map[NodeId]*Node{
+			"A": {Id: "A", Pos: &[2]int16{0, 0}},
+			"B": {Id: "B", Pos: &[2]int16{4, 0}},
+		},
+		Links: map[LinkId]*Link{
+			"A-B": {Id: "A-B", From: "A", To: "B"},
+		},
+		Obstacles: []*Obstacle{huge},
+	}
+	PlaceLabels(topo)
+	router := NewLinkRouter(topo)
+	router.RouteLinks()
+	if len(topo.Links["A-B"].Route) < 2 {
+		t.Fatalf("Expected A-B to be routed")
+	}
+	if cell := router.Occupancy()[grid.Pos{X: 2, Y: 2}]; !cell.Obstacle {
+		t.Errorf("Expected the obstacle next to the nodes, got %+v", cell)
+	}
+}
@@ -0,0 +1,137 @@
+package raumata
+
+import (
+	"github.com/REANNZ/raumata/canvas"
+	"github.com/REANNZ/raumata/internal/f32"
+	"github.com/REANNZ/raumata/vec"
+)
+
+// Orientation turns and flips the whole rendered map, for example so
+// a tall network fits a wide dashboard panel. Labels are kept upright.
+type Orientation struct {
+	// Quarter turns clockwise
+	Turns int `json:"turns,omitempty"`
+	// Mirror the map left to right, before turning it
+	Flip bool `json:"flip,omitempty"`
+}
+
+// Returns the transform turning and flipping the map around the
+// origin, or nil if the orientation doesn't change the map
+func (o Orientation) transform() *vec.Transform {
+	turns := ((o.Turns % 4) + 4) % 4
+	if turns == 0 && !o.Flip {
+		return nil
+	}
+
+	t := vec.NewIdentityTransform()
+	if o.Flip {
+		t = vec.NewScale(vec.Vec2{X: -1, Y: 1})
+	}
+	// Y-values increase going south, so this turns east to south
+	quarter := vec.NewTransform(0, 1, -1, 0, 0, 0)
+	for range turns {
+		t = t.Combine(quarter)
+	}
+	return t
+}
+
+// Returns the orientation of the map, which is the configured
+// orientation, turned a further quarter turn if that better fits
+// FitAspect
+func (r *Renderer) mapOrientation(topo *Topology) Orientation {
+	var o Orientation
+	if r.Config.Orientation != nil {
+		o = *r.Config.Orientation
+	}
+	if r.Config.FitAspect <= 0 {
+		return o
+	}
+
+	var bounds *canvas.AABB
+	for _, n := range topo.Nodes {
+		if n != nil && n.Pos != nil {
+			bounds = bounds.Union(canvas.NewAABB(n.GetExtents()))
+		}
+	}
+	for _, l := range topo.Links {
+		if l != nil {
+			for _, p := range l.Route {
+				bounds = bounds.Union(canvas.NewAABB(p, p))
+			}
+		}
+	}
+	if bounds == nil {
+		return o
+	}
+
+	size := bounds.Size()
+	if o.Turns%2 != 0 {
+		size = vec.Vec2{X: size.Y, Y: size.X}
+	}
+
+	// How many times too wide or too tall the map is, so a map
+	// twice as wide as the target is as bad as one twice as tall
+	misfit := func(aspect float32) float32 {
+		return f32.Max(aspect/r.Config.FitAspect, r.Config.FitAspect/aspect)
+	}
+	if misfit(size.Y/size.X) < misfit(size.X/size.Y) {
+		o.Turns++
+	}
+	return o
+}
+
+// MapTransform returns the turns and flips applied to the last
+// topology rendered, see [RenderConfig.Orientation], or nil if the
+// map wasn't turned or flipped. Overlays drawn over the map from
+// grid positions, such as [Renderer.RenderDensity], need the same
+// transform.
+func (r *Renderer) MapTransform() *vec.Transform {
+	return r.orientation
+}
+
+// Returns the direction d points on the oriented map
+func (r *Renderer) screenDirection(d Direction) Direction {
+	if r.orientation == nil || d == DirectionNone || d == DirectionCenter {
+		return d
+	}
+	v := r.orientation.Apply(d.AsVec())
+	return directionFromStep(int16(f32.Round(v.X)), int16(f32.Round(v.Y)))
+}
+
+// Returns the vector on the unoriented map that points along v on
+// the oriented map
+func (r *Renderer) mapVec(v vec.Vec2) vec.Vec2 {
+	if r.orientation == nil {
+		return v
+	}
+	return r.unorient().Apply(v)
+}
+
+// Returns the vector on the oriented map that points along v on the
+// unoriented map
+func (r *Renderer) screenVec(v vec.Vec2) vec.Vec2 {
+	if r.orientation == nil {
+		return v
+	}
+	return r.orientation.Apply(v)
+}
+
+// Returns the transform undoing the turns and flips of the map. They
+// only rotate and mirror, so the inverse is the transpose.
+func (r *Renderer) unorient() *vec.Transform {
+	t := r.orientation
+	return vec.NewTransform(t.A, t.C, t.B, t.D, 0, 0)
+}
+
+// Returns obj, wrapped in a group that undoes the turns and flips of
+// the map around pos if it is oriented, so text at pos reads the
+// right way up
+func (r *Renderer) keepUpright(obj canvas.Object, pos vec.Vec2) canvas.Object {
+	if r.orientation == nil || obj == nil {
+		return obj
+	}
+	group := canvas.NewGroup()
+	group.Transform = vec.NewTranslate(pos.Neg()).Combine(r.unorient()).Combine(vec.NewTranslate(pos))
+	group.AppendChild(obj)
+	return group
+}
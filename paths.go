@@ -0,0 +1,182 @@
+package raumata
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/REANNZ/raumata/canvas"
+	"github.com/REANNZ/raumata/vec"
+)
+
+// Path is a sequence of nodes through the topology, such as the hops
+// of a traceroute or an LSP, drawn over the map by
+// [Renderer.RenderPaths]
+type Path struct {
+	Id    string   `json:"id,omitempty"`
+	Nodes []NodeId `json:"nodes"`
+	// The color of the path, picked from [PathColors] if not set
+	Color canvas.StyleColor `json:"color,omitempty"`
+}
+
+// PathColors are the colors given to paths without their own color,
+// in turn
+var PathColors = []canvas.Color{
+	canvas.RGB(0.122, 0.467, 0.706),
+	canvas.RGB(1.000, 0.498, 0.055),
+	canvas.RGB(0.173, 0.627, 0.173),
+	canvas.RGB(0.839, 0.153, 0.157),
+	canvas.RGB(0.580, 0.404, 0.741),
+	canvas.RGB(0.549, 0.337, 0.294),
+	canvas.RGB(0.890, 0.467, 0.761),
+	canvas.RGB(0.090, 0.745, 0.812),
+}
+
+// A step of a path from one node to the next
+type pathHop struct {
+	from, to NodeId
+	// The link the hop follows, or nil if the nodes aren't linked
+	link *Link
+}
+
+// RenderPaths renders the paths as lines over the map, each in its own
+// color. Each hop follows the link between its nodes, and paths
+// sharing a link are drawn side by side along it. Hops between nodes
+// without a link are drawn as straight dashed lines.
+//
+// The paths follow the links as drawn by the last call to
+// RenderTopology, so render the topology first. Like the other
+// overlays, the paths aren't turned with the map, see
+// [Renderer.MapTransform].
+func (r *Renderer) RenderPaths(topo *Topology, paths []*Path) (canvas.Object, error) {
+	group := canvas.NewGroup()
+	group.Attributes.Id = "paths"
+
+	// Find the link for each hop, and the paths using each link
+	hops := make([][]pathHop, len(paths))
+	linkPaths := map[LinkId][]int{}
+	for i, path := range paths {
+		if path == nil {
+			continue
+		}
+		for j, id := range path.Nodes {
+			node := topo.GetNode(id)
+			if node == nil || node.Pos == nil {
+				return nil, fmt.Errorf("Path %s has node %s, which isn't on the map", path.Id, id)
+			}
+			if j == 0 {
+				continue
+			}
+			hop := pathHop{from: path.Nodes[j-1], to: id, link: hopLink(topo, path.Nodes[j-1], id)}
+			if hop.link != nil && !slices.Contains(linkPaths[hop.link.Id], i) {
+				linkPaths[hop.link.Id] = append(linkPaths[hop.link.Id], i)
+			}
+			hops[i] = append(hops[i], hop)
+		}
+	}
+
+	width := r.Config.DefaultLinkStyle.Size / 3
+	spacing := width * 1.5
+	scale := r.GetScale()
+
+	colors := 0
+	for i, path := range paths {
+		if path == nil || len(hops[i]) == 0 {
+			continue
+		}
+
+		color := path.Color
+		if color.IsZero() {
+			color = canvas.NewStyleColor(PathColors[colors%len(PathColors)])
+			colors++
+		}
+
+		pathGroup := canvas.NewGroup()
+		if path.Id != "" {
+			pathGroup.Attributes.Id = r.svgName("P-" + path.Id)
+		}
+		pathGroup.Attributes.AddClass("path")
+		pathGroup.Attributes.EnsureStyle()
+		pathGroup.Attributes.Style.StrokeColor = color
+		pathGroup.Attributes.Style.StrokeWidth.Set(width)
+		pathGroup.Attributes.Style.FillColor.SetNone()
+
+		for _, hop := range hops[i] {
+			var route vec.Polyline
+			if hop.link != nil {
+				// Paths sharing the link are spread out across it,
+				// in the same order whichever way they go along it
+				sharing := linkPaths[hop.link.Id]
+				index := slices.Index(sharing, i)
+				offset := (float32(index) - float32(len(sharing)-1)/2) * spacing
+
+				if len(hop.link.Route) >= 2 {
+					route = r.drawnRoute(hop.link)
+				} else {
+					route = vec.Polyline{r.nodeCenter(topo, hop.link.From), r.nodeCenter(topo, hop.link.To)}
+				}
+				if offset != 0 {
+					route = route.Offset(offset / scale)
+				}
+				if hop.link.From != hop.from {
+					route = route.Reverse()
+				}
+			} else {
+				route = vec.Polyline{r.nodeCenter(topo, hop.from), r.nodeCenter(topo, hop.to)}
+			}
+
+			line := canvas.NewPath()
+			for _, p := range route.Mul(scale) {
+				line.LineTo(p)
+			}
+			line.Attributes.AddClass("path-hop")
+			line.Attributes.SetExtra("data-from", string(hop.from))
+			line.Attributes.SetExtra("data-to", string(hop.to))
+			if hop.link == nil {
+				line.Attributes.AddClass("path-gap")
+				line.Attributes.EnsureStyle()
+				line.Attributes.Style.StrokeDashArray = []float32{width * 2, width}
+			}
+			pathGroup.AppendChild(line)
+		}
+
+		group.AppendChild(pathGroup)
+	}
+
+	return group, nil
+}
+
+// Returns the link between the two nodes, either way, preferring
+// routed links, then the lowest id
+func hopLink(topo *Topology, a, b NodeId) *Link {
+	var found *Link
+	for _, link := range topo.Links {
+		if link == nil {
+			continue
+		}
+		if !(link.From == a && link.To == b) && !(link.From == b && link.To == a) {
+			continue
+		}
+		if found == nil {
+			found = link
+			continue
+		}
+		routed, foundRouted := len(link.Route) >= 2, len(found.Route) >= 2
+		if routed != foundRouted {
+			if routed {
+				found = link
+			}
+		} else if link.Id < found.Id {
+			found = link
+		}
+	}
+	return found
+}
+
+// Returns the center of the node in grid units
+func (r *Renderer) nodeCenter(topo *Topology, id NodeId) vec.Vec2 {
+	if center, ok := r.nodeCenters[id]; ok {
+		return center
+	}
+	minPos, maxPos := topo.GetNode(id).GetExtents()
+	return minPos.Add(maxPos).Div(2)
+}
@@ -0,0 +1,181 @@
+package raumata
+
+import (
+	"maps"
+	"slices"
+
+	"github.com/REANNZ/raumata/canvas"
+)
+
+// Clone returns a deep copy of the config, so variants can be
+// derived from a base config without modifying it:
+//
+//	thumbnail := base.Clone().ScaleSizes(0.5)
+func (c *RenderConfig) Clone() *RenderConfig {
+	clone := *c
+
+	clone.DefaultNodeStyle.Style = cloneStyle(c.DefaultNodeStyle.Style)
+	clone.DefaultLinkStyle.Style = cloneStyle(c.DefaultLinkStyle.Style)
+
+	if c.NodeStyles != nil {
+		clone.NodeStyles = maps.Clone(c.NodeStyles)
+		for class, style := range clone.NodeStyles {
+			style.Style = cloneStyle(style.Style)
+			clone.NodeStyles[class] = style
+		}
+	}
+	if c.LinkStyles != nil {
+		clone.LinkStyles = maps.Clone(c.LinkStyles)
+		for class, style := range clone.LinkStyles {
+			style.Style = cloneStyle(style.Style)
+			clone.LinkStyles[class] = style
+		}
+	}
+
+	clone.NodeLabelStyles = maps.Clone(c.NodeLabelStyles)
+	clone.LinkLabelStyles = maps.Clone(c.LinkLabelStyles)
+
+	if c.LinkColorScale != nil {
+		clone.LinkColorScale = c.LinkColorScale.Clone()
+	}
+	clone.NodeTooltip = slices.Clone(c.NodeTooltip)
+	clone.NodeNames = maps.Clone(c.NodeNames)
+	if c.Watermark != nil {
+		wm := *c.Watermark
+		clone.Watermark = &wm
+	}
+	clone.Views = slices.Clone(c.Views)
+	if c.Orientation != nil {
+		o := *c.Orientation
+		clone.Orientation = &o
+	}
+	if c.NodeWeightSizes != nil {
+		sizes := *c.NodeWeightSizes
+		clone.NodeWeightSizes = &sizes
+	}
+	clone.Icons = maps.Clone(c.Icons)
+	if c.LinkStateStyles != nil {
+		clone.LinkStateStyles = maps.Clone(c.LinkStateStyles)
+		for state, style := range clone.LinkStateStyles {
+			clone.LinkStateStyles[state] = cloneStyle(style)
+		}
+	}
+
+	return &clone
+}
+
+func cloneStyle(s *canvas.Style) *canvas.Style {
+	if s == nil {
+		return nil
+	}
+	clone := *s
+	clone.StrokeDashArray = slices.Clone(s.StrokeDashArray)
+	return &clone
+}
+
+// ScaleSizes multiplies all the sizes in the config by factor,
+// including node and link sizes, stroke widths, label sizes and
+// spacing. Returns the config.
+func (c *RenderConfig) ScaleSizes(factor float32) *RenderConfig {
+	c.MinNodeSep *= factor
+	c.BundleSpacing *= factor
+
+	// Styles are copied before scaling, in case the same style
+	// is shared by multiple classes
+	c.DefaultNodeStyle.Style = cloneStyle(c.DefaultNodeStyle.Style)
+	c.DefaultNodeStyle.scale(factor)
+	for class, style := range c.NodeStyles {
+		style.Style = cloneStyle(style.Style)
+		style.scale(factor)
+		c.NodeStyles[class] = style
+	}
+
+	c.DefaultLinkStyle.Style = cloneStyle(c.DefaultLinkStyle.Style)
+	c.DefaultLinkStyle.scale(factor)
+	for class, style := range c.LinkStyles {
+		style.Style = cloneStyle(style.Style)
+		style.scale(factor)
+		c.LinkStyles[class] = style
+	}
+
+	c.NodeLabelStyle.scale(factor)
+	for class, style := range c.NodeLabelStyles {
+		style.scale(factor)
+		c.NodeLabelStyles[class] = style
+	}
+	c.LinkLabelStyle.scale(factor)
+	for class, style := range c.LinkLabelStyles {
+		style.scale(factor)
+		c.LinkLabelStyles[class] = style
+	}
+	c.LinkEndLabelStyle.scale(factor)
+
+	if c.Watermark != nil {
+		c.Watermark.Size *= factor
+	}
+	if c.NodeWeightSizes != nil {
+		sizes := *c.NodeWeightSizes
+		sizes.MinSize *= factor
+		sizes.MaxSize *= factor
+		sizes.MinLabelSize *= factor
+		sizes.MaxLabelSize *= factor
+		c.NodeWeightSizes = &sizes
+	}
+	for state, style := range c.LinkStateStyles {
+		style = cloneStyle(style)
+		scaleStyle(style, factor)
+		c.LinkStateStyles[state] = style
+	}
+	for name, icon := range c.Icons {
+		icon.Width *= factor
+		icon.Height *= factor
+		c.Icons[name] = icon
+	}
+
+	return c
+}
+
+// WithFont sets the font family used for node and link labels.
+// Returns the config.
+func (c *RenderConfig) WithFont(family string) *RenderConfig {
+	c.NodeLabelStyle.FontFamily = family
+	c.LinkLabelStyle.FontFamily = family
+	c.LinkEndLabelStyle.FontFamily = family
+	return c
+}
+
+// SetPalette sets the color scale used to color links by their
+// value. Returns the config.
+func (c *RenderConfig) SetPalette(scale *canvas.ColorScale) *RenderConfig {
+	c.LinkColorScale = scale
+	return c
+}
+
+func scaleStyle(s *canvas.Style, factor float32) {
+	if s == nil {
+		return
+	}
+	s.StrokeWidth.Value *= factor
+	for i := range s.StrokeDashArray {
+		s.StrokeDashArray[i] *= factor
+	}
+}
+
+func (s *NodeStyle) scale(factor float32) {
+	s.Size *= factor
+	scaleStyle(s.Style, factor)
+}
+
+func (s *LinkStyle) scale(factor float32) {
+	s.Size *= factor
+	s.Radius.Value *= factor
+	s.SplitTolerance.Value *= factor
+	s.ArrowMinRun.Value *= factor
+	scaleStyle(s.Style, factor)
+}
+
+func (s *LabelStyle) scale(factor float32) {
+	s.Size *= factor
+	s.BorderRadius *= factor
+	s.Width *= factor
+}
@@ -0,0 +1,136 @@
+package raumata_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	. "github.com/REANNZ/raumata"
+	"github.com/REANNZ/raumata/canvas"
+)
+
+func TestRenderConfigClone(t *testing.T) {
+	base := DefaultRenderConfig()
+	base.NodeStyles["core"] = NodeStyle{Size: 30, Style: canvas.NewStyle()}
+
+	clone := base.Clone()
+	clone.DefaultNodeStyle.StrokeWidth.Set(1)
+	clone.NodeStyles["core"].Style.StrokeWidth.Set(2)
+	clone.LinkColorScale.AddColor(0.5, canvas.RGB(0, 0, 1))
+
+	if base.DefaultNodeStyle.StrokeWidth.Value != 4 {
+		t.Errorf("Modifying the clone changed the base node style")
+	}
+	if base.NodeStyles["core"].Style.StrokeWidth.Valid {
+		t.Errorf("Modifying the clone changed the base class style")
+	}
+	if canvas.ColorEqual(base.LinkColorScale.GetColor(0.5), canvas.RGB(0, 0, 1)) {
+		t.Errorf("Modifying the clone changed the base color scale")
+	}
+}
+
+func TestRenderConfigScaleSizes(t *testing.T) {
+	base := DefaultRenderConfig()
+	base.NodeStyles["core"] = NodeStyle{Size: 30, Style: base.DefaultNodeStyle.Style}
+
+	scaled := base.Clone().ScaleSizes(0.5)
+
+	if scaled.DefaultNodeStyle.Size != base.DefaultNodeStyle.Size/2 {
+		t.Errorf("Node size not scaled: %v", scaled.DefaultNodeStyle.Size)
+	}
+	if scaled.DefaultLinkStyle.Radius.Value != base.DefaultLinkStyle.Radius.Value/2 {
+		t.Errorf("Link radius not scaled: %v", scaled.DefaultLinkStyle.Radius.Value)
+	}
+	if scaled.NodeLabelStyle.Size != base.NodeLabelStyle.Size/2 {
+		t.Errorf("Label size not scaled: %v", scaled.NodeLabelStyle.Size)
+	}
+	// The shared style must only be scaled once
+	if w := scaled.NodeStyles["core"].StrokeWidth.Value; w != 2 {
+		t.Errorf("Expected class stroke width 2, got %v", w)
+	}
+	if base.DefaultNodeStyle.Size != 20 {
+		t.Errorf("Scaling the clone changed the base config")
+	}
+
+	themed := base.Clone().WithFont("serif").SetPalette(canvas.NewColorScale())
+	if themed.NodeLabelStyle.FontFamily != "serif" || themed.LinkLabelStyle.FontFamily != "serif" {
+		t.Errorf("Font not set on labels")
+	}
+	if themed.LinkColorScale == base.LinkColorScale {
+		t.Errorf("Palette not set")
+	}
+}
+
+func TestNodeStyleJSON(t *testing.T) {
+	style := NodeStyle{Size: 30, Shape: "hexagon", Icon: "router", Style: canvas.NewStyle()}
+	style.FillColor.SetColor(canvas.RGB(1, 0, 0))
+
+	data, err := json.Marshal(&style)
+	if err != nil {
+		t.Fatalf("Error encoding node style: %s", err)
+	}
+	decoded := NodeStyle{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Error decoding node style: %s", err)
+	}
+	if decoded.Size != 30 || decoded.Shape != "hexagon" || decoded.Icon != "router" {
+		t.Errorf("Node style fields not kept, got %s", data)
+	}
+	if decoded.Style == nil || !canvas.ColorEqual(decoded.FillColor.Color(), canvas.RGB(1, 0, 0)) {
+		t.Errorf("Node style fill not kept, got %s", data)
+	}
+}
+
+func TestLinkRadiusJSON(t *testing.T) {
+	styles := map[string]LinkStyle{}
+	err := json.Unmarshal([]byte(`{"auto": {"radius": "auto"}, "fixed": {"radius": 4}, "default": {}}`), &styles)
+	if err != nil {
+		t.Fatalf("Error decoding link styles: %s", err)
+	}
+	if r := styles["auto"].Radius; !r.Valid || !r.Auto {
+		t.Errorf("Expected an auto radius, got %+v", r)
+	}
+	if r := styles["fixed"].Radius; !r.Valid || r.Auto || r.Value != 4 {
+		t.Errorf("Expected a radius of 4, got %+v", r)
+	}
+	if r := styles["default"].Radius; r.Valid {
+		t.Errorf("Expected no radius, got %+v", r)
+	}
+
+	auto := styles["auto"]
+	data, err := json.Marshal(&auto)
+	if err != nil {
+		t.Fatalf("Error encoding link style: %s", err)
+	}
+	if !strings.Contains(string(data), `"radius":"auto"`) {
+		t.Errorf("Expected the auto radius to be kept, got %s", data)
+	}
+}
+
+func TestStyleJSONErrors(t *testing.T) {
+	for _, data := range []string{
+		`{"link-style": {"curve": "spiral"}}`,
+		`{"link-styles": {"core": {"curve": "Bezier"}}}`,
+		`{"node-style": {"shape": "triangle"}}`,
+		`{"link-style": {"dash": "dash-dot"}}`,
+		`{"link-styles": {"core": {"draw": "line"}}}`,
+		`{"node-styles": {"core": {"shape": "Square"}}}`,
+		`{"link-style": {"split-tolerance": -1}}`,
+		`{"link-styles": {"core": {"arrow-ratio": -0.5}}}`,
+		`{"link-style": {"arrow-min-run": -2}}`,
+	} {
+		var config RenderConfig
+		if err := json.Unmarshal([]byte(data), &config); err == nil {
+			t.Errorf("Expected an error decoding %s", data)
+		}
+	}
+
+	var config RenderConfig
+	data := `{"link-style": {"curve": "bezier", "size": 4}}`
+	if err := json.Unmarshal([]byte(data), &config); err != nil {
+		t.Fatalf("Error decoding %s: %s", data, err)
+	}
+	if style := config.DefaultLinkStyle; style.Curve != "bezier" || style.Size != 4 {
+		t.Errorf("Expected the link style to be decoded, got %+v", style)
+	}
+}
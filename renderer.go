@@ -1,10 +1,15 @@
 package raumata
 
 import (
+	"encoding/json"
+	"fmt"
 	"math"
 	"slices"
+	"strings"
 
 	"github.com/REANNZ/raumata/canvas"
+	"github.com/REANNZ/raumata/geometry"
+	"github.com/REANNZ/raumata/grid"
 	"github.com/REANNZ/raumata/internal/f32"
 	"github.com/REANNZ/raumata/option"
 	"github.com/REANNZ/raumata/vec"
@@ -14,14 +19,88 @@ import (
 type NodeStyle struct {
 	// Size of the node
 	Size float32 `json:"size"`
+	// The shape of the node, either "circle", "square",
+	// "rounded-rect", "diamond" or "hexagon", defaults to a circle
+	Shape string `json:"shape,omitempty"`
+	// The name of an icon from [RenderConfig.Icons] drawn on the node
+	Icon string `json:"icon,omitempty"`
 	*canvas.Style
 }
 
+// LinkRadius is the bend radius of a link, either a fixed radius or
+// "auto" in JSON, which fits the radius of each corner to the link,
+// see [geometry.AutoRadius]
+type LinkRadius struct {
+	Valid bool
+	Value float32
+	Auto  bool
+}
+
+func (r *LinkRadius) Set(val float32) {
+	r.Valid = true
+	r.Value = val
+	r.Auto = false
+}
+
+// SetAuto fits the radius of each corner to the link
+func (r *LinkRadius) SetAuto() {
+	r.Valid = true
+	r.Value = 0
+	r.Auto = true
+}
+
+// Returns the radius to draw the link with
+func (r *LinkRadius) radius() float32 {
+	if r.Auto {
+		return geometry.AutoRadius
+	}
+	return r.Value
+}
+
+func (r *LinkRadius) UnmarshalJSON(data []byte) error {
+	if string(data) == `"auto"` {
+		r.SetAuto()
+		return nil
+	}
+	radius := option.Float32{}
+	if err := radius.UnmarshalJSON(data); err != nil {
+		return err
+	}
+	*r = LinkRadius{Valid: radius.Valid, Value: radius.Value}
+	return nil
+}
+
+func (r LinkRadius) MarshalJSON() ([]byte, error) {
+	if r.Auto {
+		return []byte(`"auto"`), nil
+	}
+	radius := option.Float32{Valid: r.Valid, Value: r.Value}
+	return radius.MarshalJSON()
+}
+
 // Stores style information for links
 type LinkStyle struct {
 	Size float32 `json:"size"`
 	// Bend radius for the drawn line
-	Radius option.Float32 `json:"radius"`
+	Radius LinkRadius `json:"radius"`
+	// Minimum distance between the split point and a corner,
+	// defaults to Size
+	SplitTolerance option.Float32 `json:"split-tolerance"`
+	// Length of the arrowhead as a ratio of Size, defaults to 0.5
+	ArrowRatio option.Float32 `json:"arrow-ratio"`
+	// Minimum length of straight line before the arrowhead,
+	// the arrowhead is shortened to fit if necessary
+	ArrowMinRun option.Float32 `json:"arrow-min-run"`
+	// Draw the link as a smooth curve, either "catmull-rom" or
+	// "bezier", instead of straight lines with rounded corners
+	Curve string `json:"curve,omitempty"`
+	// Draws the link's outline, or its centerline, "dashed" or
+	// "dotted". A stroke-dasharray in the style is used over it.
+	Dash string `json:"dash,omitempty"`
+	// How the link is drawn, either "arrow", a filled arrow for each
+	// direction, or "centerline", a line as wide as the link along
+	// its middle. Defaults to "arrow".
+	Draw string `json:"draw,omitempty"`
 	*canvas.Style
 }
 
@@ -35,6 +114,11 @@ type LabelStyle struct {
 	BorderRadius float32      `json:"border-radius,omityempty"`   // Border radius - Link only
 	Width        float32      `json:"width,omitempty"`            // Label width - Link only
 	Opacity      float32      `json:"opacity,omitempty"`          // Label background opacity - Link only
+	// How digits are drawn, as in CSS. "tabular-nums" draws them all
+	// the same width, so values line up and don't shift as they change.
+	FontVariantNumeric string `json:"font-variant-numeric,omitempty"`
+	// Whether the font's kerning is used, as in CSS. "none" turns it off.
+	FontKerning string `json:"font-kerning,omitempty"`
 }
 
 // Configuration values for the renderer
@@ -48,8 +132,108 @@ type RenderConfig struct {
 	DefaultLinkStyle LinkStyle            `json:"link-style"`
 	LinkStyles       map[string]LinkStyle `json:"link-styles,omitempty"`
 	NodeLabelStyle   LabelStyle           `json:"node-label-style"`
+	NodeLabelStyles  map[string]LabelStyle `json:"node-label-styles,omitempty"` // Label styles for node classes
 	LinkLabelStyle   LabelStyle           `json:"link-label-style"`
+	LinkLabelStyles  map[string]LabelStyle `json:"link-label-styles,omitempty"` // Label styles for link classes
+	LinkEndLabelStyle LabelStyle          `json:"link-end-label-style"`       // Style of the labels at each end of a link
 	LinkColorScale   *canvas.ColorScale   `json:"link-color-scale"`
+	NodeTooltip      []TooltipField       `json:"node-tooltip,omitempty"` // Node metadata fields shown on hover
+	LinkSegmentIds   bool                 `json:"link-segment-ids,omitempty"` // Give each link direction its own id
+	RenderUnrouted   bool                 `json:"render-unrouted,omitempty"`  // Draw unrouted links as straight dashed lines
+	LocalCoordinates bool                 `json:"local-coordinates,omitempty"` // Draw links and shapes relative to their own position
+	BundleSpacing    float32              `json:"bundle-spacing,omitempty"`    // Distance between links sharing a route, 0 draws them on top of each other
+	DirectedPairs    bool                 `json:"directed-pairs,omitempty"`    // Draw links sharing a route on the right of their direction of travel
+	TrunkThreshold   int                  `json:"trunk-threshold,omitempty"`   // Draw more than this many links between two nodes as one trunk, 0 never does
+	Watermark        *Watermark           `json:"watermark,omitempty"`         // Text drawn across the map, behind the topology
+	NodeNames        map[NodeId]string    `json:"node-names,omitempty"`        // Names shown for nodes without a label, by id
+	HideNodes        bool                 `json:"hide-nodes,omitempty"`        // Leave out the nodes, drawing only the links
+	HideNodeLabels   bool                 `json:"hide-node-labels,omitempty"`  // Leave out the node labels and titles
+	HideLinkLabels   bool                 `json:"hide-link-labels,omitempty"`  // Leave out the link labels
+	LinkEndLabelsOnly bool                `json:"link-end-labels-only,omitempty"` // Draw the end labels of links that have them instead of their central labels
+	HideArrowheads   bool                 `json:"hide-arrowheads,omitempty"`   // End link segments square instead of with an arrowhead
+	NodeWeightSizes  *WeightSizes         `json:"node-weight-sizes,omitempty"` // Sizes nodes by their Weight
+	Views            []View               `json:"views,omitempty"`             // Other ways of drawing the map, see [View]
+	Orientation      *Orientation         `json:"orientation,omitempty"`       // Turns and flips the map, keeping labels upright
+	FitAspect        float32              `json:"fit-aspect,omitempty"`        // Turn the map a further quarter turn if that better fits this width to height ratio
+	Icons            map[string]Icon      `json:"icons,omitempty"`             // Icons that node styles can draw on their nodes, by name
+	LinkStateStyles  map[string]*canvas.Style `json:"link-state-styles,omitempty"` // Styles of links by their State, used over the color of their data
+}
+
+// Describes a single line of a tooltip
+type TooltipField struct {
+	// The metadata key to display
+	Key string `json:"key"`
+	// The label shown for the value, the key is used if empty
+	Label string `json:"label,omitempty"`
+}
+
+// Maps the Weight of nodes to their size, so more important nodes
+// are drawn larger without a class for each size. Weights between
+// MinWeight and MaxWeight are scaled linearly to sizes between
+// MinSize and MaxSize, and weights outside the range are clamped to
+// it. The size from the weight is used over the size of the node's
+// class, but a node's own style size takes priority.
+type WeightSizes struct {
+	MinWeight float32 `json:"min-weight"`
+	MaxWeight float32 `json:"max-weight"`
+	MinSize   float32 `json:"min-size"`
+	MaxSize   float32 `json:"max-size"`
+	// Label font sizes for the same range, the label styles are
+	// used if both are 0
+	MinLabelSize float32 `json:"min-label-size,omitempty"`
+	MaxLabelSize float32 `json:"max-label-size,omitempty"`
+}
+
+// Returns how far the weight is between MinWeight and MaxWeight,
+// from 0 to 1
+func (w *WeightSizes) fraction(weight float32) float32 {
+	if w.MaxWeight <= w.MinWeight {
+		if weight >= w.MaxWeight {
+			return 1
+		}
+		return 0
+	}
+	return min(max((weight-w.MinWeight)/(w.MaxWeight-w.MinWeight), 0), 1)
+}
+
+// Size returns the node size for the weight
+func (w *WeightSizes) Size(weight float32) float32 {
+	return w.MinSize + (w.MaxSize-w.MinSize)*w.fraction(weight)
+}
+
+// LabelSize returns the label font size for the weight, or 0 if
+// label sizes aren't set
+func (w *WeightSizes) LabelSize(weight float32) float32 {
+	return w.MinLabelSize + (w.MaxLabelSize-w.MinLabelSize)*w.fraction(weight)
+}
+
+// Describes large text, such as "DRAFT", drawn across the whole
+// map behind the nodes and links
+type Watermark struct {
+	Text       string       `json:"text"`
+	Size       float32      `json:"size,omitempty"` // Font size, 0 fits the text to the map
+	Angle      float32      `json:"angle"`          // Rotation in degrees, counterclockwise
+	Opacity    float32      `json:"opacity"`
+	Color      canvas.Color `json:"color"`
+	FontFamily string       `json:"font-family"`
+}
+
+// Returns a watermark with the given text and the default
+// settings
+func NewWatermark(text string) *Watermark {
+	return &Watermark{
+		Text:       text,
+		Angle:      30,
+		Opacity:    0.15,
+		Color:      canvas.RGB(0.5, 0.5, 0.5),
+		FontFamily: "sans-serif",
+	}
+}
+
+func (w *Watermark) UnmarshalJSON(data []byte) error {
+	// Fields not in the JSON keep their default values
+	*w = *NewWatermark("")
+	return canvas.UnmarshalColorStruct(data, w)
 }
 
 func DefaultRenderConfig() *RenderConfig {
@@ -66,7 +250,7 @@ func DefaultRenderConfig() *RenderConfig {
 		},
 		DefaultLinkStyle: LinkStyle{
 			Size:   10,
-			Radius: option.Float32{},
+			Radius: LinkRadius{},
 			Style: &canvas.Style{
 				StrokeWidth: option.Float32{},
 				FillColor:   canvas.NewStyleColor(canvas.RGB(0.5, 0.5, 0.5)),
@@ -89,6 +273,14 @@ func DefaultRenderConfig() *RenderConfig {
 			Opacity:      0.9,
 			BorderRadius: 3,
 			Width:        28,
+			// Link labels are mostly values, which shouldn't jump
+			// around as they change
+			FontVariantNumeric: "tabular-nums",
+		},
+		LinkEndLabelStyle: LabelStyle{
+			Size:       6,
+			FontFamily: "monospace",
+			Color:      canvas.RGB(0, 0, 0),
 		},
 	}
 
@@ -96,13 +288,102 @@ func DefaultRenderConfig() *RenderConfig {
 	config.DefaultLinkStyle.StrokeWidth.Set(0)
 	config.DefaultLinkStyle.Radius.Set(10)
 
+	// Links that aren't carrying traffic are greyed out, with an
+	// outline showing why
+	down := canvas.NewStyle()
+	down.FillColor.SetColor(canvas.RGB(0.8, 0.8, 0.8))
+	down.StrokeColor.SetColor(canvas.RGB(0.84, 0.15, 0.16))
+	down.StrokeWidth.Set(1)
+	down.StrokeDashArray = []float32{4, 2}
+	adminDown := canvas.NewStyle()
+	adminDown.FillColor.SetColor(canvas.RGB(0.8, 0.8, 0.8))
+	adminDown.StrokeColor.SetColor(canvas.RGB(0.5, 0.5, 0.5))
+	adminDown.StrokeWidth.Set(1)
+	adminDown.StrokeDashArray = []float32{2, 2}
+	maintenance := canvas.NewStyle()
+	maintenance.FillColor.SetColor(canvas.RGB(0.58, 0.4, 0.74))
+	maintenance.StrokeColor.SetColor(canvas.RGB(0, 0, 0))
+	maintenance.StrokeWidth.Set(1)
+	maintenance.StrokeDashArray = []float32{4, 2}
+	config.LinkStateStyles = map[string]*canvas.Style{
+		LinkStateDown:        down,
+		LinkStateAdminDown:   adminDown,
+		LinkStateMaintenance: maintenance,
+	}
+
 	return config
 }
 
+// LinkColorFunc chooses the color of one direction of a link, data
+// is the [LinkData] for that direction, and may be nil. Returning
+// nil falls back to the color scale.
+type LinkColorFunc func(link *Link, data *LinkData) canvas.Color
+
+// NodeNameFunc turns a node id into the name shown for the node,
+// for example by removing a domain suffix
+type NodeNameFunc func(id NodeId) string
+
+// NodeDecorationFunc returns extra objects to draw on a node, such as
+// status glyphs. The objects are positioned relative to the center of
+// the node on the canvas, and style is the node's resolved style, so
+// they can be sized to match.
+type NodeDecorationFunc func(node *Node, style *NodeStyle) []canvas.Object
+
+// IdSanitizer rewrites a node or link id, or a class, from the
+// topology into a form that is safe to use in SVG ids and classes
+// and in CSS selectors. See [SanitizeId].
+type IdSanitizer func(id string) string
+
 type Renderer struct {
 	Config *RenderConfig
+	// Chooses link colors ahead of Config.LinkColorScale, a color
+	// set on the LinkData still takes priority (default nil)
+	LinkColor LinkColorFunc
+	// Gives the name shown for nodes without a label or a name in
+	// Config.NodeNames, returning "" uses the id (default nil)
+	NodeName NodeNameFunc
+	// Adds extra objects to each node, drawn over the node and
+	// its label (default nil)
+	NodeDecorations NodeDecorationFunc
+	// Rewrites ids and classes from the topology and the config
+	// before they are used in the SVG ids, classes and stylesheet.
+	// The original ids are kept in data attributes (default nil)
+	SanitizeId IdSanitizer
+	// Leave out nodes and links that fail to render, including any
+	// that panic, instead of failing the whole map. The errors are
+	// returned by Errors (default false)
+	ContinueOnError bool
 	scale  float32
 	nodeSizes map[NodeId]float32
+	nodeCenters map[NodeId]vec.Vec2
+	nodeAnchors map[NodeId]vec.Vec2
+	nodeLabelAt map[NodeId]Direction
+	linkOffsets map[LinkId]float32
+	corridorFans map[LinkId]corridorFan
+	trunks      []trunk
+	trunkFans   map[LinkId]trunkFan
+	// The turns and flips of the map being rendered, nil if none
+	orientation *vec.Transform
+	errors      []*RenderError
+}
+
+// RenderError is an error rendering a single node or link, only one
+// of Node and Link is set
+type RenderError struct {
+	Node NodeId
+	Link LinkId
+	Err  error
+}
+
+func (e *RenderError) Error() string {
+	if e.Link != "" {
+		return fmt.Sprintf("Error rendering link '%s': %s", e.Link, e.Err)
+	}
+	return fmt.Sprintf("Error rendering node '%s': %s", e.Node, e.Err)
+}
+
+func (e *RenderError) Unwrap() error {
+	return e.Err
 }
 
 func NewRenderer() *Renderer {
@@ -135,10 +416,13 @@ func (r *Renderer) GetScale() float32 {
 		if style.Size > maxNodeSize {
 			maxNodeSize = style.Size
 		}
-		if style.StrokeWidth.Valid && style.StrokeWidth.Value > maxNodeStrokeWidth {
+		if style.Style != nil && style.StrokeWidth.Valid && style.StrokeWidth.Value > maxNodeStrokeWidth {
 			maxNodeStrokeWidth = style.StrokeWidth.Value
 		}
 	}
+	if sizes := r.Config.NodeWeightSizes; sizes != nil {
+		maxNodeSize = max(maxNodeSize, sizes.MinSize, sizes.MaxSize)
+	}
 
 	r.scale = r.Config.MinNodeSep + maxNodeSize + maxNodeStrokeWidth
 
@@ -150,6 +434,34 @@ func (r *Renderer) SetScale(s float32) {
 	r.scale = s
 }
 
+// GridToCanvas converts a position in the topology grid to the
+// matching position on the canvas, using the same scale as the
+// rendered nodes and links
+func (r *Renderer) GridToCanvas(pos vec.Vec2) vec.Vec2 {
+	return pos.Mul(r.GetScale())
+}
+
+// CanvasToGrid converts a position on the canvas to the matching,
+// possibly fractional, position in the topology grid. It is the
+// inverse of [Renderer.GridToCanvas].
+func (r *Renderer) CanvasToGrid(pos vec.Vec2) vec.Vec2 {
+	return pos.Div(r.GetScale())
+}
+
+// ReserveArea reserves the grid cells under area, which is in canvas
+// coordinates, with [Topology.Reserve]. This keeps links and labels
+// clear of a decoration of a known size drawn over the map.
+func (r *Renderer) ReserveArea(topo *Topology, id string, area *canvas.AABB) *Obstacle {
+	minPos, maxPos := area.Bounds()
+
+	// Each cell extends half a cell either side of its position,
+	// so rounding includes every cell that overlaps the area
+	a := grid.FromVec(r.CanvasToGrid(minPos))
+	b := grid.FromVec(r.CanvasToGrid(maxPos))
+
+	return topo.Reserve(id, a, b)
+}
+
 // RenderTopologyToCanvas renders the given Topology to the top level of the given
 // This also adds the styles to the canvas.
 func (r *Renderer) RenderTopologyToCanvas(topo *Topology, c *canvas.Canvas) error {
@@ -171,21 +483,42 @@ func (r *Renderer) RenderTopology(topo *Topology) (canvas.Object, error) {
 	nodes := make([]*Node, 0, len(topo.Nodes))
 
 	r.nodeSizes = map[NodeId]float32{}
+	r.errors = nil
+	r.nodeCenters = map[NodeId]vec.Vec2{}
+	r.nodeAnchors = map[NodeId]vec.Vec2{}
+	r.nodeLabelAt = map[NodeId]Direction{}
+	r.orientation = r.mapOrientation(topo).transform()
 
 	// Collect and sort the links and nodes, this keeps the output
 	// consistent between runs
-	for _, l := range topo.Links {
-		// Filter out un-routed links
-		if l != nil && len(l.Route) >= 2 {
-			links = append(links, l)
-		}
-	}
 	for _, n := range topo.Nodes {
 		// Filter out nodes without a position
 		if n != nil && n.Pos != nil {
 			nodes = append(nodes, n)
 			style := r.getNodeStyle(n)
 			r.nodeSizes[n.Id] = style.Size
+			minPos, maxPos := n.GetExtents()
+			r.nodeCenters[n.Id] = minPos.Add(maxPos).Div(2)
+			r.nodeLabelAt[n.Id] = n.LabelAt
+			if n.Anchor != nil {
+				r.nodeAnchors[n.Id] = vec.Vec2{X: n.Anchor[0], Y: n.Anchor[1]}
+			}
+		}
+	}
+	for _, l := range topo.Links {
+		if l == nil {
+			continue
+		}
+		// Filter out un-routed links, unless they are being drawn
+		// as straight lines
+		if len(l.Route) >= 2 {
+			links = append(links, l)
+		} else if r.Config.RenderUnrouted {
+			_, hasFrom := r.nodeCenters[l.From]
+			_, hasTo := r.nodeCenters[l.To]
+			if hasFrom && hasTo {
+				links = append(links, l)
+			}
 		}
 	}
 
@@ -209,6 +542,24 @@ func (r *Renderer) RenderTopology(topo *Topology) (canvas.Object, error) {
 		}
 	})
 
+	r.linkOffsets = nil
+	r.corridorFans = nil
+	r.findTrunks(topo, links)
+	if r.Config.BundleSpacing > 0 {
+		// Links sharing a corridor are spread out along it, the
+		// rest are spread out if they share their whole route
+		untrunked := slices.DeleteFunc(slices.Clone(links), func(l *Link) bool {
+			_, ok := r.trunkFans[l.Id]
+			return ok
+		})
+		r.corridorFans = corridorFans(topo, untrunked, r.Config.BundleSpacing)
+		bundled := slices.DeleteFunc(untrunked, func(l *Link) bool {
+			_, ok := r.corridorFans[l.Id]
+			return ok
+		})
+		r.linkOffsets = bundleOffsets(bundled, r.Config.BundleSpacing, r.Config.DirectedPairs)
+	}
+
 	group := canvas.NewGroup()
 	group.Attributes.Id = "topology"
 
@@ -217,26 +568,135 @@ func (r *Renderer) RenderTopology(topo *Topology) (canvas.Object, error) {
 		return nil, err
 	}
 
+	// Nodes still take part in the layout of the links when hidden,
+	// they just aren't drawn
+	if r.Config.HideNodes {
+		nodes = nil
+	}
+
+	// Nodes with members are drawn under the links, so the links to
+	// their members can be seen
+	var containers []*Node
+	nodes = slices.DeleteFunc(nodes, func(n *Node) bool {
+		if len(n.Members) > 0 {
+			containers = append(containers, n)
+			return true
+		}
+		return false
+	})
+
 	nodeGroup, err := r.RenderNodes(nodes)
 	if err != nil {
 		return nil, err
 	}
 
-	group.AppendChild(linkGroup)
-	group.AppendChild(nodeGroup)
+	objects := []canvas.Object{linkGroup, nodeGroup}
+	if len(r.trunks) > 0 {
+		// The trunks cover the middles of their links
+		objects = []canvas.Object{linkGroup, r.renderTrunks(), nodeGroup}
+	}
+	if len(containers) > 0 {
+		containerGroup, err := r.renderNodes(containers, "containers")
+		if err != nil {
+			return nil, err
+		}
+		objects = append([]canvas.Object{containerGroup}, objects...)
+	}
+
+	// The watermark and decorations are placed around the turned
+	// map, but aren't turned themselves
+	if r.orientation != nil {
+		oriented := canvas.NewGroup()
+		oriented.Transform = r.orientation
+		for _, obj := range objects {
+			oriented.AppendChild(obj)
+		}
+		objects = []canvas.Object{oriented}
+	}
+
+	aabb := canvas.GetCombinedAABB(objects)
+	if wm := r.Config.Watermark; wm != nil && wm.Text != "" && aabb != nil {
+		group.AppendChild(r.renderWatermark(wm, aabb))
+	}
+
+	for _, obj := range objects {
+		group.AppendChild(obj)
+	}
+
+	// Decorations are placed around the topology, and drawn over it
+	if decorations := r.RenderDecorations(topo.Decorations, aabb); decorations != nil {
+		group.AppendChild(decorations)
+	}
 
 	return group, nil
 }
 
+// Renders the watermark centered on bounds. Without a size set, the
+// text is made as large as possible while staying inside bounds, so
+// it doesn't change the size of the map.
+func (r *Renderer) renderWatermark(wm *Watermark, bounds *canvas.AABB) canvas.Object {
+	minPos, maxPos := bounds.Bounds()
+	center := minPos.Add(maxPos).Div(2)
+	extent := bounds.Size()
+
+	angle := wm.Angle * math.Pi / 180
+	cos := f32.Abs(f32.Cos(angle))
+	sin := f32.Abs(f32.Sin(angle))
+
+	size := wm.Size
+	if size <= 0 {
+		// The width of the text at a size of 1
+		length := canvas.TextWidth(wm.Text, 1)
+		size = f32.Min(
+			extent.X/(length*cos+sin),
+			extent.Y/(length*sin+cos))
+	}
+
+	// The text is centered on the origin, before being rotated
+	// and moved to the center
+	text := canvas.NewText(vec.Vec2{}, wm.Text)
+	text.Anchor = canvas.TextAnchorMiddle
+	text.Baseline = canvas.TextBaselineMiddle
+	text.Size = size
+	text.Attributes.AddClass("watermark")
+
+	style := canvas.NewStyle()
+	if wm.Color != nil {
+		style.FillColor.SetColor(wm.Color)
+	}
+	style.Opacity.Set(wm.Opacity)
+	style.FontFamily = wm.FontFamily
+	text.Attributes.Style = style
+
+	// Angles are counterclockwise on the page, which is clockwise
+	// in canvas coordinates
+	group := canvas.NewGroup()
+	group.Attributes.Id = "watermark"
+	group.Transform = vec.NewRotate(-angle).Combine(vec.NewTranslate(center))
+	group.AppendChild(text)
+
+	return group
+}
+
 // RenderNodes renders a list of nodes and returns a [canvas.Object]
 func (r *Renderer) RenderNodes(nodes []*Node) (canvas.Object, error) {
+	return r.renderNodes(nodes, "nodes")
+}
+
+func (r *Renderer) renderNodes(nodes []*Node, id string) (*canvas.Group, error) {
 	group := canvas.NewGroup()
-	group.Attributes.Id = "nodes"
+	group.Attributes.Id = id
 
 	for _, node := range nodes {
-		obj, err := r.RenderNode(node)
+		obj, err := r.tryRender(func() (canvas.Object, error) {
+			return r.RenderNode(node)
+		})
 		if err != nil {
-			return nil, err
+			if !r.ContinueOnError {
+				return nil, err
+			}
+			r.errors = append(r.errors, &RenderError{Node: node.Id, Err: err})
+			continue
 		}
 		if obj != nil {
 			group.AppendChild(obj)
@@ -246,15 +706,41 @@ func (r *Renderer) RenderNodes(nodes []*Node) (canvas.Object, error) {
 	return group, nil
 }
 
+// Calls render, turning a panic into an error if ContinueOnError
+// is set
+func (r *Renderer) tryRender(render func() (canvas.Object, error)) (obj canvas.Object, err error) {
+	if r.ContinueOnError {
+		defer func() {
+			if p := recover(); p != nil {
+				obj = nil
+				err = fmt.Errorf("%v", p)
+			}
+		}()
+	}
+	return render()
+}
+
+// Errors returns the errors for the nodes and links left out since
+// the last call to RenderTopology, when ContinueOnError is set
+func (r *Renderer) Errors() []*RenderError {
+	return r.errors
+}
+
 // RenderLinks renders a list of links and returns a [canvas.Object]
 func (r *Renderer) RenderLinks(links []*Link) (canvas.Object, error) {
 	group := canvas.NewGroup()
 	group.Attributes.Id = "links"
 
 	for _, link := range links {
-		obj, err := r.RenderLink(link)
+		obj, err := r.tryRender(func() (canvas.Object, error) {
+			return r.RenderLink(link)
+		})
 		if err != nil {
-			return nil, err
+			if !r.ContinueOnError {
+				return nil, err
+			}
+			r.errors = append(r.errors, &RenderError{Link: link.Id, Err: err})
+			continue
 		}
 		if obj != nil {
 			group.AppendChild(obj)
@@ -269,46 +755,62 @@ func (r *Renderer) RenderNode(node *Node) (canvas.Object, error) {
 	if node == nil || node.Pos == nil {
 		return nil, nil
 	}
-	scale := r.GetScale()
 	// pos is the center of the node shape
-	pos := vec.Vec2{X: float32(node.Pos[0]), Y: float32(node.Pos[1])}
-	pos = pos.Mul(scale)
+	pos := r.GridToCanvas(vec.Vec2{X: float32(node.Pos[0]), Y: float32(node.Pos[1])})
 
 	style := r.getNodeStyle(node)
 
 	// Create a group for the node
 	nodeGroup := canvas.NewGroup()
-	nodeGroup.Attributes.Id = string("N-" + node.Id)
+	nodeGroup.Attributes.Id = r.svgName(string("N-" + node.Id))
 	nodeGroup.Attributes.SetExtra("data-node", string(node.Id))
 
-	// NOTE: this is where you'd branch off for different node styles
-	var nodeShape canvas.Object = canvas.NewCircle(pos, style.Size/2)
+	nodeShape := r.nodeShape(pos, style)
 
+	var shapeOrigin vec.Vec2
 	if node.IsMultiCell() {
 		radius := style.Size / 2;
 		nodeMin, nodeMax := node.GetExtents()
-		nodeShape = r.RenderShape(radius, vec.Polyline{
+		outline := vec.Polyline{
 			{ X: nodeMin.X, Y: nodeMin.Y },
 			{ X: nodeMax.X, Y: nodeMin.Y },
 			{ X: nodeMax.X, Y: nodeMax.Y },
 			{ X: nodeMin.X, Y: nodeMax.Y },
-		})
+		}
+		if r.Config.LocalCoordinates {
+			shapeOrigin = r.CanvasToGrid(pos)
+			outline = outline.Add(shapeOrigin.Neg())
+		}
+		nodeShape = r.RenderShape(radius, outline)
 	}
 
 	attrs := nodeShape.GetAttributes()
 	attrs.AddClass("node")
-	if node.Class != "" {
-		attrs.AddClass(node.Class)
-	}
+	r.addClass(attrs, node.Class)
 
 	if node.Style != nil {
 		// Copy the node style over to the node shape
 		attrs.Style = node.Style.Style
 	}
 
-	nodeGroup.AppendChild(nodeShape)
+	nodeGroup.Attributes.Title = r.nodeTooltip(node)
+
+	if shapeOrigin != (vec.Vec2{}) {
+		shapeGroup := canvas.NewGroup()
+		shapeGroup.Transform = vec.NewTranslate(r.GridToCanvas(shapeOrigin))
+		shapeGroup.AppendChild(nodeShape)
+		nodeGroup.AppendChild(shapeGroup)
+	} else {
+		icon, hasIcon := r.nodeIcon(node, style)
+		if !hasIcon || !icon.Replace {
+			nodeGroup.AppendChild(nodeShape)
+		}
+		if hasIcon {
+			nodeGroup.AppendChild(r.renderIcon(style.Icon, icon, pos))
+		}
+	}
 
-	if node.IsMultiCell() || node.LabelAt != "" {
+	if (node.IsMultiCell() || node.LabelAt != DirectionNone) && !r.Config.HideNodeLabels {
 		label, err := r.RenderNodeLabel(node)
 		if err != nil {
 			return nil, err
@@ -318,27 +820,112 @@ func (r *Renderer) RenderNode(node *Node) (canvas.Object, error) {
 		}
 	}
 
+	if r.NodeDecorations != nil {
+		if objs := r.NodeDecorations(node, style); len(objs) > 0 {
+			minPos, maxPos := node.GetExtents()
+			center := r.GridToCanvas(minPos.Add(maxPos).Div(2))
+
+			decorations := canvas.NewGroup()
+			decorations.Attributes.AddClass("node-decoration")
+			decorations.Transform = vec.NewTranslate(center)
+			for _, obj := range objs {
+				decorations.AppendChild(obj)
+			}
+			nodeGroup.AppendChild(decorations)
+		}
+	}
+
 	return nodeGroup, nil
 }
 
+// Returns the route of the link as it is drawn, in grid units, after
+// spreading out links that share a corridor, bundle or trunk, and
+// moving its ends to the nodes' attachment points
+func (r *Renderer) drawnRoute(link *Link) vec.Polyline {
+	scale := r.GetScale()
+
+	route := link.Route
+	if fan, ok := r.corridorFans[link.Id]; ok {
+		route = fan.apply(route, scale)
+	}
+	route = route.Simplify()
+	if fan, ok := r.trunkFans[link.Id]; ok {
+		route = fan.apply(fan.route, scale)
+	}
+
+	if offset := r.linkOffsets[link.Id]; offset != 0 {
+		route = route.Offset(offset / scale)
+	}
+
+	// Move the ends of the route to the nodes' attachment points
+	fromAnchor, hasFromAnchor := r.nodeAnchors[link.From]
+	toAnchor, hasToAnchor := r.nodeAnchors[link.To]
+	if hasFromAnchor || hasToAnchor {
+		route = slices.Clone(route)
+		route[0] = route[0].Add(fromAnchor.Div(scale))
+		route[len(route)-1] = route[len(route)-1].Add(toAnchor.Div(scale))
+	}
+
+	return route
+}
+
+// Returns the shape of a single cell node centered on pos. Squares are
+// as wide as the node's size, and the points of the other shapes are
+// on the circle drawn by default. Unknown shapes are drawn as circles.
+func (r *Renderer) nodeShape(pos vec.Vec2, style *NodeStyle) canvas.Object {
+	radius := style.Size / 2
+	switch style.Shape {
+	case "square", "rounded-rect":
+		rect := canvas.NewSquare(pos.Sub(vec.Vec2{X: radius, Y: radius}), style.Size)
+		if style.Shape == "rounded-rect" {
+			rect.Rx = style.Size / 4
+			rect.Ry = style.Size / 4
+		}
+		return rect
+	case "diamond":
+		return canvas.NewRegularPolygon(pos, radius, 4, false)
+	case "hexagon":
+		return canvas.NewRegularPolygon(pos, radius, 6, true)
+	default:
+		return canvas.NewCircle(pos, radius)
+	}
+}
+
 // RenderLink renders the given Link and returns a [canvas.Object]
 func (r *Renderer) RenderLink(link *Link) (canvas.Object, error) {
-	if link == nil || link.Route == nil {
+	if link == nil {
+		return nil, nil
+	}
+	if len(link.Route) < 2 {
+		if r.Config.RenderUnrouted {
+			return r.RenderUnroutedLink(link)
+		}
 		return nil, nil
 	}
-
-	route := link.Route.Simplify()
 
 	style := r.getLinkStyle(link)
 	scale := r.GetScale()
 
+	route := r.drawnRoute(link)
+	_, inTrunk := r.trunkFans[link.Id]
+	// The end labels replace the central ones if they're only drawn
+	endLabelsOnly := r.Config.LinkEndLabelsOnly && (link.FromLabel != "" || link.ToLabel != "")
+
 	linkGroup := canvas.NewGroup()
-	linkGroup.Attributes.Id = string("L-" + link.Id)
-	linkGroup.Attributes.AddClass("link")
-	if link.Class != "" {
-		linkGroup.Attributes.AddClass(link.Class)
+
+	// With large grids, the float32 coordinates have little precision
+	// left for the arcs and arrowheads, so draw the link relative to
+	// its starting grid position instead
+	if r.Config.LocalCoordinates {
+		origin := route[0]
+		route = route.Add(origin.Neg())
+		linkGroup.Transform = vec.NewTranslate(r.GridToCanvas(origin))
 	}
 
+	r.setLinkId(&linkGroup.Attributes, link.Id)
+	linkGroup.Attributes.AddClass("link")
+	r.addClass(&linkGroup.Attributes, link.Class)
+
 	// The node sizes are used to adjust lengths along links
 	fromSize := r.getNodeSize(link.From)
 	toSize := r.getNodeSize(link.To)
@@ -370,20 +957,46 @@ func (r *Renderer) RenderLink(link *Link) (canvas.Object, error) {
 	// Clamp splitAt to 0 < x < 1
 	splitAt = f32.Max(f32.Min(splitAt, 0.99), 0.01)
 
-	splitTolerance := style.Size / scale
-	routeA, routeB := findSplit(route, splitAt, splitTolerance)
+	splitTolerance := style.Size
+	if style.SplitTolerance.Valid {
+		splitTolerance = style.SplitTolerance.Value
+	}
+	splitTolerance = splitTolerance / scale
+	routeA, routeB := geometry.FindSplit(route, splitAt, splitTolerance)
 	routeA = routeA.Mul(scale)
 	routeB = routeB.Mul(scale)
 
-	// TODO: handle state-dependent link-coloring (e.g. grey for down)
+	headLength := style.Size / 2
+	if style.ArrowRatio.Valid {
+		headLength = style.Size * style.ArrowRatio.Value
+	}
+	if r.Config.HideArrowheads {
+		headLength = 0
+	}
+
+	stateStyle := r.Config.LinkStateStyles[link.State]
+	if link.State != "" {
+		linkGroup.Attributes.AddClass(r.svgName("link-state-" + link.State))
+		linkGroup.Attributes.SetExtra("data-state", link.State)
+	}
+
+	labelStyle := r.getLinkLabelStyle(link)
 
 	// Helper function for rendering the individual link parts
-	renderLinkSegment := func(route vec.Polyline, data *LinkData, from, to string) (canvas.Object, error) {
-		var color canvas.StyleColor = style.FillColor
-		if data != nil && data.Value.Valid {
-			color.SetColor(r.Config.LinkColorScale.GetColor(data.Value.Value))
+	renderLinkSegment := func(route vec.Polyline, data *LinkData, from, to, suffix string) (canvas.Object, error) {
+		color := r.linkDataColor(link, style, data)
+		var path *canvas.Path
+		if style.Draw == "centerline" {
+			path = r.renderCenterline(route, style, color)
+			// The color is the line's stroke
+			color = canvas.StyleColor{}
+		} else if style.Curve != "" {
+			path = geometry.CurvedArrow(route, style.Size, headLength, style.ArrowMinRun.Value, style.Curve)
+		}
+		// Links with a curve that isn't known are drawn as usual
+		if path == nil && style.Draw != "centerline" {
+			path = geometry.Arrow(route, style.Size, style.Radius.radius(), headLength, style.ArrowMinRun.Value)
 		}
-		path := renderArrow(route, style.Size, style.Radius.Value)
 		if path == nil {
 			return nil, nil
 		}
@@ -392,24 +1005,38 @@ func (r *Renderer) RenderLink(link *Link) (canvas.Object, error) {
 			path.Attributes.EnsureStyle()
 			path.Attributes.Style.FillColor = color
 		}
+		if style.Draw != "centerline" && style.Dash != "" && style.StrokeDashArray == nil {
+			path.Attributes.EnsureStyle()
+			path.Attributes.Style.StrokeDashArray = style.dashArray(style.StrokeWidth.Value)
+		}
+		if stateStyle != nil {
+			path.Attributes.EnsureStyle()
+			path.Attributes.Style.Merge(stateStyle)
+		}
 
 		linkSeg := canvas.NewGroup()
+		if r.Config.LinkSegmentIds {
+			linkSeg.Attributes.Id = r.svgName(string("L-"+link.Id)) + "-" + suffix
+		}
 		linkSeg.Attributes.AddClass("link-segment")
 		linkSeg.Attributes.SetExtra("data-from", from)
 		linkSeg.Attributes.SetExtra("data-to", to)
 
 		linkSeg.AppendChild(path)
 
-		if data != nil && data.Label != "" {
+		// The labels of links in a trunk would be covered by it
+		if data != nil && data.Label != "" && !r.Config.HideLinkLabels && !inTrunk && !endLabelsOnly {
 			// Calculate the adjustment to the centre point
 			// due to the node and the arrow head
 			adjustment := r.getNodeSize(NodeId(from))
 			adjustment -= style.Size
-			// Calculate the offset 0.5 along the path as seen
-			t := 1 + (adjustment / (route.Length()))
+			// Calculate the offset 0.5 along the path as seen,
+			// which stops at the base of the arrowhead
+			shaft, _ := geometry.ArrowShaft(route, headLength, style.ArrowMinRun.Value)
+			t := 1 + (adjustment / (shaft.Length()))
 			t = t / 2
-			labelPos := route.Interpolate(t)
-			label, err := r.RenderLinkLabel(labelPos, data.Label)
+			labelPos := shaft.Interpolate(t)
+			label, err := r.renderLinkLabel(labelPos, data.Label, labelStyle, link.LabelStyle, link.Class)
 			if err != nil {
 				return nil, err
 			}
@@ -419,125 +1046,470 @@ func (r *Renderer) RenderLink(link *Link) (canvas.Object, error) {
 		return linkSeg, nil
 	}
 
-	linkSegA, err := renderLinkSegment(routeA, link.FromData, string(link.From), string(link.To))
+	linkSegA, err := renderLinkSegment(routeA, link.FromData, string(link.From), string(link.To), "fwd")
 	if err != nil {
 		return nil, err
 	}
-	linkSegB, err := renderLinkSegment(routeB, link.ToData, string(link.To), string(link.From))
+	linkSegB, err := renderLinkSegment(routeB, link.ToData, string(link.To), string(link.From), "rev")
 	if err != nil {
 		return nil, err
 	}
 
-	if link.Class != "" {
-		linkSegA.GetAttributes().AddClass(link.Class)
-		linkSegB.GetAttributes().AddClass(link.Class)
-	}
+	r.addClass(linkSegA.GetAttributes(), link.Class)
+	r.addClass(linkSegB.GetAttributes(), link.Class)
 
 	linkGroup.AppendChild(linkSegA)
 	linkGroup.AppendChild(linkSegB)
 
-	// TODO: State handling
+	if !r.Config.HideLinkLabels {
+		if link.FromLabel != "" {
+			linkGroup.AppendChild(r.renderLinkEndLabel(routeA, link.From, fromSize, style.Size, link.FromLabel))
+		}
+		if link.ToLabel != "" {
+			linkGroup.AppendChild(r.renderLinkEndLabel(routeB, link.To, toSize, style.Size, link.ToLabel))
+		}
+	}
+
+	return linkGroup, nil
+}
+
+// Renders route as a line as wide as the link, in the given color.
+// The line has no arrowhead or rounded corners.
+func (r *Renderer) renderCenterline(route vec.Polyline, style *LinkStyle, color canvas.StyleColor) *canvas.Path {
+	route = route.Simplify()
+	if len(route) < 2 {
+		return nil
+	}
+
+	path := canvas.NewPath()
+	for _, p := range route {
+		path.LineTo(p)
+	}
+	path.Attributes.AddClass("link-centerline")
+	path.Attributes.Style = canvas.NewStyle()
+	path.Attributes.Style.FillColor.SetNone()
+	if color.IsZero() {
+		color = style.FillColor
+	}
+	path.Attributes.Style.StrokeColor = color
+	path.Attributes.Style.StrokeWidth.Set(style.Size)
+	path.Attributes.Style.StrokeDashArray = style.dashArray(style.Size)
+	return path
+}
+
+// Renders a label near the start of route, which is the end of a
+// link at the given node. The label is put just past the edge of the
+// node, beside the link on the side away from the node's label.
+func (r *Renderer) renderLinkEndLabel(route vec.Polyline, nodeId NodeId, nodeSize, linkSize float32, text string) canvas.Object {
+	style := &r.Config.LinkEndLabelStyle
+
+	// Far enough along that the label clears the node, but not past
+	// the middle of the link
+	routeLen := route.Length()
+	dist := nodeSize/2 + style.Size
+	t := float32(0.5)
+	if routeLen > 0 {
+		t = f32.Min(dist/routeLen, 0.5)
+	}
+	pos := route.Interpolate(t)
+
+	dir := route[len(route)-1].Sub(route[0])
+	if len(route) > 1 {
+		dir = route[1].Sub(route[0])
+	}
+	dir = dir.Normalized()
+	side := vec.Vec2{X: -dir.Y, Y: dir.X}
+
+	// Use the side of the link facing away from the node's label
+	if side.Dot(r.nodeLabelAt[nodeId].AsVec()) > 0 {
+		side = side.Neg()
+	}
+	pos = pos.Add(side.Mul(linkSize/2 + style.Size/4))
+
+	label := canvas.NewText(pos, text)
+	label.Size = style.Size
+	label.Shaping = style.shaping()
+	// Line the text up so it grows away from the link, as it
+	// appears once the map is turned
+	side = r.screenVec(side)
+	if f32.Abs(side.X) > f32.Abs(side.Y) {
+		label.Baseline = canvas.TextBaselineMiddle
+		label.Anchor = canvas.TextAnchorStart
+		if side.X < 0 {
+			label.Anchor = canvas.TextAnchorEnd
+		}
+	} else {
+		label.Anchor = canvas.TextAnchorMiddle
+		label.Baseline = canvas.TextBaselineTop
+		if side.Y < 0 {
+			label.Baseline = canvas.TextBaselineBottom
+		}
+	}
+	label.Attributes.AddClass("link-end-label")
+
+	return r.keepUpright(label, pos)
+}
+
+// Works out the lateral offsets for links that share the same route,
+// so they are drawn side by side, spacing apart, centered on the
+// route. The links must be sorted by id.
+//
+// If directed is set, bundles with links running both ways are split
+// along the route instead, with each link on the right of its
+// direction of travel, so a pair of links mirror each other.
+func bundleOffsets(links []*Link, spacing float32, directed bool) map[LinkId]float32 {
+	bundles := map[string][]*Link{}
+	keys := []string{}
+
+	for _, link := range links {
+		if len(link.Route) < 2 {
+			continue
+		}
+
+		key := bundleKey(link)
+		if _, ok := bundles[key]; !ok {
+			keys = append(keys, key)
+		}
+		bundles[key] = append(bundles[key], link)
+	}
+
+	offsets := map[LinkId]float32{}
+	for _, key := range keys {
+		bundle := bundles[key]
+		if len(bundle) < 2 {
+			continue
+		}
+
+		center := float32(len(bundle)-1) / 2
+
+		if directed {
+			// Put the reversed links first, so they are on the
+			// other side of the route to the rest
+			ordered := make([]*Link, 0, len(bundle))
+			for _, link := range bundle {
+				if link.To < link.From {
+					ordered = append(ordered, link)
+				}
+			}
+			reversed := len(ordered)
+			for _, link := range bundle {
+				if link.To >= link.From {
+					ordered = append(ordered, link)
+				}
+			}
+			if reversed > 0 && reversed < len(bundle) {
+				bundle = ordered
+				center = float32(reversed) - 0.5
+			}
+		}
+
+		for i, link := range bundle {
+			offset := (float32(i) - center) * spacing
+			if link.To < link.From {
+				offset = -offset
+			}
+			offsets[link.Id] = offset
+		}
+	}
+
+	return offsets
+}
+
+// LinkDataColor returns the fill color of the direction of the link
+// with the given data. This is the fill of the style for the link's
+// state, then the data's own color, then the color from LinkColor,
+// then the color of its value on the color scale, and finally the
+// fill of the link's style.
+func (r *Renderer) LinkDataColor(link *Link, data *LinkData) canvas.StyleColor {
+	return r.linkDataColor(link, r.getLinkStyle(link), data)
+}
+
+func (r *Renderer) linkDataColor(link *Link, style *LinkStyle, data *LinkData) canvas.StyleColor {
+	if stateStyle := r.Config.LinkStateStyles[link.State]; stateStyle != nil && !stateStyle.FillColor.IsZero() {
+		return stateStyle.FillColor
+	}
+	var color canvas.StyleColor = style.FillColor
+	if data != nil && !data.Color.IsZero() {
+		return data.Color
+	}
+	var c canvas.Color
+	if r.LinkColor != nil {
+		c = r.LinkColor(link, data)
+	}
+	if c == nil && data != nil && data.Value.Valid {
+		c = r.Config.LinkColorScale.GetColor(data.Value.Value)
+	}
+	if c != nil {
+		color.SetColor(c)
+	}
+	return color
+}
+
+// Returns a key that is the same for links with the same route,
+// whichever way they run along it
+func bundleKey(link *Link) string {
+	route := link.Route
+	if link.To < link.From {
+		route = route.Reverse()
+	}
+	return fmt.Sprint(route)
+}
+
+// RenderUnroutedLink renders the given Link as a straight line
+// between the centers of its nodes, ignoring any route. The
+// nodes must have been rendered by [Renderer.RenderTopology].
+func (r *Renderer) RenderUnroutedLink(link *Link) (canvas.Object, error) {
+	from, hasFrom := r.nodeCenters[link.From]
+	to, hasTo := r.nodeCenters[link.To]
+	if !hasFrom || !hasTo {
+		return nil, nil
+	}
+
+	linkGroup := canvas.NewGroup()
+	r.setLinkId(&linkGroup.Attributes, link.Id)
+	linkGroup.Attributes.AddClass("link")
+	linkGroup.Attributes.AddClass("link-unrouted")
+	linkGroup.Attributes.SetExtra("data-from", string(link.From))
+	linkGroup.Attributes.SetExtra("data-to", string(link.To))
+	r.addClass(&linkGroup.Attributes, link.Class)
+
+	from = r.GridToCanvas(from).Add(r.nodeAnchors[link.From])
+	to = r.GridToCanvas(to).Add(r.nodeAnchors[link.To])
+
+	line := canvas.NewLine(from, to)
+	line.Attributes.AddClass("link-unrouted-line")
+	linkGroup.AppendChild(line)
 
 	return linkGroup, nil
 }
 
 // RenderNodeLabel renders the label for the given Node and returns a [canvas.Object]
 func (r *Renderer) RenderNodeLabel(node *Node) (canvas.Object, error) {
-	scale := r.GetScale()
-
 	style := r.getNodeStyle(node)
+	labelStyle := r.getNodeLabelStyle(node)
 
 	pos := vec.Vec2{X: float32(node.Pos[0]), Y: float32(node.Pos[1])}
 	if node.IsMultiCell() {
 		minPos, maxPos := node.GetExtents()
 		pos = minPos.Add(maxPos).Div(2)
 	}
-	labelPos := pos.Mul(scale)
+	labelPos := r.GridToCanvas(pos)
 	anchor := canvas.TextAnchorNone
-	offsetDist := (style.Size / 2) + style.StrokeWidth.Value
 
-	textSize := r.Config.NodeLabelStyle.Size
+	textSize := labelStyle.Size
 
 	// Calculate the offset from the node position
-	// by rotating a vector to the appropriate position
+	// by rotating a vector to the appropriate position,
+	// then moving it out to the edge of the node shape
 
-	offsetVec := vec.Vec2{X: offsetDist, Y: 0}
-	textAdjust := vec.Vec2{}
+	offsetVec := vec.Vec2{X: 1, Y: 0}
+	baseline := canvas.TextBaselineNone
 
 	// Don't place diagonal labels at the 45deg rotation,
 	// instead rotate them so they're closer to the vertical.
 	// This makes the association with the nodes slighly clearer.
 	// The angle 3π/8 is 67.5deg
 	var diagAngle float32 = (3 * math.Pi) / 8
-	switch node.LabelAt {
-	case "n":
+	// The label goes on the side of the node it appears on once the
+	// map is turned
+	switch r.screenDirection(node.LabelAt) {
+	case DirectionN:
 		offsetVec = offsetVec.Rotate(-math.Pi / 2)
 		anchor = canvas.TextAnchorMiddle
-	case "ne":
+		baseline = canvas.TextBaselineBottom
+	case DirectionNE:
 		offsetVec = offsetVec.Rotate(-diagAngle)
 		anchor = canvas.TextAnchorStart
-	case "e":
-		textAdjust.Y = textSize / 2
+		baseline = canvas.TextBaselineBottom
+	case DirectionE:
 		anchor = canvas.TextAnchorStart
-	case "se":
+		baseline = canvas.TextBaselineMiddle
+	case DirectionSE:
 		offsetVec = offsetVec.Rotate(diagAngle)
-		textAdjust.Y = textSize
 		anchor = canvas.TextAnchorStart
-	case "s":
+		baseline = canvas.TextBaselineTop
+	case DirectionS:
 		offsetVec = offsetVec.Rotate(math.Pi / 2)
-		textAdjust.Y = textSize
 		anchor = canvas.TextAnchorMiddle
-	case "sw":
+		baseline = canvas.TextBaselineTop
+	case DirectionSW:
 		offsetVec = offsetVec.Rotate(math.Pi - diagAngle)
-		textAdjust.Y = textSize
 		anchor = canvas.TextAnchorEnd
-	case "w":
+		baseline = canvas.TextBaselineTop
+	case DirectionW:
 		offsetVec = offsetVec.Rotate(math.Pi)
-		textAdjust.Y = textSize / 2
 		anchor = canvas.TextAnchorEnd
-	case "nw":
+		baseline = canvas.TextBaselineMiddle
+	case DirectionNW:
 		offsetVec = offsetVec.Rotate(math.Pi + diagAngle)
 		anchor = canvas.TextAnchorEnd
-	case "c":
+		baseline = canvas.TextBaselineBottom
+	case DirectionCenter:
 		if node.IsMultiCell() {
 			offsetVec = vec.Vec2{}
 			anchor = canvas.TextAnchorMiddle
-			textAdjust.Y = textSize / 2
 		}
 	}
 
+	offsetVec = r.mapVec(offsetVec)
+	offsetVec = offsetVec.Mul(r.nodeShapeDistance(node, style, offsetVec))
+
 	if anchor != canvas.TextAnchorNone {
-		labelPos = labelPos.Add(offsetVec).Add(textAdjust)
-		labelText := string(node.Id)
-		if node.Label != "" {
-			labelText = node.Label
+		labelPos = labelPos.Add(offsetVec)
+		labelText := r.nodeName(node)
+
+		var label canvas.Object
+		if node.LabelAt == DirectionCenter {
+			// Titles inside multi-cell nodes are wrapped to fit
+			minPos, maxPos := node.GetExtents()
+			size := r.screenVec(maxPos.Sub(minPos))
+			size.X = f32.Abs(size.X)
+			width := r.GridToCanvas(size).X - 2*style.StrokeWidth.Value
+			lines := canvas.WrapShapedText(labelText, textSize, width, labelStyle.shaping())
+			label = r.renderTextLines(labelPos, lines, textSize, labelStyle.shaping())
+		} else {
+			text := canvas.NewText(labelPos, labelText)
+			text.Anchor = anchor
+			text.Baseline = baseline
+			text.Size = textSize
+			text.Shaping = labelStyle.shaping()
+			label = text
+		}
+
+		attrs := label.GetAttributes()
+		attrs.AddClass("node-label-text")
+		r.addClass(attrs, node.Class)
+		if node.LabelStyle != nil {
+			attrs.Style = node.LabelStyle.textStyle()
 		}
-		label := canvas.NewText(labelPos, labelText)
-		label.Anchor = anchor
-		label.Size = textSize
-		label.Attributes.AddClass("node-label-text")
 
-		return label, nil
+		return r.keepUpright(label, labelPos), nil
 	}
 
 	return nil, nil
 }
 
-// RenderLinkLabel renders a link label at pos and returns a [canvas.Object]
-func (r *Renderer) RenderLinkLabel(pos vec.Vec2, text string) (canvas.Object, error) {
+// Returns the distance from the center of the node shape to the
+// outside of its border in the direction dir, which should be a
+// unit vector.
+func (r *Renderer) nodeShapeDistance(node *Node, style *NodeStyle, dir vec.Vec2) float32 {
+	border := style.StrokeWidth.Value
+	if !node.IsMultiCell() {
+		dist := (style.Size / 2) + border
+		// Labels are kept clear of icons sticking out of the node
+		if icon, ok := r.nodeIcon(node, style); ok {
+			iconDist := rectDistance(vec.Vec2{X: icon.Width / 2, Y: icon.Height / 2}, dir)
+			if icon.Replace {
+				dist = iconDist
+			} else {
+				dist = f32.Max(dist, iconDist)
+			}
+		}
+		return dist
+	}
 
-	size := r.Config.LinkLabelStyle.Size
-	radius := r.Config.LinkLabelStyle.BorderRadius
+	// Find where the ray from the center exits the rectangle
+	minPos, maxPos := node.GetExtents()
+	halfSize := maxPos.Sub(minPos).Mul(r.GetScale() / 2)
 
-	textPos := vec.Vec2{X: 0, Y: size / 2}
+	dist := rectDistance(halfSize, dir)
+	if dist == 0 {
+		return 0
+	}
 
-	textObj := canvas.NewText(textPos, text)
-	textObj.Anchor = canvas.TextAnchorMiddle
-	textObj.Size = size
-	textObj.Attributes.AddClass("link-label-text")
+	return dist + border
+}
 
-	width := r.Config.LinkLabelStyle.Width
-	height := size + 5
+// Returns the distance from the center of a rectangle to its edge in
+// the direction dir, or 0 if dir is zero
+func rectDistance(halfSize vec.Vec2, dir vec.Vec2) float32 {
+	dist := f32.Inf(1)
+	if dir.X != 0 {
+		dist = f32.Min(dist, halfSize.X/f32.Abs(dir.X))
+	}
+	if dir.Y != 0 {
+		dist = f32.Min(dist, halfSize.Y/f32.Abs(dir.Y))
+	}
+	if f32.IsInf(dist, 1) {
+		return 0
+	}
+	return dist
+}
+
+// Returns the name shown for the node. This is the node's label if
+// it has one, then its name from the config, then the name from
+// NodeName, and finally its id.
+func (r *Renderer) nodeName(node *Node) string {
+	if node.Label != "" {
+		return node.Label
+	}
+	if name, ok := r.Config.NodeNames[node.Id]; ok {
+		return name
+	}
+	if r.NodeName != nil {
+		if name := r.NodeName(node.Id); name != "" {
+			return name
+		}
+	}
+	return string(node.Id)
+}
+
+// Builds the tooltip text for a node from the configured
+// metadata fields. Returns "" if there are no fields to show.
+func (r *Renderer) nodeTooltip(node *Node) string {
+	if len(r.Config.NodeTooltip) == 0 {
+		return ""
+	}
+
+	lines := []string{}
+	for _, field := range r.Config.NodeTooltip {
+		val, ok := node.Meta[field.Key]
+		if !ok || val == nil {
+			continue
+		}
+		label := field.Label
+		if label == "" {
+			label = field.Key
+		}
+		lines = append(lines, fmt.Sprintf("%s: %v", label, val))
+	}
+
+	if len(lines) == 0 {
+		return ""
+	}
+
+	name := r.nodeName(node)
+
+	return name + "\n" + strings.Join(lines, "\n")
+}
+
+// RenderLinkLabel renders a link label at pos and returns a [canvas.Object]
+func (r *Renderer) RenderLinkLabel(pos vec.Vec2, text string) (canvas.Object, error) {
+	return r.renderLinkLabel(pos, text, &r.Config.LinkLabelStyle, nil, "")
+}
+
+// Renders a link label at pos with the given style. If ownStyle is
+// set, its font and color are set directly on the text, and if class
+// is set, it is added to the label's classes.
+func (r *Renderer) renderLinkLabel(pos vec.Vec2, text string, style, ownStyle *LabelStyle, class string) (canvas.Object, error) {
+
+	size := style.Size
+	radius := style.BorderRadius
+
+	width := style.Width
+
+	// Long labels are wrapped to fit in the box, which gets taller
+	// to fit them
+	lines := canvas.WrapShapedText(text, size, width, style.shaping())
+	textObj := r.renderTextLines(vec.Vec2{}, lines, size, style.shaping())
+	textAttrs := textObj.GetAttributes()
+	textAttrs.AddClass("link-label-text")
+	r.addClass(textAttrs, class)
+	if ownStyle != nil {
+		textAttrs.Style = ownStyle.textStyle()
+	}
+
+	height := size*float32(len(lines)) + 5
 	border := canvas.NewRect(vec.Vec2{X: -width / 2, Y: -height / 2}, width, height)
 	if radius > 0 {
 		radius = f32.Min(radius, height/2)
@@ -547,6 +1519,9 @@ func (r *Renderer) RenderLinkLabel(pos vec.Vec2, text string) (canvas.Object, er
 	border.Attributes.AddClass("link-label-box")
 
 	transform := vec.NewTranslate(pos)
+	if r.orientation != nil {
+		transform = r.unorient().Combine(transform)
+	}
 	labelGroup := canvas.NewGroup()
 	labelGroup.Transform = transform
 	labelGroup.Attributes.AddClass("link-label")
@@ -556,6 +1531,35 @@ func (r *Renderer) RenderLinkLabel(pos vec.Vec2, text string) (canvas.Object, er
 	return labelGroup, nil
 }
 
+// Renders lines of text centered on pos. A single line is a
+// [canvas.Text], otherwise the lines are grouped together.
+func (r *Renderer) renderTextLines(pos vec.Vec2, lines []string, size float32, shaping canvas.TextShaping) canvas.Object {
+	group := canvas.NewGroup()
+	for i, line := range lines {
+		y := (float32(i) - float32(len(lines)-1)/2) * size
+		text := canvas.NewText(pos.Add(vec.Vec2{X: 0, Y: y}), line)
+		text.Anchor = canvas.TextAnchorMiddle
+		text.Baseline = canvas.TextBaselineMiddle
+		text.Size = size
+		text.Shaping = shaping
+		if len(lines) == 1 {
+			return text
+		}
+		group.AppendChild(text)
+	}
+	return group
+}
+
+// Returns the keys of the map in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
 // Sets the styles configured in the Renderer to the canvas
 //
 // The following classes are created in the canvas:
@@ -564,28 +1568,41 @@ func (r *Renderer) RenderLinkLabel(pos vec.Vec2, text string) (canvas.Object, er
 //   - "link-segment" - Styles that apply to all link segments
 //   - "node-label-text" - Styles that apply to all node labels
 //   - "link-label-text" - Styles that apply to all link labels
+//   - "node-label-text" and "link-label-text" with a class - Label
+//     styles for the class
 //   - "link-label-box" - Styles that apply to all link labels
+//   - "link-unrouted-line" - Styles that apply to links drawn without a route
+//
+// The configured icons are also added to the canvas as symbols, for
+// the nodes to draw.
 func (r *Renderer) SetStyles(c *canvas.Canvas) {
 	c.Stylesheet.AddRule(canvas.Selector{"node"}, r.Config.DefaultNodeStyle.Style)
-	for cls, style := range r.Config.NodeStyles {
-		sel := canvas.Selector{"node", cls}
-		c.Stylesheet.AddRule(sel, style.Style)
+	// The classes are added in order, since the order of rules with
+	// the same specificity shows in the output
+	for _, cls := range sortedKeys(r.Config.NodeStyles) {
+		sel := canvas.Selector{"node", r.svgName(cls)}
+		c.Stylesheet.AddRule(sel, r.Config.NodeStyles[cls].Style)
 	}
 	c.Stylesheet.AddRule(canvas.Selector{"link-segment"}, r.Config.DefaultLinkStyle.Style)
-	for cls, style := range r.Config.LinkStyles {
-		sel := canvas.Selector{"link-segment", cls}
-		c.Stylesheet.AddRule(sel, style.Style)
+	for _, cls := range sortedKeys(r.Config.LinkStyles) {
+		sel := canvas.Selector{"link-segment", r.svgName(cls)}
+		c.Stylesheet.AddRule(sel, r.Config.LinkStyles[cls].Style)
 	}
 
-	nodeLabelStyle := canvas.NewStyle()
-	nodeLabelStyle.FillColor.SetColor(r.Config.NodeLabelStyle.Color)
-	nodeLabelStyle.FontFamily = r.Config.NodeLabelStyle.FontFamily
-	c.Stylesheet.AddRule(canvas.Selector{"node-label-text"}, nodeLabelStyle)
+	c.Stylesheet.AddRule(canvas.Selector{"node-label-text"}, r.Config.NodeLabelStyle.textStyle())
+	for _, cls := range sortedKeys(r.Config.NodeLabelStyles) {
+		sel := canvas.Selector{"node-label-text", r.svgName(cls)}
+		style := r.Config.NodeLabelStyles[cls]
+		c.Stylesheet.AddRule(sel, style.textStyle())
+	}
 
-	linkLabelTextStyle := canvas.NewStyle()
-	linkLabelTextStyle.FillColor.SetColor(r.Config.LinkLabelStyle.Color)
-	linkLabelTextStyle.FontFamily = r.Config.LinkLabelStyle.FontFamily
-	c.Stylesheet.AddRule(canvas.Selector{"link-label-text"}, linkLabelTextStyle)
+	c.Stylesheet.AddRule(canvas.Selector{"link-label-text"}, r.Config.LinkLabelStyle.textStyle())
+	c.Stylesheet.AddRule(canvas.Selector{"link-end-label"}, r.Config.LinkEndLabelStyle.textStyle())
+	for _, cls := range sortedKeys(r.Config.LinkLabelStyles) {
+		sel := canvas.Selector{"link-label-text", r.svgName(cls)}
+		style := r.Config.LinkLabelStyles[cls]
+		c.Stylesheet.AddRule(sel, style.textStyle())
+	}
 
 	linkLabelBoxStyle := canvas.NewStyle()
 	linkLabelBoxStyle.FillColor.SetColor(r.Config.LinkLabelStyle.Background)
@@ -593,6 +1610,71 @@ func (r *Renderer) SetStyles(c *canvas.Canvas) {
 	linkLabelBoxStyle.Opacity.Set(r.Config.LinkLabelStyle.Opacity)
 	linkLabelBoxStyle.StrokeWidth.Set(1)
 	c.Stylesheet.AddRule(canvas.Selector{"link-label-box"}, linkLabelBoxStyle)
+
+	r.addIconSymbols(c)
+
+	if r.Config.TrunkThreshold > 0 {
+		c.Stylesheet.AddRule(canvas.Selector{"link-trunk"}, r.Config.DefaultLinkStyle.Style)
+	}
+
+	if r.Config.RenderUnrouted {
+		unroutedStyle := canvas.NewStyle()
+		unroutedStyle.StrokeColor = r.Config.DefaultLinkStyle.FillColor
+		unroutedStyle.StrokeWidth.Set(2)
+		unroutedStyle.StrokeDashArray = []float32{6, 4}
+		c.Stylesheet.AddRule(canvas.Selector{"link-unrouted-line"}, unroutedStyle)
+	}
+}
+
+// SanitizeId is an [IdSanitizer] that keeps ASCII letters, digits and
+// '-', and replaces every other byte with '_' followed by its value in
+// two hex digits, so "a b" becomes "a_20b" and "a_b" becomes "a_5fb".
+// A leading digit is replaced too, as names can't start with one.
+// Different names always give different results.
+func SanitizeId(id string) string {
+	var b strings.Builder
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '-':
+			b.WriteByte(c)
+		case c >= '0' && c <= '9' && i > 0:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "_%02x", c)
+		}
+	}
+	return b.String()
+}
+
+// Returns name as it is used in SVG ids and classes
+func (r *Renderer) svgName(name string) string {
+	if r.SanitizeId == nil {
+		return name
+	}
+	return r.SanitizeId(name)
+}
+
+// Adds a class from the topology to attrs, if it is set. If the
+// class has to be changed, the original is kept in data-class.
+func (r *Renderer) addClass(attrs *canvas.Attributes, class string) {
+	if class == "" {
+		return
+	}
+	name := r.svgName(class)
+	attrs.AddClass(name)
+	if name != class {
+		attrs.SetExtra("data-class", class)
+	}
+}
+
+// Sets the id of a link's group. If the link id has to be changed,
+// the original is kept in data-link.
+func (r *Renderer) setLinkId(attrs *canvas.Attributes, id LinkId) {
+	attrs.Id = r.svgName(string("L-" + id))
+	if attrs.Id != string("L-"+id) {
+		attrs.SetExtra("data-link", string(id))
+	}
 }
 
 // Helper function for rendering shapes in grid-space at the appropriate scale.
@@ -649,6 +1731,134 @@ func (r *Renderer) RenderShape(radius float32, paths ...vec.Polyline) canvas.Obj
 	return pathObj
 }
 
+// RenderDensity renders a debug overlay that shades each cell by the
+// number of links passing through it, as returned by
+// [LinkRouter.LinkDensity]. Colors come from the link color scale,
+// with the busiest cell at 1.
+func (r *Renderer) RenderDensity(density grid.Grid[int]) canvas.Object {
+	densityGroup := canvas.NewGroup()
+	densityGroup.Attributes.Id = "link-density"
+	densityGroup.Attributes.EnsureStyle()
+	densityGroup.Attributes.Style.Opacity.Set(0.5)
+
+	maxCount := 0
+	cells := make([]grid.Pos, 0, len(density))
+	for pos, count := range density {
+		maxCount = max(maxCount, count)
+		cells = append(cells, pos)
+	}
+	if maxCount == 0 {
+		return densityGroup
+	}
+
+	// Sort the cells to keep the output consistent
+	slices.SortFunc(cells, func(a, b grid.Pos) int {
+		if a.Y != b.Y {
+			return int(a.Y) - int(b.Y)
+		}
+		return int(a.X) - int(b.X)
+	})
+
+	scale := r.GetScale()
+	for _, pos := range cells {
+		count := density[pos]
+		cellMin := r.GridToCanvas(pos.ToVec().Sub(vec.Vec2{X: 0.5, Y: 0.5}))
+		cell := canvas.NewSquare(cellMin, scale)
+		cell.Attributes.EnsureStyle()
+		cell.Attributes.Style.FillColor.SetColor(
+			r.Config.LinkColorScale.GetColor(float32(count) / float32(maxCount)))
+		cell.Attributes.SetExtra("data-count", count)
+		densityGroup.AppendChild(cell)
+	}
+
+	return densityGroup
+}
+
+// RenderOccupancy renders a debug overlay of what the router knows
+// about each cell, as returned by [LinkRouter.Occupancy]. Nodes,
+// node labels, obstacles and keep-outs are each given their own
+// color, otherwise cells are shaded by the number of links and link
+// labels in them using the link color scale. Each cell has a title
+// listing what is in it.
+func (r *Renderer) RenderOccupancy(occupancy grid.Grid[CellOccupancy]) canvas.Object {
+	group := canvas.NewGroup()
+	group.Attributes.Id = "router-occupancy"
+	group.Attributes.EnsureStyle()
+	group.Attributes.Style.Opacity.Set(0.5)
+
+	maxCount := 0
+	cells := make([]grid.Pos, 0, len(occupancy))
+	for pos, cell := range occupancy {
+		maxCount = max(maxCount, len(cell.Links)+len(cell.LinkLabels))
+		cells = append(cells, pos)
+	}
+
+	// Sort the cells to keep the output consistent
+	slices.SortFunc(cells, func(a, b grid.Pos) int {
+		if a.Y != b.Y {
+			return int(a.Y) - int(b.Y)
+		}
+		return int(a.X) - int(b.X)
+	})
+
+	scale := r.GetScale()
+	for _, pos := range cells {
+		cell := occupancy[pos]
+
+		var color canvas.Color
+		var title []string
+		if cell.Obstacle {
+			color = canvas.HSL(0, 0, 0.2)
+			title = append(title, "obstacle")
+		}
+		if cell.Node != "" {
+			color = canvas.HSL(0, 0, 0.5)
+			title = append(title, fmt.Sprintf("node %s", cell.Node))
+		}
+		if cell.NodeLabel {
+			color = canvas.HSL(210, 0.6, 0.6)
+			title = append(title, "node label")
+		}
+		if len(cell.KeepOut) > 0 {
+			if color == nil {
+				color = canvas.HSL(30, 0.8, 0.8)
+			}
+			title = append(title, fmt.Sprintf("keep out of %s", joinIds(cell.KeepOut)))
+		}
+		if len(cell.LinkLabels) > 0 {
+			title = append(title, fmt.Sprintf("labels of %s", joinIds(cell.LinkLabels)))
+		}
+		if len(cell.Links) > 0 {
+			title = append(title, fmt.Sprintf("links %s", joinIds(cell.Links)))
+		}
+		if len(cell.WideLinks) > 0 {
+			title = append(title, fmt.Sprintf("beside wide links %s", joinIds(cell.WideLinks)))
+		}
+		if color == nil {
+			count := len(cell.Links) + len(cell.LinkLabels)
+			color = r.Config.LinkColorScale.GetColor(float32(count) / float32(maxCount))
+		}
+
+		cellMin := r.GridToCanvas(pos.ToVec().Sub(vec.Vec2{X: 0.5, Y: 0.5}))
+		square := canvas.NewSquare(cellMin, scale)
+		square.Attributes.EnsureStyle()
+		square.Attributes.Style.FillColor.SetColor(color)
+		square.Attributes.Title = strings.Join(title, "\n")
+		group.AppendChild(square)
+	}
+
+	return group
+}
+
+// Joins ids with commas, for debug output
+func joinIds[T ~string](ids []T) string {
+	strs := make([]string, len(ids))
+	for i, id := range ids {
+		strs[i] = string(id)
+	}
+	return strings.Join(strs, ", ")
+}
+
 func (r *Renderer) RenderGrid(bounds *canvas.AABB) canvas.Object {
 	gridGroup := canvas.NewGroup()
 	attrs := &gridGroup.Attributes
@@ -682,6 +1892,13 @@ func (r *Renderer) RenderGrid(bounds *canvas.AABB) canvas.Object {
 	return gridGroup
 }
 
+// LinkSize returns the size the link is drawn at, from its own style,
+// its class's style or the default style. It can be used as the
+// [LinkRouter.LinkSize] of a router.
+func (r *Renderer) LinkSize(link *Link) float32 {
+	return r.getLinkStyle(link).Size
+}
+
 func (r *Renderer) getLinkStyle(link *Link) *LinkStyle {
 	style := &LinkStyle{
 		Style: canvas.NewStyle(),
@@ -712,6 +1929,10 @@ func (r *Renderer) getNodeStyle(node *Node) *NodeStyle {
 		*style = *node.Style
 	}
 
+	if sizes := r.Config.NodeWeightSizes; sizes != nil && node.Weight != nil && style.Size == 0 {
+		style.Size = sizes.Size(*node.Weight)
+	}
+
 	if node.Class != "" {
 		classStyle, ok := r.Config.NodeStyles[node.Class]
 		if ok {
@@ -724,6 +1945,52 @@ func (r *Renderer) getNodeStyle(node *Node) *NodeStyle {
 	return style
 }
 
+// Returns the label style for the node, the node's own label style
+// takes priority over its class's, then the default
+func (r *Renderer) getNodeLabelStyle(node *Node) *LabelStyle {
+	style := &LabelStyle{}
+
+	if node.LabelStyle != nil {
+		*style = *node.LabelStyle
+	}
+
+	if sizes := r.Config.NodeWeightSizes; sizes != nil && node.Weight != nil && style.Size == 0 {
+		style.Size = sizes.LabelSize(*node.Weight)
+	}
+
+	if node.Class != "" {
+		classStyle, ok := r.Config.NodeLabelStyles[node.Class]
+		if ok {
+			style.merge(&classStyle)
+		}
+	}
+
+	style.merge(&r.Config.NodeLabelStyle)
+
+	return style
+}
+
+// Returns the label style for the link, the link's own label style
+// takes priority over its class's, then the default
+func (r *Renderer) getLinkLabelStyle(link *Link) *LabelStyle {
+	style := &LabelStyle{}
+
+	if link.LabelStyle != nil {
+		*style = *link.LabelStyle
+	}
+
+	if link.Class != "" {
+		classStyle, ok := r.Config.LinkLabelStyles[link.Class]
+		if ok {
+			style.merge(&classStyle)
+		}
+	}
+
+	style.merge(&r.Config.LinkLabelStyle)
+
+	return style
+}
+
 func (r *Renderer) getNodeSize(nodeId NodeId) float32 {
 	if r.nodeSizes == nil {
 		return r.Config.DefaultNodeStyle.Size
@@ -744,6 +2011,12 @@ func (s *NodeStyle) merge(other *NodeStyle) {
 	if s.Size == 0 {
 		s.Size = other.Size
 	}
+	if s.Shape == "" {
+		s.Shape = other.Shape
+	}
+	if s.Icon == "" {
+		s.Icon = other.Icon
+	}
 }
 
 func (s *LinkStyle) merge(other *LinkStyle) {
@@ -757,185 +2030,203 @@ func (s *LinkStyle) merge(other *LinkStyle) {
 	if !s.Radius.Valid {
 		s.Radius = other.Radius
 	}
+	if !s.SplitTolerance.Valid {
+		s.SplitTolerance = other.SplitTolerance
+	}
+	if !s.ArrowRatio.Valid {
+		s.ArrowRatio = other.ArrowRatio
+	}
+	if !s.ArrowMinRun.Valid {
+		s.ArrowMinRun = other.ArrowMinRun
+	}
+	if s.Curve == "" {
+		s.Curve = other.Curve
+	}
+	if s.Dash == "" {
+		s.Dash = other.Dash
+	}
+	if s.Draw == "" {
+		s.Draw = other.Draw
+	}
 }
 
-func renderArrow(route vec.Polyline, width, radius float32) *canvas.Path {
-	if len(route) < 2 {
+// Returns the dash pattern for lines width wide drawn with the style,
+// or nil for solid lines
+func (s *LinkStyle) dashArray(width float32) []float32 {
+	if s.StrokeDashArray != nil {
+		return s.StrokeDashArray
+	}
+	width = f32.Max(width, 1)
+	switch s.Dash {
+	case "dashed":
+		return []float32{width * 3, width * 2}
+	case "dotted":
+		return []float32{width, width}
+	default:
 		return nil
 	}
+}
 
-	path := canvas.NewPath()
-
-	path.Attributes.Style = canvas.NewStyle()
-
-	halfWidth := width / 2
-
-	// The last point on the line is the point of the arrow
-	// We essentially remove that point and replace it with
-	// one offset from the end
-	arrowPoint := route[len(route)-1]
-	prevPoint := route[len(route)-2]
-
-	dir := arrowPoint.Sub(prevPoint)
-	dirLen := dir.Length()
-	dir = dir.Div(dirLen)
-
-	if dirLen > halfWidth {
-		// The common case where we have enough room to simply
-		// move the point back without crashing into an existing
-		// point
-		route[len(route)-1] = arrowPoint.Sub(dir.Mul(halfWidth))
-	} else {
-		// If we don't have enough room to move the end point back,
-		// we need to fallback to the general solution of finding
-		// the point to split at and using that instead.
-		backOffT := halfWidth / route.Length()
-
-		route, _ = route.SplitAt(1 - backOffT)
-
+// Fills in the unset values of s from other
+func (s *LabelStyle) merge(other *LabelStyle) {
+	if s.Size == 0 {
+		s.Size = other.Size
 	}
-
-	route = route.Simplify()
-
-	if len(route) < 2 {
-		return nil
+	if s.Color == nil {
+		s.Color = other.Color
 	}
-
-	// Helper function for adding points to the path
-	addPoint := func(prevIdx, curIdx, nextIdx int) {
-		curPoint := route[curIdx]
-
-		if prevIdx < 0 || prevIdx >= len(route) {
-			// curPoint is the first point in the path
-			nextPoint := route[nextIdx]
-			dir := nextPoint.Sub(curPoint).Normalized()
-
-			curPoint = curPoint.Add(dir.Norm().Mul(halfWidth))
-			// LineTo works here because the first LineTo is actually
-			// a MoveTo
-			path.LineTo(curPoint)
-		} else if nextIdx < 0 || nextIdx >= len(route) {
-			// curPoint is the last point in the path
-			prevPoint := route[prevIdx]
-			dir := curPoint.Sub(prevPoint).Normalized()
-
-			curPoint = curPoint.Add(dir.Norm().Mul(halfWidth))
-			path.LineTo(curPoint)
-		} else {
-			// curPoint is in the middle of the path
-			prevPoint := route[prevIdx]
-			nextPoint := route[nextIdx]
-
-			prevDir := curPoint.Sub(prevPoint).Normalized()
-			nextDir := nextPoint.Sub(curPoint).Normalized()
-
-			// Unless the neighbour points are the ends of the
-			// route, we need to ensure that the path doesn't
-			// double-back on itself. We do this by taking the mid
-			// points of the neighbours and curPoint as the maximum
-			// extents of the corner.
-			if prevIdx > 0 && prevIdx < len(route)-1 {
-				prevPoint = prevPoint.Add(curPoint).Div(2)
-			}
-
-			if nextIdx > 0 && nextIdx < len(route)-1 {
-				nextPoint = curPoint.Add(nextPoint).Div(2)
-			}
-
-			prevNorm := prevDir.Norm()
-			nextNorm := nextDir.Norm()
-
-			cornerStart := prevPoint.Add(prevNorm.Mul(halfWidth))
-			cornerEnd := nextPoint.Add(nextNorm.Mul(halfWidth))
-
-			offsetVec := prevNorm.Add(nextNorm).Normalized()
-			cornerOffset := halfWidth / offsetVec.Dot(prevNorm)
-
-			cornerPeak := curPoint.Add(offsetVec.Mul(cornerOffset))
-
-			r := radius
-			cornerNorm := cornerEnd.Sub(cornerStart).Norm()
-			if cornerNorm.Dot(cornerPeak.Sub(cornerStart)) > 0 {
-				r += halfWidth
-			} else {
-				r -= halfWidth
-			}
-
-			path.RoundCorner(r, cornerStart, cornerPeak, cornerEnd)
-		}
+	if s.FontFamily == "" {
+		s.FontFamily = other.FontFamily
 	}
-
-	// Go around one side of the arrow
-	for i := 0; i < len(route); i++ {
-		addPoint(i-1, i, i+1)
+	if s.Background == nil {
+		s.Background = other.Background
 	}
+	if s.Border == nil {
+		s.Border = other.Border
+	}
+	if s.BorderRadius == 0 {
+		s.BorderRadius = other.BorderRadius
+	}
+	if s.Width == 0 {
+		s.Width = other.Width
+	}
+	if s.Opacity == 0 {
+		s.Opacity = other.Opacity
+	}
+	if s.FontVariantNumeric == "" {
+		s.FontVariantNumeric = other.FontVariantNumeric
+	}
+	if s.FontKerning == "" {
+		s.FontKerning = other.FontKerning
+	}
+}
 
-	// Draw a line to the point of the arrow
-	path.LineTo(arrowPoint)
-
-	// Draw the other size of the arrow
-	for i := len(route) - 1; i >= 0; i-- {
-		addPoint(i+1, i, i-1)
+// Returns the shaping of the label's text
+func (s *LabelStyle) shaping() canvas.TextShaping {
+	return canvas.TextShaping{
+		TabularNumbers: s.FontVariantNumeric == "tabular-nums",
+		NoKerning:      s.FontKerning == "none",
 	}
+}
 
-	// Finish
-	return path.ClosePath()
+// Returns the style for the text of a label
+func (s *LabelStyle) textStyle() *canvas.Style {
+	style := canvas.NewStyle()
+	if s.Color != nil {
+		style.FillColor.SetColor(s.Color)
+	}
+	style.FontFamily = s.FontFamily
+	return style
 }
 
-// Find an appropriate split point along route starting from startPos and
-// return the split lines (with the second one reversed).
-//
-// findSplit will avoid a split point closer than splitTolerance from a
-// corner.
-func findSplit(route vec.Polyline, startPos float32, splitTolerance float32) (vec.Polyline, vec.Polyline) {
-	route = route.Simplify()
+func (s *LabelStyle) UnmarshalJSON(data []byte) error {
+	return canvas.UnmarshalColorStruct(data, s)
+}
 
-	route1, route2 := route.SplitAt(startPos)
+// The embedded style's MarshalJSON would otherwise be used for the
+// whole node style, leaving out the size
+func (s *NodeStyle) MarshalJSON() ([]byte, error) {
+	fields := struct {
+		Size  float32 `json:"size"`
+		Shape string  `json:"shape,omitempty"`
+		Icon  string  `json:"icon,omitempty"`
+	}{s.Size, s.Shape, s.Icon}
+	return marshalWithStyle(fields, s.Style)
+}
 
-	// Check if the split point is itself a corner
-	splitP := route2[0]
-	for _, p := range route {
-		if p == splitP {
-			// The split point is a corner, move the split point a tiny amount
-			// and split again
-			route1, route2 = route.SplitAt(startPos + 0.005)
-			break
-		}
+// Checks the node style's shape is one that can be drawn
+func (s *NodeStyle) UnmarshalJSON(data []byte) error {
+	type nodeStyle NodeStyle
+	if err := json.Unmarshal(data, (*nodeStyle)(s)); err != nil {
+		return err
 	}
+	switch s.Shape {
+	case "", "circle", "square", "rounded-rect", "diamond", "hexagon":
+	default:
+		return fmt.Errorf("Unknown shape '%s', expected 'circle', 'square', 'rounded-rect', 'diamond' or 'hexagon'", s.Shape)
+	}
+	return nil
+}
 
-	route1 = route1.Simplify()
-	route2 = route2.Simplify()
-
-	seg1Length := route1[len(route1)-1].Sub(route1[len(route1)-2]).Length()
-	seg2Length := route2[0].Sub(route2[1]).Length()
+// Like [NodeStyle.MarshalJSON], the link style's own fields need
+// to be added to the embedded style's
+func (s *LinkStyle) MarshalJSON() ([]byte, error) {
+	fields := struct {
+		Size           float32        `json:"size"`
+		Radius         LinkRadius     `json:"radius"`
+		SplitTolerance option.Float32 `json:"split-tolerance"`
+		ArrowRatio     option.Float32 `json:"arrow-ratio"`
+		ArrowMinRun    option.Float32 `json:"arrow-min-run"`
+		Curve          string         `json:"curve,omitempty"`
+		Dash           string         `json:"dash,omitempty"`
+		Draw           string         `json:"draw,omitempty"`
+	}{s.Size, s.Radius, s.SplitTolerance, s.ArrowRatio, s.ArrowMinRun, s.Curve, s.Dash, s.Draw}
+	return marshalWithStyle(&fields, s.Style)
+}
 
-	didAdjust := false
-	if seg1Length < splitTolerance {
-		adjustment := (splitTolerance - seg1Length) / route1.Length()
-		newPos := startPos + adjustment
-		if newPos < 1 && newPos > 0 {
-			route1, route2 = route.SplitAt(newPos)
-			didAdjust = true
-		}
+// Checks the link style's fields that can only have certain values
+func (s *LinkStyle) UnmarshalJSON(data []byte) error {
+	type linkStyle LinkStyle
+	if err := json.Unmarshal(data, (*linkStyle)(s)); err != nil {
+		return err
+	}
+	switch s.Curve {
+	case "", "catmull-rom", "bezier":
+	default:
+		return fmt.Errorf("Unknown curve '%s', expected 'catmull-rom' or 'bezier'", s.Curve)
+	}
+	switch s.Dash {
+	case "", "dashed", "dotted":
+	default:
+		return fmt.Errorf("Unknown dash '%s', expected 'dashed' or 'dotted'", s.Dash)
 	}
-	if !didAdjust && seg2Length < splitTolerance {
-		adjustment := (splitTolerance - seg2Length) / route2.Length()
-		newPos := startPos - adjustment
-		if newPos < 1 && newPos > 0 {
-			route1, route2 = route.SplitAt(newPos)
-			didAdjust = true
+	switch s.Draw {
+	case "", "arrow", "centerline":
+	default:
+		return fmt.Errorf("Unknown draw '%s', expected 'arrow' or 'centerline'", s.Draw)
+	}
+	for _, field := range []struct {
+		name  string
+		value option.Float32
+	}{
+		{"split-tolerance", s.SplitTolerance},
+		{"arrow-ratio", s.ArrowRatio},
+		{"arrow-min-run", s.ArrowMinRun},
+	} {
+		if field.value.Valid && field.value.Value < 0 {
+			return fmt.Errorf("Invalid %s %v, it must not be negative", field.name, field.value.Value)
 		}
 	}
+	return nil
+}
 
-	if didAdjust {
-		route1 = route1.Simplify()
-		route2 = route2.Simplify()
+// Marshals fields and style into a single object. Fields that are
+// null are left out, as with [canvas.Style.MarshalJSON].
+func marshalWithStyle(fields any, style *canvas.Style) ([]byte, error) {
+	obj := map[string]json.RawMessage{}
+	if style != nil {
+		data, err := style.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &obj); err != nil {
+			return nil, err
+		}
 	}
 
-	slices.Reverse(route2)
-	return route1, route2
-}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	own := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &own); err != nil {
+		return nil, err
+	}
+	for key, value := range own {
+		if string(value) != "null" {
+			obj[key] = value
+		}
+	}
 
-func (s *LabelStyle) UnmarshalJSON(data []byte) error {
-	return canvas.UnmarshalColorStruct(data, s)
+	return json.Marshal(obj)
 }
@@ -0,0 +1,1642 @@
+package raumata_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	. "github.com/REANNZ/raumata"
+	"github.com/REANNZ/raumata/canvas"
+	"github.com/REANNZ/raumata/vec"
+)
+
+func TestNodeLabelClearsMultiCellNode(t *testing.T) {
+	renderer := NewRenderer()
+	scale := renderer.GetScale()
+
+	node := &Node{
+		Id:      "A",
+		Pos:     &[2]int16{0, 0},
+		Extents: &NodeExtents{Width: 5, Height: 1},
+	}
+
+	for _, dir := range []Direction{DirectionE, DirectionNE, DirectionSE, DirectionW, DirectionNW, DirectionSW} {
+		node.LabelAt = dir
+		obj, err := renderer.RenderNodeLabel(node)
+		if err != nil {
+			t.Fatalf("Error rendering label: %s", err)
+		}
+
+		// The node spans 2.5 grid cells either side of the center
+		// horizontally, and 0.5 vertically
+		label := obj.(*canvas.Text)
+		insideX := label.Pos.X > -2.5*scale && label.Pos.X < 2.5*scale
+		insideY := label.Pos.Y > -0.5*scale && label.Pos.Y < 0.5*scale
+		if insideX && insideY {
+			t.Errorf("Label at %q overlaps node, pos = %s", dir, label.Pos)
+		}
+	}
+}
+
+func TestRenderUnroutedLinks(t *testing.T) {
+	topo := &Topology{
+		Nodes: map[NodeId]*Node{
+			"A": {Id: "A", Pos: &[2]int16{0, 0}},
+			"B": {Id: "B", Pos: &[2]int16{4, 0}},
+		},
+		Links: map[LinkId]*Link{
+			"A-B": {Id: "A-B", From: "A", To: "B"},
+		},
+	}
+
+	renderer := NewRenderer()
+
+	countLinks := func() int {
+		obj, err := renderer.RenderTopology(topo)
+		if err != nil {
+			t.Fatalf("Error rendering topology: %s", err)
+		}
+		linkGroup := obj.(*canvas.Group).Children[0].(*canvas.Group)
+		return len(linkGroup.Children)
+	}
+
+	if n := countLinks(); n != 0 {
+		t.Errorf("Expected unrouted link to be skipped, got %d links", n)
+	}
+
+	renderer.Config.RenderUnrouted = true
+	if n := countLinks(); n != 1 {
+		t.Errorf("Expected unrouted link to be rendered, got %d links", n)
+	}
+}
+
+func TestRenderLocalCoordinates(t *testing.T) {
+	link := &Link{
+		Id:    "A-B",
+		From:  "A",
+		To:    "B",
+		Route: vec.Polyline{{X: 20000, Y: 20000}, {X: 20003, Y: 20000}, {X: 20005, Y: 20002}},
+	}
+
+	config := DefaultRenderConfig()
+	config.LocalCoordinates = true
+	renderer := NewRendererWithConfig(config)
+	scale := renderer.GetScale()
+
+	obj, err := renderer.RenderLink(link)
+	if err != nil {
+		t.Fatalf("Error rendering link: %s", err)
+	}
+
+	group := obj.(*canvas.Group)
+	offset, ok := group.Transform.GetTranslation()
+	if !ok || offset != link.Route[0].Mul(scale) {
+		t.Errorf("Expected the link to be translated to its start, got %v", group.Transform)
+	}
+
+	// Everything drawn inside the group should be close to the origin
+	c := canvas.NewCanvas()
+	c.AppendChild(canvas.NewGroup())
+	c.Children[0].(*canvas.Group).Children = group.Children
+	for _, op := range c.Flatten() {
+		for _, contour := range op.Contours {
+			for _, p := range contour.Points {
+				if p.Length() > 10*scale {
+					t.Errorf("Point %v not in local coordinates", p)
+				}
+			}
+		}
+	}
+}
+
+func TestRenderBundleSpacing(t *testing.T) {
+	route := vec.Polyline{{X: 0, Y: 0}, {X: 4, Y: 0}}
+	links := []*Link{
+		{Id: "A-B", From: "A", To: "B", Route: route},
+		{Id: "A-B-2", From: "A", To: "B", Route: route},
+		{Id: "B-A", From: "B", To: "A", Route: route.Reverse()},
+	}
+	topo := &Topology{
+		Nodes: map[NodeId]*Node{
+			"A": {Id: "A", Pos: &[2]int16{0, 0}},
+			"B": {Id: "B", Pos: &[2]int16{4, 0}},
+		},
+		Links: map[LinkId]*Link{},
+	}
+	for _, link := range links {
+		topo.Links[link.Id] = link
+	}
+
+	config := DefaultRenderConfig()
+	config.BundleSpacing = 10
+	renderer := NewRendererWithConfig(config)
+
+	// Render the topology first so the bundles are known
+	if _, err := renderer.RenderTopology(topo); err != nil {
+		t.Fatalf("Error rendering topology: %s", err)
+	}
+
+	// Each link should be drawn at a different height, spaced apart
+	heights := []float32{}
+	for _, link := range links {
+		obj, err := renderer.RenderLink(link)
+		if err != nil {
+			t.Fatalf("Error rendering link: %s", err)
+		}
+		c := canvas.NewCanvas()
+		c.AppendChild(obj)
+
+		var sum float32
+		var count int
+		for _, op := range c.Flatten() {
+			for _, contour := range op.Contours {
+				for _, p := range contour.Points {
+					sum += p.Y
+					count += 1
+				}
+			}
+		}
+		heights = append(heights, sum/float32(count))
+	}
+
+	slices.Sort(heights)
+	for i := 1; i < len(heights); i++ {
+		if gap := heights[i] - heights[i-1]; gap < 9 || gap > 11 {
+			t.Errorf("Expected links 10 apart, got heights %v", heights)
+		}
+	}
+}
+
+func TestRenderDirectedPairs(t *testing.T) {
+	route := vec.Polyline{{X: 0, Y: 0}, {X: 4, Y: 0}}
+	topo := &Topology{
+		Nodes: map[NodeId]*Node{
+			"A": {Id: "A", Pos: &[2]int16{0, 0}},
+			"B": {Id: "B", Pos: &[2]int16{4, 0}},
+		},
+		Links: map[LinkId]*Link{
+			"A-B": {Id: "A-B", From: "A", To: "B", Route: route},
+			"B-A": {Id: "B-A", From: "B", To: "A", Route: route.Reverse()},
+		},
+	}
+
+	config := DefaultRenderConfig()
+	config.BundleSpacing = 10
+	config.DirectedPairs = true
+	renderer := NewRendererWithConfig(config)
+
+	if _, err := renderer.RenderTopology(topo); err != nil {
+		t.Fatalf("Error rendering topology: %s", err)
+	}
+
+	height := func(id LinkId) float32 {
+		obj, err := renderer.RenderLink(topo.Links[id])
+		if err != nil {
+			t.Fatalf("Error rendering link: %s", err)
+		}
+		c := canvas.NewCanvas()
+		c.AppendChild(obj)
+
+		var sum float32
+		var count int
+		for _, op := range c.Flatten() {
+			for _, contour := range op.Contours {
+				for _, p := range contour.Points {
+					sum += p.Y
+					count += 1
+				}
+			}
+		}
+		return sum / float32(count)
+	}
+
+	// With the y axis pointing down, the right of A to B is below the
+	// route, and the right of B to A is above it
+	if h := height("A-B"); h < 4 || h > 6 {
+		t.Errorf("Expected A-B 5 below the route, got %v", h)
+	}
+	if h := height("B-A"); h < -6 || h > -4 {
+		t.Errorf("Expected B-A 5 above the route, got %v", h)
+	}
+}
+
+func TestRenderNodeAnchor(t *testing.T) {
+	link := &Link{
+		Id:    "A-B",
+		From:  "A",
+		To:    "B",
+		Route: vec.Polyline{{X: 0, Y: 0}, {X: 0, Y: 4}},
+	}
+	topo := &Topology{
+		Nodes: map[NodeId]*Node{
+			"A": {Id: "A", Pos: &[2]int16{0, 0}, Anchor: &[2]float32{0, 15}},
+			"B": {Id: "B", Pos: &[2]int16{0, 4}},
+		},
+		Links: map[LinkId]*Link{"A-B": link},
+	}
+
+	renderer := NewRenderer()
+	scale := renderer.GetScale()
+	if _, err := renderer.RenderTopology(topo); err != nil {
+		t.Fatalf("Error rendering topology: %s", err)
+	}
+
+	obj, err := renderer.RenderLink(link)
+	if err != nil {
+		t.Fatalf("Error rendering link: %s", err)
+	}
+	c := canvas.NewCanvas()
+	c.AppendChild(obj)
+
+	minY, maxY := float32(1e9), float32(-1e9)
+	for _, op := range c.Flatten() {
+		for _, contour := range op.Contours {
+			for _, p := range contour.Points {
+				minY = min(minY, p.Y)
+				maxY = max(maxY, p.Y)
+			}
+		}
+	}
+
+	if minY < 14.9 || minY > 15.1 {
+		t.Errorf("Expected the link to start at the anchor, got %v", minY)
+	}
+	if end := 4 * scale; maxY < end-0.1 || maxY > end+0.1 {
+		t.Errorf("Expected the link to end at the node center %v, got %v", end, maxY)
+	}
+
+	if link.Route[0] != (vec.Vec2{X: 0, Y: 0}) {
+		t.Errorf("Rendering changed the link route")
+	}
+}
+
+func TestRendererGridToCanvas(t *testing.T) {
+	renderer := NewRenderer()
+	renderer.SetScale(20)
+
+	pos := vec.Vec2{X: 3, Y: -2}
+	canvasPos := renderer.GridToCanvas(pos)
+	if canvasPos != (vec.Vec2{X: 60, Y: -40}) {
+		t.Errorf("Expected (60, -40), got %v", canvasPos)
+	}
+	if back := renderer.CanvasToGrid(canvasPos); back != pos {
+		t.Errorf("Expected %v, got %v", pos, back)
+	}
+
+	// Decorations placed with GridToCanvas line up with the nodes
+	node := &Node{Id: "A", Pos: &[2]int16{3, -2}}
+	obj, err := renderer.RenderNode(node)
+	if err != nil {
+		t.Fatalf("Error rendering node: %s", err)
+	}
+	circle := obj.(*canvas.Group).Children[0].(*canvas.Ellipse)
+	if circle.Center != canvasPos {
+		t.Errorf("Node drawn at %v, expected %v", circle.Center, canvasPos)
+	}
+}
+
+func TestRenderCurvedLink(t *testing.T) {
+	link := &Link{
+		Id:    "A-B",
+		From:  "A",
+		To:    "B",
+		Route: vec.Polyline{{X: 0, Y: 0}, {X: 4, Y: 0}, {X: 4, Y: 4}, {X: 8, Y: 4}},
+	}
+
+	for _, curve := range []string{"catmull-rom", "bezier"} {
+		config := DefaultRenderConfig()
+		config.DefaultLinkStyle.Curve = curve
+		renderer := NewRendererWithConfig(config)
+		scale := renderer.GetScale()
+
+		obj, err := renderer.RenderLink(link)
+		if err != nil {
+			t.Fatalf("Error rendering link: %s", err)
+		}
+
+		c := canvas.NewCanvas()
+		c.AppendChild(obj)
+
+		curves := 0
+		for _, op := range c.Flatten() {
+			for _, contour := range op.Contours {
+				for _, p := range contour.Points {
+					// The curve stays close to the route
+					if p.X < -scale || p.X > 9*scale || p.Y < -scale || p.Y > 5*scale {
+						t.Errorf("%s: point %v far from the route", curve, p)
+					}
+				}
+			}
+		}
+		var countCurves func(o canvas.Object)
+		countCurves = func(o canvas.Object) {
+			switch o := o.(type) {
+			case *canvas.Group:
+				for _, child := range o.Children {
+					countCurves(child)
+				}
+			case *canvas.Path:
+				for _, cmd := range o.Data {
+					if cmd.Type == canvas.CommandCubicTo {
+						curves += 1
+					}
+				}
+			}
+		}
+		countCurves(obj)
+		if curves == 0 {
+			t.Errorf("%s: no curves in the rendered link", curve)
+		}
+	}
+
+	// Links with an unknown curve are still drawn
+	config := DefaultRenderConfig()
+	config.DefaultLinkStyle.Curve = "spiral"
+	obj, err := NewRendererWithConfig(config).RenderLink(link)
+	if err != nil || obj == nil {
+		t.Errorf("Expected the link to be drawn without a curve, got %v", err)
+	}
+}
+
+func TestRenderLabelFonts(t *testing.T) {
+	topo := &Topology{
+		Nodes: map[NodeId]*Node{
+			"A": {Id: "A", Pos: &[2]int16{0, 0}, LabelAt: DirectionS, Class: "site"},
+			"B": {Id: "B", Pos: &[2]int16{4, 0}, LabelAt: DirectionS},
+		},
+		Links: map[LinkId]*Link{
+			"A-B": {
+				Id:         "A-B",
+				From:       "A",
+				To:         "B",
+				Route:      vec.Polyline{{X: 0, Y: 0}, {X: 4, Y: 0}},
+				FromData:   &LinkData{Label: "fwd"},
+				LabelStyle: &LabelStyle{FontFamily: "monospace"},
+			},
+		},
+	}
+
+	config := DefaultRenderConfig()
+	config.NodeLabelStyle.FontFamily = "sans-serif"
+	config.NodeLabelStyles = map[string]LabelStyle{
+		"site": {FontFamily: "Display", Size: 24},
+	}
+	renderer := NewRendererWithConfig(config)
+
+	c := canvas.NewCanvas()
+	if err := renderer.RenderTopologyToCanvas(topo, c); err != nil {
+		t.Fatalf("Error rendering topology: %s", err)
+	}
+
+	fonts := map[string]string{}
+	sizes := map[string]float32{}
+	for _, op := range c.Flatten() {
+		if op.Type == canvas.DrawOpText {
+			fonts[op.Text] = op.Style.FontFamily
+			sizes[op.Text] = op.Size
+		}
+	}
+
+	if fonts["A"] != "Display" || sizes["A"] != 24 {
+		t.Errorf("Expected the class label style for A, got %q size %v", fonts["A"], sizes["A"])
+	}
+	if fonts["B"] != "sans-serif" || sizes["B"] != config.NodeLabelStyle.Size {
+		t.Errorf("Expected the default label style for B, got %q size %v", fonts["B"], sizes["B"])
+	}
+	if fonts["fwd"] != "monospace" {
+		t.Errorf("Expected the link's own label font, got %q", fonts["fwd"])
+	}
+}
+
+func TestRenderLinkColorOverride(t *testing.T) {
+	var link Link
+	err := json.Unmarshal([]byte(`{
+		"id": "A-B", "from": "A", "to": "B",
+		"route": [{"X": 0, "Y": 0}, {"X": 4, "Y": 0}],
+		"from_data": {"value": 0.9, "color": "#ff0000"},
+		"to_data": {"value": 0.9}
+	}`), &link)
+	if err != nil {
+		t.Fatalf("Error parsing link: %s", err)
+	}
+
+	renderer := NewRenderer()
+	obj, err := renderer.RenderLink(&link)
+	if err != nil {
+		t.Fatalf("Error rendering link: %s", err)
+	}
+
+	c := canvas.NewCanvas()
+	c.AppendChild(obj)
+
+	var fwd, rev canvas.Color
+	for _, op := range c.Flatten() {
+		if op.Type != canvas.DrawOpShape {
+			continue
+		}
+		// The forward segment is drawn first
+		if fwd == nil {
+			fwd = op.Style.FillColor.Color()
+		} else {
+			rev = op.Style.FillColor.Color()
+		}
+	}
+
+	if fwd == nil || !canvas.ColorEqual(fwd, canvas.RGB(1, 0, 0)) {
+		t.Errorf("Expected the link color to override the value, got %v", fwd)
+	}
+	expected := renderer.Config.LinkColorScale.GetColor(0.9)
+	if rev == nil || !canvas.ColorEqual(rev, expected) {
+		t.Errorf("Expected the value color without an override, got %v", rev)
+	}
+}
+
+func TestRenderWatermark(t *testing.T) {
+	topo := &Topology{
+		Nodes: map[NodeId]*Node{
+			"A": {Id: "A", Pos: &[2]int16{0, 0}},
+			"B": {Id: "B", Pos: &[2]int16{8, 2}},
+		},
+		Links: map[LinkId]*Link{
+			"A-B": {
+				Id:    "A-B",
+				From:  "A",
+				To:    "B",
+				Route: vec.Polyline{{X: 0, Y: 0}, {X: 6, Y: 0}, {X: 8, Y: 2}},
+			},
+		},
+	}
+
+	render := func(wm *Watermark) *canvas.Canvas {
+		config := DefaultRenderConfig()
+		config.Watermark = wm
+		c := canvas.NewCanvas()
+		if err := NewRendererWithConfig(config).RenderTopologyToCanvas(topo, c); err != nil {
+			t.Fatalf("Error rendering topology: %s", err)
+		}
+		return c
+	}
+
+	plain := render(nil)
+	marked := render(NewWatermark("DRAFT"))
+
+	// The watermark is drawn first, so it is behind everything else
+	ops := marked.Flatten()
+	if len(ops) == 0 || ops[0].Type != canvas.DrawOpText || ops[0].Text != "DRAFT" {
+		t.Fatalf("Expected the watermark to be drawn first")
+	}
+	if ops[0].Style.Opacity.Value != 0.15 {
+		t.Errorf("Expected the watermark opacity to be 0.15, got %v", ops[0].Style.Opacity.Value)
+	}
+
+	// A fitted watermark doesn't change the size of the map
+	plainMin, plainMax := plain.GetAABB().Bounds()
+	markedMin, markedMax := marked.GetAABB().Bounds()
+	if !plainMin.ApproxEq(markedMin, 0.01) || !plainMax.ApproxEq(markedMax, 0.01) {
+		t.Errorf("Expected the bounds to be unchanged, got %v-%v instead of %v-%v",
+			markedMin, markedMax, plainMin, plainMax)
+	}
+}
+
+func TestRenderLinkColorFunc(t *testing.T) {
+	link := &Link{
+		Id:       "A-B",
+		From:     "A",
+		To:       "B",
+		Route:    vec.Polyline{{X: 0, Y: 0}, {X: 4, Y: 0}},
+		FromData: &LinkData{Label: "down"},
+		ToData:   &LinkData{},
+	}
+	link.FromData.Value.Set(0.9)
+	link.ToData.Value.Set(0.9)
+
+	renderer := NewRenderer()
+	renderer.LinkColor = func(link *Link, data *LinkData) canvas.Color {
+		if data != nil && data.Label == "down" {
+			return canvas.RGB(1, 0, 0)
+		}
+		return nil
+	}
+	obj, err := renderer.RenderLink(link)
+	if err != nil {
+		t.Fatalf("Error rendering link: %s", err)
+	}
+
+	c := canvas.NewCanvas()
+	c.AppendChild(obj)
+
+	colors := []canvas.Color{}
+	for _, op := range c.Flatten() {
+		if op.Type == canvas.DrawOpShape {
+			colors = append(colors, op.Style.FillColor.Color())
+		}
+	}
+	// The label box of the forward segment is drawn between the
+	// two segments
+	if len(colors) != 3 {
+		t.Fatalf("Expected 2 link segments and a label, got %d shapes", len(colors))
+	}
+
+	if !canvas.ColorEqual(colors[0], canvas.RGB(1, 0, 0)) {
+		t.Errorf("Expected the color from the function, got %v", colors[0])
+	}
+	// Without a color from the function, the scale is used
+	expected := renderer.Config.LinkColorScale.GetColor(0.9)
+	if !canvas.ColorEqual(colors[2], expected) {
+		t.Errorf("Expected the value color, got %v", colors[2])
+	}
+}
+
+func TestRenderLinkLabelWrap(t *testing.T) {
+	renderer := NewRenderer()
+	style := renderer.Config.LinkLabelStyle
+
+	short, err := renderer.RenderLinkLabel(vec.Vec2{}, "1G")
+	if err != nil {
+		t.Fatalf("Error rendering label: %s", err)
+	}
+	long, err := renderer.RenderLinkLabel(vec.Vec2{}, "10G core")
+	if err != nil {
+		t.Fatalf("Error rendering label: %s", err)
+	}
+
+	textLines := func(obj canvas.Object) []string {
+		c := canvas.NewCanvas()
+		c.AppendChild(obj)
+		lines := []string{}
+		for _, op := range c.Flatten() {
+			if op.Type == canvas.DrawOpText {
+				lines = append(lines, op.Text)
+			}
+		}
+		return lines
+	}
+
+	if lines := textLines(short); !slices.Equal(lines, []string{"1G"}) {
+		t.Errorf("Expected a single line, got %q", lines)
+	}
+	if lines := textLines(long); !slices.Equal(lines, []string{"10G", "core"}) {
+		t.Errorf("Expected the label to wrap, got %q", lines)
+	}
+
+	// The box grows to fit the extra line, but stays the same width
+	shortSize := short.GetAABB().Size()
+	longSize := long.GetAABB().Size()
+	if longSize.X != shortSize.X || longSize.Y != shortSize.Y+style.Size {
+		t.Errorf("Expected the box to be one line taller, got %v and %v", shortSize, longSize)
+	}
+}
+
+func TestRenderNodeNames(t *testing.T) {
+	topo := &Topology{
+		Nodes: map[NodeId]*Node{
+			"akl-core.example.net": {Id: "akl-core.example.net", Pos: &[2]int16{0, 0}, LabelAt: DirectionS},
+			"wlg-core.example.net": {Id: "wlg-core.example.net", Pos: &[2]int16{4, 0}, LabelAt: DirectionS},
+			"chc-core.example.net": {Id: "chc-core.example.net", Pos: &[2]int16{8, 0}, LabelAt: DirectionS, Label: "Christchurch"},
+			"dud":                  {Id: "dud", Pos: &[2]int16{12, 0}, LabelAt: DirectionS},
+		},
+	}
+
+	config := DefaultRenderConfig()
+	config.NodeNames = map[NodeId]string{"wlg-core.example.net": "Wellington"}
+	renderer := NewRendererWithConfig(config)
+	renderer.NodeName = func(id NodeId) string {
+		name, _ := strings.CutSuffix(string(id), ".example.net")
+		if name == string(id) {
+			return ""
+		}
+		return name
+	}
+
+	c := canvas.NewCanvas()
+	if err := renderer.RenderTopologyToCanvas(topo, c); err != nil {
+		t.Fatalf("Error rendering topology: %s", err)
+	}
+
+	names := []string{}
+	for _, op := range c.Flatten() {
+		if op.Type == canvas.DrawOpText {
+			names = append(names, op.Text)
+		}
+	}
+	slices.Sort(names)
+
+	expected := []string{"Christchurch", "Wellington", "akl-core", "dud"}
+	if !slices.Equal(names, expected) {
+		t.Errorf("Expected node names %q, got %q", expected, names)
+	}
+}
+
+func TestRenderHideToggles(t *testing.T) {
+	newTopo := func() *Topology {
+		return &Topology{
+			Nodes: map[NodeId]*Node{
+				"A": {Id: "A", Pos: &[2]int16{0, 0}, LabelAt: DirectionN},
+				"B": {Id: "B", Pos: &[2]int16{4, 0}, LabelAt: DirectionN},
+			},
+			Links: map[LinkId]*Link{
+				"A-B": {
+					Id:       "A-B",
+					From:     "A",
+					To:       "B",
+					Route:    vec.Polyline{{X: 0, Y: 0}, {X: 4, Y: 0}},
+					FromData: &LinkData{Label: "10G"},
+					ToData:   &LinkData{},
+				},
+			},
+		}
+	}
+
+	render := func(config *RenderConfig) []canvas.DrawOp {
+		c := canvas.NewCanvas()
+		renderer := NewRendererWithConfig(config)
+		if err := renderer.RenderTopologyToCanvas(newTopo(), c); err != nil {
+			t.Fatalf("Error rendering topology: %s", err)
+		}
+		return c.Flatten()
+	}
+
+	texts := func(ops []canvas.DrawOp) []string {
+		found := []string{}
+		for _, op := range ops {
+			if op.Type == canvas.DrawOpText {
+				found = append(found, op.Text)
+			}
+		}
+		slices.Sort(found)
+		return found
+	}
+
+	config := DefaultRenderConfig()
+	all := render(config)
+	if found := texts(all); !slices.Equal(found, []string{"10G", "A", "B"}) {
+		t.Fatalf("Expected all labels to be drawn, got %q", found)
+	}
+
+	config = DefaultRenderConfig()
+	config.HideNodeLabels = true
+	if found := texts(render(config)); !slices.Equal(found, []string{"10G"}) {
+		t.Errorf("Expected only the link label, got %q", found)
+	}
+
+	config = DefaultRenderConfig()
+	config.HideLinkLabels = true
+	if found := texts(render(config)); !slices.Equal(found, []string{"A", "B"}) {
+		t.Errorf("Expected only the node labels, got %q", found)
+	}
+
+	// Hiding the nodes removes both the node shapes and their labels,
+	// leaving the two link segments and the link label box
+	config = DefaultRenderConfig()
+	config.HideNodes = true
+	hidden := render(config)
+	if found := texts(hidden); !slices.Equal(found, []string{"10G"}) {
+		t.Errorf("Expected only the link label, got %q", found)
+	}
+	if len(hidden) != len(all)-4 {
+		t.Errorf("Expected 4 fewer draw ops without nodes, got %d, was %d", len(hidden), len(all))
+	}
+
+	// Without an arrowhead, the end of the segment is square, so the
+	// corners and the center all lie at the furthest point
+	endPoints := func(config *RenderConfig) int {
+		renderer := NewRendererWithConfig(config)
+		obj, err := renderer.RenderLink(newTopo().Links["A-B"])
+		if err != nil {
+			t.Fatalf("Error rendering link: %s", err)
+		}
+		c := canvas.NewCanvas()
+		c.AppendChild(obj)
+		points := c.Flatten()[0].Contours[0].Points
+		maxX := points[0].X
+		for _, p := range points {
+			maxX = max(maxX, p.X)
+		}
+		count := 0
+		for _, p := range points {
+			if maxX-p.X < 0.01 {
+				count++
+			}
+		}
+		return count
+	}
+
+	if n := endPoints(DefaultRenderConfig()); n != 1 {
+		t.Errorf("Expected the arrow to end at a point, got %d points at the end", n)
+	}
+	config = DefaultRenderConfig()
+	config.HideArrowheads = true
+	if n := endPoints(config); n < 3 {
+		t.Errorf("Expected a square end without the arrowhead, got %d points at the end", n)
+	}
+}
+
+func TestRenderNodeDecorations(t *testing.T) {
+	topo := &Topology{
+		Nodes: map[NodeId]*Node{
+			"A": {Id: "A", Pos: &[2]int16{2, 1}},
+			"B": {Id: "B", Pos: &[2]int16{6, 1}, Extents: &NodeExtents{Width: 3, Height: 1}},
+		},
+	}
+
+	renderer := NewRenderer()
+	renderer.SetScale(10)
+	renderer.NodeDecorations = func(node *Node, style *NodeStyle) []canvas.Object {
+		// A glyph on top of the node
+		glyph := canvas.NewCircle(vec.Vec2{X: 0, Y: -style.Size / 2}, 2)
+		return []canvas.Object{glyph}
+	}
+
+	c := canvas.NewCanvas()
+	if err := renderer.RenderTopologyToCanvas(topo, c); err != nil {
+		t.Fatalf("Error rendering topology: %s", err)
+	}
+
+	// The glyphs are the last shape drawn for each node
+	centers := []vec.Vec2{}
+	for _, op := range c.Flatten() {
+		if op.Type != canvas.DrawOpShape || len(op.Contours) == 0 {
+			continue
+		}
+		var sum vec.Vec2
+		points := op.Contours[0].Points
+		for _, p := range points {
+			sum = sum.Add(p)
+		}
+		centers = append(centers, sum.Div(float32(len(points))))
+	}
+	if len(centers) != 4 {
+		t.Fatalf("Expected 2 nodes and 2 glyphs, got %d shapes", len(centers))
+	}
+
+	expected := []vec.Vec2{{X: 20, Y: 0}, {X: 60, Y: 0}}
+	for i, center := range []vec.Vec2{centers[1], centers[3]} {
+		if center.Sub(expected[i]).Length() > 0.5 {
+			t.Errorf("Expected glyph at %v, got %v", expected[i], center)
+		}
+	}
+}
+
+func TestRenderDecorations(t *testing.T) {
+	data := `{
+		"nodes": {"A": {"pos": [0, 0]}},
+		"links": [],
+		"decorations": [
+			{"id": "logo", "anchor": "ne", "offset": [-5, 5], "width": 30, "height": 20,
+				"image": "logo.svg", "style": {"fill": "#ffffff"}},
+			{"anchor": "s", "width": 40, "height": 10, "text": "Inset", "class": "inset"}
+		]
+	}`
+
+	topo := Topology{}
+	if err := json.Unmarshal([]byte(data), &topo); err != nil {
+		t.Fatalf("Error parsing topology: %s", err)
+	}
+	if len(topo.Decorations) != 2 {
+		t.Fatalf("Expected 2 decorations, got %d", len(topo.Decorations))
+	}
+
+	renderer := NewRenderer()
+	bounds := canvas.NewAABB(vec.Vec2{X: 0, Y: 0}, vec.Vec2{X: 100, Y: 50})
+	group := renderer.RenderDecorations(topo.Decorations, bounds).(*canvas.Group)
+
+	// The logo's top-right corner is at the top-right of the map,
+	// moved in by the offset
+	logo := group.Children[0].(*canvas.Group)
+	if logo.Attributes.Id != "logo" || len(logo.Children) != 2 {
+		t.Fatalf("Expected a box and image for the logo, got %v", logo.Children)
+	}
+	if box := logo.Children[0].(*canvas.Rect); box.Pos != (vec.Vec2{X: 65, Y: 5}) {
+		t.Errorf("Expected the logo at (65, 5), got %v", box.Pos)
+	}
+	if image := logo.Children[1].(*canvas.Image); image.Href != "logo.svg" {
+		t.Errorf("Expected the logo image, got %q", image.Href)
+	}
+
+	// Without a style only the text is drawn, in the middle of the
+	// bottom edge
+	inset := group.Children[1].(*canvas.Group)
+	if !slices.Contains(inset.Attributes.Classes, "inset") || len(inset.Children) != 1 {
+		t.Fatalf("Expected only text for the inset, got %v", inset.Children)
+	}
+	if text := inset.Children[0].(*canvas.Text); text.Pos != (vec.Vec2{X: 50, Y: 45}) {
+		t.Errorf("Expected the inset text at (50, 45), got %v", text.Pos)
+	}
+}
+
+func TestRenderContinueOnError(t *testing.T) {
+	topo := &Topology{
+		Nodes: map[NodeId]*Node{
+			"A": {Id: "A", Pos: &[2]int16{0, 0}},
+			"B": {Id: "B", Pos: &[2]int16{4, 0}},
+		},
+	}
+
+	renderer := NewRenderer()
+	renderer.ContinueOnError = true
+	renderer.NodeDecorations = func(node *Node, style *NodeStyle) []canvas.Object {
+		if node.Id == "B" {
+			panic("bad node")
+		}
+		return nil
+	}
+
+	c := canvas.NewCanvas()
+	if err := renderer.RenderTopologyToCanvas(topo, c); err != nil {
+		t.Fatalf("Error rendering topology: %s", err)
+	}
+
+	shapes := 0
+	for _, op := range c.Flatten() {
+		if op.Type == canvas.DrawOpShape {
+			shapes++
+		}
+	}
+	if shapes != 1 {
+		t.Errorf("Expected only node A to be drawn, got %d shapes", shapes)
+	}
+
+	errs := renderer.Errors()
+	if len(errs) != 1 || errs[0].Node != "B" {
+		t.Fatalf("Expected an error for node B, got %v", errs)
+	}
+	if expected := "Error rendering node 'B': bad node"; errs[0].Error() != expected {
+		t.Errorf("Expected error %q, got %q", expected, errs[0].Error())
+	}
+
+	// Errors are cleared by the next render
+	renderer.NodeDecorations = nil
+	if _, err := renderer.RenderTopology(topo); err != nil {
+		t.Fatalf("Error rendering topology: %s", err)
+	}
+	if errs := renderer.Errors(); len(errs) != 0 {
+		t.Errorf("Expected no errors, got %v", errs)
+	}
+}
+
+func TestRenderSanitizeId(t *testing.T) {
+	if id := SanitizeId("core 1/akl"); id != "core_201_2fakl" {
+		t.Errorf("Expected core_201_2fakl, got %s", id)
+	}
+	if id := SanitizeId("10G"); id != "_310G" {
+		t.Errorf("Expected _310G, got %s", id)
+	}
+	// Names that differ stay different
+	seen := map[string]string{}
+	for _, name := range []string{"a b", "a/b", "a_b", "a_20b", "a_5fb", "ab", "é", "_c3_a9"} {
+		id := SanitizeId(name)
+		if other, ok := seen[id]; ok {
+			t.Errorf("Expected %q and %q to be sanitized differently, both gave %s", name, other, id)
+		}
+		seen[id] = name
+	}
+
+	topo := &Topology{
+		Nodes: map[NodeId]*Node{
+			"akl/1": {Id: "akl/1", Pos: &[2]int16{0, 0}, Class: "10G core"},
+			"wlg":   {Id: "wlg", Pos: &[2]int16{4, 0}},
+		},
+		Links: map[LinkId]*Link{
+			"akl/1 wlg": {Id: "akl/1 wlg", From: "akl/1", To: "wlg"},
+		},
+	}
+
+	config := DefaultRenderConfig()
+	config.RenderUnrouted = true
+	style := canvas.NewStyle()
+	style.FillColor.SetColor(canvas.RGB(255, 0, 0))
+	config.NodeStyles = map[string]NodeStyle{
+		"10G core": {Size: 8, Style: style},
+	}
+	renderer := NewRendererWithConfig(config)
+	renderer.SanitizeId = SanitizeId
+
+	c := canvas.NewCanvas()
+	if err := renderer.RenderTopologyToCanvas(topo, c); err != nil {
+		t.Fatalf("Error rendering topology: %s", err)
+	}
+	out := &strings.Builder{}
+	svgRenderer := canvas.NewSVGRenderer(out)
+	svgRenderer.StyleMode = canvas.SVGStyleInternal
+	if err := c.Render(svgRenderer); err != nil {
+		t.Fatalf("Error rendering canvas: %s", err)
+	}
+	svg := out.String()
+
+	// The ids and classes are sanitized, with the originals kept
+	// in data attributes, and the stylesheet uses the same classes
+	for _, expected := range []string{
+		`id="N-akl_2f1"`, `data-node="akl/1"`,
+		`_310G_20core`, `data-class="10G core"`,
+		`id="L-akl_2f1_20wlg"`, `data-link="akl/1 wlg"`,
+		`.node._310G_20core`,
+	} {
+		if !strings.Contains(svg, expected) {
+			t.Errorf("Expected the SVG to contain %s", expected)
+		}
+	}
+	if strings.Contains(svg, `class="node 10G`) || strings.Contains(svg, ".node.10G") {
+		t.Errorf("Expected no unsanitized classes, got %s", svg)
+	}
+}
+
+func TestRenderStylesOrder(t *testing.T) {
+	config := DefaultRenderConfig()
+	for _, cls := range []string{"a", "b", "c", "d", "e", "f"} {
+		config.NodeStyles[cls] = NodeStyle{Size: 10, Style: canvas.NewStyle()}
+		config.LinkStyles[cls] = LinkStyle{Size: 5, Style: canvas.NewStyle()}
+	}
+	renderer := NewRendererWithConfig(config)
+
+	render := func() string {
+		c := canvas.NewCanvas()
+		c.AppendChild(canvas.NewCircle(vec.Vec2{}, 5))
+		renderer.SetStyles(c)
+		out := &strings.Builder{}
+		svgRenderer := canvas.NewSVGRenderer(out)
+		svgRenderer.StyleMode = canvas.SVGStyleInternal
+		if err := c.Render(svgRenderer); err != nil {
+			t.Fatalf("Error rendering canvas: %s", err)
+		}
+		return out.String()
+	}
+
+	// The class styles don't come out in map order
+	first := render()
+	for range 10 {
+		if svg := render(); svg != first {
+			t.Fatalf("Expected the same stylesheet each time, got:\n%s\nand:\n%s", first, svg)
+		}
+	}
+}
+
+func TestRenderLinkEndLabels(t *testing.T) {
+	topo := &Topology{
+		Nodes: map[NodeId]*Node{
+			"A": {Id: "A", Pos: &[2]int16{0, 0}, LabelAt: DirectionS},
+			"B": {Id: "B", Pos: &[2]int16{4, 0}},
+		},
+		Links: map[LinkId]*Link{
+			"A-B": {
+				Id: "A-B", From: "A", To: "B",
+				Route:     vec.Polyline{{X: 0, Y: 0}, {X: 4, Y: 0}},
+				FromLabel: "ge-0/0/1",
+				ToLabel:   "xe-1",
+			},
+		},
+	}
+
+	renderer := NewRenderer()
+	renderer.SetScale(20)
+	if _, err := renderer.RenderTopology(topo); err != nil {
+		t.Fatalf("Error rendering topology: %s", err)
+	}
+	obj, err := renderer.RenderLink(topo.Links["A-B"])
+	if err != nil {
+		t.Fatalf("Error rendering link: %s", err)
+	}
+
+	labels := map[string]*canvas.Text{}
+	for _, child := range obj.(*canvas.Group).Children {
+		if text, ok := child.(*canvas.Text); ok && slices.Contains(text.Attributes.Classes, "link-end-label") {
+			labels[text.Text] = text
+		}
+	}
+	from, to := labels["ge-0/0/1"], labels["xe-1"]
+	if from == nil || to == nil {
+		t.Fatalf("Expected labels at both ends, got %v", labels)
+	}
+
+	// Each label is just outside its node, A's is above the link
+	// since A's label is below the node
+	if from.Pos.X <= 10 || from.Pos.X >= 40 || from.Pos.Y >= 0 {
+		t.Errorf("Expected the from label above the link near A, got %v", from.Pos)
+	}
+	if from.Baseline != canvas.TextBaselineBottom {
+		t.Errorf("Expected the from label to sit above the link")
+	}
+	if to.Pos.X >= 70 || to.Pos.X <= 40 || to.Pos.Y >= 0 {
+		t.Errorf("Expected the to label beside the link near B, got %v", to.Pos)
+	}
+
+	// The end labels can replace the central labels
+	hasLabels := func(class string) bool {
+		obj, err := renderer.RenderLink(topo.Links["A-B"])
+		if err != nil {
+			t.Fatalf("Error rendering link: %s", err)
+		}
+		var find func(o canvas.Object) bool
+		find = func(o canvas.Object) bool {
+			if slices.Contains(o.GetAttributes().Classes, class) {
+				return true
+			}
+			if group, ok := o.(*canvas.Group); ok {
+				return slices.ContainsFunc(group.Children, find)
+			}
+			return false
+		}
+		return find(obj)
+	}
+	topo.Links["A-B"].FromData = &LinkData{Label: "10G"}
+	if !hasLabels("link-label-text") || !hasLabels("link-end-label") {
+		t.Errorf("Expected both the central and end labels")
+	}
+	renderer.Config.LinkEndLabelsOnly = true
+	if hasLabels("link-label-text") || !hasLabels("link-end-label") {
+		t.Errorf("Expected only the end labels")
+	}
+
+	// Hiding link labels hides the end labels too
+	renderer.Config.HideLinkLabels = true
+	obj, _ = renderer.RenderLink(topo.Links["A-B"])
+	for _, child := range obj.(*canvas.Group).Children {
+		if _, ok := child.(*canvas.Text); ok {
+			t.Errorf("Expected no end labels when link labels are hidden")
+		}
+	}
+}
+
+func TestRenderNodeWeightSizes(t *testing.T) {
+	weight := func(w float32) *float32 { return &w }
+	topo := &Topology{
+		Nodes: map[NodeId]*Node{
+			"A": {Id: "A", Pos: &[2]int16{0, 0}, Weight: weight(0), LabelAt: DirectionS},
+			"B": {Id: "B", Pos: &[2]int16{4, 0}, Weight: weight(5), LabelAt: DirectionS},
+			"C": {Id: "C", Pos: &[2]int16{8, 0}, Weight: weight(20), LabelAt: DirectionS},
+			"D": {Id: "D", Pos: &[2]int16{12, 0}, Weight: weight(20), Style: &NodeStyle{Size: 8}},
+		},
+	}
+
+	config := DefaultRenderConfig()
+	config.NodeWeightSizes = &WeightSizes{
+		MinWeight: 0, MaxWeight: 10,
+		MinSize: 10, MaxSize: 30,
+		MinLabelSize: 8, MaxLabelSize: 24,
+	}
+	renderer := NewRendererWithConfig(config)
+	renderer.SetScale(40)
+
+	c := canvas.NewCanvas()
+	if err := renderer.RenderTopologyToCanvas(topo, c); err != nil {
+		t.Fatalf("Error rendering topology: %s", err)
+	}
+
+	widths := []float32{}
+	labels := map[string]float32{}
+	for _, op := range c.Flatten() {
+		switch op.Type {
+		case canvas.DrawOpShape:
+			minX, maxX := op.Contours[0].Points[0].X, op.Contours[0].Points[0].X
+			for _, p := range op.Contours[0].Points {
+				minX, maxX = min(minX, p.X), max(maxX, p.X)
+			}
+			widths = append(widths, maxX-minX)
+		case canvas.DrawOpText:
+			labels[op.Text] = op.Size
+		}
+	}
+
+	expected := []float32{10, 20, 30, 8}
+	if len(widths) != len(expected) {
+		t.Fatalf("Expected %d nodes, got %d shapes", len(expected), len(widths))
+	}
+	for i, w := range widths {
+		if w < expected[i]-0.5 || w > expected[i]+0.5 {
+			t.Errorf("Expected node %d to be %v wide, got %v", i, expected[i], w)
+		}
+	}
+	if labels["A"] != 8 || labels["B"] != 16 || labels["C"] != 24 {
+		t.Errorf("Expected label sizes to follow the weights, got %v", labels)
+	}
+}
+
+func TestRenderFitAspect(t *testing.T) {
+	topo := &Topology{
+		Nodes: map[NodeId]*Node{
+			"A": {Id: "A", Pos: &[2]int16{0, 0}, LabelAt: DirectionE},
+			"B": {Id: "B", Pos: &[2]int16{0, 8}, LabelAt: DirectionE},
+		},
+		Links: map[LinkId]*Link{
+			"A-B": {
+				Id: "A-B", From: "A", To: "B",
+				Route:    vec.Polyline{{X: 0, Y: 0}, {X: 0, Y: 8}},
+				FromData: &LinkData{Label: "fwd"},
+			},
+		},
+	}
+
+	config := DefaultRenderConfig()
+	config.FitAspect = 16.0 / 9
+	renderer := NewRendererWithConfig(config)
+
+	c := canvas.NewCanvas()
+	if err := renderer.RenderTopologyToCanvas(topo, c); err != nil {
+		t.Fatalf("Error rendering topology: %s", err)
+	}
+	if renderer.MapTransform() == nil {
+		t.Fatalf("Expected the tall map to be turned")
+	}
+	if size := c.GetAABB().Size(); size.X <= size.Y {
+		t.Errorf("Expected the turned map to be wide, got %v", size)
+	}
+
+	for _, op := range c.Flatten() {
+		if op.Type != canvas.DrawOpText {
+			continue
+		}
+		if _, ok := op.Transform.GetTranslation(); !ok {
+			t.Errorf("Expected %q to be upright, got %+v", op.Text, op.Transform)
+		}
+		// The labels on the east side now go below the nodes
+		if op.Text == "A" && (op.Anchor != canvas.TextAnchorMiddle || op.Baseline != canvas.TextBaselineTop) {
+			t.Errorf("Expected A's label under the node, got anchor %v baseline %v", op.Anchor, op.Baseline)
+		}
+	}
+
+	// A wide map is left alone
+	config.FitAspect = 1.0 / 8
+	renderer = NewRendererWithConfig(config)
+	if _, err := renderer.RenderTopology(topo); err != nil {
+		t.Fatalf("Error rendering topology: %s", err)
+	}
+	if renderer.MapTransform() != nil {
+		t.Errorf("Expected the map not to be turned, got %+v", renderer.MapTransform())
+	}
+}
+
+func TestRenderTrunks(t *testing.T) {
+	route := vec.Polyline{{X: 0, Y: 0}, {X: 20, Y: 0}}
+	topo := &Topology{
+		Nodes: map[NodeId]*Node{
+			"A": {Id: "A", Pos: &[2]int16{0, 0}},
+			"B": {Id: "B", Pos: &[2]int16{20, 0}},
+		},
+		Links: map[LinkId]*Link{},
+	}
+	for _, id := range []LinkId{"A-B-1", "A-B-2", "A-B-3"} {
+		topo.Links[id] = &Link{Id: id, From: "A", To: "B", Route: route}
+	}
+	// Links between the same nodes are drawn along the trunk even
+	// if the router gave them another route
+	topo.Links["B-A"] = &Link{Id: "B-A", From: "B", To: "A",
+		Route: vec.Polyline{{X: 20, Y: 0}, {X: 16, Y: 4}, {X: 4, Y: 4}, {X: 0, Y: 0}}}
+
+	config := DefaultRenderConfig()
+	config.BundleSpacing = 10
+	config.TrunkThreshold = 3
+	renderer := NewRendererWithConfig(config)
+
+	obj, err := renderer.RenderTopology(topo)
+	if err != nil {
+		t.Fatalf("Error rendering topology: %s", err)
+	}
+	c := canvas.NewCanvas()
+	c.AppendChild(obj)
+
+	trunks := 0
+	for _, op := range c.Flatten() {
+		if slices.Contains(op.Classes, "link-trunk") {
+			trunks++
+		}
+	}
+	if trunks != 1 {
+		t.Errorf("Expected 1 trunk, got %d", trunks)
+	}
+
+	// The links fan out near the nodes and run together in between
+	scale := renderer.GetScale()
+	starts := []float32{}
+	for _, id := range []LinkId{"A-B-1", "A-B-2", "A-B-3", "B-A"} {
+		obj, err := renderer.RenderLink(topo.Links[id])
+		if err != nil {
+			t.Fatalf("Error rendering link: %s", err)
+		}
+		c := canvas.NewCanvas()
+		c.AppendChild(obj)
+
+		var start, middle float32
+		var startCount, middleCount int
+		for _, op := range c.Flatten() {
+			for _, contour := range op.Contours {
+				for _, p := range contour.Points {
+					switch {
+					case p.X < 1 || p.X > 20*scale-1:
+						start += p.Y
+						startCount++
+					case p.X > 8*scale && p.X < 12*scale:
+						middle += p.Y
+						middleCount++
+					}
+				}
+			}
+		}
+		if middleCount > 0 && f32Abs(middle/float32(middleCount)) > 1 {
+			t.Errorf("Expected %s to run along the trunk, got height %f", id, middle/float32(middleCount))
+		}
+		starts = append(starts, start/float32(startCount))
+	}
+
+	slices.Sort(starts)
+	for i := 1; i < len(starts); i++ {
+		if starts[i] <= starts[i-1] || f32Abs(starts[i]) > 15 {
+			t.Errorf("Expected the ends of the links spread out, got heights %v", starts)
+		}
+	}
+
+	// Too few links for a trunk
+	config.TrunkThreshold = 4
+	renderer = NewRendererWithConfig(config)
+	if obj, err = renderer.RenderTopology(topo); err != nil {
+		t.Fatalf("Error rendering topology: %s", err)
+	}
+	c = canvas.NewCanvas()
+	c.AppendChild(obj)
+	for _, op := range c.Flatten() {
+		if slices.Contains(op.Classes, "link-trunk") {
+			t.Errorf("Expected no trunk below the threshold")
+		}
+	}
+}
+
+func f32Abs(v float32) float32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func TestRenderLegend(t *testing.T) {
+	renderer := NewRenderer()
+
+	bounds := canvas.NewAABB(vec.Vec2{}, vec.Vec2{X: 1000, Y: 500})
+	legend := renderer.RenderLegend(nil, LegendOptions{
+		Bounds:   bounds,
+		Corner:   DirectionSE,
+		Swatches: 4,
+		Title:    "Utilization",
+	})
+
+	_, legendMax := legend.GetAABB().Bounds()
+	if f32Abs(legendMax.X-1000) > 0.01 || f32Abs(legendMax.Y-500) > 0.01 {
+		t.Errorf("Expected the legend in the bottom-right corner, got %v", legendMax)
+	}
+
+	c := canvas.NewCanvas()
+	c.AppendChild(legend)
+	swatches := 0
+	labels := []string{}
+	for _, op := range c.Flatten() {
+		switch {
+		case op.Type == canvas.DrawOpText:
+			labels = append(labels, op.Text)
+		case op.Style.FillColor.Color() != nil:
+			swatches++
+		}
+	}
+	if swatches != 4 {
+		t.Errorf("Expected 4 swatches, got %d", swatches)
+	}
+	expected := []string{"0%", "25%", "50%", "75%", "100%", "Utilization"}
+	if !slices.Equal(labels, expected) {
+		t.Errorf("Expected labels %v, got %v", expected, labels)
+	}
+}
+
+func TestRenderNodeShapes(t *testing.T) {
+	config := DefaultRenderConfig()
+	config.NodeStyles = map[string]NodeStyle{
+		"core": {Shape: "hexagon"},
+	}
+	renderer := NewRendererWithConfig(config)
+
+	tests := []struct {
+		node     *Node
+		expected string
+	}{
+		{&Node{Id: "A", Pos: &[2]int16{0, 0}}, "<circle"},
+		{&Node{Id: "B", Pos: &[2]int16{0, 0}, Class: "core"}, "<polygon"},
+		{&Node{Id: "C", Pos: &[2]int16{0, 0}, Style: &NodeStyle{Shape: "rounded-rect"}}, `rx="5"`},
+		{&Node{Id: "D", Pos: &[2]int16{0, 0}, Style: &NodeStyle{Shape: "square"}}, `width="20"`},
+	}
+	for _, test := range tests {
+		obj, err := renderer.RenderNode(test.node)
+		if err != nil {
+			t.Fatalf("Error rendering node %s: %s", test.node.Id, err)
+		}
+		out := &strings.Builder{}
+		c := canvas.NewCanvas()
+		c.AppendChild(obj)
+		if err := c.Render(canvas.NewSVGRenderer(out)); err != nil {
+			t.Fatalf("Error rendering SVG: %s", err)
+		}
+		if !strings.Contains(out.String(), test.expected) {
+			t.Errorf("Expected node %s to contain %s, got %s", test.node.Id, test.expected, out.String())
+		}
+	}
+}
+
+func TestRenderNodeIcons(t *testing.T) {
+	config := DefaultRenderConfig()
+	config.Icons = map[string]Icon{
+		"router": {Href: "router.svg"},
+		"cloud":  {Href: "cloud.png", Width: 60, Height: 40, Replace: true},
+	}
+	config.NodeStyles = map[string]NodeStyle{
+		"router": {Icon: "router"},
+		"cloud":  {Icon: "cloud"},
+	}
+	renderer := NewRendererWithConfig(config)
+
+	c := canvas.NewCanvas()
+	renderer.SetStyles(c)
+	nodes := []*Node{
+		{Id: "A", Pos: &[2]int16{0, 0}, Class: "router"},
+		{Id: "B", Pos: &[2]int16{0, 0}, Class: "cloud", LabelAt: DirectionS},
+	}
+	for _, node := range nodes {
+		obj, err := renderer.RenderNode(node)
+		if err != nil {
+			t.Fatalf("Error rendering node %s: %s", node.Id, err)
+		}
+		c.AppendChild(obj)
+	}
+	out := &strings.Builder{}
+	if err := c.Render(canvas.NewSVGRenderer(out)); err != nil {
+		t.Fatalf("Error rendering SVG: %s", err)
+	}
+
+	svg := out.String()
+	for _, expected := range []string{
+		`<symbol id="icon-cloud" viewBox="0 0 1.5 1">`,
+		`<symbol id="icon-router" viewBox="0 0 1 1">`,
+		`href="#icon-router"`,
+		`href="#icon-cloud"`,
+	} {
+		if !strings.Contains(svg, expected) {
+			t.Errorf("Expected %s in %s", expected, svg)
+		}
+	}
+	// The cloud replaces the node's circle, the router is drawn in it
+	if n := strings.Count(svg, "<circle"); n != 1 {
+		t.Errorf("Expected 1 node circle, got %d", n)
+	}
+
+	// The label is moved below the icon, which is taller than the node
+	obj, err := renderer.RenderNodeLabel(nodes[1])
+	if err != nil {
+		t.Fatalf("Error rendering label: %s", err)
+	}
+	if label := obj.(*canvas.Text); label.Pos.Y < 20 {
+		t.Errorf("Expected label below the icon, got %s", label.Pos)
+	}
+}
+
+func TestRenderLinkState(t *testing.T) {
+	renderer := NewRenderer()
+	data := &LinkData{}
+	data.Value.Set(1)
+
+	render := func(state string) string {
+		link := &Link{
+			Id: "A-B", From: "A", To: "B", State: state,
+			Route:    vec.Polyline{{X: 0, Y: 0}, {X: 4, Y: 0}},
+			FromData: data,
+		}
+		obj, err := renderer.RenderLink(link)
+		if err != nil {
+			t.Fatalf("Error rendering link: %s", err)
+		}
+		out := &strings.Builder{}
+		c := canvas.NewCanvas()
+		c.AppendChild(obj)
+		if err := c.Render(canvas.NewSVGRenderer(out)); err != nil {
+			t.Fatalf("Error rendering SVG: %s", err)
+		}
+		return out.String()
+	}
+
+	down := render(LinkStateDown)
+	for _, expected := range []string{`class="link link-state-down"`, `data-state="down"`, `stroke-dasharray`} {
+		if !strings.Contains(down, expected) {
+			t.Errorf("Expected %s in %s", expected, down)
+		}
+	}
+	// Both halves are greyed out, whatever their data
+	if n := strings.Count(down, `fill="#cccccc"`); n != 2 {
+		t.Errorf("Expected both halves of the down link to be grey, got %s", down)
+	}
+	stateFill := renderer.Config.LinkStateStyles[LinkStateDown].FillColor
+	if color := renderer.LinkDataColor(&Link{State: LinkStateDown}, data); color != stateFill {
+		t.Errorf("Expected the state's fill %s, got %s", stateFill.String(), color.String())
+	}
+
+	up := render(LinkStateUp)
+	if strings.Contains(up, `fill="#cccccc"`) || strings.Contains(up, "stroke-dasharray") {
+		t.Errorf("Expected up link to be drawn as normal, got %s", up)
+	}
+}
+
+func TestRenderLabelShaping(t *testing.T) {
+	config := DefaultRenderConfig()
+	config.NodeLabelStyles = map[string]LabelStyle{"site": {FontKerning: "none"}}
+	renderer := NewRendererWithConfig(config)
+
+	data := &LinkData{Label: "10 Gb"}
+	link, err := renderer.RenderLink(&Link{
+		Id: "A-B", From: "A", To: "B",
+		Route:    vec.Polyline{{X: 0, Y: 0}, {X: 4, Y: 0}},
+		FromData: data,
+	})
+	if err != nil {
+		t.Fatalf("Error rendering link: %s", err)
+	}
+	label, err := renderer.RenderNodeLabel(&Node{Id: "A", Pos: &[2]int16{0, 0}, LabelAt: DirectionS, Class: "site"})
+	if err != nil {
+		t.Fatalf("Error rendering label: %s", err)
+	}
+	if shaping := label.(*canvas.Text).Shaping; !shaping.NoKerning || shaping.TabularNumbers {
+		t.Errorf("Expected the class's shaping for the node label, got %+v", shaping)
+	}
+
+	out := &strings.Builder{}
+	c := canvas.NewCanvas()
+	c.AppendChild(link)
+	if err := c.Render(canvas.NewSVGRenderer(out)); err != nil {
+		t.Fatalf("Error rendering SVG: %s", err)
+	}
+	if !strings.Contains(out.String(), "tabular-nums") {
+		t.Errorf("Expected link labels to use tabular numbers, got %s", out.String())
+	}
+}
+
+func TestRenderLinkRadius(t *testing.T) {
+	config := DefaultRenderConfig()
+	tight := LinkStyle{}
+	tight.Radius.Set(0)
+	config.LinkStyles = map[string]LinkStyle{"tight": tight}
+	renderer := NewRendererWithConfig(config)
+
+	// Returns the outline of the link's first half
+	outline := func(link *Link) string {
+		link.Id, link.From, link.To = "A-B", "A", "B"
+		link.Route = vec.Polyline{{X: 0, Y: 0}, {X: 4, Y: 0}, {X: 4, Y: 4}}
+		obj, err := renderer.RenderLink(link)
+		if err != nil {
+			t.Fatalf("Error rendering link: %s", err)
+		}
+		seg := obj.(*canvas.Group).Children[0].(*canvas.Group)
+		return fmt.Sprint(seg.Children[0].(*canvas.Path).Data)
+	}
+
+	withRadius := func(set func(r *LinkRadius)) *LinkStyle {
+		style := &LinkStyle{}
+		set(&style.Radius)
+		return style
+	}
+	zero := outline(&Link{Style: withRadius(func(r *LinkRadius) { r.Set(0) })})
+	auto := outline(&Link{Style: withRadius(func(r *LinkRadius) { r.SetAuto() })})
+
+	if outline(&Link{}) == zero {
+		t.Errorf("Expected the default radius to round the corners")
+	}
+	if outline(&Link{Class: "tight"}) != zero {
+		t.Errorf("Expected the class's radius to be used")
+	}
+	if outline(&Link{Class: "tight", Style: withRadius(func(r *LinkRadius) { r.SetAuto() })}) != auto {
+		t.Errorf("Expected the link's own radius over its class's")
+	}
+	if auto == zero {
+		t.Errorf("Expected the auto radius to round the corners")
+	}
+}
+
+func TestRenderLinkDash(t *testing.T) {
+	config := DefaultRenderConfig()
+	config.LinkStyles = map[string]LinkStyle{
+		"backup":  {Dash: "dashed"},
+		"logical": {Dash: "dotted", Draw: "centerline"},
+	}
+	config.DefaultLinkStyle.StrokeWidth.Set(2)
+	renderer := NewRendererWithConfig(config)
+
+	render := func(class string) string {
+		link := &Link{
+			Id: "A-B", From: "A", To: "B", Class: class,
+			Route: vec.Polyline{{X: 0, Y: 0}, {X: 4, Y: 0}},
+		}
+		obj, err := renderer.RenderLink(link)
+		if err != nil {
+			t.Fatalf("Error rendering link: %s", err)
+		}
+		out := &strings.Builder{}
+		c := canvas.NewCanvas()
+		c.AppendChild(obj)
+		if err := c.Render(canvas.NewSVGRenderer(out)); err != nil {
+			t.Fatalf("Error rendering SVG: %s", err)
+		}
+		return out.String()
+	}
+
+	if svg := render(""); strings.Contains(svg, "stroke-dasharray") {
+		t.Errorf("Expected a solid link, got %s", svg)
+	}
+	// The outline's dashes are sized by its stroke
+	if svg := render("backup"); strings.Count(svg, `stroke-dasharray="6,4"`) != 2 {
+		t.Errorf("Expected a dashed outline on both halves, got %s", svg)
+	}
+	// The centerline's dots are as wide as the link
+	svg := render("logical")
+	for _, expected := range []string{`class="link-centerline"`, `fill="none"`, `stroke-dasharray="10,10"`, `stroke-width="10"`} {
+		if !strings.Contains(svg, expected) {
+			t.Errorf("Expected %s in the centerline, got %s", expected, svg)
+		}
+	}
+}
+
+func TestRenderPaths(t *testing.T) {
+	topo := &Topology{
+		Nodes: map[NodeId]*Node{
+			"A": {Id: "A", Pos: &[2]int16{0, 0}},
+			"B": {Id: "B", Pos: &[2]int16{4, 0}},
+			"C": {Id: "C", Pos: &[2]int16{4, 4}},
+		},
+		Links: map[LinkId]*Link{
+			"A-B": {Id: "A-B", From: "A", To: "B", Route: vec.Polyline{{X: 0, Y: 0}, {X: 4, Y: 0}}},
+			"B-C": {Id: "B-C", From: "B", To: "C", Route: vec.Polyline{{X: 4, Y: 0}, {X: 4, Y: 4}}},
+		},
+	}
+	renderer := NewRenderer()
+	if _, err := renderer.RenderTopology(topo); err != nil {
+		t.Fatalf("Error rendering topology: %s", err)
+	}
+
+	paths := []*Path{
+		{Id: "one", Nodes: []NodeId{"A", "B", "C"}},
+		{Id: "two", Nodes: []NodeId{"B", "A"}, Color: canvas.NewStyleColor(canvas.RGB(0, 0, 0))},
+		{Id: "three", Nodes: []NodeId{"C", "A"}},
+	}
+	obj, err := renderer.RenderPaths(topo, paths)
+	if err != nil {
+		t.Fatalf("Error rendering paths: %s", err)
+	}
+	c := canvas.NewCanvas()
+	c.AppendChild(obj)
+
+	// The paths sharing A-B are drawn either side of it
+	heights := map[string]float32{}
+	gaps := 0
+	for _, op := range c.Flatten() {
+		if slices.Contains(op.Classes, "path-gap") {
+			gaps++
+			continue
+		}
+		points := op.Contours[0].Points
+		if points[0].Y == points[len(points)-1].Y {
+			heights[op.Style.StrokeColor.Color().ToRGB().String()] = points[0].Y
+		}
+	}
+	if gaps != 1 {
+		t.Errorf("Expected the unlinked hop from C to A to be a gap, got %d", gaps)
+	}
+	if len(heights) != 2 {
+		t.Fatalf("Expected two paths along A-B, got %v", heights)
+	}
+	var ys []float32
+	for _, y := range heights {
+		ys = append(ys, y)
+	}
+	if f32Abs(ys[0]+ys[1]) > 0.01 || ys[0] == ys[1] {
+		t.Errorf("Expected the paths either side of A-B, got %v", heights)
+	}
+
+	if _, err := renderer.RenderPaths(topo, []*Path{{Nodes: []NodeId{"A", "Z"}}}); err == nil {
+		t.Errorf("Expected an error for a path through a missing node")
+	}
+}
+
+func TestPathJSON(t *testing.T) {
+	paths := []*Path{
+		{Id: "one", Nodes: []NodeId{"A", "B"}, Color: canvas.NewStyleColor(canvas.RGB(1, 0, 0))},
+		{Id: "two", Nodes: []NodeId{"B", "A"}},
+	}
+	data, err := json.Marshal(paths)
+	if err != nil {
+		t.Fatalf("Error encoding paths: %s", err)
+	}
+
+	var decoded []*Path
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Error decoding paths %s: %s", data, err)
+	}
+	if len(decoded) != 2 || !slices.Equal(decoded[0].Nodes, paths[0].Nodes) {
+		t.Fatalf("Expected the paths back, got %s", data)
+	}
+	if color := decoded[0].Color.Color(); color == nil || color.ToRGB().ToHex() != "#ff0000" {
+		t.Errorf("Expected the path to be red, got %s", data)
+	}
+	if !decoded[1].Color.IsZero() {
+		t.Errorf("Expected the path without a color to have none, got %s", data)
+	}
+}
@@ -0,0 +1,141 @@
+package raumata
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/REANNZ/raumata/option"
+)
+
+// LinkReport summarises the links in a topology, with their values,
+// labels and states as they are drawn, and the lengths of their
+// routes. It is intended to be saved alongside a rendered map, see
+// [LinkReport.WriteCSV] and [LinkReport.WriteJSON].
+//
+// The rows are sorted by link id.
+type LinkReport []LinkReportRow
+
+// A single link in a [LinkReport]
+type LinkReportRow struct {
+	Id        LinkId         `json:"id"`
+	From      NodeId         `json:"from"`
+	To        NodeId         `json:"to"`
+	Class     string         `json:"class,omitempty"`
+	State     string         `json:"state,omitempty"`
+	FromValue option.Float32 `json:"from_value"`
+	FromLabel string         `json:"from_label,omitempty"`
+	ToValue   option.Float32 `json:"to_value"`
+	ToLabel   string         `json:"to_label,omitempty"`
+	// Whether the link has a route, unrouted links have no length
+	Routed bool `json:"routed"`
+	// The length of the route in grid cells
+	Length float32 `json:"length"`
+	// The length of the route as drawn, in canvas units
+	CanvasLength float32 `json:"canvas_length"`
+}
+
+// SetCanvasLengths sets the canvas length in the route stats of each
+// routed link in the topology, using the scale of the renderer.
+// Rendering doesn't change the topology, so this is left to the
+// caller, e.g. before writing out the routed topology.
+func (r *Renderer) SetCanvasLengths(topo *Topology) {
+	scale := r.GetScale()
+	for _, link := range topo.Links {
+		if link != nil && link.RouteStats != nil {
+			link.RouteStats.CanvasLength = link.RouteStats.Length * scale
+		}
+	}
+}
+
+// LinkReport returns a report of the links in the topology. The
+// canvas lengths use the scale of the renderer.
+func (r *Renderer) LinkReport(topo *Topology) LinkReport {
+	report := make(LinkReport, 0, len(topo.Links))
+	scale := r.GetScale()
+
+	for id, link := range topo.Links {
+		if link == nil {
+			continue
+		}
+
+		row := LinkReportRow{
+			Id:     id,
+			From:   link.From,
+			To:     link.To,
+			Class:  link.Class,
+			State:  link.State,
+			Routed: len(link.Route) >= 2,
+		}
+		if link.FromData != nil {
+			row.FromValue = link.FromData.Value
+			row.FromLabel = link.FromData.Label
+		}
+		if link.ToData != nil {
+			row.ToValue = link.ToData.Value
+			row.ToLabel = link.ToData.Label
+		}
+		if row.Routed {
+			row.Length = link.Route.Length()
+			row.CanvasLength = row.Length * scale
+		}
+
+		report = append(report, row)
+	}
+
+	slices.SortFunc(report, func(a, b LinkReportRow) int {
+		return strings.Compare(string(a.Id), string(b.Id))
+	})
+
+	return report
+}
+
+// WriteCSV writes the report as CSV, with a header row. Values
+// that aren't set are left empty.
+func (rep LinkReport) WriteCSV(w io.Writer) error {
+	out := csv.NewWriter(w)
+
+	header := []string{
+		"id", "from", "to", "class", "state",
+		"from_value", "from_label", "to_value", "to_label",
+		"routed", "length", "canvas_length",
+	}
+	if err := out.Write(header); err != nil {
+		return err
+	}
+
+	formatValue := func(v option.Float32) string {
+		if !v.Valid {
+			return ""
+		}
+		return v.String()
+	}
+	formatFloat := func(f float32) string {
+		return strconv.FormatFloat(float64(f), 'g', -1, 32)
+	}
+
+	for _, row := range rep {
+		record := []string{
+			string(row.Id), string(row.From), string(row.To), row.Class, row.State,
+			formatValue(row.FromValue), row.FromLabel,
+			formatValue(row.ToValue), row.ToLabel,
+			strconv.FormatBool(row.Routed), formatFloat(row.Length), formatFloat(row.CanvasLength),
+		}
+		if err := out.Write(record); err != nil {
+			return err
+		}
+	}
+
+	out.Flush()
+	return out.Error()
+}
+
+// WriteJSON writes the report as an indented JSON array
+func (rep LinkReport) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(rep)
+}
@@ -0,0 +1,80 @@
+package raumata_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	. "github.com/REANNZ/raumata"
+	"github.com/REANNZ/raumata/vec"
+)
+
+func TestLinkReport(t *testing.T) {
+	topo := &Topology{
+		Links: map[LinkId]*Link{
+			"b": {
+				Id:       "b",
+				From:     "B",
+				To:       "C",
+				State:    "down",
+				Route:    vec.Polyline{{X: 0, Y: 0}, {X: 3, Y: 0}, {X: 3, Y: 4}},
+				FromData: &LinkData{Label: "1G, primary"},
+				ToData:   &LinkData{},
+			},
+			"a": {Id: "a", From: "A", To: "B"},
+		},
+	}
+	topo.Links["b"].FromData.Value.Set(0.25)
+
+	renderer := NewRenderer()
+	renderer.SetScale(10)
+	report := renderer.LinkReport(topo)
+
+	if len(report) != 2 || report[0].Id != "a" || report[1].Id != "b" {
+		t.Fatalf("Expected rows for a and b, got %v", report)
+	}
+	if report[0].Routed || report[0].Length != 0 {
+		t.Errorf("Expected a to be unrouted, got %v", report[0])
+	}
+	if report[1].Length != 7 || report[1].CanvasLength != 70 {
+		t.Errorf("Expected b to be 7 cells and 70 units long, got %v and %v",
+			report[1].Length, report[1].CanvasLength)
+	}
+
+	// Rendering leaves the route stats alone, the canvas lengths are
+	// only set when asked for
+	topo.Links["b"].RouteStats = &RouteStats{Length: 7}
+	if _, err := renderer.RenderTopology(topo); err != nil {
+		t.Fatalf("Error rendering topology: %s", err)
+	}
+	if stats := topo.Links["b"].RouteStats; stats.CanvasLength != 0 {
+		t.Errorf("Expected rendering not to set the canvas length, got %v", stats.CanvasLength)
+	}
+	renderer.SetCanvasLengths(topo)
+	if stats := topo.Links["b"].RouteStats; stats.CanvasLength != 70 {
+		t.Errorf("Expected a canvas length of 70, got %v", stats.CanvasLength)
+	}
+
+	out := &strings.Builder{}
+	if err := report.WriteCSV(out); err != nil {
+		t.Fatalf("Error writing CSV: %s", err)
+	}
+	expected := "id,from,to,class,state,from_value,from_label,to_value,to_label,routed,length,canvas_length\n" +
+		"a,A,B,,,,,,,false,0,0\n" +
+		"b,B,C,,down,0.25,\"1G, primary\",,,true,7,70\n"
+	if out.String() != expected {
+		t.Errorf("Incorrect CSV, expected %q, got %q", expected, out.String())
+	}
+
+	out.Reset()
+	if err := report.WriteJSON(out); err != nil {
+		t.Fatalf("Error writing JSON: %s", err)
+	}
+	var rows []map[string]any
+	if err := json.Unmarshal([]byte(out.String()), &rows); err != nil {
+		t.Fatalf("Error parsing JSON: %s", err)
+	}
+	if len(rows) != 2 || rows[0]["from_value"] != nil || rows[1]["from_value"] != 0.25 {
+		t.Errorf("Incorrect JSON values, got %s", out.String())
+	}
+}
@@ -0,0 +1,203 @@
+package raumata
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/REANNZ/raumata/grid"
+	"github.com/REANNZ/raumata/vec"
+)
+
+// ErrStaleCache is returned by [LinkRouter.LoadCache] when the
+// cache was saved for a different layout or router settings.
+var ErrStaleCache = errors.New("Route cache does not match the topology")
+
+// The data written by SaveCache
+type routeCache struct {
+	Key    string                  `json:"key"`
+	Routes map[LinkId]vec.Polyline `json:"routes"`
+}
+
+// SaveCache writes the current routes of all the links to w, along
+// with a key identifying the layout they were routed for.
+//
+// It should be called after [LinkRouter.RouteLinks] and before the
+// topology is changed in any other way, e.g. by [PlaceLabels].
+func (r *LinkRouter) SaveCache(w io.Writer) error {
+	key, err := r.cacheKey()
+	if err != nil {
+		return err
+	}
+
+	cache := routeCache{
+		Key:    key,
+		Routes: map[LinkId]vec.Polyline{},
+	}
+	for id, link := range r.topo.Links {
+		if link != nil && len(link.Route) > 0 {
+			cache.Routes[id] = link.Route
+		}
+	}
+
+	return json.NewEncoder(w).Encode(&cache)
+}
+
+// LoadCache reads routes previously written by [LinkRouter.SaveCache]
+// and sets them on the links. Afterwards, [LinkRouter.RouteLinks]
+// does nothing.
+//
+// If the node positions, link endpoints or other routing inputs have
+// changed since the cache was saved, the routes are not loaded and
+// [ErrStaleCache] is returned.
+func (r *LinkRouter) LoadCache(rd io.Reader) error {
+	var cache routeCache
+	if err := json.NewDecoder(rd).Decode(&cache); err != nil {
+		return err
+	}
+
+	key, err := r.cacheKey()
+	if err != nil {
+		return err
+	}
+	if cache.Key != key {
+		return ErrStaleCache
+	}
+
+	for id, link := range r.topo.Links {
+		route, ok := cache.Routes[id]
+		if link == nil || !ok || link.LockRoute {
+			continue
+		}
+		if len(link.Route) > 0 {
+			r.removeRoute(id, link.Route)
+		}
+		link.Route = route
+		r.addRoute(id, route)
+	}
+
+	r.cacheLoaded = true
+
+	return nil
+}
+
+// Returns a hash of everything that affects the routes found by the
+// router. Routes on links that aren't locked are not included, since
+// they are replaced by routing.
+func (r *LinkRouter) cacheKey() (string, error) {
+	type cacheNode struct {
+		Pos     *[2]int16    `json:"pos"`
+		Extents *NodeExtents `json:"extents"`
+		LabelAt Direction    `json:"label_at"`
+		KeepOut int16        `json:"keep_out"`
+		Sides   []Direction  `json:"attach_sides"`
+		Members []NodeId     `json:"members"`
+	}
+	type cacheLink struct {
+		From        NodeId       `json:"from"`
+		To          NodeId       `json:"to"`
+		Via         [][2]int16   `json:"via"`
+		ViaRadius   []int16      `json:"via_radius"`
+		RoutePrefix [][2]int16   `json:"route_prefix"`
+		RouteSuffix [][2]int16   `json:"route_suffix"`
+		Routing     string       `json:"routing"`
+		MaxDetour   float32      `json:"max_detour"`
+		AttachFrom  Direction    `json:"attach_from"`
+		AttachTo    Direction    `json:"attach_to"`
+		Corridor    []grid.Pos   `json:"corridor"`
+		Route       vec.Polyline `json:"route"`
+		SplitAt     *float32     `json:"split_at"`
+		Labels      [2]bool      `json:"labels"`
+		Wide        bool         `json:"wide"`
+		Class       string       `json:"class,omitempty"`
+	}
+
+	// encoding/json sorts map keys, so the encoding is stable
+	input := struct {
+		Nodes     map[NodeId]cacheNode `json:"nodes"`
+		Links     map[LinkId]cacheLink `json:"links"`
+		Obstacles []*Obstacle          `json:"obstacles"`
+		Settings  []any                `json:"settings"`
+		Extents   *[2]grid.Pos         `json:"extents"`
+	}{
+		Nodes:     map[NodeId]cacheNode{},
+		Links:     map[LinkId]cacheLink{},
+		Obstacles: r.topo.Obstacles,
+		Settings: []any{
+			r.AvoidNodes, r.AttachMultiCellsCardinal, r.SpreadLinks, r.SeparateLinks,
+			r.Orthogonal, r.Smooth, r.PullTaut, r.Bundle, r.PairDirected, r.StableTies,
+			r.OrderVias, r.WideLinkSize, r.NodeClearance, r.AvoidCornerSqueeze, r.ExtentBorder, r.AutoExpand,
+			r.MaxExtentGrowth,
+			// Functions can't be compared, only whether one
+			// is set is included
+			r.Metric != nil, r.CustomHeuristic != nil,
+			r.Heuristic, r.DiagonalCost, r.Config,
+		},
+	}
+
+	// Automatic extents grow as routes are added, but are
+	// determined by the nodes anyway
+	if r.explicitExtents {
+		input.Extents = &[2]grid.Pos{r.extentMin, r.extentMax}
+	}
+
+	for id, node := range r.topo.Nodes {
+		if node == nil || node.Pos == nil {
+			continue
+		}
+		input.Nodes[id] = cacheNode{
+			Pos:     node.Pos,
+			Extents: node.Extents,
+			LabelAt: node.LabelAt,
+			KeepOut: node.KeepOut,
+			Sides:   node.AttachSides,
+			Members: node.Members,
+		}
+	}
+	for id, link := range r.topo.Links {
+		if link == nil {
+			continue
+		}
+		l := cacheLink{
+			From:        link.From,
+			To:          link.To,
+			Via:         link.Via,
+			ViaRadius:   link.ViaRadius,
+			RoutePrefix: link.RoutePrefix,
+			RouteSuffix: link.RouteSuffix,
+			Routing:     link.Routing,
+			MaxDetour:   link.MaxDetour,
+			AttachFrom:  link.AttachFrom,
+			AttachTo:    link.AttachTo,
+			Corridor:    r.topo.corridorPath(link),
+			Wide:        r.isWide(id),
+		}
+		// The class only matters if it has its own costs
+		if r.Config.LinkClasses[link.Class] != nil {
+			l.Class = link.Class
+		}
+		if link.LockRoute {
+			l.Route = link.Route
+		}
+		// Only where the labels are matters, and only if the
+		// router keeps them clear
+		if r.Config.LinkLabelWeight > 0 {
+			l.SplitAt = link.SplitAt
+			l.Labels = [2]bool{
+				link.FromData != nil && link.FromData.Label != "",
+				link.ToData != nil && link.ToData.Label != "",
+			}
+		}
+		input.Links[id] = l
+	}
+
+	data, err := json.Marshal(&input)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,57 @@
+package raumata_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	. "github.com/REANNZ/raumata"
+	"github.com/REANNZ/raumata/testutil"
+)
+
+func TestRouteCache(t *testing.T) {
+	topo := testutil.Mesh(3, 3, 4, 1)
+	router := NewLinkRouter(topo)
+	router.RouteLinks()
+	want := SnapshotRoutes(topo)
+
+	var buf bytes.Buffer
+	if err := router.SaveCache(&buf); err != nil {
+		t.Fatalf("Error saving cache: %s", err)
+	}
+	data := buf.Bytes()
+
+	// The same layout, with different link data, loads the routes
+	cached := testutil.Mesh(3, 3, 4, 1)
+	for _, link := range cached.Links {
+		link.FromData = &LinkData{Label: "10G"}
+	}
+	router = NewLinkRouter(cached)
+	if err := router.LoadCache(bytes.NewReader(data)); err != nil {
+		t.Fatalf("Error loading cache: %s", err)
+	}
+	router.RouteLinks()
+	if diff := SnapshotRoutes(cached).Diff(want); len(diff) > 0 {
+		t.Errorf("Routes differ from the cache: %v", diff)
+	}
+
+	// Moving a node makes the cache stale
+	moved := testutil.Mesh(3, 3, 4, 1)
+	moved.Nodes["n0-0"].Pos = &[2]int16{-1, -1}
+	router = NewLinkRouter(moved)
+	if err := router.LoadCache(bytes.NewReader(data)); !errors.Is(err, ErrStaleCache) {
+		t.Errorf("Expected ErrStaleCache, got %v", err)
+	}
+	for id, link := range moved.Links {
+		if len(link.Route) > 0 {
+			t.Errorf("Route loaded for %s from a stale cache", id)
+		}
+	}
+
+	// Changing the router settings makes the cache stale
+	router = NewLinkRouter(testutil.Mesh(3, 3, 4, 1))
+	router.Orthogonal = true
+	if err := router.LoadCache(bytes.NewReader(data)); !errors.Is(err, ErrStaleCache) {
+		t.Errorf("Expected ErrStaleCache for different settings, got %v", err)
+	}
+}
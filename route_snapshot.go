@@ -0,0 +1,159 @@
+package raumata
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/REANNZ/raumata/grid"
+)
+
+// RouteSnapshot is a canonical, comparable representation of the
+// routes in a topology. It is intended for regression tests that
+// compare routes against known-good ("golden") routes.
+//
+// The routes are sorted by link id and all points are whole grid
+// positions.
+type RouteSnapshot []SnapshotRoute
+
+// The route of a single link in a [RouteSnapshot]
+type SnapshotRoute struct {
+	Id     LinkId
+	Points []grid.Pos
+}
+
+// SnapshotRoutes returns a snapshot of the current routes of the links
+// in the topology. Links without a route are included with no points.
+func SnapshotRoutes(topo *Topology) RouteSnapshot {
+	snapshot := make(RouteSnapshot, 0, len(topo.Links))
+
+	for id, link := range topo.Links {
+		if link == nil {
+			continue
+		}
+
+		points := make([]grid.Pos, 0, len(link.Route))
+		for _, p := range link.Route {
+			points = append(points, grid.FromVec(p))
+		}
+
+		snapshot = append(snapshot, SnapshotRoute{
+			Id:     id,
+			Points: points,
+		})
+	}
+
+	slices.SortFunc(snapshot, func(a, b SnapshotRoute) int {
+		return strings.Compare(string(a.Id), string(b.Id))
+	})
+
+	return snapshot
+}
+
+// RouteSnapshot routes all the links, as with [LinkRouter.RouteLinks],
+// and returns a snapshot of the resulting routes.
+func (r *LinkRouter) RouteSnapshot() RouteSnapshot {
+	r.RouteLinks()
+	return SnapshotRoutes(r.topo)
+}
+
+// Equal returns whether the two snapshots contain exactly the
+// same routes
+func (s RouteSnapshot) Equal(other RouteSnapshot) bool {
+	return len(s.Diff(other)) == 0
+}
+
+// Diff returns the ids of links whose routes differ between the
+// two snapshots, including links only present in one of them.
+func (s RouteSnapshot) Diff(other RouteSnapshot) []LinkId {
+	diff := []LinkId{}
+
+	i, j := 0, 0
+	for i < len(s) || j < len(other) {
+		switch {
+		case j >= len(other) || (i < len(s) && s[i].Id < other[j].Id):
+			diff = append(diff, s[i].Id)
+			i += 1
+		case i >= len(s) || other[j].Id < s[i].Id:
+			diff = append(diff, other[j].Id)
+			j += 1
+		default:
+			if !slices.Equal(s[i].Points, other[j].Points) {
+				diff = append(diff, s[i].Id)
+			}
+			i += 1
+			j += 1
+		}
+	}
+
+	return diff
+}
+
+// String returns the snapshot in a line-based text format suitable
+// for storing in a file, one link per line:
+//
+//	<link id>: x,y x,y ...
+//
+// Use [ParseRouteSnapshot] to read it back.
+func (s RouteSnapshot) String() string {
+	var b strings.Builder
+
+	for _, rt := range s {
+		b.WriteString(string(rt.Id))
+		b.WriteString(":")
+		for _, p := range rt.Points {
+			fmt.Fprintf(&b, " %d,%d", p.X, p.Y)
+		}
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+// ParseRouteSnapshot parses a snapshot in the format produced by
+// [RouteSnapshot.String]. Blank lines are ignored.
+func ParseRouteSnapshot(text string) (RouteSnapshot, error) {
+	snapshot := RouteSnapshot{}
+
+	for n, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		sep := strings.LastIndex(line, ":")
+		if sep < 0 {
+			return nil, fmt.Errorf("Line %d: missing ':' after link id", n+1)
+		}
+
+		rt := SnapshotRoute{
+			Id:     LinkId(line[:sep]),
+			Points: []grid.Pos{},
+		}
+
+		for _, field := range strings.Fields(line[sep+1:]) {
+			xStr, yStr, ok := strings.Cut(field, ",")
+			if !ok {
+				return nil, fmt.Errorf("Line %d: invalid point '%s'", n+1, field)
+			}
+			x, err := strconv.ParseInt(xStr, 10, 16)
+			if err != nil {
+				return nil, fmt.Errorf("Line %d: invalid point '%s': %w", n+1, field, err)
+			}
+			y, err := strconv.ParseInt(yStr, 10, 16)
+			if err != nil {
+				return nil, fmt.Errorf("Line %d: invalid point '%s': %w", n+1, field, err)
+			}
+			rt.Points = append(rt.Points, grid.Pos{X: int16(x), Y: int16(y)})
+		}
+
+		snapshot = append(snapshot, rt)
+	}
+
+	slices.SortFunc(snapshot, func(a, b SnapshotRoute) int {
+		return strings.Compare(string(a.Id), string(b.Id))
+	})
+
+	return snapshot, nil
+}
@@ -0,0 +1,46 @@
+package raumata_test
+
+import (
+	"slices"
+	"testing"
+
+	. "github.com/REANNZ/raumata"
+	"github.com/REANNZ/raumata/vec"
+)
+
+func TestRouteSnapshot(t *testing.T) {
+	topo := &Topology{
+		Links: map[LinkId]*Link{
+			"b": {Id: "b", Route: vec.Polyline{{X: 0, Y: 0}, {X: 1, Y: 1}}},
+			"a": {Id: "a", Route: vec.Polyline{{X: 2, Y: -1}, {X: 2, Y: 0}}},
+			"c": {Id: "c"},
+		},
+	}
+
+	snapshot := SnapshotRoutes(topo)
+
+	expected := "a: 2,-1 2,0\nb: 0,0 1,1\nc:\n"
+	if s := snapshot.String(); s != expected {
+		t.Errorf("Incorrect snapshot, expected %q, got %q", expected, s)
+	}
+
+	parsed, err := ParseRouteSnapshot(expected)
+	if err != nil {
+		t.Fatalf("Error parsing snapshot: %s", err)
+	}
+	if !parsed.Equal(snapshot) {
+		t.Errorf("Parsed snapshot doesn't match, got %q", parsed.String())
+	}
+
+	topo.Links["b"].Route = vec.Polyline{{X: 0, Y: 0}, {X: 1, Y: 0}}
+	delete(topo.Links, "c")
+
+	diff := SnapshotRoutes(topo).Diff(snapshot)
+	if !slices.Equal(diff, []LinkId{"b", "c"}) {
+		t.Errorf("Incorrect diff, expected [b c], got %v", diff)
+	}
+
+	if _, err := ParseRouteSnapshot("a 1,2"); err == nil {
+		t.Errorf("Expected error parsing invalid snapshot")
+	}
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/REANNZ/raumata"
+	"github.com/REANNZ/raumata/canvas"
+)
+
+// The number of events queued for a client before it is dropped as
+// too slow to keep up
+const eventQueueSize = 16
+
+// An event sent to the clients watching a map
+type event struct {
+	name string
+	id   string
+	data []byte
+}
+
+// LinkDelta is the new data and colors of a link, as sent in a
+// "links" event. The colors are the fills of the link's "fwd" and
+// "rev" segments.
+type LinkDelta struct {
+	Link      raumata.LinkId    `json:"link"`
+	FromData  *raumata.LinkData `json:"from_data,omitempty"`
+	ToData    *raumata.LinkData `json:"to_data,omitempty"`
+	FromColor canvas.StyleColor `json:"from_color"`
+	ToColor   canvas.StyleColor `json:"to_color"`
+}
+
+// Streams the changes to a map as server-sent events. The current map
+// is sent as a "map" event when the client connects, and again
+// whenever the topology is replaced. Changes to the link data are
+// sent as a "links" event, an object of [LinkDelta] by the element id
+// of the link, "L-" followed by the link id, so the map on the page
+// can be updated in place. The id of each event is the ETag of the
+// map after it.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// Subscribing while the map is locked means no change is missed
+	// between sending the map and the first event
+	name := r.PathValue("name")
+	s.mu.Lock()
+	m := s.maps[name]
+	if m == nil {
+		s.mu.Unlock()
+		http.NotFound(w, r)
+		return
+	}
+	events := make(chan event, eventQueueSize)
+	if s.watchers[name] == nil {
+		s.watchers[name] = map[chan event]struct{}{}
+	}
+	s.watchers[name][events] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.watchers[name], events)
+		if len(s.watchers[name]) == 0 {
+			delete(s.watchers, name)
+		}
+		s.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	writeEvent(w, event{name: "map", id: etag(m.svg), data: m.svg})
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(max(s.KeepAlive, time.Second))
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-events:
+			if !ok {
+				// Dropped for falling behind, the client reconnects
+				// and starts again from the whole map
+				return
+			}
+			writeEvent(w, e)
+		case <-keepAlive.C:
+			// Comments keep proxies from closing idle streams
+			fmt.Fprint(w, ": keep-alive\n\n")
+		}
+		flusher.Flush()
+	}
+}
+
+// Writes the event in the text/event-stream format, with a data line
+// for each line of its data
+func writeEvent(w http.ResponseWriter, e event) {
+	fmt.Fprintf(w, "event: %s\nid: %s\n", e.name, e.id)
+	for _, line := range strings.Split(string(e.data), "\n") {
+		fmt.Fprintf(w, "data: %s\n", line)
+	}
+	fmt.Fprint(w, "\n")
+}
+
+// Sends the event to the clients watching the map. Clients too slow to
+// take it are dropped. s.mu must be held.
+func (s *Server) publish(name string, e event) {
+	for events := range s.watchers[name] {
+		select {
+		case events <- e:
+		default:
+			delete(s.watchers[name], events)
+			close(events)
+		}
+	}
+}
+
+// Returns the deltas of the updated links, by element id
+func (s *Server) linkDeltas(m *storedMap, updates map[raumata.LinkId]LinkData) ([]byte, error) {
+	topo := &raumata.Topology{}
+	if err := json.Unmarshal(m.layout, topo); err != nil {
+		return nil, err
+	}
+
+	renderer := raumata.NewRendererWithConfig(s.RenderConfig)
+	deltas := map[string]LinkDelta{}
+	for id := range updates {
+		link := topo.GetLink(id)
+		if link == nil {
+			continue
+		}
+		data := m.data[id]
+		deltas["L-"+string(id)] = LinkDelta{
+			Link:      id,
+			FromData:  data.FromData,
+			ToData:    data.ToData,
+			FromColor: renderer.LinkDataColor(link, data.FromData),
+			ToColor:   renderer.LinkDataColor(link, data.ToData),
+		}
+	}
+	return json.Marshal(deltas)
+}
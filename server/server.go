@@ -0,0 +1,501 @@
+// Package server provides HTTP handlers for rendering maps, for
+// services that draw the same topologies over and over with new link
+// data, such as dashboards.
+//
+// Routing is the slow part of making a map, so the routed layout of
+// each topology is cached, keyed by a hash of the topology without
+// its link data. Changing only the data of a map renders it again
+// without routing it.
+//
+// The handlers are:
+//
+//	PUT  /maps/{name}         Stores the topology in the body as the map name
+//	PUT  /maps/{name}/data    Updates the data of the links in the map
+//	GET  /maps/{name}         Serves the map as SVG, or PNG with ?format=png
+//	GET  /maps/{name}/events  Streams changes to the map as server-sent events
+//	POST /render              Renders the topology in the body as SVG, or PNG
+//	                          with ?format=png, without storing it
+//
+// Maps are served with an ETag, so clients polling for changes get a
+// 304 Not Modified response until the map changes. Instead of polling,
+// dashboards can watch the events of a map, which carry the new colors
+// and labels of the links whose data changed, by their element ids in
+// the SVG.
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/REANNZ/raumata"
+	"github.com/REANNZ/raumata/canvas"
+	"github.com/REANNZ/raumata/vec"
+)
+
+// Server renders maps over HTTP, see the package documentation for
+// the handlers. The zero value is not usable, create one with
+// [NewServer].
+type Server struct {
+	// Settings used to draw, route and label the maps
+	RenderConfig *raumata.RenderConfig
+	RouterConfig *raumata.RouterConfig
+	LabelConfig  *raumata.LabelConfig
+	// Sets up each router before it routes a topology, e.g. to
+	// bundle links (default nil)
+	SetupRouter func(router *raumata.LinkRouter)
+	// Writes the canvas as a PNG image, e.g. with
+	// [canvas.CommandRasterizer]. PNG isn't served if this
+	// isn't set (default nil)
+	RasterizePNG canvas.Rasterizer
+	// The most routed layouts kept, the least recently used are
+	// dropped first (default 64)
+	MaxLayouts int
+	// The largest request body accepted, in bytes (default 16MiB)
+	MaxBodySize int64
+	// How often idle event streams are sent a comment, so proxies
+	// don't close them (default 30s)
+	KeepAlive time.Duration
+
+	mux *http.ServeMux
+	mu  sync.Mutex
+	// The routed topologies as JSON, by the hash of the topology
+	// they were routed from, and the hashes from least to most
+	// recently used
+	layouts     map[string][]byte
+	layoutOrder []string
+	maps        map[string]*storedMap
+	// The event queues of the clients watching each map
+	watchers map[string]map[chan event]struct{}
+}
+
+// A map stored with PUT, and its rendered forms
+type storedMap struct {
+	layout []byte
+	data   map[raumata.LinkId]LinkData
+	svg    []byte
+	png    []byte
+}
+
+// Returns a copy of the map with the updates applied to its data, not
+// yet rendered
+func (m *storedMap) withUpdates(updates map[raumata.LinkId]LinkData) *storedMap {
+	updated := &storedMap{
+		layout: m.layout,
+		data:   make(map[raumata.LinkId]LinkData, len(m.data)),
+	}
+	for id, data := range m.data {
+		updated.data[id] = data
+	}
+	for id, update := range updates {
+		data := updated.data[id]
+		if update.FromData != nil {
+			data.FromData = update.FromData
+		}
+		if update.ToData != nil {
+			data.ToData = update.ToData
+		}
+		updated.data[id] = data
+	}
+	return updated
+}
+
+// LinkData is the data for both directions of a link, as sent to
+// PUT /maps/{name}/data in an object by link id. Directions left out
+// keep their current data.
+type LinkData = raumata.LinkDataUpdate
+
+func NewServer() *Server {
+	s := &Server{
+		RenderConfig: raumata.DefaultRenderConfig(),
+		RouterConfig: raumata.DefaultRouterConfig(),
+		LabelConfig:  raumata.DefaultLabelConfig(),
+		MaxLayouts:   64,
+		MaxBodySize:  16 << 20,
+		KeepAlive:    30 * time.Second,
+		layouts:      map[string][]byte{},
+		maps:         map[string]*storedMap{},
+		watchers:     map[string]map[chan event]struct{}{},
+	}
+
+	s.mux = http.NewServeMux()
+	s.mux.HandleFunc("PUT /maps/{name}", s.handlePutMap)
+	s.mux.HandleFunc("PUT /maps/{name}/data", s.handlePutData)
+	s.mux.HandleFunc("GET /maps/{name}", s.handleGetMap)
+	s.mux.HandleFunc("GET /maps/{name}/events", s.handleEvents)
+	s.mux.HandleFunc("POST /render", s.handleRender)
+
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// An error with the HTTP status it is reported with
+type httpError struct {
+	status int
+	err    error
+}
+
+func (e *httpError) Error() string {
+	return e.err.Error()
+}
+
+func (e *httpError) Unwrap() error {
+	return e.err
+}
+
+func badRequest(format string, args ...any) error {
+	return &httpError{status: http.StatusBadRequest, err: fmt.Errorf(format, args...)}
+}
+
+// Writes err as a plain text response, with the status of an
+// httpError or 500
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	var httpErr *httpError
+	if errors.As(err, &httpErr) {
+		status = httpErr.status
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// Decodes the JSON body of the request into v
+func (s *Server) readBody(w http.ResponseWriter, r *http.Request, v any) error {
+	body := http.MaxBytesReader(w, r.Body, s.MaxBodySize)
+	if err := json.NewDecoder(body).Decode(v); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return &httpError{status: http.StatusRequestEntityTooLarge, err: err}
+		}
+		return badRequest("Error parsing request: %s", err)
+	}
+	return nil
+}
+
+func (s *Server) handlePutMap(w http.ResponseWriter, r *http.Request) {
+	topo := &raumata.Topology{}
+	if err := s.readBody(w, r, topo); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	layout, err := s.Layout(topo)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	m := &storedMap{
+		layout: layout,
+		data:   map[raumata.LinkId]LinkData{},
+	}
+	for id, link := range topo.Links {
+		if link != nil {
+			m.data[id] = LinkData{FromData: link.FromData, ToData: link.ToData}
+		}
+	}
+	if m.svg, err = s.render(layout, m.data, false); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	name := r.PathValue("name")
+	s.mu.Lock()
+	s.maps[name] = m
+	s.publish(name, event{name: "map", id: etag(m.svg), data: m.svg})
+	s.mu.Unlock()
+
+	w.Header().Set("ETag", etag(m.svg))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handlePutData(w http.ResponseWriter, r *http.Request) {
+	updates := map[raumata.LinkId]LinkData{}
+	if err := s.readBody(w, r, &updates); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	name := r.PathValue("name")
+	s.mu.Lock()
+	m := s.maps[name]
+	s.mu.Unlock()
+
+	// The stored map is replaced rather than changed, so it can be
+	// served while the new one is rendered. If another request
+	// replaces it in the meantime, the updates are applied again to
+	// that map, so neither request's data is lost
+	var updated *storedMap
+	var deltas []byte
+	for {
+		if m == nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		var err error
+		updated = m.withUpdates(updates)
+		if updated.svg, err = s.render(updated.layout, updated.data, false); err != nil {
+			writeError(w, err)
+			return
+		}
+		if deltas, err = s.linkDeltas(updated, updates); err != nil {
+			writeError(w, err)
+			return
+		}
+
+		s.mu.Lock()
+		if current := s.maps[name]; current != m {
+			s.mu.Unlock()
+			m = current
+			continue
+		}
+		s.maps[name] = updated
+		s.publish(name, event{name: "links", id: etag(updated.svg), data: deltas})
+		s.mu.Unlock()
+		break
+	}
+
+	w.Header().Set("ETag", etag(updated.svg))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleGetMap(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	m := s.maps[r.PathValue("name")]
+	s.mu.Unlock()
+	if m == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.URL.Query().Get("format") != "png" {
+		serveImage(w, r, m.svg, "image/svg+xml")
+		return
+	}
+	if s.RasterizePNG == nil {
+		http.Error(w, "PNG is not supported", http.StatusNotAcceptable)
+		return
+	}
+
+	// PNGs are only made when asked for
+	s.mu.Lock()
+	png := m.png
+	s.mu.Unlock()
+	if png == nil {
+		var err error
+		if png, err = s.render(m.layout, m.data, true); err != nil {
+			writeError(w, err)
+			return
+		}
+		s.mu.Lock()
+		m.png = png
+		s.mu.Unlock()
+	}
+	serveImage(w, r, png, "image/png")
+}
+
+func (s *Server) handleRender(w http.ResponseWriter, r *http.Request) {
+	asPNG := r.URL.Query().Get("format") == "png"
+	if asPNG && s.RasterizePNG == nil {
+		http.Error(w, "PNG is not supported", http.StatusNotAcceptable)
+		return
+	}
+
+	topo := &raumata.Topology{}
+	if err := s.readBody(w, r, topo); err != nil {
+		writeError(w, err)
+		return
+	}
+	layout, err := s.Layout(topo)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	data := map[raumata.LinkId]LinkData{}
+	for id, link := range topo.Links {
+		if link != nil {
+			data[id] = LinkData{FromData: link.FromData, ToData: link.ToData}
+		}
+	}
+	image, err := s.render(layout, data, asPNG)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	contentType := "image/svg+xml"
+	if asPNG {
+		contentType = "image/png"
+	}
+	serveImage(w, r, image, contentType)
+}
+
+// Writes the image with its ETag, or 304 Not Modified if the client
+// already has it
+func serveImage(w http.ResponseWriter, r *http.Request, image []byte, contentType string) {
+	tag := etag(image)
+	w.Header().Set("ETag", tag)
+	// Clients must check for a new map each time
+	w.Header().Set("Cache-Control", "no-cache")
+	if match := r.Header.Get("If-None-Match"); match == tag || match == "*" {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(image)
+}
+
+func etag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// Layout returns the routed topology, with its node labels placed,
+// as JSON. Topologies that only differ in their link data share a
+// layout, which is only routed the first time.
+func (s *Server) Layout(topo *raumata.Topology) ([]byte, error) {
+	key, err := layoutKey(topo)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	layout, ok := s.layouts[key]
+	if ok {
+		s.touchLayout(key)
+	}
+	s.mu.Unlock()
+	if ok {
+		return layout, nil
+	}
+
+	// The topology is routed from a copy, so the caller's isn't
+	// changed
+	routed := &raumata.Topology{}
+	if err := copyTopology(routed, topo); err != nil {
+		return nil, err
+	}
+	if err := routed.FitMembers(); err != nil {
+		return nil, badRequest("Error fitting nodes to their members: %s", err)
+	}
+
+	router := raumata.NewLinkRouterWithConfig(routed, s.RouterConfig)
+	if s.SetupRouter != nil {
+		s.SetupRouter(router)
+	}
+	router.RouteLinks()
+	raumata.PlaceLabelsWithConfig(routed, s.LabelConfig)
+
+	if layout, err = json.Marshal(routed); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	if _, ok := s.layouts[key]; !ok {
+		s.layouts[key] = layout
+	}
+	s.touchLayout(key)
+	for len(s.layoutOrder) > max(s.MaxLayouts, 1) {
+		delete(s.layouts, s.layoutOrder[0])
+		s.layoutOrder = s.layoutOrder[1:]
+	}
+	s.mu.Unlock()
+
+	return layout, nil
+}
+
+// Moves the layout to the most recently used end, s.mu must be held
+func (s *Server) touchLayout(key string) {
+	s.layoutOrder = slices.DeleteFunc(s.layoutOrder, func(k string) bool {
+		return k == key
+	})
+	s.layoutOrder = append(s.layoutOrder, key)
+}
+
+// Returns a hash of the topology without its link data. Where the
+// link labels are can change the routes and node labels, so whether
+// each direction has a label is kept.
+func layoutKey(topo *raumata.Topology) (string, error) {
+	stripped := &raumata.Topology{}
+	if err := copyTopology(stripped, topo); err != nil {
+		return "", err
+	}
+	strip := func(data *raumata.LinkData) *raumata.LinkData {
+		if data == nil || data.Label == "" {
+			return nil
+		}
+		return &raumata.LinkData{Label: "label"}
+	}
+	for _, link := range stripped.Links {
+		if link != nil {
+			link.FromData = strip(link.FromData)
+			link.ToData = strip(link.ToData)
+			link.RouteStats = nil
+		}
+	}
+
+	// encoding/json sorts map keys, so the encoding is stable
+	data, err := json.Marshal(stripped)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Deep copies src into dst through JSON
+func copyTopology(dst, src *raumata.Topology) error {
+	data, err := json.Marshal(src)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dst)
+}
+
+// Renders the layout with the link data, as SVG or PNG
+func (s *Server) render(layout []byte, data map[raumata.LinkId]LinkData, asPNG bool) ([]byte, error) {
+	topo := &raumata.Topology{}
+	if err := json.Unmarshal(layout, topo); err != nil {
+		return nil, err
+	}
+	for id, d := range data {
+		if link := topo.GetLink(id); link != nil {
+			link.FromData = d.FromData
+			link.ToData = d.ToData
+		}
+	}
+
+	renderer := raumata.NewRendererWithConfig(s.RenderConfig)
+	c := canvas.NewCanvas()
+	c.Margin = vec.Vec2{X: 10, Y: 10}
+	if err := renderer.RenderTopologyToCanvas(topo, c); err != nil {
+		return nil, &httpError{status: http.StatusUnprocessableEntity, err: err}
+	}
+
+	out := &bytes.Buffer{}
+	if asPNG {
+		if err := s.RasterizePNG(c, out); err != nil {
+			return nil, err
+		}
+		return out.Bytes(), nil
+	}
+
+	svg := canvas.NewSVGRenderer(out)
+	// Rendering the same data must give the same ETag
+	svg.Stable = true
+	if err := c.Render(svg); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
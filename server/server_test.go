@@ -0,0 +1,244 @@
+package server_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/REANNZ/raumata"
+	"github.com/REANNZ/raumata/canvas"
+	"github.com/REANNZ/raumata/server"
+)
+
+const topology = `{
+	"nodes": {
+		"A": {"pos": [0, 0], "label_at": "n"},
+		"B": {"pos": [4, 0], "label_at": "n"}
+	},
+	"links": {
+		"A-B": {"from": "A", "to": "B", "from_data": {"value": 0.1, "label": "10M"}}
+	}
+}`
+
+func do(t *testing.T, h http.Handler, method, path, body string, header ...string) *http.Response {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec.Result()
+}
+
+func TestServerMaps(t *testing.T) {
+	s := server.NewServer()
+	routed := 0
+	s.SetupRouter = func(router *raumata.LinkRouter) {
+		routed++
+	}
+
+	resp := do(t, s, "PUT", "/maps/core", topology)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected 204 storing the map, got %s", resp.Status)
+	}
+
+	resp = do(t, s, "GET", "/maps/core", "")
+	body, _ := io.ReadAll(resp.Body)
+	tag := resp.Header.Get("ETag")
+	if resp.StatusCode != http.StatusOK || tag == "" {
+		t.Fatalf("Expected the map with an ETag, got %s %q", resp.Status, tag)
+	}
+	if resp.Header.Get("Content-Type") != "image/svg+xml" || !strings.Contains(string(body), "10M") {
+		t.Errorf("Expected the map as SVG with the link label")
+	}
+
+	resp = do(t, s, "GET", "/maps/core", "", "If-None-Match", tag)
+	if resp.StatusCode != http.StatusNotModified {
+		t.Errorf("Expected 304 for an unchanged map, got %s", resp.Status)
+	}
+
+	// New data is drawn without routing the map again
+	resp = do(t, s, "PUT", "/maps/core/data", `{"A-B": {"to_data": {"value": 0.9, "label": "90M"}}}`)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected 204 updating the data, got %s", resp.Status)
+	}
+	resp = do(t, s, "GET", "/maps/core", "", "If-None-Match", tag)
+	body, _ = io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") == tag {
+		t.Errorf("Expected a new map after the data changed, got %s", resp.Status)
+	}
+	if !strings.Contains(string(body), "10M") || !strings.Contains(string(body), "90M") {
+		t.Errorf("Expected the labels of both directions")
+	}
+
+	// The same topology with different data shares the layout
+	resp = do(t, s, "POST", "/render", strings.Replace(topology, "10M", "20M", 1))
+	body, _ = io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "20M") {
+		t.Errorf("Expected the rendered map, got %s", resp.Status)
+	}
+	if routed != 1 {
+		t.Errorf("Expected the topology to be routed once, got %d", routed)
+	}
+
+	for _, path := range []string{"/maps/missing", "/maps/core?format=png"} {
+		if resp := do(t, s, "GET", path, ""); resp.StatusCode < 400 {
+			t.Errorf("Expected an error getting %s, got %s", path, resp.Status)
+		}
+	}
+	if resp := do(t, s, "PUT", "/maps/bad", "{"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a bad topology, got %s", resp.Status)
+	}
+}
+
+func TestServerConcurrentData(t *testing.T) {
+	topo := &raumata.Topology{Nodes: map[raumata.NodeId]*raumata.Node{}, Links: map[raumata.LinkId]*raumata.Link{}}
+	for i := range 16 {
+		from, to := raumata.NodeId(fmt.Sprintf("A%d", i)), raumata.NodeId(fmt.Sprintf("B%d", i))
+		topo.Nodes[from] = &raumata.Node{Id: from, Pos: &[2]int16{0, int16(i * 6)}}
+		topo.Nodes[to] = &raumata.Node{Id: to, Pos: &[2]int16{8, int16(i * 6)}}
+		id := raumata.LinkId(fmt.Sprintf("L%d", i))
+		topo.Links[id] = &raumata.Link{Id: id, From: from, To: to}
+	}
+	body, _ := json.Marshal(topo)
+
+	s := server.NewServer()
+	if resp := do(t, s, "PUT", "/maps/core", string(body)); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected 204 storing the map, got %s", resp.Status)
+	}
+
+	// Updates of different links sent at the same time are all kept
+	var wg sync.WaitGroup
+	for id := range topo.Links {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			body := fmt.Sprintf(`{%q: {"from_data": {"value": 0.5, "label": "%sM"}}}`, id, id[1:])
+			if resp := do(t, s, "PUT", "/maps/core/data", body); resp.StatusCode != http.StatusNoContent {
+				t.Errorf("Expected 204 updating the data, got %s", resp.Status)
+			}
+		}()
+	}
+	wg.Wait()
+
+	svg, _ := io.ReadAll(do(t, s, "GET", "/maps/core", "").Body)
+	for id := range topo.Links {
+		if !strings.Contains(string(svg), ">"+string(id[1:])+"M<") {
+			t.Errorf("Expected the map to have the label of %s", id)
+		}
+	}
+}
+
+func TestServerMultiCellLink(t *testing.T) {
+	s := server.NewServer()
+	s.SetupRouter = func(router *raumata.LinkRouter) {
+		router.Workers = 2
+	}
+
+	// Links between two multi-cell nodes can't be routed, but
+	// shouldn't stop the rest of the map being drawn
+	body := `{
+		"nodes": [
+			{"id": "A", "pos": [0, 0], "extents": {"width": 2, "height": 2}},
+			{"id": "B", "pos": [6, 0], "extents": {"width": 2, "height": 2}}
+		],
+		"links": [{"from": "A", "to": "B"}]
+	}`
+	resp := do(t, s, "POST", "/render", body)
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected the rendered map, got %s", resp.Status)
+	}
+}
+
+func TestServerPNG(t *testing.T) {
+	s := server.NewServer()
+	s.RasterizePNG = func(c *canvas.Canvas, w io.Writer) error {
+		_, err := io.WriteString(w, "png")
+		return err
+	}
+
+	do(t, s, "PUT", "/maps/core", topology)
+	resp := do(t, s, "GET", "/maps/core?format=png", "")
+	body, _ := io.ReadAll(resp.Body)
+	if resp.Header.Get("Content-Type") != "image/png" || string(body) != "png" {
+		t.Errorf("Expected the PNG, got %s %q", resp.Header.Get("Content-Type"), body)
+	}
+}
+
+// Reads the next event from the stream, skipping comments
+func readEvent(t *testing.T, r *bufio.Reader) (name string, data string) {
+	t.Helper()
+	lines := []string{}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Error reading event: %s", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && name != "":
+			return name, strings.Join(lines, "\n")
+		case strings.HasPrefix(line, "event: "):
+			name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			lines = append(lines, strings.TrimPrefix(line, "data: "))
+		}
+	}
+}
+
+func TestServerEvents(t *testing.T) {
+	s := server.NewServer()
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	do(t, s, "PUT", "/maps/core", topology)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", ts.URL+"/maps/core/events", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Error watching the map: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %q", resp.Header.Get("Content-Type"))
+	}
+	events := bufio.NewReader(resp.Body)
+
+	name, data := readEvent(t, events)
+	if name != "map" || !strings.Contains(data, "<svg") {
+		t.Errorf("Expected the map first, got %q event", name)
+	}
+
+	do(t, s, "PUT", "/maps/core/data", `{"A-B": {"to_data": {"value": 0.9, "label": "90M"}}}`)
+	name, data = readEvent(t, events)
+	deltas := map[string]server.LinkDelta{}
+	if err := json.Unmarshal([]byte(data), &deltas); name != "links" || err != nil {
+		t.Fatalf("Expected the link deltas, got %q event: %s", name, data)
+	}
+	delta, ok := deltas["L-A-B"]
+	if !ok || delta.ToData == nil || delta.ToData.Label != "90M" || delta.FromData == nil {
+		t.Errorf("Expected the data of both directions of A-B, got %s", data)
+	}
+	if delta.ToColor.Color() == nil {
+		t.Errorf("Expected a color for the new value")
+	}
+
+	do(t, s, "PUT", "/maps/core", topology)
+	if name, _ = readEvent(t, events); name != "map" {
+		t.Errorf("Expected the new map, got %q event", name)
+	}
+
+	if resp := do(t, s, "GET", "/maps/missing/events", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 watching a missing map, got %s", resp.Status)
+	}
+}
@@ -0,0 +1,198 @@
+package raumata
+
+import (
+	"slices"
+
+	"github.com/REANNZ/raumata/grid"
+	"github.com/REANNZ/raumata/vec"
+)
+
+// Pulls the routes of the links taut in turn, see PullTaut.
+// Orthogonal links are left as they are.
+func (r *LinkRouter) pullRoutesTaut(ids []LinkId) {
+	occupied := grid.Grid[[]LinkId]{}
+	for id, link := range r.topo.Links {
+		if link == nil {
+			continue
+		}
+		for _, pos := range routeCells(link.Route) {
+			occupied[pos] = append(occupied[pos], id)
+		}
+	}
+
+	for _, id := range ids {
+		link := r.topo.GetLink(id)
+		if link == nil || link.isOrthogonal(r.Orthogonal) {
+			continue
+		}
+
+		pulled := r.pullRouteTaut(id, link.Route, occupied)
+		for _, pos := range routeCells(link.Route) {
+			occupied[pos] = slices.DeleteFunc(occupied[pos], func(l LinkId) bool {
+				return l == id
+			})
+		}
+		for _, pos := range routeCells(pulled) {
+			occupied[pos] = append(occupied[pos], id)
+		}
+
+		r.moveRoute(id, link.Route, pulled)
+		link.Route = pulled
+	}
+}
+
+// Pulls the path taut, replacing runs of grid steps with straight
+// lines wherever every cell a line passes through is free, or is
+// already on the part of the path it replaces. This removes the
+// small zig-zags left by searching the grid.
+//
+// The route still visits the cell nearest each via point, prefix,
+// suffix and corridor position, and keeps its first and last steps
+// if the link attaches to a particular side of its nodes, or to a
+// multi-cell node with AttachMultiCellsCardinal.
+//
+// occupied has the cells taken by each link's route, including the
+// cells passed over by the straight lines of routes that have
+// already been pulled taut.
+func (r *LinkRouter) pullRouteTaut(id LinkId, path vec.Polyline, occupied grid.Grid[[]LinkId]) vec.Polyline {
+	link := r.topo.GetLink(id)
+	if link == nil || len(path) < 3 {
+		return path
+	}
+
+	cells := routeCells(path)
+	if len(cells) < 3 {
+		return path
+	}
+
+	// The cells the route has to keep, by their index in cells
+	keep := map[int]bool{}
+	for _, anchor := range r.topo.routeAnchors(link) {
+		pos := grid.Pos{X: anchor[0], Y: anchor[1]}
+		nearest := 0
+		for i, cell := range cells {
+			if cell.ChebyshevDistance(pos) < cells[nearest].ChebyshevDistance(pos) {
+				nearest = i
+			}
+		}
+		keep[nearest] = true
+	}
+	// Moving the first or last step could change the side of the
+	// node the link leaves from, or attach it to a multi-cell node
+	// diagonally
+	multiCell := func(id NodeId) bool {
+		node := r.topo.GetNode(id)
+		return r.AttachMultiCellsCardinal && node != nil && node.IsMultiCell()
+	}
+	if link.AttachFrom != DirectionNone || r.SeparateLinks || multiCell(link.From) {
+		keep[1] = true
+	}
+	if link.AttachTo != DirectionNone || r.SeparateLinks || multiCell(link.To) {
+		keep[len(cells)-2] = true
+	}
+
+	free := func(pos grid.Pos) bool {
+		if _, isNode := r.nodes[pos]; isNode {
+			return false
+		}
+		if r.nodeLabels[pos] || r.inObstacle(pos) {
+			return false
+		}
+		for _, node := range r.keepOut[pos] {
+			if node != link.From && node != link.To {
+				return false
+			}
+		}
+		others := func(ids []LinkId) bool {
+			return slices.ContainsFunc(ids, func(l LinkId) bool { return l != id })
+		}
+		return !others(occupied[pos]) && !others(r.wideCells[pos]) && !others(r.linkLabels[pos])
+	}
+
+	// Whether the line between cells i and j only passes through
+	// cells that are free or that the route already goes through
+	// between them
+	canPull := func(i, j int) bool {
+		for _, pos := range lineCells(cells[i], cells[j]) {
+			if !slices.Contains(cells[i:j+1], pos) && !free(pos) {
+				return false
+			}
+		}
+		return true
+	}
+
+	pulled := vec.Polyline{path[0]}
+	for i := 0; i < len(cells)-1; {
+		limit := i + 1
+		for limit < len(cells)-1 && !keep[limit] {
+			limit++
+		}
+
+		j := limit
+		for j > i+1 && !canPull(i, j) {
+			j--
+		}
+
+		if j == len(cells)-1 {
+			pulled = append(pulled, path[len(path)-1])
+		} else {
+			pulled = append(pulled, cells[j].ToVec())
+		}
+		i = j
+	}
+
+	return pulled
+}
+
+// Returns the cells passed through by each segment of the path in
+// order, see lineCells
+func routeCells(path vec.Polyline) []grid.Pos {
+	if len(path) == 0 {
+		return nil
+	}
+
+	cells := []grid.Pos{grid.FromVec(path[0])}
+	for i := 1; i < len(path); i++ {
+		line := lineCells(grid.FromVec(path[i-1]), grid.FromVec(path[i]))
+		cells = append(cells, line[1:]...)
+	}
+	return cells
+}
+
+// Returns the cells a straight line between the centres of a and b
+// passes through, in order from a to b. A line passing exactly
+// through the corner of two cells goes diagonally between them,
+// the same as a diagonal step in a route.
+func lineCells(a, b grid.Pos) []grid.Pos {
+	dx, dy := int(b.X)-int(a.X), int(b.Y)-int(a.Y)
+	sx, sy := int16(1), int16(1)
+	if dx < 0 {
+		dx, sx = -dx, -1
+	}
+	if dy < 0 {
+		dy, sy = -dy, -1
+	}
+
+	pos := a
+	cells := []grid.Pos{pos}
+	for ix, iy := 0, 0; ix < dx || iy < dy; {
+		// Compare where the line next crosses a vertical cell
+		// border with where it next crosses a horizontal one
+		next := (1+2*ix)*dy - (1+2*iy)*dx
+		switch {
+		case next == 0:
+			pos.X += sx
+			pos.Y += sy
+			ix++
+			iy++
+		case next < 0:
+			pos.X += sx
+			ix++
+		default:
+			pos.Y += sy
+			iy++
+		}
+		cells = append(cells, pos)
+	}
+	return cells
+}
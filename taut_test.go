@@ -0,0 +1,95 @@
+package raumata_test
+
+import (
+	"slices"
+	"testing"
+
+	. "github.com/REANNZ/raumata"
+	"github.com/REANNZ/raumata/grid"
+	"github.com/REANNZ/raumata/vec"
+)
+
+func TestLinkRouterPullTaut(t *testing.T) {
+	newTopo := func(blocker [2]int16) *Topology {
+		return &Topology{
+			Nodes: map[NodeId]*Node{
+				"A": {Id: "A", Pos: &[2]int16{0, 0}},
+				"B": {Id: "B", Pos: &[2]int16{7, 3}},
+				"C": {Id: "C", Pos: &blocker},
+			},
+			Links: map[LinkId]*Link{
+				"A-B": {Id: "A-B", From: "A", To: "B"},
+			},
+		}
+	}
+
+	// Searching the grid gives a straight run then a diagonal one
+	topo := newTopo([2]int16{-1, -1})
+	NewLinkRouter(topo).RouteLinks()
+	if route := topo.Links["A-B"].Route.Simplify(); len(route) < 3 {
+		t.Fatalf("Expected the grid route to bend, got %v", route)
+	}
+
+	topo = newTopo([2]int16{-1, -1})
+	router := NewLinkRouter(topo)
+	router.PullTaut = true
+	router.RouteLinks()
+	expected := vec.Polyline{{X: 0, Y: 0}, {X: 7, Y: 3}}
+	if route := topo.Links["A-B"].Route; !slices.Equal(route, expected) {
+		t.Errorf("Expected a straight route, got %v", route)
+	}
+
+	// The straight line would pass through C, so the route only
+	// straightens where it can go around it
+	topo = newTopo([2]int16{3, 1})
+	router = NewLinkRouter(topo)
+	router.PullTaut = true
+	router.RouteLinks()
+	route := topo.Links["A-B"].Route
+	if len(route) < 3 {
+		t.Fatalf("Expected the route to bend around C, got %v", route)
+	}
+	for i := 1; i < len(route); i++ {
+		a, b := route[i-1], route[i]
+		for s := float32(0); s <= 1; s += 0.01 {
+			if grid.FromVec(a.Add(b.Sub(a).Mul(s))) == (grid.Pos{X: 3, Y: 1}) {
+				t.Fatalf("Expected the route not to pass through C, got %v", route)
+			}
+		}
+	}
+}
+
+func TestLinkRouterPullTautMultiCell(t *testing.T) {
+	// A straight line from A to B would attach to B's corner
+	// diagonally
+	for _, id := range []LinkId{"A-B", "B-A"} {
+		topo := &Topology{
+			Nodes: map[NodeId]*Node{
+				"A": {Id: "A", Pos: &[2]int16{0, 0}},
+				"B": {Id: "B", Pos: &[2]int16{10, 4}, Extents: &NodeExtents{Width: 3, Height: 3}},
+			},
+			Links: map[LinkId]*Link{},
+		}
+		link := &Link{Id: id, From: "A", To: "B"}
+		if id == "B-A" {
+			link.From, link.To = "B", "A"
+		}
+		topo.Links[id] = link
+
+		router := NewLinkRouter(topo)
+		router.PullTaut = true
+		router.RouteLinks()
+
+		route := link.Route
+		if len(route) < 3 {
+			t.Fatalf("Expected %s to keep its step into B, got %v", id, route)
+		}
+		step := route[len(route)-1].Sub(route[len(route)-2])
+		if id == "B-A" {
+			step = route[1].Sub(route[0])
+		}
+		if step.X != 0 && step.Y != 0 {
+			t.Errorf("Expected %s to attach to B in a cardinal direction, got %v", id, route)
+		}
+	}
+}
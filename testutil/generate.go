@@ -0,0 +1,164 @@
+// Package testutil generates synthetic topologies for benchmarking and
+// fuzzing the link router and renderer.
+//
+// All the generators are deterministic, the same arguments always
+// give the same topology, so results can be compared across versions.
+package testutil
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/REANNZ/raumata"
+)
+
+// The number of grid cells between neighbouring nodes
+const spacing = 3
+
+func newTopology() *raumata.Topology {
+	return &raumata.Topology{
+		Nodes: map[raumata.NodeId]*raumata.Node{},
+		Links: map[raumata.LinkId]*raumata.Link{},
+	}
+}
+
+func addNode(topo *raumata.Topology, id string, x, y int) {
+	nodeId := raumata.NodeId(id)
+	topo.Nodes[nodeId] = &raumata.Node{
+		Id:    nodeId,
+		Pos:   &[2]int16{int16(x), int16(y)},
+		Label: id,
+	}
+}
+
+// Adds a link between the two nodes, the link id is made unique
+// in the same way as when parsing a topology
+func addLink(topo *raumata.Topology, from, to string) {
+	id := raumata.LinkId(fmt.Sprintf("%s-%s", from, to))
+	for n := 2; topo.Links[id] != nil; n++ {
+		id = raumata.LinkId(fmt.Sprintf("%s-%s-%d", from, to, n))
+	}
+
+	topo.Links[id] = &raumata.Link{
+		Id:   id,
+		From: raumata.NodeId(from),
+		To:   raumata.NodeId(to),
+	}
+}
+
+// Ring returns a topology of n nodes placed around the edge of a
+// square, each linked to the next, with the last linked back to
+// the first.
+func Ring(n int) *raumata.Topology {
+	topo := newTopology()
+	if n <= 0 {
+		return topo
+	}
+
+	// Walk around the edge of the smallest square that fits
+	// all the nodes
+	side := (n + 3) / 4
+	for i := 0; i < n; i++ {
+		edge, offset := i/side, i%side
+		var x, y int
+		switch edge {
+		case 0:
+			x, y = offset, 0
+		case 1:
+			x, y = side, offset
+		case 2:
+			x, y = side-offset, side
+		default:
+			x, y = 0, side-offset
+		}
+		addNode(topo, fmt.Sprintf("n%d", i), x*spacing, y*spacing)
+	}
+
+	if n > 1 {
+		for i := 0; i < n; i++ {
+			addLink(topo, fmt.Sprintf("n%d", i), fmt.Sprintf("n%d", (i+1)%n))
+		}
+	}
+
+	return topo
+}
+
+// Mesh returns a topology of width×height nodes on a grid, each
+// linked to its right and lower neighbours. Then extra links
+// between random pairs of nodes are added, chosen using seed.
+func Mesh(width, height, extra int, seed int64) *raumata.Topology {
+	topo := newTopology()
+	if width <= 0 || height <= 0 {
+		return topo
+	}
+
+	name := func(x, y int) string {
+		return fmt.Sprintf("n%d-%d", x, y)
+	}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			addNode(topo, name(x, y), x*spacing, y*spacing)
+			if x > 0 {
+				addLink(topo, name(x-1, y), name(x, y))
+			}
+			if y > 0 {
+				addLink(topo, name(x, y-1), name(x, y))
+			}
+		}
+	}
+
+	if width*height < 2 {
+		return topo
+	}
+
+	rng := rand.New(rand.NewSource(seed))
+	for i := 0; i < extra; i++ {
+		a := rng.Intn(width * height)
+		b := rng.Intn(width*height - 1)
+		if b >= a {
+			b += 1
+		}
+		addLink(topo, name(a%width, a/width), name(b%width, b/width))
+	}
+
+	return topo
+}
+
+// TwoTier returns a topology with a row of core nodes linked in a
+// chain, and a row of edge nodes below them. Each core node has
+// edgePerCore edge nodes, each linked to their own core node and
+// the next one along, so the links from neighbouring groups cross.
+func TwoTier(core, edgePerCore int) *raumata.Topology {
+	topo := newTopology()
+	if core <= 0 {
+		return topo
+	}
+
+	groupWidth := max(edgePerCore, 1)
+
+	coreName := func(i int) string {
+		return fmt.Sprintf("c%d", i)
+	}
+
+	for i := 0; i < core; i++ {
+		x := i*groupWidth*spacing + (groupWidth-1)*spacing/2
+		addNode(topo, coreName(i), x, 0)
+		if i > 0 {
+			addLink(topo, coreName(i-1), coreName(i))
+		}
+	}
+
+	for i := 0; i < core; i++ {
+		for j := 0; j < edgePerCore; j++ {
+			id := fmt.Sprintf("e%d-%d", i, j)
+			addNode(topo, id, (i*groupWidth+j)*spacing, 3*spacing)
+			addLink(topo, coreName(i), id)
+			if core > 1 {
+				addLink(topo, coreName((i+1)%core), id)
+			}
+		}
+	}
+
+	return topo
+}
@@ -0,0 +1,51 @@
+package testutil_test
+
+import (
+	"testing"
+
+	"github.com/REANNZ/raumata"
+	. "github.com/REANNZ/raumata/testutil"
+)
+
+func checkTopology(t *testing.T, name string, topo *raumata.Topology, nodes, links int) {
+	t.Helper()
+
+	if len(topo.Nodes) != nodes {
+		t.Errorf("%s: expected %d nodes, got %d", name, nodes, len(topo.Nodes))
+	}
+	if len(topo.Links) != links {
+		t.Errorf("%s: expected %d links, got %d", name, links, len(topo.Links))
+	}
+
+	positions := map[[2]int16]raumata.NodeId{}
+	for id, node := range topo.Nodes {
+		if other, ok := positions[*node.Pos]; ok {
+			t.Errorf("%s: nodes %s and %s have the same position", name, id, other)
+		}
+		positions[*node.Pos] = id
+	}
+
+	for id, link := range topo.Links {
+		if topo.Nodes[link.From] == nil || topo.Nodes[link.To] == nil {
+			t.Errorf("%s: link %s references a missing node", name, id)
+		}
+	}
+}
+
+func TestGenerators(t *testing.T) {
+	checkTopology(t, "ring", Ring(10), 10, 10)
+	checkTopology(t, "mesh", Mesh(4, 3, 5, 1), 12, 17+5)
+	checkTopology(t, "two-tier", TwoTier(3, 4), 15, 2+3*4*2)
+}
+
+func TestMeshDeterministic(t *testing.T) {
+	a := Mesh(5, 5, 10, 42)
+	b := Mesh(5, 5, 10, 42)
+
+	for id, link := range a.Links {
+		other := b.Links[id]
+		if other == nil || other.From != link.From || other.To != link.To {
+			t.Errorf("Link %s differs between meshes with the same seed", id)
+		}
+	}
+}
@@ -5,6 +5,9 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/REANNZ/raumata/canvas"
+	"github.com/REANNZ/raumata/grid"
+	"github.com/REANNZ/raumata/internal/f32"
 	"github.com/REANNZ/raumata/option"
 	"github.com/REANNZ/raumata/vec"
 )
@@ -17,10 +20,33 @@ type Node struct {
 	Id      NodeId     `json:"id"`
 	Pos     *[2]int16  `json:"pos,omitempty"`
 	Label   string     `json:"label,omitempty"`
-	LabelAt string     `json:"label_at,omitempty"`
+	LabelAt Direction  `json:"label_at,omitempty"`
 	Class   string     `json:"class,omitempty"`
 	Style   *NodeStyle `json:"style,omitempty"`
 	Extents *NodeExtents `json:"extents,omitempty"`
+	// Arbitrary metadata about the node, e.g. model or site
+	Meta    map[string]any `json:"meta,omitempty"`
+	// Number of cells around the node that links not connected
+	// to the node must avoid
+	KeepOut int16          `json:"keep_out,omitempty"`
+	// Offset from the drawn center of the node to the point
+	// where links attach, in canvas units
+	Anchor  *[2]float32    `json:"anchor,omitempty"`
+	// Label styles for the node, e.g. the font
+	LabelStyle *LabelStyle `json:"label_style,omitempty"`
+	// The sides of a multi-cell node that links can attach to, any
+	// of "n", "e", "s" and "w". If empty, links attach to any side.
+	AttachSides []Direction `json:"attach_sides,omitempty"`
+	// Nodes this node is drawn around, such as the devices at a
+	// site. If set, the position and extents are worked out from
+	// the members by [Topology.FitMembers], and links to members
+	// can pass through this node.
+	Members []NodeId `json:"members,omitempty"`
+	// Cells left between the members and the edge of the node
+	MemberPadding int16 `json:"member_padding,omitempty"`
+	// How important the node is, e.g. higher for core routers than
+	// for CPEs, used to size it with [RenderConfig.NodeWeightSizes]
+	Weight *float32 `json:"weight,omitempty"`
 }
 
 type NodeExtents struct {
@@ -40,11 +66,73 @@ type Link struct {
 	Via      [][2]int16   `json:"via,omitempty"`
 	SplitAt  *float32     `json:"split_at,omitempty"`
 	Class    string       `json:"class,omitempty"`
+	// The operational state of the link, such as "down", drawn with
+	// the style for the state in the config
 	State    string       `json:"state,omitempty"`
 	Style    *LinkStyle   `json:"style,omitempty"`
 	Route    vec.Polyline `json:"route,omitempty"`
 	FromData *LinkData    `json:"from_data,omitempty"`
 	ToData   *LinkData    `json:"to_data,omitempty"`
+	// Small labels drawn by each end of the link, such as the
+	// names of the interfaces at each node
+	FromLabel string `json:"from_label,omitempty"`
+	ToLabel   string `json:"to_label,omitempty"`
+
+	// Cells the route must start with after leaving the "from" node
+	RoutePrefix [][2]int16 `json:"route_prefix,omitempty"`
+	// Cells the route must end with before reaching the "to" node
+	RouteSuffix [][2]int16 `json:"route_suffix,omitempty"`
+	// For each via point, how many cells away the route can pass
+	// it instead of going through it. Missing values are 0.
+	ViaRadius   []int16    `json:"via_radius,omitempty"`
+	// Overrides the routing style for the link, either "orthogonal"
+	// or "any". If empty, the router's default is used.
+	Routing     string     `json:"routing,omitempty"`
+	// The side of the "from" node the route must leave from, a
+	// compass direction such as "e" or "nw". If empty, any side.
+	AttachFrom  Direction  `json:"attach_from,omitempty"`
+	// The side of the "to" node the route must arrive at
+	AttachTo    Direction  `json:"attach_to,omitempty"`
+	// Prevents the router from changing Route. Other links are
+	// still routed around it.
+	LockRoute   bool       `json:"lock_route,omitempty"`
+	// Label styles for the link, e.g. the font
+	LabelStyle  *LabelStyle `json:"label_style,omitempty"`
+	// The longest the route can be, as a multiple of the straight
+	// distance through the via points, before the router stops
+	// avoiding other links. 0 means no limit.
+	MaxDetour   float32    `json:"max_detour,omitempty"`
+	// The name of a corridor in the topology the route must follow,
+	// after the via points
+	Corridor    string     `json:"corridor,omitempty"`
+	// Arbitrary metadata about the link, e.g. where its data comes
+	// from
+	Meta        map[string]any `json:"meta,omitempty"`
+	// Measurements of the route, set by the router. Not used as
+	// input.
+	RouteStats  *RouteStats `json:"route_stats,omitempty"`
+}
+
+// The states of a link with default styles, see
+// [RenderConfig.LinkStateStyles]. Other states can be given styles
+// in the config too.
+const (
+	LinkStateUp          = "up"
+	LinkStateDown        = "down"
+	LinkStateAdminDown   = "admin-down"
+	LinkStateMaintenance = "maintenance"
+)
+
+// Measurements of a link's route, so long detours can be found
+// after routing
+type RouteStats struct {
+	// The length of the route in grid cells
+	Length       float32 `json:"length"`
+	// The length of the route on the canvas, only set by
+	// [Renderer.SetCanvasLengths]
+	CanvasLength float32 `json:"canvas_length,omitempty"`
+	// The number of times the route changes direction
+	Bends        int     `json:"bends"`
 }
 
 // Data associated with a link
@@ -53,12 +141,32 @@ type LinkData struct {
 	Value option.Float32 `json:"value"`
 	// The label for the link, typically the amount of traffic
 	Label string `json:"label"`
+	// Overrides the color of the link, instead of using Value
+	// with the color scale
+	Color canvas.StyleColor `json:"color,omitempty"`
+}
+
+// MarshalJSON leaves the color out when it isn't set, which
+// omitempty alone doesn't do for a struct
+func (d LinkData) MarshalJSON() ([]byte, error) {
+	type linkData LinkData
+	data := struct {
+		*linkData
+		Color *canvas.StyleColor `json:"color,omitempty"`
+	}{linkData: (*linkData)(&d)}
+	if !d.Color.IsZero() {
+		data.Color = &d.Color
+	}
+	return json.Marshal(data)
 }
 
 // A full map topology
 type Topology struct {
-	Nodes map[NodeId]*Node `json:"nodes"`
-	Links map[LinkId]*Link `json:"links"`
+	Nodes       map[NodeId]*Node     `json:"nodes"`
+	Links       map[LinkId]*Link     `json:"links"`
+	Obstacles   []*Obstacle          `json:"obstacles,omitempty"`
+	Corridors   map[string]*Corridor `json:"corridors,omitempty"`
+	Decorations []*Decoration        `json:"decorations,omitempty"`
 }
 
 func (t *Topology) GetNode(id NodeId) *Node {
@@ -89,10 +197,17 @@ func (id LinkId) String() string {
 //
 // Link ids, if not provided, are determined automatically from the
 // "from" and "to" fields of the link.
+//
+// The optional "obstacles" field is an array of [Obstacle]s, and the
+// optional "corridors" field is an object of named [Corridor]s. The
+// optional "decorations" field is an array of [Decoration]s.
 func (t *Topology) UnmarshalJSON(data []byte) error {
 	var topLevel struct {
-		Nodes *json.RawMessage
-		Links *json.RawMessage
+		Nodes       *json.RawMessage
+		Links       *json.RawMessage
+		Obstacles   []*Obstacle
+		Corridors   map[string]*Corridor
+		Decorations []*Decoration
 	}
 
 	err := json.Unmarshal(data, &topLevel)
@@ -111,6 +226,9 @@ func (t *Topology) UnmarshalJSON(data []byte) error {
 			}
 
 			for _, n := range array {
+				if n == nil {
+					return errors.New("Node must not be null")
+				}
 				if n.Id == "" {
 					return errors.New("Node must have an id")
 				}
@@ -126,6 +244,9 @@ func (t *Topology) UnmarshalJSON(data []byte) error {
 				return err
 			}
 			for id, n := range nodeMap {
+				if n == nil {
+					return fmt.Errorf("Node '%s' must not be null", id)
+				}
 				n.Id = id
 			}
 		} else {
@@ -151,6 +272,9 @@ func (t *Topology) UnmarshalJSON(data []byte) error {
 			}
 
 			for _, l := range array {
+				if l == nil {
+					return errors.New("Link must not be null")
+				}
 				id := l.Id
 				if id == "" {
 					// Automatically determine an id
@@ -181,6 +305,9 @@ func (t *Topology) UnmarshalJSON(data []byte) error {
 			}
 
 			for id, link := range linkMap {
+				if link == nil {
+					return fmt.Errorf("Link '%s' must not be null", id)
+				}
 				link.Id = id
 			}
 		} else {
@@ -196,6 +323,117 @@ func (t *Topology) UnmarshalJSON(data []byte) error {
 		}
 	}
 
+	for _, o := range topLevel.Obstacles {
+		if o == nil {
+			return errors.New("Obstacle must not be null")
+		}
+		t.Obstacles = append(t.Obstacles, o)
+	}
+
+	for name, c := range topLevel.Corridors {
+		if c == nil {
+			return fmt.Errorf("Corridor '%s' must not be null", name)
+		}
+		if t.Corridors == nil {
+			t.Corridors = map[string]*Corridor{}
+		}
+		t.Corridors[name] = c
+	}
+
+	for id, link := range t.Links {
+		if link != nil && link.Corridor != "" && t.Corridors[link.Corridor] == nil {
+			return fmt.Errorf("Link '%s' has unknown corridor '%s'", id, link.Corridor)
+		}
+	}
+
+	for _, d := range topLevel.Decorations {
+		if d == nil {
+			return errors.New("Decoration must not be null")
+		}
+		t.Decorations = append(t.Decorations, d)
+	}
+
+	return nil
+}
+
+// Returns all the positions a route for the link must pass through
+// in order: the route prefix, the via points, the link's corridor,
+// then the route suffix
+func (t *Topology) routeAnchors(l *Link) [][2]int16 {
+	corridor := t.corridorPath(l)
+	if len(l.RoutePrefix) == 0 && len(l.RouteSuffix) == 0 && len(corridor) == 0 {
+		return l.Via
+	}
+
+	anchors := make([][2]int16, 0, len(l.RoutePrefix)+len(l.Via)+len(corridor)+len(l.RouteSuffix))
+	anchors = append(anchors, l.RoutePrefix...)
+	anchors = append(anchors, l.Via...)
+	for _, pos := range corridor {
+		anchors = append(anchors, [2]int16{pos.X, pos.Y})
+	}
+	anchors = append(anchors, l.RouteSuffix...)
+
+	return anchors
+}
+
+// Returns the cells the link's labels are expected to be drawn in
+// if it has the given route, halfway along each side of the split
+func (l *Link) labelCells(path vec.Polyline) []grid.Pos {
+	if len(path) < 2 {
+		return nil
+	}
+
+	// The renderer also moves the split point for nodes of
+	// different sizes, which isn't known here
+	var splitAt float32 = 0.5
+	if l.SplitAt != nil {
+		splitAt = *l.SplitAt
+	}
+
+	cells := []grid.Pos{}
+	if l.FromData != nil && l.FromData.Label != "" {
+		cells = append(cells, grid.FromVec(path.Interpolate(splitAt/2)))
+	}
+	if l.ToData != nil && l.ToData.Label != "" {
+		cells = append(cells, grid.FromVec(path.Interpolate((1+splitAt)/2)))
+	}
+	return cells
+}
+
+// Returns how close, in cells, the route must pass to the via
+// point with index i
+func (l *Link) viaRadius(i int) int16 {
+	if i < len(l.ViaRadius) {
+		return max(l.ViaRadius[i], 0)
+	}
+	return 0
+}
+
+// Returns whether the link must be routed with only horizontal
+// and vertical steps, given the router's default
+func (l *Link) isOrthogonal(def bool) bool {
+	switch l.Routing {
+	case "orthogonal":
+		return true
+	case "any":
+		return false
+	default:
+		return def
+	}
+}
+
+// Checks the node's attach sides are all north, east, south or
+// west, the only sides of a multi-cell node links can attach to
+func (n *Node) UnmarshalJSON(data []byte) error {
+	type node Node
+	if err := json.Unmarshal(data, (*node)(n)); err != nil {
+		return err
+	}
+	for _, side := range n.AttachSides {
+		if !side.IsCardinal() {
+			return fmt.Errorf("Invalid attach side '%s', expected 'n', 'e', 's' or 'w'", side)
+		}
+	}
 	return nil
 }
 
@@ -228,3 +466,15 @@ func (n *Node) GetExtents() (min, max vec.Vec2) {
 		return p.Sub(offset), p.Add(offset)
 	}
 }
+
+// Returns the grid cells the node covers
+func (n *Node) cells() []grid.Pos {
+	minVec, maxVec := n.GetExtents()
+	cells := []grid.Pos{}
+	for y := int16(f32.Ceil(minVec.Y)); y < int16(f32.Ceil(maxVec.Y)); y++ {
+		for x := int16(f32.Ceil(minVec.X)); x < int16(f32.Ceil(maxVec.X)); x++ {
+			cells = append(cells, grid.Pos{X: x, Y: y})
+		}
+	}
+	return cells
+}
@@ -1,10 +1,12 @@
 package raumata_test
 
 import (
+	"context"
 	"encoding/json"
 	"testing"
 
 	. "github.com/REANNZ/raumata"
+	"github.com/REANNZ/raumata/canvas"
 )
 
 func TestUnmarshalTopology(t *testing.T) {
@@ -44,3 +46,256 @@ func TestUnmarshalTopology(t *testing.T) {
 		return
 	}
 }
+
+func FuzzUnmarshalTopology(f *testing.F) {
+	f.Add(`{"nodes": {"a": {"pos": [0, 0]}}, "links": {"a-a": {"from": "a", "to": "a"}}}`)
+	f.Add(`{"nodes": [{"id": "a"}, {"id": "b"}], "links": [{"from": "a", "to": "b"}]}`)
+	f.Add(`{"nodes": {"a": null}}`)
+	f.Add(`{"links": [null]}`)
+	f.Add(`{"nodes": "", "links": 1}`)
+
+	f.Fuzz(func(t *testing.T, data string) {
+		topo := Topology{}
+		if err := json.Unmarshal([]byte(data), &topo); err != nil {
+			return
+		}
+
+		for id, node := range topo.Nodes {
+			if node == nil {
+				t.Errorf("Node %s is nil", id)
+			} else if node.Id != id {
+				t.Errorf("Node %s has id %s", id, node.Id)
+			}
+		}
+		for id, link := range topo.Links {
+			if link == nil {
+				t.Errorf("Link %s is nil", id)
+			} else if link.Id != id {
+				t.Errorf("Link %s has id %s", id, link.Id)
+			}
+		}
+	})
+}
+
+func FuzzRouteTopology(f *testing.F) {
+	f.Add(`{"nodes": {"a": {"pos": [0, 0]}, "b": {"pos": [4, 2]}}, "links": [{"from": "a", "to": "b"}]}`)
+	f.Add(`{"nodes": {"a": {"pos": [0, 0]}, "b": {"pos": [3, 3]}},
+		"links": [{"from": "a", "to": "b", "route_prefix": [[1, 0]], "via": [[2, 1]], "route_suffix": [[2, 3]]}]}`)
+	f.Add(`{"nodes": [{"id": "a", "pos": [0, 0], "extents": {"width": 2, "height": 2}},
+		{"id": "b", "pos": [6, 0], "extents": {"width": 2, "height": 2}}], "links": [{"from": "a", "to": "b"}]}`)
+	f.Add(`{"nodes": {"a": {"pos": [0, 0]}, "b": {"pos": [8, 0]}}, "links": [{"from": "a", "to": "b", "corridor": "c"}],
+		"corridors": {"c": {"cells": [[2, 2], [6, 2]]}}, "obstacles": [{"rect": [[4, -2], [4, 1]]}]}`)
+
+	f.Fuzz(func(t *testing.T, data string) {
+		topo := Topology{}
+		if err := json.Unmarshal([]byte(data), &topo); err != nil {
+			return
+		}
+		// The router visits every cell covered by nodes, obstacles
+		// and the gaps between anchors, so only small topologies
+		// are routed
+		if !fuzzSmall(&topo) {
+			return
+		}
+
+		config := DefaultRouterConfig()
+		config.SearchLimit = 200
+		NewLinkRouterWithConfig(&topo, config).RouteLinks()
+	})
+}
+
+// Returns whether every coordinate and size in the topology is small
+func fuzzSmall(topo *Topology) bool {
+	const limit = 16
+	small := func(v ...int16) bool {
+		for _, x := range v {
+			if x < -limit || x > limit {
+				return false
+			}
+		}
+		return true
+	}
+	smallCells := func(cells [][2]int16) bool {
+		for _, cell := range cells {
+			if !small(cell[0], cell[1]) {
+				return false
+			}
+		}
+		return len(cells) <= limit
+	}
+
+	for _, node := range topo.Nodes {
+		if node == nil {
+			continue
+		}
+		if node.Pos != nil && !small(node.Pos[0], node.Pos[1]) {
+			return false
+		}
+		if node.Extents != nil && !small(node.Extents.Width, node.Extents.Height) {
+			return false
+		}
+		if !small(node.KeepOut, node.MemberPadding) {
+			return false
+		}
+	}
+	for _, link := range topo.Links {
+		if link == nil {
+			continue
+		}
+		if !smallCells(link.Via) || !smallCells(link.RoutePrefix) || !smallCells(link.RouteSuffix) || !small(link.ViaRadius...) {
+			return false
+		}
+		for _, p := range link.Route {
+			if !(p.X >= -limit && p.X <= limit && p.Y >= -limit && p.Y <= limit) {
+				return false
+			}
+		}
+	}
+	for _, obstacle := range topo.Obstacles {
+		if obstacle == nil {
+			continue
+		}
+		if obstacle.Rect != nil && !smallCells(obstacle.Rect[:]) {
+			return false
+		}
+		if !smallCells(obstacle.Polygon) {
+			return false
+		}
+	}
+	for _, corridor := range topo.Corridors {
+		if corridor != nil && !smallCells(corridor.Cells) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestUnmarshalAttachSides(t *testing.T) {
+	topo := Topology{}
+	data := `{"nodes": {"A": {"pos": [0, 0], "attach_sides": ["n", "south"]}}}`
+	if err := json.Unmarshal([]byte(data), &topo); err != nil {
+		t.Fatalf("Error parsing topology: %s", err)
+	}
+	if sides := topo.Nodes["A"].AttachSides; len(sides) != 2 || sides[0] != DirectionN || sides[1] != DirectionS {
+		t.Errorf("Expected the north and south sides, got %v", sides)
+	}
+
+	for _, side := range []string{"ne", "c", ""} {
+		topo := Topology{}
+		data := `{"nodes": {"A": {"pos": [0, 0], "attach_sides": ["n", "` + side + `"]}}}`
+		if err := json.Unmarshal([]byte(data), &topo); err == nil {
+			t.Errorf("Expected an error for attach side %q", side)
+		}
+	}
+}
+
+func TestMarshalTopologyStyles(t *testing.T) {
+	data := `{
+		"nodes": {"A": {"pos": [0, 0], "style": {"size": 30}}},
+		"links": [{"from": "A", "to": "A", "style": {"size": 8, "fill": "#ff0000"}}]
+	}`
+
+	topo := Topology{}
+	if err := json.Unmarshal([]byte(data), &topo); err != nil {
+		t.Fatalf("Error parsing topology: %s", err)
+	}
+
+	out, err := json.Marshal(&topo)
+	if err != nil {
+		t.Fatalf("Error writing topology: %s", err)
+	}
+
+	parsed := Topology{}
+	if err := json.Unmarshal(out, &parsed); err != nil {
+		t.Fatalf("Error parsing written topology: %s", err)
+	}
+	if size := parsed.Nodes["A"].Style.Size; size != 30 {
+		t.Errorf("Expected node size 30, got %v in %s", size, out)
+	}
+	style := parsed.Links["A-A"].Style
+	if style.Size != 8 || style.Style == nil || style.FillColor.IsZero() {
+		t.Errorf("Expected link size and fill to be kept, got %s", out)
+	}
+}
+
+func TestMarshalLinkDataColor(t *testing.T) {
+	out, err := json.Marshal(&LinkData{Label: "10G"})
+	if err != nil {
+		t.Fatalf("Error writing link data: %s", err)
+	}
+	if expected := `{"value":null,"label":"10G"}`; string(out) != expected {
+		t.Errorf("Expected %s without a color, got %s", expected, out)
+	}
+
+	data := LinkData{Color: canvas.NewStyleColor(canvas.RGB(1, 0, 0))}
+	if out, err = json.Marshal(&data); err != nil {
+		t.Fatalf("Error writing link data: %s", err)
+	}
+	parsed := LinkData{}
+	if err := json.Unmarshal(out, &parsed); err != nil {
+		t.Fatalf("Error parsing written link data: %s", err)
+	}
+	if !canvas.ColorEqual(parsed.Color.Color(), data.Color.Color()) {
+		t.Errorf("Expected the color to be kept, got %s", out)
+	}
+}
+
+func TestTopologyFetchData(t *testing.T) {
+	topo := &Topology{
+		Links: map[LinkId]*Link{
+			"B-C": {Id: "B-C", From: "B", To: "C", FromData: &LinkData{Label: "old"}},
+			"A-B": {Id: "A-B", From: "A", To: "B"},
+		},
+	}
+
+	var asked []LinkId
+	source := DataSourceFunc(func(ctx context.Context, links []LinkId) (map[LinkId]LinkDataUpdate, error) {
+		asked = links
+		return map[LinkId]LinkDataUpdate{
+			"B-C": {ToData: &LinkData{Label: "new"}},
+			"X-Y": {ToData: &LinkData{Label: "unknown"}},
+		}, nil
+	})
+	if err := topo.FetchData(context.Background(), source); err != nil {
+		t.Fatalf("Error fetching data: %s", err)
+	}
+
+	if len(asked) != 2 || asked[0] != "A-B" || asked[1] != "B-C" {
+		t.Errorf("Expected the sorted link ids, got %v", asked)
+	}
+	link := topo.Links["B-C"]
+	if link.FromData.Label != "old" || link.ToData == nil || link.ToData.Label != "new" {
+		t.Errorf("Expected only the to direction of B-C to change")
+	}
+}
+
+func TestDeltaData(t *testing.T) {
+	data := func(value float32) *LinkData {
+		d := &LinkData{}
+		d.Value.Set(value)
+		return d
+	}
+	before := map[LinkId]LinkDataUpdate{
+		"A-B": {FromData: data(0.5), ToData: data(0.2)},
+	}
+	after := map[LinkId]LinkDataUpdate{
+		"A-B": {FromData: data(0.25), ToData: data(0.2)},
+		"B-C": {FromData: data(0.9)},
+	}
+
+	deltas := DeltaData(before, after, nil)
+	fell := deltas["A-B"].FromData
+	if !fell.Value.Valid || fell.Value.Value != -0.25 || fell.Label != "-25%" {
+		t.Errorf("Expected A-B to fall by 25%%, got %+v", fell)
+	}
+	scale := canvas.DivergingColorScale()
+	if !canvas.ColorEqual(fell.Color.Color(), scale.GetColor(-0.25)) {
+		t.Errorf("Expected the color of the change on the diverging scale")
+	}
+	if same := deltas["A-B"].ToData; same.Value.Value != 0 || same.Label != "+0%" {
+		t.Errorf("Expected no change for the other direction, got %+v", same)
+	}
+	if added := deltas["B-C"].FromData; added == nil || added.Value.Valid {
+		t.Errorf("Expected no value for a link without earlier data, got %+v", added)
+	}
+}
@@ -0,0 +1,166 @@
+package raumata
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/REANNZ/raumata/canvas"
+	"github.com/REANNZ/raumata/geometry"
+	"github.com/REANNZ/raumata/internal/f32"
+	"github.com/REANNZ/raumata/vec"
+)
+
+// A route between two nodes with enough links that they are drawn
+// as one thick trunk, with the links only fanned out near their
+// nodes, see [RenderConfig.TrunkThreshold]
+type trunk struct {
+	// The route from the node with the lower id to the other
+	route    vec.Polyline
+	from, to NodeId
+	title    string
+	// The width of the trunk on the canvas, and how far from each
+	// end the links fan out, in grid units
+	width float32
+	reach float32
+}
+
+// How far a link in a trunk is moved sideways near its nodes. route
+// is the trunk's route in the link's direction, drawn in place of the
+// link's own route.
+type trunkFan struct {
+	route  vec.Polyline
+	offset float32
+	reach  float32
+}
+
+// Groups links between the same pair of nodes into trunks, for the
+// pairs with more than TrunkThreshold links. The router may have given
+// the links different routes, so they are all drawn along the route of
+// the first link. The links are spaced apart by BundleSpacing, or one
+// and a half link widths if that isn't set. The links must be sorted
+// by id.
+func (r *Renderer) findTrunks(topo *Topology, links []*Link) {
+	r.trunks = nil
+	r.trunkFans = nil
+	if r.Config.TrunkThreshold <= 0 {
+		return
+	}
+
+	type nodePair [2]NodeId
+	bundles := map[nodePair][]*Link{}
+	keys := []nodePair{}
+	for _, link := range links {
+		if len(link.Route) < 2 || link.From == link.To {
+			continue
+		}
+		key := nodePair{link.From, link.To}
+		if key[1] < key[0] {
+			key[0], key[1] = key[1], key[0]
+		}
+		if _, ok := bundles[key]; !ok {
+			keys = append(keys, key)
+		}
+		bundles[key] = append(bundles[key], link)
+	}
+
+	spacing := r.Config.BundleSpacing
+	if spacing == 0 {
+		spacing = r.Config.DefaultLinkStyle.Size * 1.5
+	}
+	scale := r.GetScale()
+
+	r.trunkFans = map[LinkId]trunkFan{}
+	for _, key := range keys {
+		bundle := bundles[key]
+		if len(bundle) <= r.Config.TrunkThreshold {
+			continue
+		}
+
+		first := bundle[0]
+		t := trunk{
+			route: first.Route.Simplify(),
+			from:  first.From,
+			to:    first.To,
+			width: float32(len(bundle)-1)*spacing + r.Config.DefaultLinkStyle.Size,
+		}
+		if t.to < t.from {
+			t.route = t.route.Reverse()
+			t.from, t.to = t.to, t.from
+		}
+		if from, to := topo.Nodes[t.from], topo.Nodes[t.to]; from != nil && to != nil {
+			t.title = fmt.Sprintf("%d links between %s and %s", len(bundle), r.nodeName(from), r.nodeName(to))
+		}
+		// Each link joins the trunk at twice its distance from the
+		// middle, so the outermost links join it last
+		t.reach = float32(len(bundle)-1) * spacing / scale
+		// Routes too short to leave a trunk between the fans are
+		// drawn as usual
+		if t.reach <= 0 || t.route.Length() <= 2*t.reach {
+			continue
+		}
+
+		center := float32(len(bundle)-1) / 2
+		for i, link := range bundle {
+			offset := (float32(i) - center) * spacing
+			if link.To < link.From {
+				offset = -offset
+			}
+			route := t.route
+			if link.To < link.From {
+				route = route.Reverse()
+			}
+			r.trunkFans[link.Id] = trunkFan{route: route, offset: offset, reach: 2 * f32.Abs(offset) / scale}
+		}
+		r.trunks = append(r.trunks, t)
+	}
+}
+
+// Splits the route into the parts within reach of each end, and the
+// part between them
+func splitEnds(route vec.Polyline, reach float32) (start, middle, end vec.Polyline) {
+	start, rest := route.SplitAt(reach / route.Length())
+	middle, end = rest.SplitAt(1 - reach/rest.Length())
+	return start, middle, end
+}
+
+// Moves the ends of the route sideways by the fan's offset, joining
+// the middle of the route where the fan reaches it. The middle is left
+// where it is, under the trunk. scale converts the offset to grid
+// units.
+func (f trunkFan) apply(route vec.Polyline, scale float32) vec.Polyline {
+	if f.reach <= 0 {
+		return route
+	}
+	start, middle, end := splitEnds(route, f.reach)
+	offset := f.offset / scale
+
+	start = start.Offset(offset)
+	end = end.Offset(offset)
+
+	fanned := slices.Clone(start[:len(start)-1])
+	fanned = append(fanned, middle...)
+	return append(fanned, end[1:]...)
+}
+
+// Renders the trunks, to be drawn over their links
+func (r *Renderer) renderTrunks() canvas.Object {
+	group := canvas.NewGroup()
+	group.Attributes.Id = "trunks"
+
+	style := &r.Config.DefaultLinkStyle
+	scale := r.GetScale()
+	for _, t := range r.trunks {
+		_, middle, _ := splitEnds(t.route, t.reach)
+		path := geometry.Arrow(middle.Mul(scale), t.width, style.Radius.radius(), 0, 0)
+		if path == nil {
+			continue
+		}
+		path.Attributes.AddClass("link-trunk")
+		path.Attributes.SetExtra("data-from", string(t.from))
+		path.Attributes.SetExtra("data-to", string(t.to))
+		path.Attributes.Title = t.title
+		group.AppendChild(path)
+	}
+
+	return group
+}
@@ -135,6 +135,45 @@ func (pl Polyline) Reverse() Polyline {
 	return newLine
 }
 
+// Offset returns a polyline running parallel to pl, at distance d
+// to the side given by rotating the direction of travel by +90°
+// (to the right when the y axis points down). Negative distances
+// offset to the other side.
+//
+// Corners are mitered, with the miter length limited for very
+// sharp corners. The polyline should not contain zero-length
+// segments, see [Polyline.Fix].
+func (pl Polyline) Offset(d float32) Polyline {
+	if len(pl) < 2 || d == 0 {
+		return pl
+	}
+
+	// The normal of each segment
+	normals := make([]Vec2, len(pl)-1)
+	for i := range normals {
+		dir := pl[i+1].Sub(pl[i]).Normalized()
+		normals[i] = Vec2{X: -dir.Y, Y: dir.X}
+	}
+
+	newLine := make([]Vec2, len(pl))
+	newLine[0] = pl[0].Add(normals[0].Mul(d))
+	for i := 1; i < len(pl)-1; i++ {
+		n1 := normals[i-1]
+		n2 := normals[i]
+
+		miter := n1.Add(n2).Normalized()
+		// Limit the miter length to 4x the offset, this
+		// only happens for corners sharper than ~30°
+		cosHalf := f32.Max(miter.Dot(n1), 0.25)
+
+		newLine[i] = pl[i].Add(miter.Mul(d / cosHalf))
+	}
+	last := len(pl) - 1
+	newLine[last] = pl[last].Add(normals[last-1].Mul(d))
+
+	return newLine
+}
+
 // Subdivide returns a polyline with each segment divided into
 // count parts
 func (pl Polyline) Subdivide(count int) Polyline {
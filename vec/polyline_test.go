@@ -261,6 +261,26 @@ func TestPolylineSplitAt(t *testing.T) {
 	checkVec(t, l2[1], vec.Vec2{3, 1})
 }
 
+func TestPolylineOffset(t *testing.T) {
+	line := vec.Polyline{{0, 0}, {2, 0}, {2, 2}}
+
+	expected := vec.Polyline{{0, 1}, {1, 1}, {1, 2}}
+	actual := line.Offset(1)
+	for i := range expected {
+		if !actual[i].ApproxEq(expected[i], 1e-6) {
+			t.Errorf("Point %d incorrect, expected %s, got %s", i, expected[i], actual[i])
+		}
+	}
+
+	// Offsetting back the other way gives the original line
+	back := actual.Offset(-1)
+	for i := range line {
+		if !back[i].ApproxEq(line[i], 1e-6) {
+			t.Errorf("Point %d not restored, expected %s, got %s", i, line[i], back[i])
+		}
+	}
+}
+
 func TestPolylineSubdivide(t *testing.T) {
 	checkSubdivide := func(pl vec.Polyline, n int, rec bool) {
 		t.Helper()
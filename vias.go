@@ -0,0 +1,342 @@
+package raumata
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/REANNZ/raumata/grid"
+	"github.com/REANNZ/raumata/internal/f32"
+)
+
+// ViaProblem describes a via point that a link can't be routed
+// through as given, found by [LinkRouter.CheckVias]
+type ViaProblem struct {
+	Link LinkId
+	// The via point as given in the topology
+	Via [2]int16
+	// Why the via point can't be used
+	Reason string
+	// Where the via point was moved to, nil if it wasn't moved
+	SnappedTo *[2]int16
+}
+
+func (p ViaProblem) String() string {
+	msg := fmt.Sprintf("Link '%s' via (%d, %d) %s", p.Link, p.Via[0], p.Via[1], p.Reason)
+	if p.SnappedTo != nil {
+		msg += fmt.Sprintf(", moved to (%d, %d)", p.SnappedTo[0], p.SnappedTo[1])
+	}
+	return msg
+}
+
+// CheckVias finds via points that routing can't pass through,
+// either because they are outside the extents or because the cell
+// is taken by a node, node label or obstacle. Otherwise such vias
+// either grow the grid or cause long detours.
+//
+// If snap is true, each problem via is moved to the nearest free
+// cell inside the extents, and the link's Via field is updated.
+//
+// It should be called before [LinkRouter.RouteLinks], and before
+// [LinkRouter.LoadCache] if vias are snapped.
+func (r *LinkRouter) CheckVias(snap bool) []ViaProblem {
+	problems := []ViaProblem{}
+	r.resetKeepOut()
+
+	ids := make([]LinkId, 0, len(r.topo.Links))
+	for id, link := range r.topo.Links {
+		if link != nil && len(link.Via) > 0 && !link.LockRoute {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+
+	for _, id := range ids {
+		link := r.topo.Links[id]
+		for i, via := range link.Via {
+			pos := grid.Pos{X: via[0], Y: via[1]}
+			reason := r.viaProblem(link, pos)
+			if reason == "" {
+				continue
+			}
+
+			problem := ViaProblem{
+				Link:   id,
+				Via:    via,
+				Reason: reason,
+			}
+
+			if snap {
+				if newPos, ok := r.nearestFreeCell(link, pos); ok {
+					link.Via[i] = [2]int16{newPos.X, newPos.Y}
+					problem.SnappedTo = &link.Via[i]
+
+					if len(link.Route) == 0 {
+						r.removeLink(pos, id)
+						r.addLink(newPos, id)
+					}
+				}
+			}
+
+			problems = append(problems, problem)
+		}
+	}
+
+	// Vias outside the nodes have already grown the automatic
+	// extents, so they are worked out again without them
+	if snap && len(problems) > 0 && !r.explicitExtents {
+		r.extentMin = r.nodeExtentMin
+		r.extentMax = r.nodeExtentMax
+		for pos := range r.linkMap {
+			r.extentMin = r.extentMin.Min(pos)
+			r.extentMax = r.extentMax.Max(pos)
+		}
+	}
+
+	return problems
+}
+
+// Returns the extents that vias should be inside. When the extents
+// are determined automatically, these are around the nodes.
+func (r *LinkRouter) viaBounds() (min, max grid.Pos) {
+	if r.explicitExtents {
+		return r.extentMin, r.extentMax
+	}
+
+	border := r.ExtentBorder
+	min = grid.Pos{X: r.nodeExtentMin.X - border, Y: r.nodeExtentMin.Y - border}
+	max = grid.Pos{X: r.nodeExtentMax.X + border, Y: r.nodeExtentMax.Y + border}
+	return min, max
+}
+
+// Returns why the link can't be routed through pos, or an empty
+// string if it can
+func (r *LinkRouter) viaProblem(link *Link, pos grid.Pos) string {
+	extMin, extMax := r.viaBounds()
+	if pos.X < extMin.X || pos.Y < extMin.Y || pos.X > extMax.X || pos.Y > extMax.Y {
+		return "is outside the extents"
+	}
+	if r.inObstacle(pos) {
+		return "is on an obstacle"
+	}
+	if nodeId, isNode := r.nodes[pos]; isNode && r.AvoidNodes {
+		return fmt.Sprintf("is on node '%s'", nodeId)
+	}
+	if r.nodeLabels[pos] {
+		return "is on a node label"
+	}
+	for _, nodeId := range r.keepOut[pos] {
+		if nodeId != link.From && nodeId != link.To {
+			return fmt.Sprintf("is inside the keep-out of node '%s'", nodeId)
+		}
+	}
+	return ""
+}
+
+// Returns the closest cell to pos inside the extents that the link
+// can be routed through
+func (r *LinkRouter) nearestFreeCell(link *Link, pos grid.Pos) (grid.Pos, bool) {
+	extMin, extMax := r.viaBounds()
+
+	// Search outwards in square rings around the closest cell
+	// inside the extents. The first ring with any free cells has the
+	// nearest, by Chebyshev distance, of those pick the closest
+	// by Euclidean distance. The rings are clipped to the extents,
+	// and worked out with ints so they can't overflow at the edges
+	// of the grid.
+	start := pos.Max(extMin).Min(extMax)
+	sx, sy := int(start.X), int(start.Y)
+	minX, minY := int(extMin.X), int(extMin.Y)
+	maxX, maxY := int(extMax.X), int(extMax.Y)
+	// Every cell in the extents is in one of the rings up to here
+	maxDist := max(sx-minX, maxX-sx, sy-minY, maxY-sy)
+
+	for dist := 0; dist <= maxDist; dist++ {
+		best := grid.Pos{}
+		found := false
+		check := func(x, y int) {
+			p := grid.Pos{X: int16(x), Y: int16(y)}
+			if r.viaProblem(link, p) != "" {
+				return
+			}
+			if !found || p.EuclideanDistance(pos) < best.EuclideanDistance(pos) {
+				best = p
+				found = true
+			}
+		}
+
+		x0, x1 := max(sx-dist, minX), min(sx+dist, maxX)
+		for y := max(sy-dist, minY); y <= min(sy+dist, maxY); y++ {
+			// Only the edge of the ring
+			if y == sy-dist || y == sy+dist {
+				for x := x0; x <= x1; x++ {
+					check(x, y)
+				}
+				continue
+			}
+			if sx-dist >= minX {
+				check(sx-dist, y)
+			}
+			if dist > 0 && sx+dist <= maxX {
+				check(sx+dist, y)
+			}
+		}
+		if found {
+			return best, true
+		}
+	}
+
+	return grid.Pos{}, false
+}
+
+// The most via points that are put in the shortest order exactly,
+// links with more are improved from the order they are listed in
+const maxExactVias = 10
+
+// Puts the via points of the link in the order that gives the
+// shortest path through them. anchors and radii are the positions
+// and radii of all the route anchors, from the "from" node to the
+// "to" node, the vias are reordered in place.
+func (r *LinkRouter) orderVias(link *Link, anchors []grid.Pos, radii []int16) {
+	first := len(link.RoutePrefix)
+	vias := anchors[first : first+len(link.Via)]
+
+	// The path through the vias starts at the end of the route
+	// prefix and finishes at whatever comes after them
+	var start, end grid.Pos
+	if first > 0 {
+		start = anchors[first-1]
+	} else {
+		from := r.topo.GetNode(link.From)
+		start = grid.Pos{X: from.Pos[0], Y: from.Pos[1]}
+	}
+	if next := first + len(vias); next < len(anchors) {
+		end = anchors[next]
+	} else {
+		to := r.topo.GetNode(link.To)
+		end = grid.Pos{X: to.Pos[0], Y: to.Pos[1]}
+	}
+
+	order := shortestViaOrder(start, end, vias)
+
+	orderedVias := make([]grid.Pos, len(vias))
+	orderedRadii := make([]int16, len(vias))
+	for i, j := range order {
+		orderedVias[i] = vias[j]
+		orderedRadii[i] = radii[first+j]
+	}
+	copy(vias, orderedVias)
+	copy(radii[first:], orderedRadii)
+}
+
+// Returns the order to visit the vias in, as indexes into vias, that
+// gives the shortest path from start to end. The given order is kept
+// unless another is strictly shorter.
+func shortestViaOrder(start, end grid.Pos, vias []grid.Pos) []int {
+	n := len(vias)
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	if n < 2 {
+		return order
+	}
+
+	length := func(order []int) float32 {
+		total := start.EuclideanDistance(vias[order[0]])
+		for i := 1; i < n; i++ {
+			total += vias[order[i-1]].EuclideanDistance(vias[order[i]])
+		}
+		return total + vias[order[n-1]].EuclideanDistance(end)
+	}
+
+	var best []int
+	if n <= maxExactVias {
+		best = heldKarp(start, end, vias)
+	} else {
+		best = twoOpt(slices.Clone(order), length)
+	}
+
+	if length(best) < length(order) {
+		return best
+	}
+	return order
+}
+
+// Finds the shortest path from start to end through all the vias
+// by dynamic programming over the subsets of vias visited
+func heldKarp(start, end grid.Pos, vias []grid.Pos) []int {
+	n := len(vias)
+	subsets := 1 << n
+
+	// cost[set*n+last] is the length of the shortest path from
+	// start through the vias in set, finishing at last
+	inf := f32.Inf(1)
+	cost := make([]float32, subsets*n)
+	prev := make([]int, subsets*n)
+	for i := range cost {
+		cost[i] = inf
+		prev[i] = -1
+	}
+	for i := 0; i < n; i++ {
+		cost[(1<<i)*n+i] = start.EuclideanDistance(vias[i])
+	}
+
+	for set := 1; set < subsets; set++ {
+		for last := 0; last < n; last++ {
+			c := cost[set*n+last]
+			if set&(1<<last) == 0 || c == inf {
+				continue
+			}
+			for next := 0; next < n; next++ {
+				if set&(1<<next) != 0 {
+					continue
+				}
+				nextSet := set | 1<<next
+				nextCost := c + vias[last].EuclideanDistance(vias[next])
+				if nextCost < cost[nextSet*n+next] {
+					cost[nextSet*n+next] = nextCost
+					prev[nextSet*n+next] = last
+				}
+			}
+		}
+	}
+
+	all := subsets - 1
+	last := 0
+	bestCost := inf
+	for i := 0; i < n; i++ {
+		c := cost[all*n+i] + vias[i].EuclideanDistance(end)
+		if c < bestCost {
+			bestCost = c
+			last = i
+		}
+	}
+
+	order := make([]int, n)
+	set := all
+	for i := n - 1; i >= 0; i-- {
+		order[i] = last
+		last, set = prev[set*n+last], set&^(1<<last)
+	}
+	return order
+}
+
+// Shortens the path by reversing sections of it while that helps
+func twoOpt(order []int, length func([]int) float32) []int {
+	best := length(order)
+	for improved := true; improved; {
+		improved = false
+		for i := 0; i < len(order)-1; i++ {
+			for j := i + 1; j < len(order); j++ {
+				slices.Reverse(order[i : j+1])
+				if l := length(order); l < best {
+					best = l
+					improved = true
+				} else {
+					slices.Reverse(order[i : j+1])
+				}
+			}
+		}
+	}
+	return order
+}
@@ -0,0 +1,138 @@
+package raumata_test
+
+import (
+	"testing"
+
+	. "github.com/REANNZ/raumata"
+)
+
+func TestLinkRouterCheckVias(t *testing.T) {
+	newTopo := func() *Topology {
+		return &Topology{
+			Nodes: map[NodeId]*Node{
+				"A": {Id: "A", Pos: &[2]int16{0, 0}},
+				"B": {Id: "B", Pos: &[2]int16{6, 0}},
+				"C": {Id: "C", Pos: &[2]int16{3, 3}},
+			},
+			Links: map[LinkId]*Link{
+				"A-B": {Id: "A-B", From: "A", To: "B", Via: [][2]int16{{3, 3}}},
+				"A-C": {Id: "A-C", From: "A", To: "C", Via: [][2]int16{{2, 40}}},
+				"B-C": {Id: "B-C", From: "B", To: "C", Via: [][2]int16{{5, 2}}},
+			},
+		}
+	}
+
+	// Checking alone reports the problems without changing anything
+	topo := newTopo()
+	problems := NewLinkRouter(topo).CheckVias(false)
+	if len(problems) != 2 {
+		t.Fatalf("Expected 2 problems, got %v", problems)
+	}
+	if problems[0].Link != "A-B" || problems[0].Reason != "is on node 'C'" {
+		t.Errorf("Expected A-B's via to be on node C, got %s", problems[0])
+	}
+	if problems[1].Link != "A-C" || problems[1].Reason != "is outside the extents" {
+		t.Errorf("Expected A-C's via to be outside the extents, got %s", problems[1])
+	}
+	if problems[0].SnappedTo != nil || topo.Links["A-B"].Via[0] != [2]int16{3, 3} {
+		t.Errorf("Expected the via not to be moved")
+	}
+
+	// Snapping moves them to the nearest free cell
+	topo = newTopo()
+	router := NewLinkRouter(topo)
+	problems = router.CheckVias(true)
+	if len(problems) != 2 {
+		t.Fatalf("Expected 2 problems, got %v", problems)
+	}
+	if via := topo.Links["A-B"].Via[0]; via != [2]int16{3, 2} {
+		t.Errorf("Expected A-B's via to move to (3, 2), got %v", via)
+	}
+	if via := topo.Links["A-C"].Via[0]; via != [2]int16{2, 4} {
+		t.Errorf("Expected A-C's via to move to (2, 4), got %v", via)
+	}
+	if problems[1].SnappedTo == nil || *problems[1].SnappedTo != [2]int16{2, 4} {
+		t.Errorf("Expected the problem to record the new position, got %s", problems[1])
+	}
+
+	// The extents no longer include the original via, only the
+	// new one plus the border
+	_, extMax := router.GetExtents()
+	if extMax.Y != 5 {
+		t.Errorf("Expected the extents to end at 5, got %v", extMax.Y)
+	}
+
+	router.RouteLinks()
+	for id, link := range topo.Links {
+		if len(link.Route) == 0 {
+			t.Errorf("Expected link %s to be routed", id)
+		}
+	}
+}
+
+func TestLinkRouterOrderVias(t *testing.T) {
+	newTopo := func() *Topology {
+		return &Topology{
+			Nodes: map[NodeId]*Node{
+				"A": {Id: "A", Pos: &[2]int16{0, 0}},
+				"B": {Id: "B", Pos: &[2]int16{10, 0}},
+			},
+			Links: map[LinkId]*Link{
+				"A-B": {
+					Id: "A-B", From: "A", To: "B",
+					Via:       [][2]int16{{8, 2}, {2, 2}, {5, 2}},
+					ViaRadius: []int16{0, 1},
+				},
+			},
+		}
+	}
+
+	// In the listed order the route doubles back on itself
+	topo := newTopo()
+	NewLinkRouter(topo).RouteLinks()
+	listed := topo.Links["A-B"].Route.Length()
+
+	topo = newTopo()
+	router := NewLinkRouter(topo)
+	router.OrderVias = true
+	router.RouteLinks()
+	route := topo.Links["A-B"].Route
+	if route.Length() >= listed {
+		t.Errorf("Expected a shorter route than %v, got %v", listed, route.Length())
+	}
+	for i := 1; i < len(route); i++ {
+		if route[i].X < route[i-1].X {
+			t.Errorf("Expected the route to head straight for B, got %v", route)
+			break
+		}
+	}
+
+	// The vias in the topology are left as they were listed
+	if via := topo.Links["A-B"].Via[0]; via != [2]int16{8, 2} {
+		t.Errorf("Expected the vias not to be changed, got %v", topo.Links["A-B"].Via)
+	}
+}
+
+func TestLinkRouterSnapViasAtGridEdge(t *testing.T) {
+	topo := &Topology{
+		Nodes: map[NodeId]*Node{
+			"A": {Id: "A", Pos: &[2]int16{32760, 32760}},
+			"B": {Id: "B", Pos: &[2]int16{32760, 32767}},
+			"C": {Id: "C", Pos: &[2]int16{32767, 32767}},
+		},
+		Links: map[LinkId]*Link{
+			"A-B": {Id: "A-B", From: "A", To: "B", Via: [][2]int16{{32767, 32767}}},
+		},
+	}
+
+	// The ring around the via runs off the edge of the grid
+	router := NewLinkRouter(topo)
+	router.SetExtents(32760, 32760, 32767, 32767)
+	problems := router.CheckVias(true)
+	if len(problems) != 1 || problems[0].SnappedTo == nil {
+		t.Fatalf("Expected the via to be moved, got %v", problems)
+	}
+	if via := topo.Links["A-B"].Via[0]; via != [2]int16{32767, 32766} {
+		t.Errorf("Expected the via to move to (32767, 32766), got %v", via)
+	}
+}
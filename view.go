@@ -0,0 +1,97 @@
+package raumata
+
+import (
+	"slices"
+)
+
+// A View is a named way of drawing a topology, such as a crop of
+// part of the map or a smaller thumbnail. Views are drawn from the
+// same routed topology, with the labels already placed, so several
+// can be made from one run of the router.
+//
+// With none of Nodes, NodeClasses or Area set, the view has the
+// whole topology.
+type View struct {
+	Name string `json:"name"`
+	// The nodes drawn in the view, as well as those in NodeClasses.
+	// Links are only drawn if both of their nodes are
+	Nodes []NodeId `json:"nodes,omitempty"`
+	// The classes of the nodes drawn in the view
+	NodeClasses []string `json:"node-classes,omitempty"`
+	// The grid cells the view is cropped to, the top-left and
+	// bottom-right cells. Only nodes positioned within the area are
+	// drawn, out of those chosen by Nodes and NodeClasses
+	Area *[2][2]int16 `json:"area,omitempty"`
+	// Multiplies all the sizes in the config, see
+	// [RenderConfig.ScaleSizes]. 0 leaves them as they are
+	Scale float32 `json:"scale,omitempty"`
+	// Hide details to declutter the view, these can only hide things
+	// and don't show what the config already hides
+	HideNodeLabels bool `json:"hide-node-labels,omitempty"`
+	HideLinkLabels bool `json:"hide-link-labels,omitempty"`
+	HideArrowheads bool `json:"hide-arrowheads,omitempty"`
+}
+
+// Returns whether the view includes the node
+func (v *View) hasNode(node *Node) bool {
+	if len(v.Nodes) > 0 || len(v.NodeClasses) > 0 {
+		if !slices.Contains(v.Nodes, node.Id) &&
+			(node.Class == "" || !slices.Contains(v.NodeClasses, node.Class)) {
+			return false
+		}
+	}
+
+	if v.Area != nil {
+		if node.Pos == nil {
+			return false
+		}
+		min, max := v.Area[0], v.Area[1]
+		if node.Pos[0] < min[0] || node.Pos[0] > max[0] ||
+			node.Pos[1] < min[1] || node.Pos[1] > max[1] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Topology returns the part of topo drawn in the view. The nodes and
+// links are shared with topo, not copied, so they keep their routes
+// and label positions.
+func (v *View) Topology(topo *Topology) *Topology {
+	view := *topo
+	view.Nodes = make(map[NodeId]*Node, len(topo.Nodes))
+	view.Links = make(map[LinkId]*Link, len(topo.Links))
+
+	for id, node := range topo.Nodes {
+		if node != nil && v.hasNode(node) {
+			view.Nodes[id] = node
+		}
+	}
+	for id, link := range topo.Links {
+		if link == nil {
+			continue
+		}
+		if view.Nodes[link.From] != nil && view.Nodes[link.To] != nil {
+			view.Links[id] = link
+		}
+	}
+
+	return &view
+}
+
+// Config returns a copy of config changed for the view, leaving
+// config as it is
+func (v *View) Config(config *RenderConfig) *RenderConfig {
+	viewConfig := config.Clone()
+	viewConfig.Views = nil
+
+	if v.Scale > 0 {
+		viewConfig.ScaleSizes(v.Scale)
+	}
+	viewConfig.HideNodeLabels = viewConfig.HideNodeLabels || v.HideNodeLabels
+	viewConfig.HideLinkLabels = viewConfig.HideLinkLabels || v.HideLinkLabels
+	viewConfig.HideArrowheads = viewConfig.HideArrowheads || v.HideArrowheads
+
+	return viewConfig
+}
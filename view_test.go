@@ -0,0 +1,65 @@
+package raumata_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/REANNZ/raumata"
+)
+
+func TestView(t *testing.T) {
+	topo := &Topology{
+		Nodes: map[NodeId]*Node{
+			"A": {Id: "A", Pos: &[2]int16{0, 0}, Class: "core"},
+			"B": {Id: "B", Pos: &[2]int16{4, 0}, Class: "core"},
+			"C": {Id: "C", Pos: &[2]int16{4, 4}},
+			"D": {Id: "D", Pos: &[2]int16{10, 0}, Class: "core"},
+		},
+		Links: map[LinkId]*Link{
+			"A-B": {Id: "A-B", From: "A", To: "B"},
+			"B-C": {Id: "B-C", From: "B", To: "C"},
+			"B-D": {Id: "B-D", From: "B", To: "D"},
+		},
+	}
+	NewLinkRouter(topo).RouteLinks()
+
+	config := DefaultRenderConfig()
+	err := json.Unmarshal([]byte(`{"views": [
+		{"name": "core", "node-classes": ["core"], "area": [[0, 0], [5, 5]]},
+		{"name": "thumbnail", "scale": 0.5, "hide-link-labels": true}
+	]}`), config)
+	if err != nil {
+		t.Fatalf("Error parsing views: %s", err)
+	}
+
+	// Only the core nodes in the area, and the links between them
+	core := config.Views[0].Topology(topo)
+	if len(core.Nodes) != 2 || core.Nodes["A"] == nil || core.Nodes["B"] == nil {
+		t.Errorf("Expected nodes A and B in the core view, got %v", core.Nodes)
+	}
+	if len(core.Links) != 1 || core.Links["A-B"] != topo.Links["A-B"] {
+		t.Errorf("Expected only the A-B link in the core view, got %v", core.Links)
+	}
+	if len(topo.Nodes) != 4 || len(topo.Links) != 3 {
+		t.Errorf("Making the view changed the topology")
+	}
+
+	thumbnail := config.Views[1]
+	if all := thumbnail.Topology(topo); len(all.Nodes) != 4 || len(all.Links) != 3 {
+		t.Errorf("Expected the whole topology in the thumbnail view")
+	}
+	thumbConfig := thumbnail.Config(config)
+	if thumbConfig.DefaultNodeStyle.Size != config.DefaultNodeStyle.Size/2 {
+		t.Errorf("Expected the sizes to be scaled, got %v", thumbConfig.DefaultNodeStyle.Size)
+	}
+	if !thumbConfig.HideLinkLabels || config.HideLinkLabels {
+		t.Errorf("Expected link labels hidden only in the thumbnail")
+	}
+	if len(thumbConfig.Views) != 0 {
+		t.Errorf("Expected the view config not to have views")
+	}
+
+	if _, err := NewRendererWithConfig(thumbConfig).RenderTopology(core); err != nil {
+		t.Errorf("Error rendering view: %s", err)
+	}
+}
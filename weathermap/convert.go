@@ -0,0 +1,261 @@
+package weathermap
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"strings"
+
+	"github.com/REANNZ/raumata"
+	"github.com/REANNZ/raumata/canvas"
+)
+
+// The width Weathermap draws links with if it isn't set
+const defaultLinkWidth = 7
+
+// Options for converting a [Map]
+type Options struct {
+	// The number of pixels in each cell of the layout grid, 10 if not
+	// set. Smaller cells keep the layout closer to the original, but
+	// make a larger grid to route links through.
+	CellSize int
+}
+
+// Result is a [Map] converted to a raumata topology and config
+type Result struct {
+	Topology *raumata.Topology
+	// The default config with the map's icons and color scale
+	Config *raumata.RenderConfig
+	// Parts of the map that couldn't be converted exactly, such as
+	// nodes moved so they don't share a cell
+	Warnings []string
+}
+
+// Convert converts the map to a topology and config. Nodes without a
+// position and links to unknown nodes are left out, with a warning.
+func (m *Map) Convert(opts Options) *Result {
+	cellSize := opts.CellSize
+	if cellSize <= 0 {
+		cellSize = 10
+	}
+
+	res := &Result{
+		Topology: &raumata.Topology{
+			Nodes: map[raumata.NodeId]*raumata.Node{},
+			Links: map[raumata.LinkId]*raumata.Link{},
+		},
+		Config: raumata.DefaultRenderConfig(),
+	}
+	warn := func(format string, args ...any) {
+		res.Warnings = append(res.Warnings, fmt.Sprintf(format, args...))
+	}
+
+	// The number of canvas units per pixel, for sizes given in pixels
+	pixelScale := raumata.NewRendererWithConfig(res.Config).GetScale() / float32(cellSize)
+
+	icons := map[string]string{}
+	taken := map[[2]int16]raumata.NodeId{}
+	for _, wmNode := range m.Nodes {
+		if !wmNode.HasPosition {
+			warn("Node %s has no position, leaving it out", wmNode.Name)
+			continue
+		}
+
+		node := &raumata.Node{
+			Id:    raumata.NodeId(wmNode.Name),
+			Label: wmNode.Label,
+		}
+
+		cell, ok := toCell(wmNode.Position, cellSize)
+		if !ok {
+			warn("Node %s is outside the grid, moving it to %d,%d", wmNode.Name, cell[0], cell[1])
+		}
+		if other, ok := taken[cell]; ok {
+			free := nearestFreeCell(cell, taken)
+			warn("Node %s is in the same cell as %s, moving it from %d,%d to %d,%d",
+				wmNode.Name, other, cell[0], cell[1], free[0], free[1])
+			cell = free
+		}
+		taken[cell] = node.Id
+		node.Pos = &cell
+
+		if wmNode.LabelOffset != "" {
+			dir, err := raumata.ParseDirection(wmNode.LabelOffset)
+			if err != nil {
+				warn("Node %s has label offset %s, which isn't a direction", wmNode.Name, wmNode.LabelOffset)
+			} else {
+				node.LabelAt = dir
+			}
+		}
+
+		if wmNode.InfoURL != "" {
+			node.Meta = map[string]any{"infourl": wmNode.InfoURL}
+		}
+
+		if wmNode.Icon != "" {
+			name, ok := icons[wmNode.Icon]
+			if !ok {
+				name = iconName(wmNode.Icon, res.Config.Icons)
+				icons[wmNode.Icon] = name
+				if res.Config.Icons == nil {
+					res.Config.Icons = map[string]raumata.Icon{}
+				}
+				res.Config.Icons[name] = raumata.Icon{
+					Href:    wmNode.Icon,
+					Width:   float32(wmNode.IconWidth) * pixelScale,
+					Height:  float32(wmNode.IconHeight) * pixelScale,
+					Replace: true,
+				}
+			}
+			node.Style = &raumata.NodeStyle{Icon: name}
+		}
+
+		res.Topology.Nodes[node.Id] = node
+	}
+
+	for _, wmLink := range m.Links {
+		from, to := raumata.NodeId(wmLink.From), raumata.NodeId(wmLink.To)
+		if res.Topology.Nodes[from] == nil || res.Topology.Nodes[to] == nil {
+			warn("Link %s is between %s and %s, which aren't both on the map, leaving it out",
+				wmLink.Name, wmLink.From, wmLink.To)
+			continue
+		}
+
+		link := &raumata.Link{
+			Id:   raumata.LinkId(wmLink.Name),
+			From: from,
+			To:   to,
+		}
+		for _, via := range wmLink.Via {
+			cell, ok := toCell(via, cellSize)
+			if !ok {
+				warn("Link %s has a via outside the grid, moving it to %d,%d", wmLink.Name, cell[0], cell[1])
+			}
+			link.Via = append(link.Via, cell)
+		}
+		link.Meta = linkMeta(wmLink)
+		if wmLink.Width > 0 && wmLink.Width != defaultLinkWidth {
+			size := res.Config.DefaultLinkStyle.Size * float32(wmLink.Width) / defaultLinkWidth
+			link.Style = &raumata.LinkStyle{Size: size}
+		}
+		if wmLink.Scale != "" && wmLink.Scale != defaultName {
+			warn("Link %s uses scale %s, only the default scale is converted", wmLink.Name, wmLink.Scale)
+		}
+
+		res.Topology.Links[link.Id] = link
+	}
+
+	if bands := m.Scales[defaultName]; len(bands) > 0 {
+		res.Config.LinkColorScale = colorScale(bands)
+	}
+
+	return res
+}
+
+// Returns the cell the pixel position is in, and false if the cell
+// is outside the grid, in which case the closest cell on the edge of
+// the grid is returned
+func toCell(pos [2]int, cellSize int) ([2]int16, bool) {
+	cell := [2]int16{}
+	inside := true
+	for i, p := range pos {
+		c := math.Round(float64(p) / float64(cellSize))
+		if c < math.MinInt16 || c > math.MaxInt16 {
+			c = max(min(c, math.MaxInt16), math.MinInt16)
+			inside = false
+		}
+		cell[i] = int16(c)
+	}
+	return cell, inside
+}
+
+// Returns the link's data sources and info URL for its meta, with
+// the same keys as the targets file, or nil if it has none
+func linkMeta(link *Link) map[string]any {
+	meta := map[string]any{}
+	if len(link.Targets) > 0 {
+		meta["targets"] = link.Targets
+	}
+	if link.BandwidthIn > 0 {
+		meta["bandwidth_in"] = link.BandwidthIn
+	}
+	if link.BandwidthOut > 0 {
+		meta["bandwidth_out"] = link.BandwidthOut
+	}
+	if link.InfoURL != "" {
+		meta["infourl"] = link.InfoURL
+	}
+	if len(meta) == 0 {
+		return nil
+	}
+	return meta
+}
+
+// Returns the free cell closest to cell, searching outwards in rings
+func nearestFreeCell(cell [2]int16, taken map[[2]int16]raumata.NodeId) [2]int16 {
+	for dist := int16(1); ; dist++ {
+		best, bestDist := cell, -1
+		for dy := -dist; dy <= dist; dy++ {
+			for dx := -dist; dx <= dist; dx++ {
+				if max(abs(dx), abs(dy)) != dist {
+					continue
+				}
+				x, y := int(cell[0])+int(dx), int(cell[1])+int(dy)
+				if x < math.MinInt16 || x > math.MaxInt16 || y < math.MinInt16 || y > math.MaxInt16 {
+					continue
+				}
+				c := [2]int16{int16(x), int16(y)}
+				if _, ok := taken[c]; ok {
+					continue
+				}
+				// Prefer the cells straight out from the node to the
+				// corners of the ring
+				if d := int(dx)*int(dx) + int(dy)*int(dy); bestDist < 0 || d < bestDist {
+					best, bestDist = c, d
+				}
+			}
+		}
+		if bestDist >= 0 {
+			return best
+		}
+	}
+}
+
+func abs(v int16) int16 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// Returns a name for the icon at the path, from its file name,
+// that isn't already used
+func iconName(iconPath string, used map[string]raumata.Icon) string {
+	base := strings.TrimSuffix(path.Base(iconPath), path.Ext(iconPath))
+	base = strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return '-'
+	}, base)
+
+	name := base
+	for i := 2; ; i++ {
+		if _, ok := used[name]; !ok {
+			return name
+		}
+		name = fmt.Sprintf("%s-%d", base, i)
+	}
+}
+
+// Converts the bands of a scale, in percent, to a color scale from 0
+// to 1. Each band is a separate range of the scale, so the color
+// changes sharply between bands, as it does in Weathermap.
+func colorScale(bands []ScaleBand) *canvas.ColorScale {
+	scale := canvas.NewColorScale()
+	for _, band := range bands {
+		scale.AddColor(band.Min/100, band.Color)
+		scale.AddColor(band.Max/100, band.Color2)
+	}
+	return scale
+}
@@ -0,0 +1,463 @@
+// Package weathermap reads the configuration files of PHP Network
+// Weathermap, and converts the maps in them to raumata topologies and
+// render configs, for moving existing maps over.
+//
+// The nodes, links, positions, vias, icons, link widths and the
+// default color scale are converted. Weathermap places everything in
+// pixels, so the positions are fitted to the layout grid, and the
+// links are routed again instead of being drawn as straight lines.
+// The link targets, such as RRD files, are kept in [Link.Targets]
+// and the converted links' meta for setting up a data source, but
+// aren't fetched.
+package weathermap
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/REANNZ/raumata/canvas"
+)
+
+// The name of the templates that every node or link starts from
+const defaultName = "DEFAULT"
+
+// Map is a map read from a Weathermap config
+type Map struct {
+	Title  string
+	Width  int
+	Height int
+	// The bands of each color scale, by name. The scale named
+	// "DEFAULT" is used by links without their own.
+	Scales map[string][]ScaleBand
+	// The nodes and links, in the order they are defined, with the
+	// settings from their templates filled in. The "DEFAULT"
+	// templates aren't included.
+	Nodes []*Node
+	Links []*Link
+}
+
+// Node is a NODE from the config
+type Node struct {
+	Name  string
+	Label string
+	// The position of the node in pixels, only set if HasPosition is
+	Position    [2]int
+	HasPosition bool
+	// The compass direction of the label from the node, e.g. "S"
+	LabelOffset string
+	// The image drawn for the node, with its size if given
+	Icon       string
+	IconWidth  int
+	IconHeight int
+	InfoURL    string
+
+	// The node Position is relative to, if any
+	relativeTo string
+	// Whether the node is used as a template by others
+	isTemplate bool
+}
+
+// Link is a LINK from the config
+type Link struct {
+	Name     string
+	From, To string
+	// Points the link passes through, in pixels
+	Via [][2]int
+	// The width of the link in pixels, 0 if not set
+	Width int
+	// Where the data for the link comes from, e.g. RRD files
+	Targets []string
+	// The speed of the link each way, in bits per second, 0 if not set
+	BandwidthIn, BandwidthOut float64
+	InfoURL                   string
+	// The name of the color scale used for the link
+	Scale string
+
+	isTemplate bool
+}
+
+// ScaleBand is a band of a color scale, colored from Color at Min
+// to Color2 at Max. Min and Max are percentages.
+type ScaleBand struct {
+	Min, Max      float32
+	Color, Color2 canvas.Color
+}
+
+// Parse reads a Weathermap config. Settings that don't affect the
+// layout of the map, such as fonts and key styles, are ignored.
+func Parse(r io.Reader) (*Map, error) {
+	p := &parser{
+		m: &Map{
+			Scales: map[string][]ScaleBand{},
+		},
+		nodes:       map[string]*Node{},
+		links:       map[string]*Link{},
+		defaultNode: &Node{},
+		defaultLink: &Link{},
+	}
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		if err := p.parseLine(text); err != nil {
+			return nil, fmt.Errorf("Error parsing line %d: %w", line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := p.resolvePositions(); err != nil {
+		return nil, err
+	}
+
+	// Templates without a position or ends aren't drawn by
+	// Weathermap, so they are left out
+	nodes := p.m.Nodes[:0]
+	for _, node := range p.m.Nodes {
+		if !node.isTemplate || node.HasPosition {
+			nodes = append(nodes, node)
+		}
+	}
+	p.m.Nodes = nodes
+	links := p.m.Links[:0]
+	for _, link := range p.m.Links {
+		if !link.isTemplate || link.From != "" {
+			links = append(links, link)
+		}
+	}
+	p.m.Links = links
+
+	return p.m, nil
+}
+
+type parser struct {
+	m     *Map
+	nodes map[string]*Node
+	links map[string]*Link
+	// The templates for new nodes and links
+	defaultNode *Node
+	defaultLink *Link
+	// The node or link the lines are for, at most one is set
+	node *Node
+	link *Link
+}
+
+func (p *parser) parseLine(text string) error {
+	fields := strings.Fields(text)
+	keyword := strings.ToUpper(fields[0])
+	args := fields[1:]
+	// The rest of the line, for keywords that take text
+	rest := strings.TrimSpace(text[len(fields[0]):])
+
+	switch keyword {
+	case "NODE":
+		if len(args) != 1 {
+			return fmt.Errorf("NODE needs a name")
+		}
+		return p.startNode(args[0])
+	case "LINK":
+		if len(args) != 1 {
+			return fmt.Errorf("LINK needs a name")
+		}
+		return p.startLink(args[0])
+	}
+
+	switch {
+	case p.node != nil:
+		return p.parseNodeLine(keyword, args, rest)
+	case p.link != nil:
+		return p.parseLinkLine(keyword, args, rest)
+	default:
+		return p.parseGlobalLine(keyword, args, rest)
+	}
+}
+
+func (p *parser) startNode(name string) error {
+	p.link = nil
+	if name == defaultName {
+		p.node = p.defaultNode
+		return nil
+	}
+	if _, ok := p.nodes[name]; ok {
+		return fmt.Errorf("Duplicate node %s", name)
+	}
+
+	node := *p.defaultNode
+	node.Name = name
+	p.node = &node
+	p.nodes[name] = p.node
+	p.m.Nodes = append(p.m.Nodes, p.node)
+	return nil
+}
+
+func (p *parser) startLink(name string) error {
+	p.node = nil
+	if name == defaultName {
+		p.link = p.defaultLink
+		return nil
+	}
+	if _, ok := p.links[name]; ok {
+		return fmt.Errorf("Duplicate link %s", name)
+	}
+
+	link := *p.defaultLink
+	link.Name = name
+	link.Via = nil
+	link.Targets = append([]string(nil), p.defaultLink.Targets...)
+	p.link = &link
+	p.links[name] = p.link
+	p.m.Links = append(p.m.Links, p.link)
+	return nil
+}
+
+func (p *parser) parseGlobalLine(keyword string, args []string, rest string) error {
+	var err error
+	switch keyword {
+	case "TITLE":
+		p.m.Title = rest
+	case "WIDTH":
+		p.m.Width, err = intArg(keyword, args)
+	case "HEIGHT":
+		p.m.Height, err = intArg(keyword, args)
+	case "SCALE":
+		err = p.parseScale(args)
+	}
+	return err
+}
+
+func (p *parser) parseNodeLine(keyword string, args []string, rest string) error {
+	node := p.node
+	switch keyword {
+	case "TEMPLATE":
+		if len(args) != 1 {
+			return fmt.Errorf("TEMPLATE needs a node name")
+		}
+		template, ok := p.nodes[args[0]]
+		if !ok {
+			return fmt.Errorf("Unknown template node %s", args[0])
+		}
+		template.isTemplate = true
+		name, isTemplate := node.Name, node.isTemplate
+		*node = *template
+		node.Name, node.isTemplate = name, isTemplate
+	case "LABEL":
+		node.Label = rest
+	case "POSITION":
+		switch len(args) {
+		case 2:
+			node.relativeTo = ""
+		case 3:
+			node.relativeTo = args[0]
+			args = args[1:]
+		default:
+			return fmt.Errorf("POSITION needs an x and y, and optionally a node")
+		}
+		x, errX := strconv.Atoi(args[0])
+		y, errY := strconv.Atoi(args[1])
+		if errX != nil || errY != nil {
+			return fmt.Errorf("Invalid POSITION %s %s", args[0], args[1])
+		}
+		node.Position = [2]int{x, y}
+		node.HasPosition = true
+	case "LABELOFFSET":
+		if len(args) > 0 {
+			node.LabelOffset = strings.ToUpper(args[0])
+		}
+	case "ICON":
+		switch len(args) {
+		case 1:
+			node.Icon, node.IconWidth, node.IconHeight = args[0], 0, 0
+		case 3:
+			w, errW := strconv.Atoi(args[0])
+			h, errH := strconv.Atoi(args[1])
+			if errW != nil || errH != nil {
+				return fmt.Errorf("Invalid ICON size %s %s", args[0], args[1])
+			}
+			node.Icon, node.IconWidth, node.IconHeight = args[2], w, h
+		default:
+			return fmt.Errorf("ICON needs a file, and optionally a width and height")
+		}
+		if strings.EqualFold(node.Icon, "none") {
+			node.Icon = ""
+		}
+	case "INFOURL":
+		node.InfoURL = rest
+	}
+	return nil
+}
+
+func (p *parser) parseLinkLine(keyword string, args []string, rest string) error {
+	link := p.link
+	var err error
+	switch keyword {
+	case "TEMPLATE":
+		if len(args) != 1 {
+			return fmt.Errorf("TEMPLATE needs a link name")
+		}
+		template, ok := p.links[args[0]]
+		if !ok {
+			return fmt.Errorf("Unknown template link %s", args[0])
+		}
+		template.isTemplate = true
+		name, isTemplate := link.Name, link.isTemplate
+		*link = *template
+		link.Name, link.isTemplate = name, isTemplate
+		link.Via = append([][2]int(nil), template.Via...)
+		link.Targets = append([]string(nil), template.Targets...)
+	case "NODES":
+		if len(args) != 2 {
+			return fmt.Errorf("NODES needs two nodes")
+		}
+		// Offsets of the ends from the nodes, e.g. "core:NE", aren't
+		// used, the ends are attached by the router
+		link.From, _, _ = strings.Cut(args[0], ":")
+		link.To, _, _ = strings.Cut(args[1], ":")
+	case "VIA":
+		if len(args) != 2 {
+			return fmt.Errorf("VIA needs an x and y")
+		}
+		x, errX := strconv.Atoi(args[0])
+		y, errY := strconv.Atoi(args[1])
+		if errX != nil || errY != nil {
+			return fmt.Errorf("Invalid VIA %s %s", args[0], args[1])
+		}
+		link.Via = append(link.Via, [2]int{x, y})
+	case "WIDTH":
+		link.Width, err = intArg(keyword, args)
+	case "TARGET":
+		link.Targets = append([]string(nil), args...)
+	case "BANDWIDTH":
+		switch len(args) {
+		case 1:
+			link.BandwidthIn, err = parseBandwidth(args[0])
+			link.BandwidthOut = link.BandwidthIn
+		case 2:
+			link.BandwidthIn, err = parseBandwidth(args[0])
+			if err == nil {
+				link.BandwidthOut, err = parseBandwidth(args[1])
+			}
+		default:
+			return fmt.Errorf("BANDWIDTH needs one or two speeds")
+		}
+	case "INFOURL":
+		link.InfoURL = rest
+	case "USESCALE":
+		if len(args) > 0 {
+			link.Scale = args[0]
+		}
+	}
+	return err
+}
+
+// Parses "SCALE [name] min max r g b [r2 g2 b2]"
+func (p *parser) parseScale(args []string) error {
+	name := defaultName
+	if len(args) > 0 {
+		if _, err := strconv.ParseFloat(args[0], 32); err != nil {
+			name, args = args[0], args[1:]
+		}
+	}
+	if len(args) != 5 && len(args) != 8 {
+		return fmt.Errorf("SCALE needs a range and one or two colors")
+	}
+
+	values := make([]float32, len(args))
+	for i, arg := range args {
+		value, err := strconv.ParseFloat(arg, 32)
+		if err != nil {
+			return fmt.Errorf("Invalid SCALE value %s", arg)
+		}
+		values[i] = float32(value)
+	}
+
+	band := ScaleBand{
+		Min:   values[0],
+		Max:   values[1],
+		Color: canvas.RGB(values[2]/255, values[3]/255, values[4]/255),
+	}
+	band.Color2 = band.Color
+	if len(values) == 8 {
+		band.Color2 = canvas.RGB(values[5]/255, values[6]/255, values[7]/255)
+	}
+	p.m.Scales[name] = append(p.m.Scales[name], band)
+	return nil
+}
+
+// Makes the positions of nodes placed relative to others absolute
+func (p *parser) resolvePositions() error {
+	resolving := map[string]bool{}
+	var resolve func(node *Node) error
+	resolve = func(node *Node) error {
+		if node.relativeTo == "" {
+			return nil
+		}
+		if resolving[node.Name] {
+			return fmt.Errorf("Node %s is positioned relative to itself", node.Name)
+		}
+		resolving[node.Name] = true
+
+		other, ok := p.nodes[node.relativeTo]
+		if !ok {
+			return fmt.Errorf("Node %s is positioned relative to unknown node %s", node.Name, node.relativeTo)
+		}
+		if err := resolve(other); err != nil {
+			return err
+		}
+		node.Position[0] += other.Position[0]
+		node.Position[1] += other.Position[1]
+		node.relativeTo = ""
+		return nil
+	}
+
+	for _, node := range p.m.Nodes {
+		if err := resolve(node); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func intArg(keyword string, args []string) (int, error) {
+	if len(args) != 1 {
+		return 0, fmt.Errorf("%s needs a number", keyword)
+	}
+	value, err := strconv.Atoi(args[0])
+	if err != nil {
+		return 0, fmt.Errorf("Invalid %s %s", keyword, args[0])
+	}
+	return value, nil
+}
+
+// Parses a speed such as "100M" into bits per second
+func parseBandwidth(s string) (float64, error) {
+	multiplier := 1.0
+	if n := len(s); n > 0 {
+		switch s[n-1] {
+		case 'K', 'k':
+			multiplier = 1e3
+		case 'M', 'm':
+			multiplier = 1e6
+		case 'G', 'g':
+			multiplier = 1e9
+		case 'T', 't':
+			multiplier = 1e12
+		}
+		if multiplier != 1 {
+			s = s[:n-1]
+		}
+	}
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid bandwidth %s", s)
+	}
+	return value * multiplier, nil
+}
@@ -0,0 +1,227 @@
+package weathermap_test
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/REANNZ/raumata"
+	"github.com/REANNZ/raumata/weathermap"
+)
+
+const testConfig = `
+# A small map
+WIDTH 800
+HEIGHT 600
+TITLE Core Network
+
+SCALE 0 0 192 192 192
+SCALE 0 50 0 255 0
+SCALE 50 100 255 0 0
+
+NODE DEFAULT
+	LABELOFFSET S
+
+NODE router
+	ICON 32 32 images/router.png
+
+NODE akl
+	TEMPLATE router
+	LABEL Auckland
+	POSITION 100 100
+	INFOURL http://example.com/akl
+
+NODE wlg
+	label Wellington
+	POSITION akl 200 300
+
+NODE chc
+	POSITION 302 398
+
+LINK DEFAULT
+	WIDTH 14
+	BANDWIDTH 10G
+
+LINK akl-wlg
+	NODES akl:N wlg
+	VIA 300 100
+	TARGET /var/rrd/akl-wlg.rrd
+	BANDWIDTH 1G 10M
+
+LINK wlg-chc
+	NODES wlg chc
+	USESCALE other
+
+LINK wlg-nowhere
+	NODES wlg nowhere
+`
+
+func TestParse(t *testing.T) {
+	m, err := weathermap.Parse(strings.NewReader(testConfig))
+	if err != nil {
+		t.Fatalf("Error parsing config: %s", err)
+	}
+
+	if m.Title != "Core Network" || m.Width != 800 || m.Height != 600 {
+		t.Errorf("Expected the title and size of the map, got %q %dx%d", m.Title, m.Width, m.Height)
+	}
+	if len(m.Scales["DEFAULT"]) != 3 {
+		t.Errorf("Expected 3 bands in the default scale, got %v", m.Scales)
+	}
+
+	// The router template has no position, so isn't on the map
+	if len(m.Nodes) != 3 {
+		t.Fatalf("Expected 3 nodes, got %d", len(m.Nodes))
+	}
+	akl, wlg := m.Nodes[0], m.Nodes[1]
+	if akl.Name != "akl" || akl.Icon != "images/router.png" || akl.IconWidth != 32 {
+		t.Errorf("Expected akl to have the router's icon, got %+v", akl)
+	}
+	if akl.LabelOffset != "S" {
+		t.Errorf("Expected the default label offset, got %q", akl.LabelOffset)
+	}
+	if wlg.Label != "Wellington" || wlg.Position != [2]int{300, 400} {
+		t.Errorf("Expected wlg at 300,400 from its relative position, got %+v", wlg)
+	}
+
+	if len(m.Links) != 3 {
+		t.Fatalf("Expected 3 links, got %d", len(m.Links))
+	}
+	link := m.Links[0]
+	if link.From != "akl" || link.To != "wlg" {
+		t.Errorf("Expected the link from akl to wlg, got %s to %s", link.From, link.To)
+	}
+	if link.Width != 14 || link.BandwidthIn != 1e9 || link.BandwidthOut != 1e7 {
+		t.Errorf("Expected the width and bandwidth of the link, got %+v", link)
+	}
+	if len(link.Via) != 1 || len(link.Targets) != 1 {
+		t.Errorf("Expected the via and target of the link, got %+v", link)
+	}
+	if m.Links[1].BandwidthIn != 1e10 {
+		t.Errorf("Expected the default bandwidth, got %v", m.Links[1].BandwidthIn)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	configs := map[string]string{
+		"NODE a\n\tPOSITION 1 x":   "line 2",
+		"NODE a\nNODE a":           "Duplicate node",
+		"NODE a\n\tTEMPLATE b":     "Unknown template",
+		"NODE a\n\tPOSITION b 1 1": "unknown node",
+		"NODE a\n\tPOSITION a 1 1": "relative to itself",
+		"SCALE 0 100 255 0":        "SCALE",
+		"LINK a\n\tBANDWIDTH 10X":  "Invalid bandwidth",
+	}
+	for config, expected := range configs {
+		_, err := weathermap.Parse(strings.NewReader(config))
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected an error containing %q for %q, got %v", expected, config, err)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	m, err := weathermap.Parse(strings.NewReader(testConfig))
+	if err != nil {
+		t.Fatalf("Error parsing config: %s", err)
+	}
+
+	res := m.Convert(weathermap.Options{CellSize: 100})
+	topo := res.Topology
+
+	akl := topo.GetNode("akl")
+	if akl == nil || *akl.Pos != [2]int16{1, 1} || akl.LabelAt != raumata.DirectionS {
+		t.Fatalf("Expected akl in cell 1,1 with its label below, got %+v", akl)
+	}
+	if akl.Meta["infourl"] != "http://example.com/akl" {
+		t.Errorf("Expected the info URL in the node's meta, got %v", akl.Meta)
+	}
+	if akl.Style == nil || akl.Style.Icon != "router" {
+		t.Fatalf("Expected akl to have the router icon, got %+v", akl.Style)
+	}
+	icon := res.Config.Icons["router"]
+	if icon.Href != "images/router.png" || !icon.Replace || icon.Width <= 0 {
+		t.Errorf("Expected the router icon in the config, got %+v", icon)
+	}
+
+	// wlg and chc both round to cell 3,4
+	wlg, chc := topo.GetNode("wlg"), topo.GetNode("chc")
+	if *wlg.Pos != [2]int16{3, 4} || *chc.Pos == *wlg.Pos {
+		t.Errorf("Expected chc to be moved out of wlg's cell, got %v and %v", *wlg.Pos, *chc.Pos)
+	}
+
+	link := topo.GetLink("akl-wlg")
+	if link == nil || len(link.Via) != 1 || link.Via[0] != [2]int16{3, 1} {
+		t.Fatalf("Expected akl-wlg via cell 3,1, got %+v", link)
+	}
+	if link.Style == nil || link.Style.Size != res.Config.DefaultLinkStyle.Size*2 {
+		t.Errorf("Expected akl-wlg twice the default width, got %+v", link.Style)
+	}
+	if targets, _ := link.Meta["targets"].([]string); len(targets) != 1 || targets[0] != "/var/rrd/akl-wlg.rrd" {
+		t.Errorf("Expected akl-wlg's target in its meta, got %v", link.Meta)
+	}
+	if link.Meta["bandwidth_in"] != 1e9 || link.Meta["bandwidth_out"] != 1e7 {
+		t.Errorf("Expected akl-wlg's bandwidth in its meta, got %v", link.Meta)
+	}
+	if topo.GetLink("wlg-nowhere") != nil {
+		t.Errorf("Expected the link to an unknown node to be left out")
+	}
+
+	for _, expected := range []string{"chc", "other", "nowhere"} {
+		found := false
+		for _, warning := range res.Warnings {
+			found = found || strings.Contains(warning, expected)
+		}
+		if !found {
+			t.Errorf("Expected a warning about %s, got %v", expected, res.Warnings)
+		}
+	}
+
+	scale := res.Config.LinkColorScale
+	if c := scale.GetColor(0.25); c.ToRGB().ToHex() != "#00ff00" {
+		t.Errorf("Expected green at 25%%, got %s", c)
+	}
+	if c := scale.GetColor(0.75); c.ToRGB().ToHex() != "#ff0000" {
+		t.Errorf("Expected red at 75%%, got %s", c)
+	}
+
+	// The converted map can be rendered
+	renderer := raumata.NewRendererWithConfig(res.Config)
+	if _, err := renderer.RenderTopology(topo); err != nil {
+		t.Errorf("Error rendering the converted map: %s", err)
+	}
+}
+
+func TestConvertOutsideGrid(t *testing.T) {
+	config := "NODE a\n\tPOSITION 10 10\nNODE b\n\tPOSITION 10000000 -10000000\n" +
+		"NODE c\n\tPOSITION 20000000 -20000000\nLINK a-b\n\tNODES a b\n\tVIA 0 -10000000\n"
+	m, err := weathermap.Parse(strings.NewReader(config))
+	if err != nil {
+		t.Fatalf("Error parsing config: %s", err)
+	}
+
+	res := m.Convert(weathermap.Options{})
+	topo := res.Topology
+
+	// b and c are both clamped to the corner, so c is moved next to it
+	b, c := topo.GetNode("b"), topo.GetNode("c")
+	if *b.Pos != [2]int16{math.MaxInt16, math.MinInt16} || *c.Pos == *b.Pos {
+		t.Errorf("Expected b in the corner of the grid and c beside it, got %v and %v", *b.Pos, *c.Pos)
+	}
+	if c.Pos[0] > b.Pos[0] || c.Pos[1] < b.Pos[1] {
+		t.Errorf("Expected c inside the grid, got %v", *c.Pos)
+	}
+	if via := topo.GetLink("a-b").Via[0]; via != [2]int16{0, math.MinInt16} {
+		t.Errorf("Expected the via on the edge of the grid, got %v", via)
+	}
+
+	for _, expected := range []string{"Node b", "Node c", "Link a-b"} {
+		found := false
+		for _, warning := range res.Warnings {
+			found = found || strings.Contains(warning, expected) && strings.Contains(warning, "outside the grid")
+		}
+		if !found {
+			t.Errorf("Expected a warning about %s being outside the grid, got %v", expected, res.Warnings)
+		}
+	}
+}